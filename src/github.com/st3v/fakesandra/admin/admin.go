@@ -0,0 +1,256 @@
+// Package admin provides an HTTP API to prime, inspect and reset fakesandra
+// from outside the Go process, e.g. from tests written in Java, Python or
+// Node. It wraps the same defaults the Go harness uses.
+//
+//	POST   /stubs              add a stub, the body holds a stub in scenario format
+//	GET    /stubs              list stubs
+//	DELETE /stubs              remove all stubs
+//	DELETE /stubs/{id}         remove a stub
+//	GET    /journal            list recorded queries
+//	GET    /journal/unmatched  list recorded queries that no handler answered
+//	DELETE /journal            discard recorded queries
+//	POST   /faults             add a fault rule, the body holds a rule in scenario format
+//	GET    /faults             list fault rules
+//	DELETE /faults             remove all fault rules
+//	DELETE /faults/{id}        remove a fault rule
+//	GET    /connections        list open client connections
+//	GET    /clock              show the time of the engine clock
+//	PUT    /clock              set the clock, the body holds {"now": RFC 3339 time}
+//	DELETE /clock              make the clock follow the system clock again
+//	POST   /clock/advance      advance the clock, the body holds {"duration": "24h"}
+//	POST   /reset              reset stubs, fault rules, journal, data and clock
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/st3v/fakesandra"
+	"github.com/st3v/fakesandra/scenario"
+)
+
+// ConnectionLister is implemented by the servers returned by
+// fakesandra.NewServer.
+type ConnectionLister interface {
+	Connections() []fakesandra.Connection
+}
+
+type api struct {
+	conns ConnectionLister
+}
+
+// NewHandler returns the HTTP handler of the admin API. Connections are
+// listed using conns.
+func NewHandler(conns ConnectionLister) http.Handler {
+	a := &api{conns}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stubs", methods{"POST": a.addStub, "GET": a.listStubs, "DELETE": a.resetStubs}.serve)
+	mux.HandleFunc("/stubs/", methods{"DELETE": a.removeStub}.serve)
+	mux.HandleFunc("/journal", methods{"GET": a.listJournal, "DELETE": a.resetJournal}.serve)
+	mux.HandleFunc("/journal/unmatched", methods{"GET": a.listUnmatched}.serve)
+	mux.HandleFunc("/faults", methods{"POST": a.addFault, "GET": a.listFaults, "DELETE": a.resetFaults}.serve)
+	mux.HandleFunc("/faults/", methods{"DELETE": a.removeFault}.serve)
+	mux.HandleFunc("/connections", methods{"GET": a.listConnections}.serve)
+	mux.HandleFunc("/clock", methods{"GET": a.showClock, "PUT": a.setClock, "DELETE": a.resetClock}.serve)
+	mux.HandleFunc("/clock/advance", methods{"POST": a.advanceClock}.serve)
+	mux.HandleFunc("/reset", methods{"POST": a.reset}.serve)
+
+	return mux
+}
+
+// methods dispatches requests to a single path by HTTP method.
+type methods map[string]http.HandlerFunc
+
+func (m methods) serve(w http.ResponseWriter, r *http.Request) {
+	handler, ok := m[r.Method]
+	if !ok {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("Method %s not allowed for %s", r.Method, r.URL.Path))
+		return
+	}
+	handler(w, r)
+}
+
+// pathID returns the last segment of the request path.
+func pathID(r *http.Request) string {
+	return path.Base(r.URL.Path)
+}
+
+// ListenAndServe serves the admin API on addr.
+func ListenAndServe(addr string, conns ConnectionLister) error {
+	return http.ListenAndServe(addr, NewHandler(conns))
+}
+
+func (a *api) addStub(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s, err := scenario.ParseStub(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	id, err := fakesandra.DefaultStubs.Add(s)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]string{"id": id})
+}
+
+func (a *api) listStubs(w http.ResponseWriter, r *http.Request) {
+	stubs := []stubJSON{}
+	for _, s := range fakesandra.DefaultStubs.Stubs() {
+		stubs = append(stubs, newStubJSON(s))
+	}
+	writeJSON(w, http.StatusOK, stubs)
+}
+
+func (a *api) resetStubs(w http.ResponseWriter, r *http.Request) {
+	fakesandra.DefaultStubs.Reset()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *api) removeStub(w http.ResponseWriter, r *http.Request) {
+	id := pathID(r)
+	if !fakesandra.DefaultStubs.Remove(id) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("No stub with id %q", id))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *api) listJournal(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, newEntriesJSON(fakesandra.DefaultJournal.Entries()))
+}
+
+func (a *api) listUnmatched(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, newEntriesJSON(fakesandra.DefaultJournal.Unmatched()))
+}
+
+func (a *api) resetJournal(w http.ResponseWriter, r *http.Request) {
+	fakesandra.DefaultJournal.Reset()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *api) addFault(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rule, err := scenario.ParseFault(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	id, err := fakesandra.DefaultFaults.Add(rule)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]string{"id": id})
+}
+
+func (a *api) listFaults(w http.ResponseWriter, r *http.Request) {
+	rules := []ruleJSON{}
+	for _, rule := range fakesandra.DefaultFaults.Rules() {
+		rules = append(rules, newRuleJSON(rule))
+	}
+	writeJSON(w, http.StatusOK, rules)
+}
+
+func (a *api) resetFaults(w http.ResponseWriter, r *http.Request) {
+	fakesandra.DefaultFaults.Reset()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *api) removeFault(w http.ResponseWriter, r *http.Request) {
+	id := pathID(r)
+	if !fakesandra.DefaultFaults.Remove(id) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("No fault rule with id %q", id))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *api) listConnections(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.conns.Connections())
+}
+
+func (a *api) showClock(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, newClockJSON(fakesandra.DefaultEngine.Clock()))
+}
+
+func (a *api) setClock(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Now *time.Time `json:"now"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if body.Now == nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Missing now"))
+		return
+	}
+
+	clock := fakesandra.DefaultEngine.Clock()
+	clock.Set(*body.Now)
+	writeJSON(w, http.StatusOK, newClockJSON(clock))
+}
+
+func (a *api) advanceClock(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Duration string `json:"duration"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	d, err := time.ParseDuration(body.Duration)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	clock := fakesandra.DefaultEngine.Clock()
+	clock.Advance(d)
+	writeJSON(w, http.StatusOK, newClockJSON(clock))
+}
+
+func (a *api) resetClock(w http.ResponseWriter, r *http.Request) {
+	fakesandra.DefaultEngine.Clock().Reset()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *api) reset(w http.ResponseWriter, r *http.Request) {
+	fakesandra.Reset()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing admin response: %s", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,198 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra"
+	"github.com/st3v/fakesandra/admin"
+)
+
+type connections []fakesandra.Connection
+
+func (c connections) Connections() []fakesandra.Connection {
+	return c
+}
+
+var _ = Describe("Admin API", func() {
+	var (
+		server *httptest.Server
+		conns  connections
+	)
+
+	do := func(method, path, body string) (int, interface{}) {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+
+		var v interface{}
+		if resp.StatusCode != http.StatusNoContent {
+			Expect(json.NewDecoder(resp.Body).Decode(&v)).To(Succeed())
+		}
+		return resp.StatusCode, v
+	}
+
+	BeforeEach(func() {
+		fakesandra.Reset()
+		conns = connections{{ID: 1, RemoteAddr: "127.0.0.1:5000", LocalAddr: "127.0.0.1:9042", ConnectedAt: time.Unix(0, 0)}}
+		server = httptest.NewServer(admin.NewHandler(conns))
+	})
+
+	AfterEach(func() {
+		server.Close()
+		fakesandra.Reset()
+	})
+
+	Describe("stubs", func() {
+		It("adds, lists and removes stubs", func() {
+			status, body := do("POST", "/stubs", `{
+				"when": {"query": "^SELECT", "consistency": "ONE"},
+				"then": {"keyspace": "ks", "table": "t", "columns": [{"name": "id", "type": "uuid"}], "rows": [["a3bb189e-8bf9-3888-9912-ace4e6543002"]]}
+			}`)
+			Expect(status).To(Equal(http.StatusCreated))
+			id := body.(map[string]interface{})["id"].(string)
+			Expect(id).ToNot(BeEmpty())
+
+			status, body = do("GET", "/stubs", "")
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(body).To(HaveLen(1))
+
+			stub := body.([]interface{})[0].(map[string]interface{})
+			Expect(stub["id"]).To(Equal(id))
+			Expect(stub["when"]).To(Equal(map[string]interface{}{"query": "^SELECT", "consistency": "ONE"}))
+			Expect(stub["then"].(map[string]interface{})["rows"]).To(Equal([]interface{}{
+				[]interface{}{"a3bb189e-8bf9-3888-9912-ace4e6543002"},
+			}))
+
+			status, _ = do("DELETE", "/stubs/"+id, "")
+			Expect(status).To(Equal(http.StatusNoContent))
+			Expect(fakesandra.DefaultStubs.Stubs()).To(BeEmpty())
+		})
+
+		It("reports invalid stubs", func() {
+			status, body := do("POST", "/stubs", `{"when": {"query": "x"},
+"then": {"bogus": true}}`)
+			Expect(status).To(Equal(http.StatusBadRequest))
+			Expect(body.(map[string]interface{})["error"]).To(ContainSubstring("line 2"))
+		})
+
+		It("returns not found for unknown stubs", func() {
+			status, _ := do("DELETE", "/stubs/unknown", "")
+			Expect(status).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("faults", func() {
+		It("adds, lists and removes fault rules", func() {
+			status, body := do("POST", "/faults", `{"pattern": "^INSERT", "latency": {"fixed": "10ms"}, "error": {"code": "OVERLOADED"}}`)
+			Expect(status).To(Equal(http.StatusCreated))
+			id := body.(map[string]interface{})["id"].(string)
+
+			status, body = do("GET", "/faults", "")
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(body).To(HaveLen(1))
+
+			rule := body.([]interface{})[0].(map[string]interface{})
+			Expect(rule["pattern"]).To(Equal("^INSERT"))
+			Expect(rule["latency"]).To(Equal(map[string]interface{}{"fixed": "10ms"}))
+
+			status, _ = do("DELETE", "/faults/"+id, "")
+			Expect(status).To(Equal(http.StatusNoContent))
+			Expect(fakesandra.DefaultFaults.Rules()).To(BeEmpty())
+		})
+
+		It("lists fault rules in the format it accepts", func() {
+			for _, rule := range []string{
+				`{"pattern": "^INSERT", "opcodes": ["QUERY"], "nth": 2, "latency": {"fixed": "10ms"}, "drop": true}`,
+				`{"probability": 0.5, "latency": {"uniform": {"min": "1ms", "max": "1.5s"}}, "error": {"code": "WRITE_TIMEOUT", "writeType": "CAS", "replicationFactor": 5}}`,
+				`{"latency": {"normal": {"mean": "20ms", "stddev": "5ms"}}, "close": true}`,
+			} {
+				status, _ := do("POST", "/faults", rule)
+				Expect(status).To(Equal(http.StatusCreated))
+			}
+
+			_, listed := do("GET", "/faults", "")
+			fakesandra.DefaultFaults.Reset()
+
+			for _, rule := range listed.([]interface{}) {
+				delete(rule.(map[string]interface{}), "id")
+				data, err := json.Marshal(rule)
+				Expect(err).ToNot(HaveOccurred())
+
+				status, body := do("POST", "/faults", string(data))
+				Expect(status).To(Equal(http.StatusCreated), "%s", body)
+			}
+
+			_, relisted := do("GET", "/faults", "")
+			for _, rule := range relisted.([]interface{}) {
+				delete(rule.(map[string]interface{}), "id")
+			}
+			Expect(relisted).To(Equal(listed))
+		})
+	})
+
+	Describe("journal", func() {
+		It("lists recorded queries", func() {
+			status, body := do("GET", "/journal", "")
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(body).To(BeEmpty())
+
+			status, body = do("GET", "/journal/unmatched", "")
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(body).To(BeEmpty())
+		})
+	})
+
+	It("lists connections", func() {
+		status, body := do("GET", "/connections", "")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(body).To(HaveLen(1))
+		Expect(body.([]interface{})[0].(map[string]interface{})["remoteAddr"]).To(Equal("127.0.0.1:5000"))
+	})
+
+	Describe("clock", func() {
+		It("sets, advances and resets the engine clock", func() {
+			status, body := do("PUT", "/clock", `{"now": "2020-01-01T00:00:00Z"}`)
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(body).To(Equal(map[string]interface{}{"now": "2020-01-01T00:00:00Z", "frozen": true}))
+
+			status, body = do("POST", "/clock/advance", `{"duration": "36h"}`)
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(body.(map[string]interface{})["now"]).To(Equal("2020-01-02T12:00:00Z"))
+			Expect(fakesandra.DefaultEngine.Clock().Now()).To(Equal(time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC)))
+
+			status, _ = do("DELETE", "/clock", "")
+			Expect(status).To(Equal(http.StatusNoContent))
+
+			status, body = do("GET", "/clock", "")
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(body.(map[string]interface{})["frozen"]).To(BeFalse())
+			Expect(fakesandra.DefaultEngine.Clock().Now()).To(BeTemporally("~", time.Now(), time.Minute))
+		})
+
+		It("reports invalid durations", func() {
+			status, body := do("POST", "/clock/advance", `{"duration": "tomorrow"}`)
+			Expect(status).To(Equal(http.StatusBadRequest))
+			Expect(body.(map[string]interface{})["error"]).To(ContainSubstring("invalid duration"))
+		})
+	})
+
+	It("resets all state", func() {
+		_, _ = do("POST", "/faults", `{"drop": true}`)
+		_, _ = do("POST", "/stubs", `{"when": {"query": "x"}, "then": {"void": true}}`)
+
+		status, _ := do("POST", "/reset", "")
+		Expect(status).To(Equal(http.StatusNoContent))
+		Expect(fakesandra.DefaultStubs.Stubs()).To(BeEmpty())
+		Expect(fakesandra.DefaultFaults.Rules()).To(BeEmpty())
+	})
+})
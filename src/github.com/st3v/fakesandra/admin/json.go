@@ -0,0 +1,204 @@
+package admin
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	"gopkg.in/inf.v0"
+
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/cql/types"
+	"github.com/st3v/fakesandra/engine"
+	"github.com/st3v/fakesandra/journal"
+	"github.com/st3v/fakesandra/middleware/fault"
+	"github.com/st3v/fakesandra/stub"
+)
+
+type entryJSON struct {
+	Statement   string    `json:"statement"`
+	Consistency string    `json:"consistency"`
+	Values      []string  `json:"values,omitempty"`
+	ReceivedAt  time.Time `json:"receivedAt"`
+}
+
+func newEntriesJSON(entries []journal.Entry) []entryJSON {
+	result := []entryJSON{}
+	for _, e := range entries {
+		values := []string{}
+		for _, v := range e.Values {
+			values = append(values, blob(v))
+		}
+
+		result = append(result, entryJSON{
+			Statement:   e.Statement,
+			Consistency: e.Consistency.String(),
+			Values:      values,
+			ReceivedAt:  e.ReceivedAt,
+		})
+	}
+	return result
+}
+
+type clockJSON struct {
+	Now    time.Time `json:"now"`
+	Frozen bool      `json:"frozen"`
+}
+
+func newClockJSON(c *engine.Clock) clockJSON {
+	return clockJSON{Now: c.Now(), Frozen: c.Frozen()}
+}
+
+type stubJSON struct {
+	ID   string                 `json:"id"`
+	When map[string]string      `json:"when"`
+	Then map[string]interface{} `json:"then"`
+}
+
+func newStubJSON(s stub.Stub) stubJSON {
+	sj := stubJSON{
+		ID:   s.ID,
+		When: map[string]string{"query": s.Pattern},
+		Then: map[string]interface{}{},
+	}
+
+	if s.Consistency != nil {
+		sj.When["consistency"] = s.Consistency.String()
+	}
+
+	switch r := s.Result.(type) {
+	case *result.Rows:
+		columns := []map[string]string{}
+		for _, c := range r.Columns {
+			columns = append(columns, map[string]string{"name": c.Name, "type": c.Type.String()})
+			sj.Then["keyspace"] = c.Keyspace
+			sj.Then["table"] = c.Table
+		}
+
+		rows := [][]interface{}{}
+		for _, data := range r.Data {
+			row := []interface{}{}
+			for i, v := range data {
+				row = append(row, value(r.Columns[i].Type, v))
+			}
+			rows = append(rows, row)
+		}
+
+		sj.Then["columns"] = columns
+		sj.Then["rows"] = rows
+	default:
+		sj.Then["void"] = true
+	}
+
+	if s.Error != nil {
+		sj.Then = map[string]interface{}{
+			"error": map[string]string{
+				"code":    s.Error.Code.String(),
+				"message": s.Error.Message,
+			},
+		}
+	}
+
+	return sj
+}
+
+type ruleJSON struct {
+	ID          string      `json:"id"`
+	Pattern     string      `json:"pattern,omitempty"`
+	Opcodes     []string    `json:"opcodes,omitempty"`
+	Probability float64     `json:"probability,omitempty"`
+	Nth         int         `json:"nth,omitempty"`
+	Latency     fault.Delay `json:"latency,omitempty"`
+	Close       bool        `json:"close,omitempty"`
+	Drop        bool        `json:"drop,omitempty"`
+	Error       interface{} `json:"error,omitempty"`
+}
+
+// faultErrorJSON omits unset fields, since the scenario parser rejects
+// empty write types and replication factors below one.
+type faultErrorJSON struct {
+	Code              string `json:"code"`
+	Message           string `json:"message,omitempty"`
+	WriteType         string `json:"writeType,omitempty"`
+	DataPresent       bool   `json:"dataPresent,omitempty"`
+	ReplicationFactor int    `json:"replicationFactor,omitempty"`
+}
+
+func newRuleJSON(r fault.Rule) ruleJSON {
+	rj := ruleJSON{
+		ID:          r.ID,
+		Pattern:     r.Pattern,
+		Probability: r.Probability,
+		Nth:         r.Nth,
+		Latency:     r.Latency,
+		Close:       r.Close,
+		Drop:        r.Drop,
+	}
+
+	for _, oc := range r.Opcodes {
+		rj.Opcodes = append(rj.Opcodes, oc.String())
+	}
+
+	if r.Error != nil {
+		rj.Error = faultErrorJSON{
+			Code:              r.Error.Code.String(),
+			Message:           r.Error.Message,
+			WriteType:         r.Error.WriteType,
+			DataPresent:       r.Error.DataPresent,
+			ReplicationFactor: r.Error.ReplicationFactor,
+		}
+	}
+
+	return rj
+}
+
+// value decodes an encoded value of type t into something that can be
+// represented as JSON.
+func value(t types.Type, b []byte) interface{} {
+	v, err := types.Unmarshal(t, b)
+	if err != nil {
+		return blob(b)
+	}
+	return jsonValue(v)
+}
+
+func jsonValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case []byte:
+		return blob(x)
+	case types.UUID, net.IP, time.Duration, types.DurationValue:
+		return fmt.Sprint(x)
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	case *big.Int:
+		return json.Number(x.String())
+	case *inf.Dec:
+		return json.Number(x.String())
+	case []interface{}:
+		values := make([]interface{}, len(x))
+		for i, e := range x {
+			values[i] = jsonValue(e)
+		}
+		return values
+	case []types.Pair:
+		m := map[string]interface{}{}
+		for _, p := range x {
+			m[fmt.Sprint(jsonValue(p.Key))] = jsonValue(p.Value)
+		}
+		return m
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for k, e := range x {
+			m[k] = jsonValue(e)
+		}
+		return m
+	}
+	return v
+}
+
+func blob(b []byte) string {
+	return "0x" + hex.EncodeToString(b)
+}
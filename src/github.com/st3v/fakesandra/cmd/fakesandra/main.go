@@ -1,24 +1,126 @@
 package main
 
 import (
+	"crypto/md5"
+	"flag"
 	"fmt"
 	"log"
+	"math"
+	"math/big"
+	"strings"
 
 	"github.com/st3v/fakesandra"
+	"github.com/st3v/fakesandra/admin"
+	"github.com/st3v/fakesandra/cql/types"
+	"github.com/st3v/fakesandra/engine"
+	"github.com/st3v/fakesandra/middleware/fault"
 	"github.com/st3v/fakesandra/middleware/frame"
 	"github.com/st3v/fakesandra/middleware/query"
+	"github.com/st3v/fakesandra/scenario"
 )
 
 func main() {
+	scenarioFile := flag.String("scenario", "", "JSON file describing stubs, faults and schema to load at startup")
+	adminAddr := flag.String("admin", "", "address of the HTTP admin API, e.g. localhost:8080, disabled if empty")
+	seed := flag.Int64("seed", 0, "seed for the UUIDs generated by now() and uuid(), random if 0")
+	cassandraVersion := flag.String("cassandra-version", engine.DefaultProfile().Version, "Cassandra release to behave like, one of 2.1, 3.11 or 4.x")
+
+	cluster := engine.DefaultCluster()
+	flag.StringVar(&cluster.Name, "cluster-name", cluster.Name, "cluster name listed in system.local")
+	flag.StringVar(&cluster.Local.DataCenter, "datacenter", cluster.Local.DataCenter, "data center listed in system.local")
+	flag.StringVar(&cluster.Local.Rack, "rack", cluster.Local.Rack, "rack listed in system.local")
+	flag.StringVar(&cluster.Local.ReleaseVersion, "release-version", cluster.Local.ReleaseVersion, "Cassandra release listed in system.local, taken from -cassandra-version if empty")
+	flag.StringVar(&cluster.Local.HostID, "host-id", cluster.Local.HostID, "host ID listed in system.local")
+	flag.StringVar(&cluster.Local.RPCAddress, "rpc-address", cluster.Local.RPCAddress, "RPC address listed in system.local")
+	flag.StringVar(&cluster.Local.SchemaVersion, "schema-version", "", "schema version listed in system.local, derived from the schema if empty")
+	flag.StringVar(&cluster.Local.NativeProtocolVersion, "native-protocol-version", cluster.Local.NativeProtocolVersion, "native protocol version listed in system.local, taken from -cassandra-version if empty")
+	tokens := flag.String("tokens", strings.Join(cluster.Local.Tokens, ","), "comma-separated tokens listed in system.local")
+	peers := flag.String("peers", "", "comma-separated addresses of peers listed in system.peers")
+	flag.Parse()
+
 	fmt.Println("Work in Progress!")
 
-	// use middleware to log frames
-	frameHandler := frame.Logger(log.Print, fakesandra.DefaultHandler)
+	if err := fakesandra.SetCassandraVersion(*cassandraVersion); err != nil {
+		log.Fatalf("Error setting Cassandra version: %s", err)
+	}
+
+	if *seed != 0 {
+		fakesandra.DefaultEngine.Seed(*seed)
+	}
+
+	cluster.Local.Tokens = nil
+	if *tokens != "" {
+		cluster.Local.Tokens = strings.Split(*tokens, ",")
+	}
+	if *peers != "" {
+		cluster.Peers = peerNodes(cluster.Local, strings.Split(*peers, ","))
+	}
+	fakesandra.DefaultEngine.SetCluster(cluster)
+
+	if *scenarioFile != "" {
+		s, err := scenario.Load(*scenarioFile)
+		if err != nil {
+			log.Fatalf("Error loading scenario: %s", err)
+		}
+
+		if err := s.Apply(fakesandra.DefaultEngine.Exec, fakesandra.DefaultStubs, fakesandra.DefaultFaults); err != nil {
+			log.Fatalf("Error applying scenario: %s", err)
+		}
+	}
+
+	// use middleware to log frames and inject faults
+	frameHandler := frame.Logger(
+		log.Print,
+		fault.Frame(fakesandra.DefaultFaults, fakesandra.DefaultHandler),
+	)
 
 	// use middleware to log queries
 	fakesandra.HandleQuery(query.Logger(log.Print))
 
-	if err := fakesandra.ListenAndServe(":9042", frameHandler); err != nil {
+	server := fakesandra.NewServer(":9042", frameHandler)
+
+	if *adminAddr != "" {
+		go func() {
+			log.Printf("Admin API listening on %s", *adminAddr)
+			if err := admin.ListenAndServe(*adminAddr, server); err != nil {
+				log.Fatalf("Error serving admin API: %s", err)
+			}
+		}()
+	}
+
+	if err := server.ListenAndServe(); err != nil {
 		panic(err)
 	}
 }
+
+// peerNodes returns the peers with the given addresses. They share the data
+// center, rack and versions of the local node, their host IDs are derived
+// from their addresses. Each peer owns a single token, which splits the
+// token ring evenly between the peers and the first token of the local
+// node.
+func peerNodes(local engine.Node, addresses []string) []engine.Node {
+	first := new(big.Int).SetInt64(math.MinInt64)
+	if len(local.Tokens) > 0 {
+		first.SetString(local.Tokens[0], 10)
+	}
+
+	ring := new(big.Int).Lsh(big.NewInt(1), 64)
+	step := new(big.Int).Div(ring, big.NewInt(int64(len(addresses)+1)))
+
+	peers := make([]engine.Node, len(addresses))
+	for i, addr := range addresses {
+		token := new(big.Int).Mul(step, big.NewInt(int64(i+1)))
+		token.Add(token, first)
+		if token.Cmp(new(big.Int).SetInt64(math.MaxInt64)) > 0 {
+			token.Sub(token, ring)
+		}
+
+		peer := local
+		peer.Address = addr
+		peer.RPCAddress = addr
+		peer.HostID = types.UUID(md5.Sum([]byte(addr))).String()
+		peer.Tokens = []string{token.String()}
+		peers[i] = peer
+	}
+	return peers
+}
@@ -0,0 +1,385 @@
+package parser
+
+import "strings"
+
+// Statement is a parsed CQL statement. The concrete types are pointers to
+// the statement structs below.
+type Statement interface {
+	statement()
+}
+
+// Name is an optionally keyspace-qualified name of a table, type, index,
+// view, function or aggregate.
+type Name struct {
+	Keyspace string
+	Name     string
+}
+
+func (n Name) String() string {
+	if n.Keyspace == "" {
+		return QuoteIdent(n.Name)
+	}
+	return QuoteIdent(n.Keyspace) + "." + QuoteIdent(n.Name)
+}
+
+// Type is a CQL type as written in a statement, e.g. frozen<map<int, text>>.
+// Unquoted names are lower-cased, frozen<...> is kept as a type named
+// "frozen" with a single parameter and custom types have Custom set and the
+// Java class in Name. Type names are not resolved by the parser.
+type Type struct {
+	Keyspace string
+	Name     string
+	Params   []Type
+	Custom   bool
+}
+
+func (t Type) String() string {
+	if t.Custom {
+		return quoteString(t.Name)
+	}
+
+	name := t.Name
+	if t.Keyspace != "" {
+		name = QuoteIdent(t.Keyspace) + "." + QuoteIdent(name)
+	} else if !builtinTypes[name] {
+		name = QuoteIdent(name)
+	}
+
+	if len(t.Params) == 0 {
+		return name
+	}
+
+	params := make([]string, len(t.Params))
+	for i, p := range t.Params {
+		params[i] = p.String()
+	}
+	return name + "<" + strings.Join(params, ", ") + ">"
+}
+
+// Property is an option set using WITH, e.g. replication or compaction.
+type Property struct {
+	Name  string
+	Value Term
+}
+
+// Properties is a list of options in the order they were given.
+type Properties []Property
+
+// Get returns the value of the property with the given name.
+func (ps Properties) Get(name string) (Term, bool) {
+	for _, p := range ps {
+		if p.Name == name {
+			return p.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Ordering is a column with a sort direction, used by ORDER BY and
+// CLUSTERING ORDER BY.
+type Ordering struct {
+	Column     string
+	Descending bool
+}
+
+// Using holds the USING TIMESTAMP and USING TTL clauses of a write. Either
+// may be nil.
+type Using struct {
+	Timestamp Term
+	TTL       Term
+}
+
+// ColumnDef defines a table column or a field of a user-defined type.
+type ColumnDef struct {
+	Name   string
+	Type   Type
+	Static bool
+}
+
+// Rename is a RENAME ... TO ... clause.
+type Rename struct {
+	From string
+	To   string
+}
+
+// Selector is a single expression in the selection of a SELECT statement.
+type Selector struct {
+	Expr  Term
+	Alias string
+}
+
+// Assignment is a single SET clause of an UPDATE statement. Target is a
+// *Column, an *Index for c[key] = v or a *Field for c.field = v. Operations
+// such as c = c + ? are represented as an *Operation value, the shorthand
+// c += ? is expanded by the parser.
+type Assignment struct {
+	Target Term
+	Value  Term
+}
+
+// Use is USE keyspace.
+type Use struct {
+	Keyspace string
+}
+
+// Select is a SELECT statement. Selectors is empty for SELECT *.
+type Select struct {
+	Table             Name
+	Distinct          bool
+	JSON              bool
+	Selectors         []Selector
+	Where             []Relation
+	GroupBy           []string
+	OrderBy           []Ordering
+	PerPartitionLimit Term
+	Limit             Term
+	AllowFiltering    bool
+}
+
+// Insert is an INSERT statement. JSON is set for INSERT JSON, in which case
+// Columns and Values are empty.
+type Insert struct {
+	Table       Name
+	Columns     []string
+	Values      []Term
+	JSON        Term
+	IfNotExists bool
+	Using       Using
+}
+
+// Update is an UPDATE statement.
+type Update struct {
+	Table       Name
+	Using       Using
+	Assignments []Assignment
+	Where       []Relation
+	IfExists    bool
+	If          []Relation
+}
+
+// Delete is a DELETE statement. Columns is empty if whole rows are
+// deleted, otherwise it holds *Column, *Index and *Field terms.
+type Delete struct {
+	Table    Name
+	Columns  []Term
+	Using    Using
+	Where    []Relation
+	IfExists bool
+	If       []Relation
+}
+
+// BatchType is the type of a batch.
+type BatchType int
+
+const (
+	LoggedBatch BatchType = iota
+	UnloggedBatch
+	CounterBatch
+)
+
+func (t BatchType) String() string {
+	switch t {
+	case UnloggedBatch:
+		return "UNLOGGED"
+	case CounterBatch:
+		return "COUNTER"
+	default:
+		return "LOGGED"
+	}
+}
+
+// Batch is a BEGIN BATCH ... APPLY BATCH statement.
+type Batch struct {
+	Type       BatchType
+	Using      Using
+	Statements []Statement
+}
+
+// CreateKeyspace is CREATE KEYSPACE or CREATE SCHEMA.
+type CreateKeyspace struct {
+	Keyspace    string
+	IfNotExists bool
+	Options     Properties
+}
+
+// AlterKeyspace is ALTER KEYSPACE.
+type AlterKeyspace struct {
+	Keyspace string
+	Options  Properties
+}
+
+// DropKeyspace is DROP KEYSPACE.
+type DropKeyspace struct {
+	Keyspace string
+	IfExists bool
+}
+
+// CreateTable is CREATE TABLE or CREATE COLUMNFAMILY.
+type CreateTable struct {
+	Table           Name
+	IfNotExists     bool
+	Columns         []ColumnDef
+	PartitionKey    []string
+	ClusteringKey   []string
+	ClusteringOrder []Ordering
+	CompactStorage  bool
+	Options         Properties
+}
+
+// AlterTable is ALTER TABLE. Exactly one of the alterations is set.
+type AlterTable struct {
+	Table   Name
+	Add     []ColumnDef
+	Drop    []string
+	Rename  []Rename
+	Alter   *ColumnDef
+	Options Properties
+}
+
+// DropTable is DROP TABLE or DROP COLUMNFAMILY.
+type DropTable struct {
+	Table    Name
+	IfExists bool
+}
+
+// Truncate is TRUNCATE [TABLE].
+type Truncate struct {
+	Table Name
+}
+
+// CreateType is CREATE TYPE.
+type CreateType struct {
+	Type        Name
+	IfNotExists bool
+	Fields      []ColumnDef
+}
+
+// AlterType is ALTER TYPE. Exactly one of the alterations is set.
+type AlterType struct {
+	Type   Name
+	Add    []ColumnDef
+	Rename []Rename
+	Alter  *ColumnDef
+}
+
+// DropType is DROP TYPE.
+type DropType struct {
+	Type     Name
+	IfExists bool
+}
+
+// IndexTarget is the column an index is created on. Kind is empty for
+// regular columns and one of "values", "keys", "entries" or "full" for
+// collections.
+type IndexTarget struct {
+	Column string
+	Kind   string
+}
+
+// CreateIndex is CREATE [CUSTOM] INDEX. Class is set for custom indexes,
+// e.g. to org.apache.cassandra.index.sasi.SASIIndex.
+type CreateIndex struct {
+	Index       string
+	Table       Name
+	IfNotExists bool
+	Target      IndexTarget
+	Class       string
+	Options     Properties
+}
+
+// DropIndex is DROP INDEX.
+type DropIndex struct {
+	Index    Name
+	IfExists bool
+}
+
+// CreateFunction is CREATE FUNCTION.
+type CreateFunction struct {
+	Function          Name
+	OrReplace         bool
+	IfNotExists       bool
+	Args              []ColumnDef
+	CalledOnNullInput bool
+	Returns           Type
+	Language          string
+	Body              string
+}
+
+// DropFunction is DROP FUNCTION. ArgTypes is nil unless a signature was
+// given.
+type DropFunction struct {
+	Function Name
+	IfExists bool
+	ArgTypes []Type
+}
+
+// CreateAggregate is CREATE AGGREGATE.
+type CreateAggregate struct {
+	Aggregate   Name
+	OrReplace   bool
+	IfNotExists bool
+	ArgTypes    []Type
+	StateFunc   string
+	StateType   Type
+	FinalFunc   string
+	InitCond    Term
+}
+
+// DropAggregate is DROP AGGREGATE. ArgTypes is nil unless a signature was
+// given.
+type DropAggregate struct {
+	Aggregate Name
+	IfExists  bool
+	ArgTypes  []Type
+}
+
+// CreateView is CREATE MATERIALIZED VIEW. Selectors is empty for SELECT *.
+type CreateView struct {
+	View            Name
+	IfNotExists     bool
+	Base            Name
+	Selectors       []Selector
+	Where           []Relation
+	PartitionKey    []string
+	ClusteringKey   []string
+	ClusteringOrder []Ordering
+	Options         Properties
+}
+
+// AlterView is ALTER MATERIALIZED VIEW.
+type AlterView struct {
+	View    Name
+	Options Properties
+}
+
+// DropView is DROP MATERIALIZED VIEW.
+type DropView struct {
+	View     Name
+	IfExists bool
+}
+
+func (*Use) statement()             {}
+func (*Select) statement()          {}
+func (*Insert) statement()          {}
+func (*Update) statement()          {}
+func (*Delete) statement()          {}
+func (*Batch) statement()           {}
+func (*CreateKeyspace) statement()  {}
+func (*AlterKeyspace) statement()   {}
+func (*DropKeyspace) statement()    {}
+func (*CreateTable) statement()     {}
+func (*AlterTable) statement()      {}
+func (*DropTable) statement()       {}
+func (*Truncate) statement()        {}
+func (*CreateType) statement()      {}
+func (*AlterType) statement()       {}
+func (*DropType) statement()        {}
+func (*CreateIndex) statement()     {}
+func (*DropIndex) statement()       {}
+func (*CreateFunction) statement()  {}
+func (*DropFunction) statement()    {}
+func (*CreateAggregate) statement() {}
+func (*DropAggregate) statement()   {}
+func (*CreateView) statement()      {}
+func (*AlterView) statement()       {}
+func (*DropView) statement()        {}
@@ -0,0 +1,490 @@
+package parser
+
+import "strings"
+
+func (p *parser) createStatement() Statement {
+	p.expectKeyword("create")
+	orReplace := p.acceptKeyword("or", "replace")
+
+	switch {
+	case orReplace && p.isKeyword("function"):
+		return p.createFunction(true)
+	case orReplace && p.isKeyword("aggregate"):
+		return p.createAggregate(true)
+	case orReplace:
+		p.mismatch("K_FUNCTION")
+	case p.acceptKeyword("keyspace"), p.acceptKeyword("schema"):
+		return p.createKeyspace()
+	case p.acceptKeyword("table"), p.acceptKeyword("columnfamily"):
+		return p.createTable()
+	case p.acceptKeyword("type"):
+		return p.createType()
+	case p.isKeyword("index"), p.isKeyword("custom"):
+		return p.createIndex()
+	case p.isKeyword("function"):
+		return p.createFunction(false)
+	case p.isKeyword("aggregate"):
+		return p.createAggregate(false)
+	case p.acceptKeyword("materialized", "view"):
+		return p.createView()
+	}
+
+	p.noViableAlternative()
+	return nil
+}
+
+func (p *parser) alterStatement() Statement {
+	p.expectKeyword("alter")
+
+	switch {
+	case p.acceptKeyword("keyspace"), p.acceptKeyword("schema"):
+		s := &AlterKeyspace{Keyspace: p.ident()}
+		p.expectKeyword("with")
+		s.Options = p.properties()
+		return s
+	case p.acceptKeyword("table"), p.acceptKeyword("columnfamily"):
+		return p.alterTable()
+	case p.acceptKeyword("type"):
+		return p.alterType()
+	case p.acceptKeyword("materialized", "view"):
+		s := &AlterView{View: p.name()}
+		p.expectKeyword("with")
+		s.Options = p.properties()
+		return s
+	}
+
+	p.noViableAlternative()
+	return nil
+}
+
+func (p *parser) dropStatement() Statement {
+	p.expectKeyword("drop")
+
+	switch {
+	case p.acceptKeyword("keyspace"), p.acceptKeyword("schema"):
+		s := &DropKeyspace{IfExists: p.ifExists()}
+		s.Keyspace = p.ident()
+		return s
+	case p.acceptKeyword("table"), p.acceptKeyword("columnfamily"):
+		s := &DropTable{IfExists: p.ifExists()}
+		s.Table = p.name()
+		return s
+	case p.acceptKeyword("type"):
+		s := &DropType{IfExists: p.ifExists()}
+		s.Type = p.name()
+		return s
+	case p.acceptKeyword("index"):
+		s := &DropIndex{IfExists: p.ifExists()}
+		s.Index = p.name()
+		return s
+	case p.acceptKeyword("function"):
+		s := &DropFunction{IfExists: p.ifExists()}
+		s.Function = p.name()
+		s.ArgTypes = p.signature()
+		return s
+	case p.acceptKeyword("aggregate"):
+		s := &DropAggregate{IfExists: p.ifExists()}
+		s.Aggregate = p.name()
+		s.ArgTypes = p.signature()
+		return s
+	case p.acceptKeyword("materialized", "view"):
+		s := &DropView{IfExists: p.ifExists()}
+		s.View = p.name()
+		return s
+	}
+
+	p.noViableAlternative()
+	return nil
+}
+
+// signature parses an optional parenthesized list of argument types.
+func (p *parser) signature() []Type {
+	if !p.acceptPunct("(") {
+		return nil
+	}
+
+	types := []Type{}
+	if !p.isPunct(")") {
+		types = p.types()
+	}
+	p.expectPunct(")")
+
+	return types
+}
+
+func (p *parser) types() []Type {
+	types := []Type{p.typ()}
+	for p.acceptPunct(",") {
+		types = append(types, p.typ())
+	}
+	return types
+}
+
+// properties parses name = value pairs separated by AND.
+func (p *parser) properties() Properties {
+	props := Properties{}
+	for {
+		props = append(props, p.property())
+		if !p.acceptKeyword("and") {
+			return props
+		}
+	}
+}
+
+func (p *parser) property() Property {
+	prop := Property{Name: p.ident()}
+	p.expectPunct("=")
+	prop.Value = p.term()
+	return prop
+}
+
+// tableOptions parses the WITH clause of CREATE TABLE and CREATE
+// MATERIALIZED VIEW.
+func (p *parser) tableOptions() (Properties, []Ordering, bool) {
+	var (
+		props    = Properties{}
+		ordering []Ordering
+		compact  bool
+	)
+
+	for {
+		switch {
+		case p.acceptKeyword("clustering", "order", "by"):
+			p.expectPunct("(")
+			ordering = p.orderings()
+			p.expectPunct(")")
+		case p.acceptKeyword("compact", "storage"):
+			compact = true
+		default:
+			props = append(props, p.property())
+		}
+
+		if !p.acceptKeyword("and") {
+			return props, ordering, compact
+		}
+	}
+}
+
+// createKeyspace parses the rest of
+//
+//	CREATE KEYSPACE [IF NOT EXISTS] name WITH properties
+func (p *parser) createKeyspace() *CreateKeyspace {
+	s := &CreateKeyspace{IfNotExists: p.ifNotExists()}
+	s.Keyspace = p.ident()
+	p.expectKeyword("with")
+	s.Options = p.properties()
+	return s
+}
+
+// createTable parses the rest of
+//
+//	CREATE TABLE [IF NOT EXISTS] name (definitions) [WITH options]
+func (p *parser) createTable() *CreateTable {
+	s := &CreateTable{IfNotExists: p.ifNotExists()}
+	s.Table = p.name()
+
+	p.expectPunct("(")
+	for {
+		if p.isKeyword("primary", "key") {
+			start := p.peek()
+			p.pos += 2
+			if s.PartitionKey != nil {
+				p.fail(start, "Multiple PRIMARY KEYs specifed (exactly one required)")
+			}
+			s.PartitionKey, s.ClusteringKey = p.primaryKey()
+		} else {
+			c := ColumnDef{Name: p.ident(), Type: p.typ()}
+			c.Static = p.acceptKeyword("static")
+			if start := p.peek(); p.acceptKeyword("primary", "key") {
+				if s.PartitionKey != nil {
+					p.fail(start, "Multiple PRIMARY KEYs specifed (exactly one required)")
+				}
+				s.PartitionKey = []string{c.Name}
+			}
+			s.Columns = append(s.Columns, c)
+		}
+
+		if !p.acceptPunct(",") {
+			break
+		}
+	}
+	p.expectPunct(")")
+
+	if p.acceptKeyword("with") {
+		s.Options, s.ClusteringOrder, s.CompactStorage = p.tableOptions()
+	}
+
+	return s
+}
+
+// primaryKey parses ((partition, key), clustering, columns) or
+// (partition, clustering, columns).
+func (p *parser) primaryKey() ([]string, []string) {
+	p.expectPunct("(")
+
+	var partition []string
+	if p.acceptPunct("(") {
+		partition = p.identList()
+		p.expectPunct(")")
+	} else {
+		partition = []string{p.ident()}
+	}
+
+	clustering := []string{}
+	for p.acceptPunct(",") {
+		clustering = append(clustering, p.ident())
+	}
+
+	p.expectPunct(")")
+	return partition, clustering
+}
+
+// alterTable parses the rest of
+//
+//	ALTER TABLE name ADD column type [STATIC] | ADD (definitions)
+//	               | DROP column | DROP (columns)
+//	               | RENAME column TO column [AND ...]
+//	               | ALTER column TYPE type
+//	               | WITH options
+func (p *parser) alterTable() *AlterTable {
+	s := &AlterTable{Table: p.name()}
+
+	switch {
+	case p.acceptKeyword("add"):
+		parens := p.acceptPunct("(")
+		for {
+			c := ColumnDef{Name: p.ident(), Type: p.typ()}
+			c.Static = p.acceptKeyword("static")
+			s.Add = append(s.Add, c)
+
+			if !parens || !p.acceptPunct(",") {
+				break
+			}
+		}
+		if parens {
+			p.expectPunct(")")
+		}
+	case p.acceptKeyword("drop"):
+		if p.acceptPunct("(") {
+			s.Drop = p.identList()
+			p.expectPunct(")")
+		} else {
+			s.Drop = []string{p.ident()}
+		}
+	case p.acceptKeyword("rename"):
+		s.Rename = p.renames()
+	case p.acceptKeyword("alter"):
+		c := ColumnDef{Name: p.ident()}
+		p.expectKeyword("type")
+		c.Type = p.typ()
+		s.Alter = &c
+	case p.acceptKeyword("with"):
+		s.Options, _, _ = p.tableOptions()
+	default:
+		p.noViableAlternative()
+	}
+
+	return s
+}
+
+func (p *parser) renames() []Rename {
+	renames := []Rename{}
+	for {
+		r := Rename{From: p.ident()}
+		p.expectKeyword("to")
+		r.To = p.ident()
+		renames = append(renames, r)
+
+		if !p.acceptKeyword("and") {
+			return renames
+		}
+	}
+}
+
+// createType parses the rest of
+//
+//	CREATE TYPE [IF NOT EXISTS] name (field type, ...)
+func (p *parser) createType() *CreateType {
+	s := &CreateType{IfNotExists: p.ifNotExists()}
+	s.Type = p.name()
+
+	p.expectPunct("(")
+	for {
+		s.Fields = append(s.Fields, ColumnDef{Name: p.ident(), Type: p.typ()})
+		if !p.acceptPunct(",") {
+			break
+		}
+	}
+	p.expectPunct(")")
+
+	return s
+}
+
+// alterType parses the rest of
+//
+//	ALTER TYPE name ADD field type
+//	              | RENAME field TO field [AND ...]
+//	              | ALTER field TYPE type
+func (p *parser) alterType() *AlterType {
+	s := &AlterType{Type: p.name()}
+
+	switch {
+	case p.acceptKeyword("add"):
+		s.Add = []ColumnDef{{Name: p.ident(), Type: p.typ()}}
+	case p.acceptKeyword("rename"):
+		s.Rename = p.renames()
+	case p.acceptKeyword("alter"):
+		c := ColumnDef{Name: p.ident()}
+		p.expectKeyword("type")
+		c.Type = p.typ()
+		s.Alter = &c
+	default:
+		p.noViableAlternative()
+	}
+
+	return s
+}
+
+// createIndex parses
+//
+//	CREATE [CUSTOM] INDEX [IF NOT EXISTS] [name] ON table (target)
+//	[USING 'class' [WITH OPTIONS = map]]
+func (p *parser) createIndex() *CreateIndex {
+	custom := p.acceptKeyword("custom")
+	p.expectKeyword("index")
+
+	s := &CreateIndex{IfNotExists: p.ifNotExists()}
+	if !p.isKeyword("on") {
+		s.Index = p.ident()
+	}
+
+	p.expectKeyword("on")
+	s.Table = p.name()
+
+	p.expectPunct("(")
+	if t := p.peek(); t.Kind == Ident && p.isPunctAt(1, "(") {
+		switch kind := strings.ToLower(t.Text); kind {
+		case "keys", "values", "entries", "full":
+			p.pos += 2
+			s.Target = IndexTarget{Column: p.ident(), Kind: kind}
+			p.expectPunct(")")
+		default:
+			p.noViableAlternative()
+		}
+	} else {
+		s.Target = IndexTarget{Column: p.ident()}
+	}
+	p.expectPunct(")")
+
+	if custom {
+		p.expectKeyword("using")
+		if t := p.peek(); t.Kind != String {
+			p.mismatch("STRING_LITERAL")
+		}
+		s.Class = p.next().Text
+
+		if p.acceptKeyword("with", "options") {
+			p.expectPunct("=")
+			s.Options = Properties{{Name: "options", Value: p.term()}}
+		}
+	}
+
+	return s
+}
+
+// createFunction parses the rest of
+//
+//	CREATE [OR REPLACE] FUNCTION [IF NOT EXISTS] name (arg type, ...)
+//	(CALLED | RETURNS NULL) ON NULL INPUT RETURNS type
+//	LANGUAGE language AS 'body'
+func (p *parser) createFunction(orReplace bool) *CreateFunction {
+	p.expectKeyword("function")
+	s := &CreateFunction{OrReplace: orReplace, IfNotExists: p.ifNotExists()}
+	s.Function = p.name()
+
+	p.expectPunct("(")
+	if !p.isPunct(")") {
+		for {
+			s.Args = append(s.Args, ColumnDef{Name: p.ident(), Type: p.typ()})
+			if !p.acceptPunct(",") {
+				break
+			}
+		}
+	}
+	p.expectPunct(")")
+
+	if p.acceptKeyword("called") {
+		s.CalledOnNullInput = true
+	} else {
+		p.expectKeyword("returns", "null")
+	}
+	p.expectKeyword("on", "null", "input", "returns")
+	s.Returns = p.typ()
+
+	p.expectKeyword("language")
+	s.Language = p.ident()
+
+	p.expectKeyword("as")
+	if t := p.peek(); t.Kind != String {
+		p.mismatch("STRING_LITERAL")
+	}
+	s.Body = p.next().Text
+
+	return s
+}
+
+// createAggregate parses the rest of
+//
+//	CREATE [OR REPLACE] AGGREGATE [IF NOT EXISTS] name (type, ...)
+//	SFUNC function STYPE type [FINALFUNC function] [INITCOND term]
+func (p *parser) createAggregate(orReplace bool) *CreateAggregate {
+	p.expectKeyword("aggregate")
+	s := &CreateAggregate{OrReplace: orReplace, IfNotExists: p.ifNotExists()}
+	s.Aggregate = p.name()
+	s.ArgTypes = p.signature()
+	if s.ArgTypes == nil {
+		p.mismatch("'('")
+	}
+
+	p.expectKeyword("sfunc")
+	s.StateFunc = p.ident()
+	p.expectKeyword("stype")
+	s.StateType = p.typ()
+
+	if p.acceptKeyword("finalfunc") {
+		s.FinalFunc = p.ident()
+	}
+
+	if p.acceptKeyword("initcond") {
+		s.InitCond = p.term()
+	}
+
+	return s
+}
+
+// createView parses the rest of
+//
+//	CREATE MATERIALIZED VIEW [IF NOT EXISTS] name AS
+//	SELECT selectors FROM table WHERE relations
+//	PRIMARY KEY (key) [WITH options]
+func (p *parser) createView() *CreateView {
+	s := &CreateView{IfNotExists: p.ifNotExists()}
+	s.View = p.name()
+
+	p.expectKeyword("as", "select")
+	s.Selectors = p.selectors()
+	p.expectKeyword("from")
+	s.Base = p.name()
+
+	p.expectKeyword("where")
+	s.Where = p.relations()
+
+	p.expectKeyword("primary", "key")
+	s.PartitionKey, s.ClusteringKey = p.primaryKey()
+
+	if p.acceptKeyword("with") {
+		s.Options, s.ClusteringOrder, _ = p.tableOptions()
+	}
+
+	return s
+}
@@ -0,0 +1,15 @@
+package parser
+
+import "fmt"
+
+// Error is a syntax error. Its message follows the wording of Cassandra's
+// SyntaxException, e.g. "line 1:9 mismatched input 'FORM' expecting K_FROM".
+type Error struct {
+	Line    int
+	Col     int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d:%d %s", e.Line, e.Col, e.Message)
+}
@@ -0,0 +1,297 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Term is an expression in a statement: a literal, a bind marker, a column
+// reference, a collection or tuple literal, a function call or an
+// arithmetic operation. String returns the CQL representation.
+type Term interface {
+	fmt.Stringer
+	term()
+}
+
+// LiteralKind is the kind of a constant.
+type LiteralKind int
+
+const (
+	NullLiteral LiteralKind = iota
+	StringLiteral
+	IntegerLiteral
+	FloatLiteral
+	BooleanLiteral
+	UUIDLiteral
+	BlobLiteral
+	DurationLiteral
+)
+
+// Literal is a constant. Value holds the unescaped content of strings, the
+// lower-cased keyword of booleans and the literal input for everything
+// else, e.g. "-1.5", "0xcafe" or "1h30m".
+type Literal struct {
+	Kind  LiteralKind
+	Value string
+}
+
+// BindMarker is a positional (?) or named (:name) bind marker. Index is the
+// position of the marker within the statement, counting both kinds.
+type BindMarker struct {
+	Index int
+	Name  string
+}
+
+// Column refers to a column by name.
+type Column struct {
+	Name string
+}
+
+// Index selects an element of a collection, e.g. m['key'] or l[0].
+type Index struct {
+	Expr Term
+	Key  Term
+}
+
+// Field selects a field of a user-defined type, e.g. address.street.
+type Field struct {
+	Expr Term
+	Name string
+}
+
+// Star is the * in count(*).
+type Star struct{}
+
+// List is a list literal.
+type List struct {
+	Elems []Term
+}
+
+// Set is a set literal. The empty literal {} is parsed as an empty *Map.
+type Set struct {
+	Elems []Term
+}
+
+// Entry is a key-value pair of a map literal.
+type Entry struct {
+	Key   Term
+	Value Term
+}
+
+// Map is a map literal.
+type Map struct {
+	Entries []Entry
+}
+
+// Tuple is a tuple literal. It also represents the parenthesized lists of
+// IN relations and the column lists of multi-column relations.
+type Tuple struct {
+	Elems []Term
+}
+
+// FieldValue is a single field of a user-defined type literal.
+type FieldValue struct {
+	Name  string
+	Value Term
+}
+
+// UserType is a user-defined type literal, e.g. {street: 'Main St', zip: 1}.
+type UserType struct {
+	Fields []FieldValue
+}
+
+// FunctionCall is a call of a native or user-defined function or
+// aggregate. Unquoted names are lower-cased.
+type FunctionCall struct {
+	Keyspace string
+	Name     string
+	Args     []Term
+}
+
+// Cast is CAST(expr AS type).
+type Cast struct {
+	Expr Term
+	Type Type
+}
+
+// TypeHint is a term with an explicit type, e.g. (int)?.
+type TypeHint struct {
+	Type Type
+	Expr Term
+}
+
+// Operation is an arithmetic operation, e.g. the c + ? in SET c = c + ?.
+type Operation struct {
+	Op    string
+	Left  Term
+	Right Term
+}
+
+func (*Literal) term()      {}
+func (*BindMarker) term()   {}
+func (*Column) term()       {}
+func (*Index) term()        {}
+func (*Field) term()        {}
+func (*Star) term()         {}
+func (*List) term()         {}
+func (*Set) term()          {}
+func (*Map) term()          {}
+func (*Tuple) term()        {}
+func (*UserType) term()     {}
+func (*FunctionCall) term() {}
+func (*Cast) term()         {}
+func (*TypeHint) term()     {}
+func (*Operation) term()    {}
+
+func (l *Literal) String() string {
+	switch l.Kind {
+	case NullLiteral:
+		return "null"
+	case StringLiteral:
+		return quoteString(l.Value)
+	}
+	return l.Value
+}
+
+func (m *BindMarker) String() string {
+	if m.Name == "" {
+		return "?"
+	}
+	return ":" + QuoteIdent(m.Name)
+}
+
+func (c *Column) String() string {
+	return QuoteIdent(c.Name)
+}
+
+func (i *Index) String() string {
+	return fmt.Sprintf("%s[%s]", i.Expr, i.Key)
+}
+
+func (f *Field) String() string {
+	return fmt.Sprintf("%s.%s", f.Expr, QuoteIdent(f.Name))
+}
+
+func (*Star) String() string {
+	return "*"
+}
+
+func (l *List) String() string {
+	return "[" + joinTerms(l.Elems) + "]"
+}
+
+func (s *Set) String() string {
+	return "{" + joinTerms(s.Elems) + "}"
+}
+
+func (m *Map) String() string {
+	entries := make([]string, len(m.Entries))
+	for i, e := range m.Entries {
+		entries[i] = fmt.Sprintf("%s: %s", e.Key, e.Value)
+	}
+	return "{" + strings.Join(entries, ", ") + "}"
+}
+
+func (t *Tuple) String() string {
+	return "(" + joinTerms(t.Elems) + ")"
+}
+
+func (u *UserType) String() string {
+	fields := make([]string, len(u.Fields))
+	for i, f := range u.Fields {
+		fields[i] = fmt.Sprintf("%s: %s", QuoteIdent(f.Name), f.Value)
+	}
+	return "{" + strings.Join(fields, ", ") + "}"
+}
+
+func (f *FunctionCall) String() string {
+	name := QuoteIdent(f.Name)
+	if f.Keyspace != "" {
+		name = QuoteIdent(f.Keyspace) + "." + name
+	}
+	return name + "(" + joinTerms(f.Args) + ")"
+}
+
+func (c *Cast) String() string {
+	return fmt.Sprintf("CAST(%s AS %s)", c.Expr, c.Type)
+}
+
+func (h *TypeHint) String() string {
+	return fmt.Sprintf("(%s)%s", h.Type, h.Expr)
+}
+
+func (o *Operation) String() string {
+	return fmt.Sprintf("%s %s %s", o.Left, o.Op, o.Right)
+}
+
+func joinTerms(terms []Term) string {
+	s := make([]string, len(terms))
+	for i, t := range terms {
+		s[i] = t.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// Operator is the operator of a relation or condition.
+type Operator string
+
+const (
+	Eq          Operator = "="
+	NotEq       Operator = "!="
+	Lt          Operator = "<"
+	Lte         Operator = "<="
+	Gt          Operator = ">"
+	Gte         Operator = ">="
+	In          Operator = "IN"
+	Contains    Operator = "CONTAINS"
+	ContainsKey Operator = "CONTAINS KEY"
+	Like        Operator = "LIKE"
+	IsNot       Operator = "IS NOT"
+)
+
+// Relation is a restriction in a WHERE clause or a condition in an IF
+// clause. Left is a *Column, an *Index, a *Field, a *Tuple of columns for
+// multi-column relations or a token(...) *FunctionCall. For IN relations
+// Right is either a bind marker or a *Tuple holding the candidates.
+type Relation struct {
+	Left  Term
+	Op    Operator
+	Right Term
+}
+
+func (r Relation) String() string {
+	return fmt.Sprintf("%s %s %s", r.Left, r.Op, r.Right)
+}
+
+var unquotedIdent = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// QuoteIdent returns name as it would have to be written in a statement,
+// i.e. in double quotes if it is not lower-case or a reserved keyword.
+func QuoteIdent(name string) string {
+	if unquotedIdent.MatchString(name) && !reserved[name] {
+		return name
+	}
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+func quoteString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// reserved holds the keywords that cannot be used as unquoted identifiers.
+var reserved = map[string]bool{
+	"add": true, "allow": true, "alter": true, "and": true, "apply": true,
+	"asc": true, "authorize": true, "batch": true, "begin": true, "by": true,
+	"columnfamily": true, "create": true, "delete": true, "desc": true,
+	"describe": true, "drop": true, "entries": true, "execute": true,
+	"from": true, "full": true, "grant": true, "if": true, "in": true,
+	"index": true, "infinity": true, "insert": true, "into": true,
+	"keyspace": true, "limit": true, "modify": true, "nan": true,
+	"norecursive": true, "not": true, "null": true, "of": true, "on": true,
+	"or": true, "order": true, "primary": true, "rename": true,
+	"replace": true, "revoke": true, "schema": true, "select": true,
+	"set": true, "table": true, "to": true, "token": true, "truncate": true,
+	"unlogged": true, "update": true, "use": true, "using": true,
+	"view": true, "where": true, "with": true,
+}
@@ -0,0 +1,271 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TokenKind identifies the class of a token.
+type TokenKind int
+
+const (
+	EOF TokenKind = iota
+	Ident
+	QuotedIdent
+	String
+	Integer
+	Float
+	UUID
+	Blob
+	Duration
+	Punct
+)
+
+var tokenKindNames = map[TokenKind]string{
+	EOF:         "EOF",
+	Ident:       "IDENT",
+	QuotedIdent: "QUOTED_NAME",
+	String:      "STRING_LITERAL",
+	Integer:     "INTEGER",
+	Float:       "FLOAT",
+	UUID:        "UUID",
+	Blob:        "HEXNUMBER",
+	Duration:    "DURATION",
+	Punct:       "PUNCT",
+}
+
+func (k TokenKind) String() string {
+	if name, found := tokenKindNames[k]; found {
+		return name
+	}
+	return "UNKNOWN"
+}
+
+// Token is a single lexical element of a CQL statement. Text holds the
+// unescaped content of strings and quoted identifiers and the literal input
+// for everything else. Line is 1-based, Col is 0-based, as in Cassandra's
+// error messages.
+type Token struct {
+	Kind TokenKind
+	Text string
+	Line int
+	Col  int
+}
+
+func (t Token) String() string {
+	if t.Kind == EOF {
+		return "<EOF>"
+	}
+	return t.Text
+}
+
+var (
+	uuidPattern     = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	blobPattern     = regexp.MustCompile(`^0[xX][0-9a-fA-F]*`)
+	numberPattern   = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?([eE][+-]?[0-9]+)?`)
+	durationPattern = regexp.MustCompile(`^(?i)([0-9]+(y|mo|w|d|h|ms|m|s|us|µs|ns))+`)
+)
+
+// twoCharPuncts have to be checked before single characters.
+var twoCharPuncts = []string{"<=", ">=", "!=", "+=", "-="}
+
+const singleCharPuncts = "(),;.*=<>+-[]{}:?"
+
+// Tokenize splits a CQL statement into tokens. Whitespace and comments are
+// dropped. The last token is always of kind EOF.
+func Tokenize(input string) ([]Token, error) {
+	l := &lexer{input: input, line: 1}
+
+	tokens := []Token{}
+	for {
+		t, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+		if t.Kind == EOF {
+			return tokens, nil
+		}
+	}
+}
+
+type lexer struct {
+	input string
+	pos   int
+	line  int
+	col   int
+}
+
+func (l *lexer) errorf(format string, args ...interface{}) error {
+	return &Error{Line: l.line, Col: l.col, Message: fmt.Sprintf(format, args...)}
+}
+
+// advance moves n bytes forward and keeps track of line and column.
+func (l *lexer) advance(n int) {
+	for i := 0; i < n && l.pos < len(l.input); i++ {
+		if l.input[l.pos] == '\n' {
+			l.line++
+			l.col = 0
+		} else {
+			l.col++
+		}
+		l.pos++
+	}
+}
+
+func (l *lexer) rest() string {
+	return l.input[l.pos:]
+}
+
+func (l *lexer) skipSpaceAndComments() error {
+	for l.pos < len(l.input) {
+		rest := l.rest()
+		switch {
+		case isSpace(rest[0]):
+			l.advance(1)
+		case strings.HasPrefix(rest, "--"), strings.HasPrefix(rest, "//"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			l.advance(end)
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				return l.errorf("unterminated comment")
+			}
+			l.advance(end + 4)
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (l *lexer) next() (Token, error) {
+	if err := l.skipSpaceAndComments(); err != nil {
+		return Token{}, err
+	}
+
+	t := Token{Line: l.line, Col: l.col}
+	if l.pos >= len(l.input) {
+		return t, nil
+	}
+
+	rest := l.rest()
+	c := rest[0]
+
+	emit := func(kind TokenKind, text string, n int) (Token, error) {
+		t.Kind, t.Text = kind, text
+		l.advance(n)
+		return t, nil
+	}
+
+	switch {
+	case c == '\'':
+		text, n, err := l.quoted('\'')
+		if err != nil {
+			return t, err
+		}
+		return emit(String, text, n)
+	case c == '"':
+		text, n, err := l.quoted('"')
+		if err != nil {
+			return t, err
+		}
+		return emit(QuotedIdent, text, n)
+	case strings.HasPrefix(rest, "$$"):
+		end := strings.Index(rest[2:], "$$")
+		if end < 0 {
+			return t, l.errorf("unterminated string literal")
+		}
+		return emit(String, rest[2:2+end], end+4)
+	}
+
+	if m := uuidPattern.FindString(rest); m != "" && !isIdentChar(at(rest, len(m))) {
+		return emit(UUID, m, len(m))
+	}
+
+	switch {
+	case isDigit(c):
+		if m := blobPattern.FindString(rest); m != "" {
+			return emit(Blob, m, len(m))
+		}
+		if m := durationPattern.FindString(rest); m != "" && !isIdentChar(at(rest, len(m))) {
+			return emit(Duration, m, len(m))
+		}
+		m := numberPattern.FindString(rest)
+		if strings.ContainsAny(m, ".eE") {
+			return emit(Float, m, len(m))
+		}
+		return emit(Integer, m, len(m))
+	case isLetter(c):
+		n := 1
+		for n < len(rest) && isIdentChar(rest[n]) {
+			n++
+		}
+		return emit(Ident, rest[:n], n)
+	}
+
+	for _, p := range twoCharPuncts {
+		if strings.HasPrefix(rest, p) {
+			return emit(Punct, p, 2)
+		}
+	}
+
+	if strings.IndexByte(singleCharPuncts, c) >= 0 {
+		return emit(Punct, rest[:1], 1)
+	}
+
+	return t, l.errorf("no viable alternative at character '%c'", c)
+}
+
+// quoted reads a string delimited by quote, in which the quote character
+// is escaped by doubling it. It returns the unescaped content and the number
+// of bytes consumed.
+func (l *lexer) quoted(quote byte) (string, int, error) {
+	rest := l.rest()
+
+	var b strings.Builder
+	for i := 1; i < len(rest); i++ {
+		if rest[i] != quote {
+			b.WriteByte(rest[i])
+			continue
+		}
+		if i+1 < len(rest) && rest[i+1] == quote {
+			b.WriteByte(quote)
+			i++
+			continue
+		}
+		return b.String(), i + 1, nil
+	}
+
+	if quote == '"' {
+		return "", 0, l.errorf("unterminated quoted identifier")
+	}
+	return "", 0, l.errorf("unterminated string literal")
+}
+
+func at(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return 0
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isLetter(c) || isDigit(c) || c == '_'
+}
@@ -0,0 +1,72 @@
+package parser_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/st3v/fakesandra/cql/parser"
+)
+
+var _ = Describe("Tokenize", func() {
+	kinds := func(tokens []Token) []TokenKind {
+		k := make([]TokenKind, len(tokens))
+		for i, t := range tokens {
+			k[i] = t.Kind
+		}
+		return k
+	}
+
+	texts := func(tokens []Token) []string {
+		t := make([]string, len(tokens))
+		for i, tok := range tokens {
+			t[i] = tok.Text
+		}
+		return t
+	}
+
+	It("tokenizes identifiers, literals and punctuation", func() {
+		tokens, err := Tokenize(`SELECT "Quoted""Name", 'it''s', 0xCAFE, -1.5e3, 1h30m, ? FROM ks.t WHERE a <= :b`)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(texts(tokens)).To(Equal([]string{
+			"SELECT", `Quoted"Name`, ",", "it's", ",", "0xCAFE", ",", "-", "1.5e3", ",", "1h30m", ",", "?",
+			"FROM", "ks", ".", "t", "WHERE", "a", "<=", ":", "b", "",
+		}))
+
+		Expect(kinds(tokens)).To(Equal([]TokenKind{
+			Ident, QuotedIdent, Punct, String, Punct, Blob, Punct, Punct, Float, Punct, Duration, Punct, Punct,
+			Ident, Ident, Punct, Ident, Ident, Ident, Punct, Punct, Ident, EOF,
+		}))
+	})
+
+	It("recognizes uuids", func() {
+		tokens, err := Tokenize(`a3bb189e-8bf9-3888-9912-ace4e6543002 123e4567-e89b-12d3-a456-426655440000`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(kinds(tokens)).To(Equal([]TokenKind{UUID, UUID, EOF}))
+	})
+
+	It("reads dollar-quoted strings", func() {
+		tokens, err := Tokenize(`AS $$ return 'x'; $$`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tokens[1]).To(Equal(Token{Kind: String, Text: " return 'x'; ", Line: 1, Col: 3}))
+	})
+
+	It("skips comments and tracks positions", func() {
+		tokens, err := Tokenize("-- comment\nSELECT /* inline\n */ * // trailing\nFROM t")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(texts(tokens)).To(Equal([]string{"SELECT", "*", "FROM", "t", ""}))
+		Expect(tokens[1].Line).To(Equal(3))
+		Expect(tokens[1].Col).To(Equal(4))
+		Expect(tokens[2].Line).To(Equal(4))
+	})
+
+	It("fails on unterminated strings", func() {
+		_, err := Tokenize(`SELECT 'foo`)
+		Expect(err).To(MatchError("line 1:7 unterminated string literal"))
+	})
+
+	It("fails on unexpected characters", func() {
+		_, err := Tokenize(`SELECT & FROM t`)
+		Expect(err).To(MatchError("line 1:7 no viable alternative at character '&'"))
+	})
+})
@@ -0,0 +1,902 @@
+// Package parser implements a lexer and a parser for CQL 3.x. It turns
+// statements into a typed AST that handlers can inspect instead of matching
+// query strings with regular expressions.
+//
+// The parser is purely syntactic. Names are not resolved against a schema
+// and types are kept as written, e.g. a UDT is just a name.
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Parse parses a single CQL statement. A trailing semicolon is allowed.
+func Parse(stmt string) (Statement, error) {
+	var result Statement
+
+	err := run(stmt, func(p *parser) {
+		result = p.statement()
+		p.acceptPunct(";")
+		p.expectEOF()
+	})
+
+	return result, err
+}
+
+// ParseScript parses a sequence of statements separated by semicolons,
+// e.g. a schema file.
+func ParseScript(script string) ([]Statement, error) {
+	result := []Statement{}
+
+	err := run(script, func(p *parser) {
+		for {
+			for p.acceptPunct(";") {
+			}
+			if p.peek().Kind == EOF {
+				return
+			}
+
+			result = append(result, p.statement())
+
+			if !p.acceptPunct(";") {
+				p.expectEOF()
+				return
+			}
+		}
+	})
+
+	return result, err
+}
+
+// ParseType parses a CQL type, e.g. frozen<list<text>>.
+func ParseType(s string) (Type, error) {
+	var result Type
+
+	err := run(s, func(p *parser) {
+		result = p.typ()
+		p.expectEOF()
+	})
+
+	return result, err
+}
+
+// run tokenizes input and calls fn with a parser for the tokens. Parse
+// errors are raised as panics carrying an *Error and recovered here.
+func run(input string, fn func(p *parser)) (err error) {
+	tokens, err := Tokenize(input)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+
+	fn(&parser{tokens: tokens})
+	return nil
+}
+
+type parser struct {
+	tokens  []Token
+	pos     int
+	markers int
+}
+
+func (p *parser) fail(t Token, format string, args ...interface{}) {
+	panic(&Error{Line: t.Line, Col: t.Col, Message: fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) mismatch(expecting string) {
+	t := p.peek()
+	p.fail(t, "mismatched input '%s' expecting %s", t, expecting)
+}
+
+func (p *parser) noViableAlternative() {
+	t := p.peek()
+	p.fail(t, "no viable alternative at input '%s'", t)
+}
+
+func (p *parser) peek() Token {
+	return p.peekAt(0)
+}
+
+func (p *parser) peekAt(n int) Token {
+	if p.pos+n >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+n]
+}
+
+func (p *parser) next() Token {
+	t := p.peek()
+	if t.Kind != EOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expectEOF() {
+	if p.peek().Kind != EOF {
+		p.mismatch("EOF")
+	}
+}
+
+func (p *parser) isKeywordAt(n int, kw string) bool {
+	t := p.peekAt(n)
+	return t.Kind == Ident && strings.EqualFold(t.Text, kw)
+}
+
+// isKeyword returns true if the upcoming tokens are the given keywords.
+func (p *parser) isKeyword(kws ...string) bool {
+	for i, kw := range kws {
+		if !p.isKeywordAt(i, kw) {
+			return false
+		}
+	}
+	return true
+}
+
+// acceptKeyword consumes the given keywords if they are next.
+func (p *parser) acceptKeyword(kws ...string) bool {
+	if !p.isKeyword(kws...) {
+		return false
+	}
+	p.pos += len(kws)
+	return true
+}
+
+func (p *parser) expectKeyword(kws ...string) {
+	for _, kw := range kws {
+		if !p.acceptKeyword(kw) {
+			p.mismatch("K_" + strings.ToUpper(kw))
+		}
+	}
+}
+
+func (p *parser) isPunctAt(n int, punct string) bool {
+	t := p.peekAt(n)
+	return t.Kind == Punct && t.Text == punct
+}
+
+func (p *parser) isPunct(punct string) bool {
+	return p.isPunctAt(0, punct)
+}
+
+func (p *parser) acceptPunct(punct string) bool {
+	if !p.isPunct(punct) {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+func (p *parser) expectPunct(punct string) {
+	if !p.acceptPunct(punct) {
+		p.mismatch("'" + punct + "'")
+	}
+}
+
+// isIdentAt returns true if the token at n can be used as an identifier.
+func (p *parser) isIdentAt(n int) bool {
+	t := p.peekAt(n)
+	return t.Kind == QuotedIdent || (t.Kind == Ident && !reserved[strings.ToLower(t.Text)])
+}
+
+// ident reads an identifier. Unquoted identifiers are lower-cased.
+func (p *parser) ident() string {
+	if !p.isIdentAt(0) {
+		p.noViableAlternative()
+	}
+
+	t := p.next()
+	if t.Kind == QuotedIdent {
+		return t.Text
+	}
+	return strings.ToLower(t.Text)
+}
+
+func (p *parser) identList() []string {
+	idents := []string{p.ident()}
+	for p.acceptPunct(",") {
+		idents = append(idents, p.ident())
+	}
+	return idents
+}
+
+// name reads an optionally keyspace-qualified name.
+func (p *parser) name() Name {
+	n := Name{Name: p.ident()}
+	if p.acceptPunct(".") {
+		n.Keyspace, n.Name = n.Name, p.ident()
+	}
+	return n
+}
+
+func (p *parser) ifNotExists() bool {
+	return p.acceptKeyword("if", "not", "exists")
+}
+
+func (p *parser) ifExists() bool {
+	return p.acceptKeyword("if", "exists")
+}
+
+func (p *parser) statement() Statement {
+	switch {
+	case p.isKeyword("select"):
+		return p.selectStatement()
+	case p.isKeyword("insert"):
+		return p.insertStatement()
+	case p.isKeyword("update"):
+		return p.updateStatement()
+	case p.isKeyword("delete"):
+		return p.deleteStatement()
+	case p.isKeyword("begin"):
+		return p.batchStatement()
+	case p.isKeyword("use"):
+		p.next()
+		return &Use{Keyspace: p.ident()}
+	case p.isKeyword("create"):
+		return p.createStatement()
+	case p.isKeyword("alter"):
+		return p.alterStatement()
+	case p.isKeyword("drop"):
+		return p.dropStatement()
+	case p.isKeyword("truncate"):
+		p.next()
+		if !p.acceptKeyword("table") {
+			p.acceptKeyword("columnfamily")
+		}
+		return &Truncate{Table: p.name()}
+	}
+
+	p.noViableAlternative()
+	return nil
+}
+
+// selectStatement parses
+//
+//	SELECT [JSON] [DISTINCT] selectors FROM name [WHERE relations]
+//	[GROUP BY columns] [ORDER BY orderings] [PER PARTITION LIMIT n]
+//	[LIMIT n] [ALLOW FILTERING]
+func (p *parser) selectStatement() *Select {
+	p.expectKeyword("select")
+	s := &Select{}
+
+	// json and distinct are not reserved and might be column names
+	modifier := func(kw string) bool {
+		if p.isKeyword(kw) && !p.isKeywordAt(1, "from") && !p.isKeywordAt(1, "as") && !p.isPunctAt(1, ",") {
+			p.next()
+			return true
+		}
+		return false
+	}
+	s.JSON = modifier("json")
+	s.Distinct = modifier("distinct")
+
+	s.Selectors = p.selectors()
+
+	p.expectKeyword("from")
+	s.Table = p.name()
+
+	if p.acceptKeyword("where") {
+		s.Where = p.relations()
+	}
+
+	if p.acceptKeyword("group") {
+		p.expectKeyword("by")
+		s.GroupBy = p.identList()
+	}
+
+	if p.acceptKeyword("order") {
+		p.expectKeyword("by")
+		s.OrderBy = p.orderings()
+	}
+
+	if p.acceptKeyword("per") {
+		p.expectKeyword("partition", "limit")
+		s.PerPartitionLimit = p.term()
+	}
+
+	if p.acceptKeyword("limit") {
+		s.Limit = p.term()
+	}
+
+	s.AllowFiltering = p.acceptKeyword("allow", "filtering")
+
+	return s
+}
+
+// selectors parses * or a list of selectors with optional aliases.
+func (p *parser) selectors() []Selector {
+	if p.acceptPunct("*") {
+		return nil
+	}
+
+	selectors := []Selector{}
+	for {
+		sel := Selector{Expr: p.term()}
+		if p.acceptKeyword("as") {
+			sel.Alias = p.ident()
+		}
+		selectors = append(selectors, sel)
+
+		if !p.acceptPunct(",") {
+			return selectors
+		}
+	}
+}
+
+func (p *parser) orderings() []Ordering {
+	orderings := []Ordering{}
+	for {
+		o := Ordering{Column: p.ident()}
+		if p.acceptKeyword("desc") {
+			o.Descending = true
+		} else {
+			p.acceptKeyword("asc")
+		}
+		orderings = append(orderings, o)
+
+		if !p.acceptPunct(",") {
+			return orderings
+		}
+	}
+}
+
+// insertStatement parses
+//
+//	INSERT INTO name (columns) VALUES (terms) [IF NOT EXISTS] [USING ...]
+//	INSERT INTO name JSON term [DEFAULT NULL|UNSET] [IF NOT EXISTS] [USING ...]
+func (p *parser) insertStatement() *Insert {
+	p.expectKeyword("insert", "into")
+	s := &Insert{Table: p.name()}
+
+	if p.acceptKeyword("json") {
+		s.JSON = p.term()
+		if p.acceptKeyword("default") {
+			if !p.acceptKeyword("null") {
+				p.expectKeyword("unset")
+			}
+		}
+	} else {
+		p.expectPunct("(")
+		s.Columns = p.identList()
+		p.expectPunct(")")
+
+		p.expectKeyword("values")
+		p.expectPunct("(")
+		s.Values = p.terms()
+		p.expectPunct(")")
+	}
+
+	s.IfNotExists = p.ifNotExists()
+	s.Using = p.using()
+
+	return s
+}
+
+// updateStatement parses
+//
+//	UPDATE name [USING ...] SET assignments WHERE relations
+//	[IF EXISTS | IF conditions]
+func (p *parser) updateStatement() *Update {
+	p.expectKeyword("update")
+	s := &Update{Table: p.name()}
+	s.Using = p.using()
+
+	p.expectKeyword("set")
+	for {
+		s.Assignments = append(s.Assignments, p.assignment())
+		if !p.acceptPunct(",") {
+			break
+		}
+	}
+
+	p.expectKeyword("where")
+	s.Where = p.relations()
+	s.IfExists, s.If = p.conditions()
+
+	return s
+}
+
+func (p *parser) assignment() Assignment {
+	target := p.operand()
+
+	switch {
+	case p.acceptPunct("="):
+		return Assignment{Target: target, Value: p.term()}
+	case p.isPunct("+="), p.isPunct("-="):
+		op := p.next().Text[:1]
+		return Assignment{Target: target, Value: &Operation{Op: op, Left: target, Right: p.term()}}
+	}
+
+	p.mismatch("'='")
+	return Assignment{}
+}
+
+// deleteStatement parses
+//
+//	DELETE [operands] FROM name [USING TIMESTAMP n] WHERE relations
+//	[IF EXISTS | IF conditions]
+func (p *parser) deleteStatement() *Delete {
+	p.expectKeyword("delete")
+	s := &Delete{}
+
+	if !p.isKeyword("from") {
+		for {
+			s.Columns = append(s.Columns, p.operand())
+			if !p.acceptPunct(",") {
+				break
+			}
+		}
+	}
+
+	p.expectKeyword("from")
+	s.Table = p.name()
+	s.Using = p.using()
+
+	p.expectKeyword("where")
+	s.Where = p.relations()
+	s.IfExists, s.If = p.conditions()
+
+	return s
+}
+
+// batchStatement parses
+//
+//	BEGIN [UNLOGGED | COUNTER] BATCH [USING TIMESTAMP n]
+//	statements
+//	APPLY BATCH
+func (p *parser) batchStatement() *Batch {
+	p.expectKeyword("begin")
+	s := &Batch{}
+
+	switch {
+	case p.acceptKeyword("unlogged"):
+		s.Type = UnloggedBatch
+	case p.acceptKeyword("counter"):
+		s.Type = CounterBatch
+	}
+
+	p.expectKeyword("batch")
+	s.Using = p.using()
+
+	for !p.isKeyword("apply") {
+		switch {
+		case p.isKeyword("insert"):
+			s.Statements = append(s.Statements, p.insertStatement())
+		case p.isKeyword("update"):
+			s.Statements = append(s.Statements, p.updateStatement())
+		case p.isKeyword("delete"):
+			s.Statements = append(s.Statements, p.deleteStatement())
+		default:
+			p.mismatch("K_APPLY")
+		}
+		p.acceptPunct(";")
+	}
+
+	p.expectKeyword("apply", "batch")
+	return s
+}
+
+// using parses an optional USING TIMESTAMP n [AND TTL n] clause, in any
+// order.
+func (p *parser) using() Using {
+	u := Using{}
+	if !p.acceptKeyword("using") {
+		return u
+	}
+
+	for {
+		switch {
+		case p.acceptKeyword("timestamp"):
+			u.Timestamp = p.term()
+		case p.acceptKeyword("ttl"):
+			u.TTL = p.term()
+		default:
+			p.noViableAlternative()
+		}
+
+		if !p.acceptKeyword("and") {
+			return u
+		}
+	}
+}
+
+// conditions parses an optional IF EXISTS or IF conditions clause.
+func (p *parser) conditions() (bool, []Relation) {
+	if p.acceptKeyword("if", "exists") {
+		return true, nil
+	}
+
+	if !p.acceptKeyword("if") {
+		return false, nil
+	}
+
+	conditions := []Relation{}
+	for {
+		left := p.operand()
+		op := p.operator()
+		conditions = append(conditions, Relation{Left: left, Op: op, Right: p.relationValue(op)})
+
+		if !p.acceptKeyword("and") {
+			return false, conditions
+		}
+	}
+}
+
+func (p *parser) relations() []Relation {
+	relations := []Relation{p.relation()}
+	for p.acceptKeyword("and") {
+		relations = append(relations, p.relation())
+	}
+	return relations
+}
+
+// relation parses a single restriction of a WHERE clause.
+func (p *parser) relation() Relation {
+	var left Term
+
+	switch {
+	case p.isPunct("("):
+		p.next()
+		tuple := &Tuple{}
+		for _, c := range p.identList() {
+			tuple.Elems = append(tuple.Elems, &Column{Name: c})
+		}
+		p.expectPunct(")")
+		left = tuple
+	case p.isKeyword("token") && p.isPunctAt(1, "("):
+		p.pos += 2
+		fn := &FunctionCall{Name: "token"}
+		for _, c := range p.identList() {
+			fn.Args = append(fn.Args, &Column{Name: c})
+		}
+		p.expectPunct(")")
+		left = fn
+	default:
+		left = p.operand()
+	}
+
+	op := p.operator()
+	return Relation{Left: left, Op: op, Right: p.relationValue(op)}
+}
+
+func (p *parser) operator() Operator {
+	t := p.peek()
+
+	if t.Kind == Punct {
+		switch op := Operator(t.Text); op {
+		case Eq, NotEq, Lt, Lte, Gt, Gte:
+			p.next()
+			return op
+		}
+	}
+
+	switch {
+	case p.acceptKeyword("in"):
+		return In
+	case p.acceptKeyword("contains", "key"):
+		return ContainsKey
+	case p.acceptKeyword("contains"):
+		return Contains
+	case p.acceptKeyword("like"):
+		return Like
+	case p.acceptKeyword("is", "not"):
+		return IsNot
+	}
+
+	p.noViableAlternative()
+	return ""
+}
+
+// relationValue parses the right-hand side of a relation. IN takes a
+// parenthesized list or a single bind marker, IS NOT takes NULL.
+func (p *parser) relationValue(op Operator) Term {
+	switch op {
+	case In:
+		if p.acceptPunct("(") {
+			tuple := &Tuple{}
+			if !p.isPunct(")") {
+				tuple.Elems = p.terms()
+			}
+			p.expectPunct(")")
+			return tuple
+		}
+		return p.bindMarker()
+	case IsNot:
+		p.expectKeyword("null")
+		return &Literal{Kind: NullLiteral}
+	}
+	return p.term()
+}
+
+// operand parses a column reference with optional element or field
+// selections, e.g. m['key'] or address.street.
+func (p *parser) operand() Term {
+	var t Term = &Column{Name: p.ident()}
+	return p.postfix(t)
+}
+
+// postfix parses element and field selections following t.
+func (p *parser) postfix(t Term) Term {
+	for {
+		switch {
+		case p.acceptPunct("["):
+			t = &Index{Expr: t, Key: p.term()}
+			p.expectPunct("]")
+		case p.isPunct(".") && p.isIdentAt(1):
+			p.next()
+			t = &Field{Expr: t, Name: p.ident()}
+		default:
+			return t
+		}
+	}
+}
+
+func (p *parser) terms() []Term {
+	terms := []Term{p.term()}
+	for p.acceptPunct(",") {
+		terms = append(terms, p.term())
+	}
+	return terms
+}
+
+// term parses a simple term optionally followed by + or - operations.
+func (p *parser) term() Term {
+	t := p.simpleTerm()
+	for p.isPunct("+") || p.isPunct("-") {
+		op := p.next().Text
+		t = &Operation{Op: op, Left: t, Right: p.simpleTerm()}
+	}
+	return t
+}
+
+var isoDuration = regexp.MustCompile(`^(?i)P((\d+Y)?(\d+M)?(\d+W)?(\d+D)?)(T(\d+H)?(\d+M)?(\d+S)?)?$`)
+
+var literalKinds = map[TokenKind]LiteralKind{
+	String:   StringLiteral,
+	Integer:  IntegerLiteral,
+	Float:    FloatLiteral,
+	UUID:     UUIDLiteral,
+	Blob:     BlobLiteral,
+	Duration: DurationLiteral,
+}
+
+func (p *parser) simpleTerm() Term {
+	t := p.peek()
+
+	if kind, found := literalKinds[t.Kind]; found {
+		p.next()
+		return &Literal{Kind: kind, Value: t.Text}
+	}
+
+	if t.Kind == Punct {
+		switch t.Text {
+		case "-":
+			if lit, ok := p.numberAt(1); ok {
+				p.pos += 2
+				lit.Value = "-" + lit.Value
+				return lit
+			}
+		case "?", ":":
+			return p.bindMarker()
+		case "[":
+			p.next()
+			list := &List{}
+			if !p.isPunct("]") {
+				list.Elems = p.terms()
+			}
+			p.expectPunct("]")
+			return list
+		case "{":
+			return p.braces()
+		case "(":
+			return p.parens()
+		}
+		p.noViableAlternative()
+	}
+
+	if t.Kind == Ident {
+		lower := strings.ToLower(t.Text)
+		switch {
+		case lower == "null":
+			p.next()
+			return &Literal{Kind: NullLiteral}
+		case lower == "true" || lower == "false":
+			p.next()
+			return &Literal{Kind: BooleanLiteral, Value: lower}
+		case lower == "nan" || lower == "infinity":
+			lit, _ := p.numberAt(0)
+			p.next()
+			return lit
+		case lower == "cast" && p.isPunctAt(1, "("):
+			p.pos += 2
+			c := &Cast{Expr: p.term()}
+			p.expectKeyword("as")
+			c.Type = p.typ()
+			p.expectPunct(")")
+			return c
+		case lower == "token" && p.isPunctAt(1, "("):
+			p.next()
+			return p.functionCall(Name{Name: lower})
+		case isoDuration.MatchString(t.Text) && len(t.Text) > 1 && !strings.HasSuffix(lower, "t"):
+			p.next()
+			return &Literal{Kind: DurationLiteral, Value: t.Text}
+		}
+	}
+
+	if !p.isIdentAt(0) {
+		p.noViableAlternative()
+	}
+
+	// function calls, optionally keyspace-qualified
+	if p.isPunctAt(1, "(") {
+		return p.functionCall(Name{Name: p.ident()})
+	}
+	if p.isPunctAt(1, ".") && p.isIdentAt(2) && p.isPunctAt(3, "(") {
+		ks := p.ident()
+		p.next()
+		return p.functionCall(Name{Keyspace: ks, Name: p.ident()})
+	}
+
+	return p.operand()
+}
+
+// numberAt returns the numeric literal at n, including NaN and Infinity.
+func (p *parser) numberAt(n int) (*Literal, bool) {
+	t := p.peekAt(n)
+	switch {
+	case t.Kind == Integer:
+		return &Literal{Kind: IntegerLiteral, Value: t.Text}, true
+	case t.Kind == Float:
+		return &Literal{Kind: FloatLiteral, Value: t.Text}, true
+	case p.isKeywordAt(n, "nan"):
+		return &Literal{Kind: FloatLiteral, Value: "NaN"}, true
+	case p.isKeywordAt(n, "infinity"):
+		return &Literal{Kind: FloatLiteral, Value: "Infinity"}, true
+	}
+	return nil, false
+}
+
+func (p *parser) bindMarker() *BindMarker {
+	m := &BindMarker{Index: p.markers}
+
+	switch {
+	case p.acceptPunct("?"):
+	case p.acceptPunct(":"):
+		m.Name = p.ident()
+	default:
+		p.mismatch("'?'")
+	}
+
+	p.markers++
+	return m
+}
+
+func (p *parser) functionCall(name Name) *FunctionCall {
+	fn := &FunctionCall{Keyspace: name.Keyspace, Name: name.Name, Args: []Term{}}
+
+	p.expectPunct("(")
+	switch {
+	case p.acceptPunct("*"):
+		fn.Args = append(fn.Args, &Star{})
+	case !p.isPunct(")"):
+		fn.Args = p.terms()
+	}
+	p.expectPunct(")")
+
+	return fn
+}
+
+// braces parses a map, set or user-defined type literal. Keys that are
+// plain identifiers make it a user-defined type.
+func (p *parser) braces() Term {
+	p.expectPunct("{")
+
+	if p.acceptPunct("}") {
+		return &Map{}
+	}
+
+	if p.isIdentAt(0) && p.isPunctAt(1, ":") {
+		udt := &UserType{}
+		for {
+			f := FieldValue{Name: p.ident()}
+			p.expectPunct(":")
+			f.Value = p.term()
+			udt.Fields = append(udt.Fields, f)
+
+			if !p.acceptPunct(",") {
+				break
+			}
+		}
+		p.expectPunct("}")
+		return udt
+	}
+
+	first := p.term()
+	if !p.acceptPunct(":") {
+		set := &Set{Elems: []Term{first}}
+		for p.acceptPunct(",") {
+			set.Elems = append(set.Elems, p.term())
+		}
+		p.expectPunct("}")
+		return set
+	}
+
+	m := &Map{Entries: []Entry{{Key: first, Value: p.term()}}}
+	for p.acceptPunct(",") {
+		e := Entry{Key: p.term()}
+		p.expectPunct(":")
+		e.Value = p.term()
+		m.Entries = append(m.Entries, e)
+	}
+	p.expectPunct("}")
+	return m
+}
+
+// parens parses a type hint such as (int)? or a tuple literal.
+func (p *parser) parens() Term {
+	p.expectPunct("(")
+
+	if t := p.peek(); t.Kind == Ident && builtinTypes[strings.ToLower(t.Text)] &&
+		(p.isPunctAt(1, ")") || p.isPunctAt(1, "<")) {
+		hint := &TypeHint{Type: p.typ()}
+		p.expectPunct(")")
+		hint.Expr = p.simpleTerm()
+		return hint
+	}
+
+	tuple := &Tuple{Elems: p.terms()}
+	p.expectPunct(")")
+	return tuple
+}
+
+// builtinTypes are the type names that are not user-defined types.
+var builtinTypes = map[string]bool{
+	"ascii": true, "bigint": true, "blob": true, "boolean": true,
+	"counter": true, "date": true, "decimal": true, "double": true,
+	"duration": true, "float": true, "inet": true, "int": true,
+	"smallint": true, "text": true, "time": true, "timestamp": true,
+	"timeuuid": true, "tinyint": true, "uuid": true, "varchar": true,
+	"varint": true, "frozen": true, "list": true, "map": true, "set": true,
+	"tuple": true,
+}
+
+// typ parses a CQL type.
+func (p *parser) typ() Type {
+	t := p.peek()
+
+	if t.Kind == String {
+		p.next()
+		return Type{Name: t.Text, Custom: true}
+	}
+
+	if t.Kind == Ident && builtinTypes[strings.ToLower(t.Text)] {
+		p.next()
+		typ := Type{Name: strings.ToLower(t.Text)}
+
+		switch typ.Name {
+		case "frozen", "list", "set", "map", "tuple":
+			p.expectPunct("<")
+			typ.Params = []Type{p.typ()}
+			for p.acceptPunct(",") {
+				typ.Params = append(typ.Params, p.typ())
+			}
+			p.expectPunct(">")
+		}
+
+		return typ
+	}
+
+	n := p.name()
+	return Type{Keyspace: n.Keyspace, Name: n.Name}
+}
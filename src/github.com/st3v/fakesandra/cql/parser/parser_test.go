@@ -0,0 +1,344 @@
+package parser_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/st3v/fakesandra/cql/parser"
+)
+
+var _ = Describe("Parse", func() {
+	parse := func(stmt string) Statement {
+		s, err := Parse(stmt)
+		Expect(err).ToNot(HaveOccurred())
+		return s
+	}
+
+	col := func(name string) *Column {
+		return &Column{Name: name}
+	}
+
+	lit := func(kind LiteralKind, value string) *Literal {
+		return &Literal{Kind: kind, Value: value}
+	}
+
+	Describe("SELECT", func() {
+		It("parses all clauses", func() {
+			s := parse(`select DISTINCT a AS "Alias", count(*), writetime(b), ks.fn(?, 1)
+				FROM ks."Table"
+				WHERE token(a) > :start AND (c, d) >= (1, 'x') AND e IN (1, 2) AND m CONTAINS KEY 'k'
+				GROUP BY a, c ORDER BY c DESC, d
+				PER PARTITION LIMIT 2 LIMIT 10 ALLOW FILTERING;`)
+
+			Expect(s).To(Equal(&Select{
+				Table:    Name{Keyspace: "ks", Name: "Table"},
+				Distinct: true,
+				Selectors: []Selector{
+					{Expr: col("a"), Alias: "Alias"},
+					{Expr: &FunctionCall{Name: "count", Args: []Term{&Star{}}}},
+					{Expr: &FunctionCall{Name: "writetime", Args: []Term{col("b")}}},
+					{Expr: &FunctionCall{Keyspace: "ks", Name: "fn", Args: []Term{
+						&BindMarker{Index: 0}, lit(IntegerLiteral, "1"),
+					}}},
+				},
+				Where: []Relation{
+					{Left: &FunctionCall{Name: "token", Args: []Term{col("a")}}, Op: Gt, Right: &BindMarker{Index: 1, Name: "start"}},
+					{Left: &Tuple{Elems: []Term{col("c"), col("d")}}, Op: Gte, Right: &Tuple{Elems: []Term{
+						lit(IntegerLiteral, "1"), lit(StringLiteral, "x"),
+					}}},
+					{Left: col("e"), Op: In, Right: &Tuple{Elems: []Term{lit(IntegerLiteral, "1"), lit(IntegerLiteral, "2")}}},
+					{Left: col("m"), Op: ContainsKey, Right: lit(StringLiteral, "k")},
+				},
+				GroupBy:           []string{"a", "c"},
+				OrderBy:           []Ordering{{Column: "c", Descending: true}, {Column: "d"}},
+				PerPartitionLimit: lit(IntegerLiteral, "2"),
+				Limit:             lit(IntegerLiteral, "10"),
+				AllowFiltering:    true,
+			}))
+		})
+
+		It("parses SELECT * and non-reserved keywords as column names", func() {
+			Expect(parse(`SELECT * FROM t`)).To(Equal(&Select{Table: Name{Name: "t"}}))
+
+			s := parse(`SELECT json, key, ttl(value) FROM t`).(*Select)
+			Expect(s.JSON).To(BeFalse())
+			Expect(s.Selectors).To(HaveLen(3))
+			Expect(s.Selectors[1].Expr).To(Equal(col("key")))
+		})
+
+		It("parses field and element selections and casts", func() {
+			s := parse(`SELECT addr.street, m['k'], CAST(a AS text) FROM t`).(*Select)
+			Expect(s.Selectors).To(Equal([]Selector{
+				{Expr: &Field{Expr: col("addr"), Name: "street"}},
+				{Expr: &Index{Expr: col("m"), Key: lit(StringLiteral, "k")}},
+				{Expr: &Cast{Expr: col("a"), Type: Type{Name: "text"}}},
+			}))
+		})
+
+		It("parses IN with a single bind marker and IS NOT NULL", func() {
+			s := parse(`SELECT * FROM t WHERE a IN ? AND b IS NOT NULL`).(*Select)
+			Expect(s.Where).To(Equal([]Relation{
+				{Left: col("a"), Op: In, Right: &BindMarker{}},
+				{Left: col("b"), Op: IsNot, Right: &Literal{Kind: NullLiteral}},
+			}))
+		})
+	})
+
+	Describe("INSERT", func() {
+		It("parses values, conditions and USING", func() {
+			s := parse(`INSERT INTO ks.t (id, l, s, m, u, tup, f) VALUES (
+				a3bb189e-8bf9-3888-9912-ace4e6543002, [1, -2], {'a'}, {1: 0xff}, {street: 'x', "Zip": ?},
+				(1, true), (int)?
+			) IF NOT EXISTS USING TTL 10 AND TIMESTAMP 123`)
+
+			Expect(s).To(Equal(&Insert{
+				Table:   Name{Keyspace: "ks", Name: "t"},
+				Columns: []string{"id", "l", "s", "m", "u", "tup", "f"},
+				Values: []Term{
+					lit(UUIDLiteral, "a3bb189e-8bf9-3888-9912-ace4e6543002"),
+					&List{Elems: []Term{lit(IntegerLiteral, "1"), lit(IntegerLiteral, "-2")}},
+					&Set{Elems: []Term{lit(StringLiteral, "a")}},
+					&Map{Entries: []Entry{{Key: lit(IntegerLiteral, "1"), Value: lit(BlobLiteral, "0xff")}}},
+					&UserType{Fields: []FieldValue{
+						{Name: "street", Value: lit(StringLiteral, "x")},
+						{Name: "Zip", Value: &BindMarker{Index: 0}},
+					}},
+					&Tuple{Elems: []Term{lit(IntegerLiteral, "1"), lit(BooleanLiteral, "true")}},
+					&TypeHint{Type: Type{Name: "int"}, Expr: &BindMarker{Index: 1}},
+				},
+				IfNotExists: true,
+				Using:       Using{TTL: lit(IntegerLiteral, "10"), Timestamp: lit(IntegerLiteral, "123")},
+			}))
+		})
+
+		It("parses INSERT JSON", func() {
+			s := parse(`INSERT INTO t JSON '{"id": 1}' DEFAULT UNSET`).(*Insert)
+			Expect(s.JSON).To(Equal(lit(StringLiteral, `{"id": 1}`)))
+		})
+	})
+
+	Describe("UPDATE", func() {
+		It("parses assignments and conditions", func() {
+			s := parse(`UPDATE t USING TIMESTAMP ? SET c = c + 1, l = [0] + l, m['k'] = ?, s -= {'x'}, a.b = 2
+				WHERE id = ? IF c > 0 AND m['k'] != null`)
+
+			Expect(s).To(Equal(&Update{
+				Table: Name{Name: "t"},
+				Using: Using{Timestamp: &BindMarker{Index: 0}},
+				Assignments: []Assignment{
+					{Target: col("c"), Value: &Operation{Op: "+", Left: col("c"), Right: lit(IntegerLiteral, "1")}},
+					{Target: col("l"), Value: &Operation{Op: "+", Left: &List{Elems: []Term{lit(IntegerLiteral, "0")}}, Right: col("l")}},
+					{Target: &Index{Expr: col("m"), Key: lit(StringLiteral, "k")}, Value: &BindMarker{Index: 1}},
+					{Target: col("s"), Value: &Operation{Op: "-", Left: col("s"), Right: &Set{Elems: []Term{lit(StringLiteral, "x")}}}},
+					{Target: &Field{Expr: col("a"), Name: "b"}, Value: lit(IntegerLiteral, "2")},
+				},
+				Where: []Relation{{Left: col("id"), Op: Eq, Right: &BindMarker{Index: 2}}},
+				If: []Relation{
+					{Left: col("c"), Op: Gt, Right: lit(IntegerLiteral, "0")},
+					{Left: &Index{Expr: col("m"), Key: lit(StringLiteral, "k")}, Op: NotEq, Right: &Literal{Kind: NullLiteral}},
+				},
+			}))
+		})
+
+		It("parses IF EXISTS", func() {
+			Expect(parse(`UPDATE t SET a = 1 WHERE id = 1 IF EXISTS`).(*Update).IfExists).To(BeTrue())
+		})
+	})
+
+	Describe("DELETE", func() {
+		It("parses columns, elements and USING TIMESTAMP", func() {
+			Expect(parse(`DELETE a, m['k'] FROM t USING TIMESTAMP 5 WHERE id = 1 AND c > 2`)).To(Equal(&Delete{
+				Table:   Name{Name: "t"},
+				Columns: []Term{col("a"), &Index{Expr: col("m"), Key: lit(StringLiteral, "k")}},
+				Using:   Using{Timestamp: lit(IntegerLiteral, "5")},
+				Where: []Relation{
+					{Left: col("id"), Op: Eq, Right: lit(IntegerLiteral, "1")},
+					{Left: col("c"), Op: Gt, Right: lit(IntegerLiteral, "2")},
+				},
+			}))
+		})
+	})
+
+	Describe("BATCH", func() {
+		It("parses batched statements and numbers bind markers across them", func() {
+			s := parse(`BEGIN COUNTER BATCH USING TIMESTAMP 1
+				UPDATE t SET c = c + ? WHERE id = ?;
+				UPDATE t SET c = c - 1 WHERE id = ?
+				APPLY BATCH`).(*Batch)
+
+			Expect(s.Type).To(Equal(CounterBatch))
+			Expect(s.Using.Timestamp).To(Equal(lit(IntegerLiteral, "1")))
+			Expect(s.Statements).To(HaveLen(2))
+			Expect(s.Statements[1].(*Update).Where[0].Right).To(Equal(&BindMarker{Index: 2}))
+		})
+	})
+
+	Describe("USE", func() {
+		It("parses the keyspace", func() {
+			Expect(parse(`USE "MyKeyspace"`)).To(Equal(&Use{Keyspace: "MyKeyspace"}))
+		})
+	})
+
+	Describe("DDL", func() {
+		It("parses CREATE KEYSPACE", func() {
+			Expect(parse(`CREATE KEYSPACE IF NOT EXISTS ks WITH REPLICATION = {'class': 'SimpleStrategy', 'replication_factor': 1} AND durable_writes = false`)).To(Equal(&CreateKeyspace{
+				Keyspace:    "ks",
+				IfNotExists: true,
+				Options: Properties{
+					{Name: "replication", Value: &Map{Entries: []Entry{
+						{Key: lit(StringLiteral, "class"), Value: lit(StringLiteral, "SimpleStrategy")},
+						{Key: lit(StringLiteral, "replication_factor"), Value: lit(IntegerLiteral, "1")},
+					}}},
+					{Name: "durable_writes", Value: lit(BooleanLiteral, "false")},
+				},
+			}))
+		})
+
+		It("parses CREATE TABLE", func() {
+			s := parse(`CREATE TABLE ks.t (
+				a int, b text, c timeuuid, s set<text> STATIC, m frozen<map<text, list<int>>>, u ks.address,
+				PRIMARY KEY ((a, b), c)
+			) WITH CLUSTERING ORDER BY (c DESC) AND default_time_to_live = 60 AND compaction = {'class': 'LeveledCompactionStrategy'}`).(*CreateTable)
+
+			Expect(s.Table).To(Equal(Name{Keyspace: "ks", Name: "t"}))
+			Expect(s.PartitionKey).To(Equal([]string{"a", "b"}))
+			Expect(s.ClusteringKey).To(Equal([]string{"c"}))
+			Expect(s.ClusteringOrder).To(Equal([]Ordering{{Column: "c", Descending: true}}))
+			Expect(s.Columns[3]).To(Equal(ColumnDef{Name: "s", Type: Type{Name: "set", Params: []Type{{Name: "text"}}}, Static: true}))
+			Expect(s.Columns[4].Type.String()).To(Equal("frozen<map<text, list<int>>>"))
+			Expect(s.Columns[5].Type).To(Equal(Type{Keyspace: "ks", Name: "address"}))
+
+			ttl, found := s.Options.Get("default_time_to_live")
+			Expect(found).To(BeTrue())
+			Expect(ttl).To(Equal(lit(IntegerLiteral, "60")))
+		})
+
+		It("parses an inline primary key", func() {
+			s := parse(`CREATE TABLE t (id uuid PRIMARY KEY, v text)`).(*CreateTable)
+			Expect(s.PartitionKey).To(Equal([]string{"id"}))
+			Expect(s.ClusteringKey).To(BeEmpty())
+		})
+
+		It("rejects multiple primary keys", func() {
+			_, err := Parse(`CREATE TABLE t (id uuid PRIMARY KEY, v text, PRIMARY KEY (v))`)
+			Expect(err).To(MatchError(ContainSubstring("Multiple PRIMARY KEYs specifed (exactly one required)")))
+		})
+
+		It("parses ALTER TABLE", func() {
+			Expect(parse(`ALTER TABLE t ADD (a int, b list<text>)`).(*AlterTable).Add).To(HaveLen(2))
+			Expect(parse(`ALTER TABLE t DROP a`).(*AlterTable).Drop).To(Equal([]string{"a"}))
+			Expect(parse(`ALTER TABLE t RENAME a TO b AND c TO d`).(*AlterTable).Rename).To(Equal([]Rename{{From: "a", To: "b"}, {From: "c", To: "d"}}))
+			Expect(parse(`ALTER TABLE t WITH comment = 'x'`).(*AlterTable).Options).To(HaveLen(1))
+		})
+
+		It("parses types", func() {
+			Expect(parse(`CREATE TYPE IF NOT EXISTS ks.address (street text, zip int)`)).To(Equal(&CreateType{
+				Type:        Name{Keyspace: "ks", Name: "address"},
+				IfNotExists: true,
+				Fields:      []ColumnDef{{Name: "street", Type: Type{Name: "text"}}, {Name: "zip", Type: Type{Name: "int"}}},
+			}))
+			Expect(parse(`ALTER TYPE address ADD country text`).(*AlterType).Add).To(HaveLen(1))
+			Expect(parse(`DROP TYPE IF EXISTS address`)).To(Equal(&DropType{Type: Name{Name: "address"}, IfExists: true}))
+		})
+
+		It("parses indexes", func() {
+			Expect(parse(`CREATE INDEX ON t (keys(m))`)).To(Equal(&CreateIndex{
+				Table:  Name{Name: "t"},
+				Target: IndexTarget{Column: "m", Kind: "keys"},
+			}))
+
+			s := parse(`CREATE CUSTOM INDEX IF NOT EXISTS t_name ON t (name) USING 'org.apache.cassandra.index.sasi.SASIIndex' WITH OPTIONS = {'mode': 'CONTAINS'}`).(*CreateIndex)
+			Expect(s.Index).To(Equal("t_name"))
+			Expect(s.Class).To(Equal("org.apache.cassandra.index.sasi.SASIIndex"))
+			Expect(s.Options).To(HaveLen(1))
+		})
+
+		It("parses functions and aggregates", func() {
+			Expect(parse(`CREATE OR REPLACE FUNCTION ks.plus (a int, b int) RETURNS NULL ON NULL INPUT RETURNS int LANGUAGE java AS 'return a + b;'`)).To(Equal(&CreateFunction{
+				Function:  Name{Keyspace: "ks", Name: "plus"},
+				OrReplace: true,
+				Args:      []ColumnDef{{Name: "a", Type: Type{Name: "int"}}, {Name: "b", Type: Type{Name: "int"}}},
+				Returns:   Type{Name: "int"},
+				Language:  "java",
+				Body:      "return a + b;",
+			}))
+
+			Expect(parse(`CREATE AGGREGATE ks.total (int) SFUNC plus STYPE int FINALFUNC done INITCOND 0`)).To(Equal(&CreateAggregate{
+				Aggregate: Name{Keyspace: "ks", Name: "total"},
+				ArgTypes:  []Type{{Name: "int"}},
+				StateFunc: "plus",
+				StateType: Type{Name: "int"},
+				FinalFunc: "done",
+				InitCond:  lit(IntegerLiteral, "0"),
+			}))
+
+			Expect(parse(`DROP FUNCTION ks.plus (int, int)`).(*DropFunction).ArgTypes).To(HaveLen(2))
+		})
+
+		It("parses materialized views", func() {
+			s := parse(`CREATE MATERIALIZED VIEW ks.by_name AS SELECT * FROM ks.users
+				WHERE name IS NOT NULL AND id IS NOT NULL PRIMARY KEY (name, id) WITH CLUSTERING ORDER BY (id DESC)`).(*CreateView)
+
+			Expect(s.Base).To(Equal(Name{Keyspace: "ks", Name: "users"}))
+			Expect(s.Where).To(HaveLen(2))
+			Expect(s.PartitionKey).To(Equal([]string{"name"}))
+			Expect(s.ClusteringKey).To(Equal([]string{"id"}))
+			Expect(s.ClusteringOrder).To(Equal([]Ordering{{Column: "id", Descending: true}}))
+		})
+
+		It("parses DROP and TRUNCATE", func() {
+			Expect(parse(`DROP KEYSPACE IF EXISTS ks`)).To(Equal(&DropKeyspace{Keyspace: "ks", IfExists: true}))
+			Expect(parse(`DROP TABLE ks.t`)).To(Equal(&DropTable{Table: Name{Keyspace: "ks", Name: "t"}}))
+			Expect(parse(`DROP MATERIALIZED VIEW v`)).To(Equal(&DropView{View: Name{Name: "v"}}))
+			Expect(parse(`TRUNCATE TABLE t`)).To(Equal(&Truncate{Table: Name{Name: "t"}}))
+		})
+	})
+
+	Describe("errors", func() {
+		It("reports mismatched input with its position", func() {
+			_, err := Parse(`SELECT * FORM t`)
+			Expect(err).To(MatchError("line 1:9 mismatched input 'FORM' expecting K_FROM"))
+		})
+
+		It("reports reserved keywords used as identifiers", func() {
+			_, err := Parse(`SELECT * FROM select`)
+			Expect(err).To(MatchError("line 1:14 no viable alternative at input 'select'"))
+		})
+
+		It("reports unknown statements", func() {
+			_, err := Parse(`SELEC * FROM t`)
+			Expect(err).To(MatchError("line 1:0 no viable alternative at input 'SELEC'"))
+		})
+
+		It("reports trailing input", func() {
+			_, err := Parse(`USE ks foo`)
+			Expect(err).To(MatchError("line 1:7 mismatched input 'foo' expecting EOF"))
+		})
+	})
+})
+
+var _ = Describe("ParseScript", func() {
+	It("parses statements separated by semicolons", func() {
+		stmts, err := ParseScript(`
+			CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1};
+			-- users
+			CREATE TABLE ks.users (id int PRIMARY KEY);;
+			BEGIN BATCH INSERT INTO ks.users (id) VALUES (1); APPLY BATCH;
+		`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stmts).To(HaveLen(3))
+		Expect(stmts[2]).To(BeAssignableToTypeOf(&Batch{}))
+	})
+})
+
+var _ = Describe("Term", func() {
+	It("renders CQL", func() {
+		s, err := Parse(`UPDATE t SET "Col" = {'it''s': [1, ?], 'b': (0x01, null)} WHERE k = :key`)
+		Expect(err).ToNot(HaveOccurred())
+
+		u := s.(*Update)
+		Expect(u.Assignments[0].Target.String()).To(Equal(`"Col"`))
+		Expect(u.Assignments[0].Value.String()).To(Equal(`{'it''s': [1, ?], 'b': (0x01, null)}`))
+		Expect(u.Where[0].String()).To(Equal(`k = :key`))
+	})
+})
@@ -12,4 +12,5 @@ var (
 	// routing & handling
 	errMissingRoute   = errors.New("Missing route")
 	errMissingHandler = errors.New("Missing handler")
+	errNotHijackable  = errors.New("Response writer cannot be hijacked")
 )
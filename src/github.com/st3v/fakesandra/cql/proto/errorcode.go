@@ -0,0 +1,107 @@
+package proto
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrorCode identifies the error reported by an ERROR response.
+type ErrorCode int32
+
+const (
+	ErrServer          ErrorCode = 0x0000
+	ErrProtocol        ErrorCode = 0x000A
+	ErrBadCredentials  ErrorCode = 0x0100
+	ErrUnavailable     ErrorCode = 0x1000
+	ErrOverloaded      ErrorCode = 0x1001
+	ErrIsBootstrapping ErrorCode = 0x1002
+	ErrTruncate        ErrorCode = 0x1003
+	ErrWriteTimeout    ErrorCode = 0x1100
+	ErrReadTimeout     ErrorCode = 0x1200
+	ErrFunctionFailure ErrorCode = 0x1400
+	ErrSyntax          ErrorCode = 0x2000
+	ErrUnauthorized    ErrorCode = 0x2100
+	ErrInvalid         ErrorCode = 0x2200
+	ErrConfig          ErrorCode = 0x2300
+	ErrAlreadyExists   ErrorCode = 0x2400
+	ErrUnprepared      ErrorCode = 0x2500
+)
+
+var errorCodeNames = map[ErrorCode]string{
+	ErrServer:          "SERVER_ERROR",
+	ErrProtocol:        "PROTOCOL_ERROR",
+	ErrBadCredentials:  "BAD_CREDENTIALS",
+	ErrUnavailable:     "UNAVAILABLE",
+	ErrOverloaded:      "OVERLOADED",
+	ErrIsBootstrapping: "IS_BOOTSTRAPPING",
+	ErrTruncate:        "TRUNCATE_ERROR",
+	ErrWriteTimeout:    "WRITE_TIMEOUT",
+	ErrReadTimeout:     "READ_TIMEOUT",
+	ErrFunctionFailure: "FUNCTION_FAILURE",
+	ErrSyntax:          "SYNTAX_ERROR",
+	ErrUnauthorized:    "UNAUTHORIZED",
+	ErrInvalid:         "INVALID",
+	ErrConfig:          "CONFIG_ERROR",
+	ErrAlreadyExists:   "ALREADY_EXISTS",
+	ErrUnprepared:      "UNPREPARED",
+}
+
+func (ec ErrorCode) String() string {
+	name, found := errorCodeNames[ec]
+	if !found {
+		return "UNKNOWN"
+	}
+	return name
+}
+
+// ErrorCodeByName returns the error code with the given name, e.g.
+// READ_TIMEOUT. The lookup is case-insensitive.
+func ErrorCodeByName(name string) (ErrorCode, bool) {
+	for ec, n := range errorCodeNames {
+		if strings.EqualFold(n, name) {
+			return ec, true
+		}
+	}
+	return 0, false
+}
+
+// Error is an error that is reported to the client with the given code.
+type Error struct {
+	Code    ErrorCode
+	Message string
+}
+
+func NewError(code ErrorCode, format string, args ...interface{}) *Error {
+	return &Error{code, fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// AlreadyExistsError is reported when a keyspace or table to be created
+// already exists. Table is empty for keyspaces.
+type AlreadyExistsError struct {
+	Keyspace string
+	Table    string
+}
+
+func (e *AlreadyExistsError) Error() string {
+	if e.Table == "" {
+		return fmt.Sprintf("Cannot add existing keyspace \"%s\"", e.Keyspace)
+	}
+	return fmt.Sprintf("Cannot add already existing table \"%s\" to keyspace \"%s\"", e.Table, e.Keyspace)
+}
+
+// FunctionFailureError is reported when a user-defined function fails.
+// ArgTypes are the CQL types of the arguments of the function.
+type FunctionFailureError struct {
+	Keyspace string
+	Function string
+	ArgTypes []string
+	Message  string
+}
+
+func (e *FunctionFailureError) Error() string {
+	return e.Message
+}
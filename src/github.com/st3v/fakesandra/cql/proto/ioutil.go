@@ -3,6 +3,7 @@ package proto
 import (
 	"encoding/binary"
 	"io"
+	"net"
 )
 
 func WriteBinary(w io.Writer, data interface{}) error {
@@ -127,14 +128,33 @@ func readVersionDir(r io.Reader, v *VersionDir) error {
 }
 
 type frameWriter struct {
-	out io.Writer
+	out     io.Writer
+	session *Session
 }
 
 func FrameWriter(w io.Writer) *frameWriter {
-	return &frameWriter{w}
+	return &frameWriter{out: w}
+}
+
+// SessionFrameWriter returns a frame writer for a connection whose state is
+// kept in session.
+func SessionFrameWriter(w io.Writer, session *Session) *frameWriter {
+	return &frameWriter{out: w, session: session}
 }
 
 func (fw *frameWriter) WriteFrame(f Frame) error {
 	_, err := f.WriteTo(fw.out)
 	return err
 }
+
+func (fw *frameWriter) Session() *Session {
+	return fw.session
+}
+
+func (fw *frameWriter) Hijack() (net.Conn, error) {
+	conn, ok := fw.out.(net.Conn)
+	if !ok {
+		return nil, errNotHijackable
+	}
+	return conn, nil
+}
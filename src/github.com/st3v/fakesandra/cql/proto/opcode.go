@@ -1,5 +1,7 @@
 package proto
 
+import "strings"
+
 type Opcode uint8
 
 const (
@@ -49,3 +51,14 @@ func (oc Opcode) String() string {
 	}
 	return name
 }
+
+// OpcodeByName returns the opcode with the given name, e.g. QUERY. The
+// lookup is case-insensitive.
+func OpcodeByName(name string) (Opcode, bool) {
+	for oc, n := range opcodeNames {
+		if strings.EqualFold(n, name) {
+			return oc, true
+		}
+	}
+	return 0, false
+}
@@ -3,6 +3,12 @@ package proto
 import (
 	"fmt"
 	"io"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/st3v/fakesandra/cql/parser"
 )
 
 // Version represents the version of a CQL frame.
@@ -36,6 +42,17 @@ const (
 	LocalOne
 )
 
+// ConsistencyByName returns the consistency with the given name, e.g.
+// LOCAL_QUORUM. The lookup is case-insensitive.
+func ConsistencyByName(name string) (Consistency, bool) {
+	for c := Any; c <= LocalOne; c++ {
+		if strings.EqualFold(c.String(), name) {
+			return c, true
+		}
+	}
+	return 0, false
+}
+
 func (c Consistency) String() string {
 	switch c {
 	case Any:
@@ -59,7 +76,7 @@ func (c Consistency) String() string {
 	case LocalSerial:
 		return "LOCAL_SERIAL"
 	case LocalOne:
-		return "LOCAL_SERIAL"
+		return "LOCAL_ONE"
 	default:
 		return "UNKNOWN"
 	}
@@ -93,12 +110,46 @@ type ResponseWriter interface {
 	WriteFrame(response Frame) error
 }
 
+// Hijacker is implemented by response writers that allow handlers to take
+// over the underlying connection, e.g. to close it.
+type Hijacker interface {
+	Hijack() (net.Conn, error)
+}
+
+// Hijack returns the connection underlying rw or an error if rw does not
+// implement Hijacker.
+func Hijack(rw ResponseWriter) (net.Conn, error) {
+	h, ok := rw.(Hijacker)
+	if !ok {
+		return nil, errNotHijackable
+	}
+	return h.Hijack()
+}
+
 // Versioner identifies the right Framer that should be used to frame
 // incomming bytes.
 type Versioner interface {
 	Version(in io.Reader) (Framer, error)
 }
 
+// Negotiator is implemented by versioners that can restrict the request
+// versions they accept, e.g. to those of the Cassandra release a server
+// pretends to be.
+type Negotiator interface {
+	Negotiate(in io.Reader, offered []Version) (Framer, error)
+}
+
+// Negotiate is like v.Version but only accepts request frames of the offered
+// versions. If v does not implement Negotiator all versions v has a framer
+// for are accepted.
+func Negotiate(v Versioner, in io.Reader, offered []Version) (Framer, error) {
+	n, ok := v.(Negotiator)
+	if !ok {
+		return v.Version(in)
+	}
+	return n.Negotiate(in, offered)
+}
+
 // Framer reads raw bytes off a reader and frames them according to a
 // particular version of the CQL protocol.
 type Framer interface {
@@ -123,13 +174,47 @@ type QueryFrameHandler interface {
 	Prepend(handler QueryHandler)
 }
 
-// TODO: instead of passing a string, create interface for query
+// Query represents a CQL query as sent by a client, independent of the
+// protocol version it was framed with.
+type Query interface {
+	fmt.Stringer
+
+	// Statement returns the whitespace-collapsed query string.
+	Statement() string
+
+	// Parsed returns the statement parsed into an AST, or the syntax error
+	// the statement could not be parsed with.
+	Parsed() (parser.Statement, error)
+	Consistency() Consistency
+	Values() ([][]byte, bool)
+	NamedValues() (map[string][]byte, bool)
+	SkipMetadata() bool
+	PageSize() (int32, bool)
+	PagingState() ([]byte, bool)
+	SerialConsistency() (Consistency, bool)
+	DefaultTimestamp() (time.Time, bool)
+}
+
+var (
+	newlines = regexp.MustCompile(`[\r\n]`)
+	spaces   = regexp.MustCompile(`[\s\t]+`)
+)
+
+// TrimStatement collapses all whitespace in stmt into single spaces.
+func TrimStatement(stmt string) string {
+	stmt = newlines.ReplaceAllString(stmt, " ")
+	stmt = spaces.ReplaceAllString(stmt, " ")
+	return strings.Trim(stmt, " ")
+}
+
+// QueryHandler handles a CQL query. Query handlers are chained, a handler
+// that writes a response to the response writer ends the chain.
 type QueryHandler interface {
-	ServeQuery(query string, request Frame, rw ResponseWriter)
+	ServeQuery(query Query, request Frame, rw ResponseWriter)
 }
 
-type QueryHandlerFunc func(query string, request Frame, rw ResponseWriter)
+type QueryHandlerFunc func(query Query, request Frame, rw ResponseWriter)
 
-func (fn QueryHandlerFunc) ServeQuery(q string, r Frame, rw ResponseWriter) {
+func (fn QueryHandlerFunc) ServeQuery(q Query, r Frame, rw ResponseWriter) {
 	fn(q, r, rw)
 }
@@ -0,0 +1,46 @@
+package proto
+
+import "sync"
+
+// Session holds the state of a client connection that outlives a single
+// request, e.g. the keyspace selected with USE.
+type Session struct {
+	mu       sync.RWMutex
+	keyspace string
+}
+
+func NewSession() *Session {
+	return &Session{}
+}
+
+// Keyspace returns the keyspace selected with USE, if any.
+func (s *Session) Keyspace() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keyspace
+}
+
+func (s *Session) SetKeyspace(keyspace string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keyspace = keyspace
+}
+
+// Sessioner is implemented by response writers that are bound to a client
+// connection. Response writers that wrap another one should implement it by
+// calling SessionOf on the wrapped writer.
+type Sessioner interface {
+	Session() *Session
+}
+
+// SessionOf returns the session of the connection rw writes to. If rw does
+// not implement Sessioner a new, empty session is returned, i.e. state is
+// not retained between requests.
+func SessionOf(rw ResponseWriter) *Session {
+	if s, ok := rw.(Sessioner); ok {
+		if session := s.Session(); session != nil {
+			return session
+		}
+	}
+	return NewSession()
+}
@@ -0,0 +1,141 @@
+package v3
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/st3v/fakesandra/cql/parser"
+	"github.com/st3v/fakesandra/cql/proto"
+)
+
+// batchStatements maps the type of BATCH requests, i.e. logged, unlogged
+// or counter, to the statement beginning the equivalent CQL batch.
+var batchStatements = map[uint8]string{
+	0: "BEGIN BATCH",
+	1: "BEGIN UNLOGGED BATCH",
+	2: "BEGIN COUNTER BATCH",
+}
+
+const (
+	batchQueryString uint8 = 0
+	batchPreparedID  uint8 = 1
+)
+
+// unpreparedError is returned for BATCH requests that refer to a statement
+// that has not been prepared.
+type unpreparedError struct {
+	id []byte
+}
+
+func (e *unpreparedError) Error() string {
+	return fmt.Sprintf("Prepared query with ID %x not found", e.id)
+}
+
+// readBatch reads the body of a BATCH request into q. The statement of q
+// is the equivalent BEGIN BATCH ... APPLY BATCH statement. Its values are
+// the values of the batched statements in order. Prepared looks up the
+// statements batched by ID.
+func readBatch(r io.Reader, q *Query, prepared func(id []byte) (string, bool)) error {
+	var typ uint8
+	if err := proto.ReadByte(r, &typ); err != nil {
+		return err
+	}
+
+	begin, found := batchStatements[typ]
+	if !found {
+		return fmt.Errorf("unknown batch type %d", typ)
+	}
+
+	var n uint16
+	if err := proto.ReadShort(r, &n); err != nil {
+		return err
+	}
+
+	stmts := make([]string, n)
+	values := [][]byte{}
+	for i := range stmts {
+		stmt, vs, err := readBatchQuery(r, prepared)
+		if err != nil {
+			return err
+		}
+		stmts[i] = stmt
+		values = append(values, vs...)
+	}
+
+	if err := proto.ReadConsistency(r, &q.consistency); err != nil {
+		return err
+	}
+
+	if err := proto.ReadBinary(r, &q.flagSet); err != nil {
+		return err
+	}
+
+	// Cassandra does not support named values in batches either.
+	if q.flagSet.Contains(qryNames) {
+		return errors.New("named values are not supported in batches")
+	}
+	q.values, q.valueNames = values, make([]string, len(values))
+	if len(values) > 0 {
+		q.flagSet |= queryFlagSet(qryValues)
+	}
+
+	if err := readSerialConsistency(r, q.flagSet, &q.serialConsistency); err != nil {
+		return err
+	}
+
+	var err error
+	if q.defaultTimestamp, err = readDefaultTimestamp(r, q.flagSet); err != nil {
+		return err
+	}
+
+	q.statement = fmt.Sprintf("%s %s; APPLY BATCH", begin, strings.Join(stmts, "; "))
+	q.parsed, q.parseErr = parser.Parse(q.statement)
+	return nil
+}
+
+// readBatchQuery reads a statement of a BATCH request, given either as a
+// query string or as the ID of a prepared statement, and its values.
+func readBatchQuery(r io.Reader, prepared func(id []byte) (string, bool)) (string, [][]byte, error) {
+	var kind uint8
+	if err := proto.ReadByte(r, &kind); err != nil {
+		return "", nil, err
+	}
+
+	var stmt string
+	switch kind {
+	case batchQueryString:
+		var err error
+		if stmt, err = proto.ReadLongString(r); err != nil {
+			return "", nil, err
+		}
+	case batchPreparedID:
+		id, err := proto.ReadShortBytes(r)
+		if err != nil {
+			return "", nil, err
+		}
+
+		var found bool
+		if stmt, found = prepared(id); !found {
+			return "", nil, &unpreparedError{id: id}
+		}
+	default:
+		return "", nil, fmt.Errorf("unknown batch query kind %d", kind)
+	}
+
+	var n uint16
+	if err := proto.ReadShort(r, &n); err != nil {
+		return "", nil, err
+	}
+
+	values := make([][]byte, n)
+	for i := range values {
+		var err error
+		if values[i], err = proto.ReadBytes(r); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return strings.TrimRight(strings.TrimSpace(stmt), ";"), values, nil
+}
@@ -2,51 +2,211 @@ package v3
 
 import (
 	"bytes"
+	"crypto/md5"
+	"fmt"
+	"net"
+	"sync"
 
 	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/result"
 )
 
 var StartupFrameHandler = proto.FrameHandlerFunc(startupFrameHandler)
 
+// OptionsFrameHandler lists the supported STARTUP options.
+var OptionsFrameHandler = proto.FrameHandlerFunc(optionsFrameHandler)
+
+// RegisterFrameHandler accepts event registrations. No events are pushed to
+// the client though.
+var RegisterFrameHandler = proto.FrameHandlerFunc(registerFrameHandler)
+
 var QueryFrameHandler = NewQueryFrameHandler(ResultVoidHandler)
 
 var ResultVoidHandler = proto.QueryHandlerFunc(resultVoidHandler)
 
-func resultVoidHandler(qry string, req proto.Frame, rw proto.ResponseWriter) {
+func resultVoidHandler(qry proto.Query, req proto.Frame, rw proto.ResponseWriter) {
 	rw.WriteFrame(ResultVoidResponse(req))
 }
 
+// UnexpectedQueryHandler rejects every query with an Invalid error. It is
+// used as the last resort in strict mode.
+var UnexpectedQueryHandler = proto.QueryHandlerFunc(unexpectedQueryHandler)
+
+func unexpectedQueryHandler(qry proto.Query, req proto.Frame, rw proto.ResponseWriter) {
+	msg := fmt.Sprintf("Unexpected query, no stub or handler matches: %s", qry.Statement())
+	rw.WriteFrame(ErrorResponse(req, proto.ErrInvalid, msg))
+}
+
 func startupFrameHandler(req proto.Frame, rw proto.ResponseWriter) {
 	// log.Println("Received STARTUP request")
 	rw.WriteFrame(ReadyResponse(req))
 }
 
+func optionsFrameHandler(req proto.Frame, rw proto.ResponseWriter) {
+	rw.WriteFrame(SupportedResponse(req))
+}
+
+func registerFrameHandler(req proto.Frame, rw proto.ResponseWriter) {
+	rw.WriteFrame(ReadyResponse(req))
+}
+
+// Preparer is implemented by query handlers that describe statements when
+// clients prepare them, i.e. tell their bind variables and result columns.
+type Preparer interface {
+	Prepare(stmt string, session *proto.Session) (*result.Prepared, error)
+}
+
 func NewQueryFrameHandler(handler proto.QueryHandler) *queryFrameHandler {
-	return &queryFrameHandler{
+	qfm := &queryFrameHandler{
 		queryHandler: handler,
+		prepared:     map[string]string{},
 	}
+	qfm.preparer, _ = handler.(Preparer)
+	return qfm
 }
 
+// queryFrameHandler serves QUERY, PREPARE, EXECUTE and BATCH requests.
+// Queries, executed statements and batches are passed to the chain of query
+// handlers.
 type queryFrameHandler struct {
 	queryHandler proto.QueryHandler
+
+	// preparer describes prepared statements. It is the query handler last
+	// put in the chain that implements Preparer.
+	preparer Preparer
+
+	mu sync.RWMutex
+
+	// prepared holds the statements prepared so far by their IDs.
+	prepared map[string]string
 }
 
 func (qfm *queryFrameHandler) ServeCQL(req proto.Frame, rw proto.ResponseWriter) {
+	r := bytes.NewReader(req.Body())
+
 	var qry Query
-	if err := readQuery(bytes.NewReader(req.Body()), &qry); err != nil {
-		// TODO: write error to ResponseWriter
+	switch req.Opcode() {
+	case proto.OpPrepare:
+		stmt, err := proto.ReadLongString(r)
+		if err != nil {
+			rw.WriteFrame(ProtocolErrorResponse(req.StreamID(), "Invalid PREPARE message"))
+			return
+		}
+		rw.WriteFrame(PreparedResponse(req, qfm.prepare(stmt), qfm.describe(stmt, proto.SessionOf(rw))))
 		return
+
+	case proto.OpExecute:
+		id, err := proto.ReadShortBytes(r)
+		if err != nil {
+			rw.WriteFrame(ProtocolErrorResponse(req.StreamID(), "Invalid EXECUTE message"))
+			return
+		}
+
+		stmt, found := qfm.statement(id)
+		if !found {
+			rw.WriteFrame(UnpreparedResponse(req, id))
+			return
+		}
+
+		qry.statement = stmt
+		if err := readQueryParameters(r, &qry); err != nil {
+			rw.WriteFrame(ProtocolErrorResponse(req.StreamID(), "Invalid EXECUTE message"))
+			return
+		}
+
+	case proto.OpBatch:
+		err := readBatch(r, &qry, qfm.statement)
+		if e, ok := err.(*unpreparedError); ok {
+			rw.WriteFrame(UnpreparedResponse(req, e.id))
+			return
+		}
+		if err != nil {
+			rw.WriteFrame(ProtocolErrorResponse(req.StreamID(), "Invalid BATCH message"))
+			return
+		}
+
+	default:
+		if err := readQuery(r, &qry); err != nil {
+			rw.WriteFrame(ProtocolErrorResponse(req.StreamID(), "Invalid QUERY message"))
+			return
+		}
 	}
 
-	qfm.queryHandler.ServeQuery(qry.TrimmedStatement(), req, rw)
+	qfm.queryHandler.ServeQuery(qry, req, rw)
 }
 
+// prepare stores stmt and returns its ID. Like Cassandra, the ID is the MD5
+// hash of the statement, so preparing a statement again yields the same ID.
+func (qfm *queryFrameHandler) prepare(stmt string) []byte {
+	sum := md5.Sum([]byte(stmt))
+
+	qfm.mu.Lock()
+	defer qfm.mu.Unlock()
+	qfm.prepared[string(sum[:])] = stmt
+
+	return sum[:]
+}
+
+// statement returns the prepared statement with the given ID.
+func (qfm *queryFrameHandler) statement(id []byte) (string, bool) {
+	qfm.mu.RLock()
+	defer qfm.mu.RUnlock()
+
+	stmt, found := qfm.prepared[string(id)]
+	return stmt, found
+}
+
+// describe returns the bind variables and result columns of stmt.
+// Statements the preparer cannot describe, e.g. those answered by stubs of
+// tables it does not know, are prepared without them.
+func (qfm *queryFrameHandler) describe(stmt string, session *proto.Session) *result.Prepared {
+	if qfm.preparer == nil {
+		return &result.Prepared{}
+	}
+
+	prepared, err := qfm.preparer.Prepare(stmt, session)
+	if err != nil {
+		return &result.Prepared{}
+	}
+	return prepared
+}
+
+// Prepend puts handler in front of the existing chain of query handlers. The
+// rest of the chain is only invoked if handler does not write a response. If
+// handler implements Preparer it describes the statements prepared from now
+// on.
 func (qfm *queryFrameHandler) Prepend(handler proto.QueryHandler) {
+	if p, ok := handler.(Preparer); ok {
+		qfm.preparer = p
+	}
+
 	next := qfm.queryHandler
 	qfm.queryHandler = proto.QueryHandlerFunc(
-		func(qry string, req proto.Frame, rw proto.ResponseWriter) {
-			handler.ServeQuery(qry, req, rw)
-			next.ServeQuery(qry, req, rw)
+		func(qry proto.Query, req proto.Frame, rw proto.ResponseWriter) {
+			tw := &trackingWriter{out: rw}
+			handler.ServeQuery(qry, req, tw)
+			if !tw.written {
+				next.ServeQuery(qry, req, rw)
+			}
 		},
 	)
 }
+
+type trackingWriter struct {
+	out     proto.ResponseWriter
+	written bool
+}
+
+func (tw *trackingWriter) WriteFrame(f proto.Frame) error {
+	tw.written = true
+	return tw.out.WriteFrame(f)
+}
+
+func (tw *trackingWriter) Session() *proto.Session {
+	return proto.SessionOf(tw.out)
+}
+
+func (tw *trackingWriter) Hijack() (net.Conn, error) {
+	tw.written = true
+	return proto.Hijack(tw.out)
+}
@@ -1,14 +1,23 @@
 package v3
 
-import "github.com/st3v/fakesandra/cql/proto"
+import (
+	"fmt"
+
+	"github.com/st3v/fakesandra/cql/proto"
+)
 
 var DefaultMux = NewOpcodeMux()
 
 func NewOpcodeMux() *opcodeMux {
 	return &opcodeMux{
 		handlers: map[proto.Opcode]proto.FrameHandler{
-			proto.OpQuery:   QueryFrameHandler,
-			proto.OpStartup: StartupFrameHandler,
+			proto.OpStartup:  StartupFrameHandler,
+			proto.OpOptions:  OptionsFrameHandler,
+			proto.OpRegister: RegisterFrameHandler,
+			proto.OpQuery:    QueryFrameHandler,
+			proto.OpPrepare:  QueryFrameHandler,
+			proto.OpExecute:  QueryFrameHandler,
+			proto.OpBatch:    QueryFrameHandler,
 		},
 	}
 }
@@ -19,8 +28,10 @@ type opcodeMux struct {
 
 func (opmux *opcodeMux) ServeCQL(req proto.Frame, rw proto.ResponseWriter) {
 	handler, found := opmux.Handler(req.Opcode())
-	if !found {
-		// TODO: write error to ResponseWriter
+	if !found || handler == nil {
+		msg := fmt.Sprintf("Unsupported opcode %s (0x%02x)", req.Opcode(), uint8(req.Opcode()))
+		rw.WriteFrame(ProtocolErrorResponse(req.StreamID(), msg))
+		return
 	}
 
 	handler.ServeCQL(req, rw)
@@ -0,0 +1,340 @@
+package v3
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/st3v/fakesandra/cql/parser"
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+// recorder is a ResponseWriter that keeps the frames written to it.
+type recorder struct {
+	frames []proto.Frame
+}
+
+func (rec *recorder) WriteFrame(f proto.Frame) error {
+	rec.frames = append(rec.frames, f)
+	return nil
+}
+
+// preparer is a query handler that describes every statement alike.
+type preparer struct {
+	prepared *result.Prepared
+}
+
+func (p preparer) ServeQuery(qry proto.Query, req proto.Frame, rw proto.ResponseWriter) {}
+
+func (p preparer) Prepare(stmt string, session *proto.Session) (*result.Prepared, error) {
+	return p.prepared, nil
+}
+
+var _ = Describe("opcodeMux", func() {
+	var (
+		queries []proto.Query
+		mux     *opcodeMux
+		rec     *recorder
+	)
+
+	serve := func(oc proto.Opcode, body []byte) proto.Frame {
+		rec = &recorder{}
+		mux.ServeCQL(&frame{header: header{StreamID: 5, Opcode: oc}, body: body}, rec)
+		Expect(rec.frames).To(HaveLen(1))
+		Expect(rec.frames[0].StreamID()).To(Equal(uint16(5)))
+		return rec.frames[0]
+	}
+
+	readError := func(resp proto.Frame) (proto.ErrorCode, string, *bytes.Reader) {
+		Expect(resp.Opcode()).To(Equal(proto.OpError))
+		r := bytes.NewReader(resp.Body())
+
+		var code int32
+		Expect(proto.ReadInt(r, &code)).To(Succeed())
+		msg, err := proto.ReadString(r)
+		Expect(err).NotTo(HaveOccurred())
+		return proto.ErrorCode(code), msg, r
+	}
+
+	BeforeEach(func() {
+		queries = nil
+		mux = NewOpcodeMux()
+		qfh := NewQueryFrameHandler(proto.QueryHandlerFunc(
+			func(qry proto.Query, req proto.Frame, rw proto.ResponseWriter) {
+				queries = append(queries, qry)
+				rw.WriteFrame(ResultVoidResponse(req))
+			},
+		))
+		for _, oc := range []proto.Opcode{proto.OpQuery, proto.OpPrepare, proto.OpExecute, proto.OpBatch} {
+			mux.Handle(oc, qfh)
+		}
+	})
+
+	It("lists the supported options", func() {
+		resp := serve(proto.OpOptions, nil)
+		Expect(resp.Opcode()).To(Equal(proto.OpSupported))
+
+		r := bytes.NewReader(resp.Body())
+		options := map[string][]string{}
+
+		var n uint16
+		Expect(proto.ReadShort(r, &n)).To(Succeed())
+		for i := uint16(0); i < n; i++ {
+			key, err := proto.ReadString(r)
+			Expect(err).NotTo(HaveOccurred())
+
+			var m uint16
+			Expect(proto.ReadShort(r, &m)).To(Succeed())
+			values := []string{}
+			for j := uint16(0); j < m; j++ {
+				v, err := proto.ReadString(r)
+				Expect(err).NotTo(HaveOccurred())
+				values = append(values, v)
+			}
+			options[key] = values
+		}
+
+		Expect(options).To(Equal(map[string][]string{
+			"CQL_VERSION": {"3.0.0"},
+			"COMPRESSION": {},
+		}))
+		Expect(r.Len()).To(BeZero())
+	})
+
+	It("accepts event registrations", func() {
+		body := new(bytes.Buffer)
+		proto.WriteShort(body, 1)
+		proto.WriteString(body, "SCHEMA_CHANGE")
+
+		Expect(serve(proto.OpRegister, body.Bytes()).Opcode()).To(Equal(proto.OpReady))
+	})
+
+	It("executes prepared statements", func() {
+		body := new(bytes.Buffer)
+		proto.WriteLongString(body, "SELECT * FROM ks.t WHERE k = ?")
+
+		resp := serve(proto.OpPrepare, body.Bytes())
+		Expect(resp.Opcode()).To(Equal(proto.OpResult))
+		Expect(queries).To(BeEmpty())
+
+		r := bytes.NewReader(resp.Body())
+		var kind int32
+		Expect(proto.ReadInt(r, &kind)).To(Succeed())
+		Expect(ResultCode(kind)).To(Equal(ResultPrepared))
+		id, err := proto.ReadShortBytes(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(HaveLen(16))
+
+		body.Reset()
+		proto.WriteShortBytes(body, id)
+		proto.WriteShort(body, uint16(proto.Quorum))
+		proto.WriteByte(body, uint8(qryValues))
+		proto.WriteShort(body, 1)
+		proto.WriteBytes(body, []byte{0, 0, 0, 1})
+
+		Expect(serve(proto.OpExecute, body.Bytes()).Opcode()).To(Equal(proto.OpResult))
+		Expect(queries).To(HaveLen(1))
+		Expect(queries[0].Statement()).To(Equal("SELECT * FROM ks.t WHERE k = ?"))
+		Expect(queries[0].Consistency()).To(Equal(proto.Quorum))
+		values, set := queries[0].Values()
+		Expect(set).To(BeTrue())
+		Expect(values).To(Equal([][]byte{{0, 0, 0, 1}}))
+	})
+
+	It("describes prepared statements", func() {
+		qfh := NewQueryFrameHandler(ResultVoidHandler)
+		qfh.Prepend(preparer{&result.Prepared{
+			Variables: []result.Column{
+				{Keyspace: "ks", Table: "t", Name: "k", Type: types.Native(types.Int)},
+				{Keyspace: "ks", Table: "u", Name: "[limit]", Type: types.Native(types.Int)},
+			},
+			Columns: []result.Column{
+				{Keyspace: "ks", Table: "t", Name: "v", Type: types.Native(types.Varchar)},
+			},
+		}})
+		mux.Handle(proto.OpPrepare, qfh)
+
+		body := new(bytes.Buffer)
+		proto.WriteLongString(body, "SELECT v FROM ks.t WHERE k = ? LIMIT ?")
+		r := bytes.NewReader(serve(proto.OpPrepare, body.Bytes()).Body())
+
+		var kind, flags, n int32
+		Expect(proto.ReadInt(r, &kind)).To(Succeed())
+		Expect(proto.ReadShortBytes(r)).To(HaveLen(16))
+
+		// readSpec reads a column specification, including its table if
+		// it is not global.
+		readSpec := func(global bool) []string {
+			spec := []string{}
+			fields := 1
+			if !global {
+				fields = 3
+			}
+			for i := 0; i < fields; i++ {
+				s, err := proto.ReadString(r)
+				Expect(err).NotTo(HaveOccurred())
+				spec = append(spec, s)
+			}
+			t, err := types.ReadOption(r)
+			Expect(err).NotTo(HaveOccurred())
+			return append(spec, t.String())
+		}
+
+		Expect(proto.ReadInt(r, &flags)).To(Succeed())
+		Expect(flags).To(BeZero())
+		Expect(proto.ReadInt(r, &n)).To(Succeed())
+		Expect(n).To(Equal(int32(2)))
+		Expect(readSpec(false)).To(Equal([]string{"ks", "t", "k", "int"}))
+		Expect(readSpec(false)).To(Equal([]string{"ks", "u", "[limit]", "int"}))
+
+		Expect(proto.ReadInt(r, &flags)).To(Succeed())
+		Expect(flags).To(Equal(rowsGlobalTablesSpec))
+		Expect(proto.ReadInt(r, &n)).To(Succeed())
+		Expect(n).To(Equal(int32(1)))
+		Expect(proto.ReadString(r)).To(Equal("ks"))
+		Expect(proto.ReadString(r)).To(Equal("t"))
+		Expect(readSpec(true)).To(Equal([]string{"v", "text"}))
+		Expect(r.Len()).To(BeZero())
+	})
+
+	It("rejects statements that have not been prepared", func() {
+		body := new(bytes.Buffer)
+		proto.WriteShortBytes(body, []byte{0xca, 0xfe})
+		proto.WriteShort(body, uint16(proto.One))
+		proto.WriteByte(body, 0)
+
+		code, msg, r := readError(serve(proto.OpExecute, body.Bytes()))
+		Expect(code).To(Equal(proto.ErrUnprepared))
+		Expect(msg).To(Equal("Prepared query with ID cafe not found"))
+		Expect(proto.ReadShortBytes(r)).To(Equal([]byte{0xca, 0xfe}))
+		Expect(queries).To(BeEmpty())
+	})
+
+	It("rejects malformed requests", func() {
+		code, msg, _ := readError(serve(proto.OpQuery, []byte{0, 0}))
+		Expect(code).To(Equal(proto.ErrProtocol))
+		Expect(msg).To(Equal("Invalid QUERY message"))
+	})
+
+	It("rejects unsupported opcodes", func() {
+		code, msg, _ := readError(serve(proto.OpAuthResponse, nil))
+		Expect(code).To(Equal(proto.ErrProtocol))
+		Expect(msg).To(Equal("Unsupported opcode AUTH_RESPONSE (0x0f)"))
+	})
+
+	Context("when serving batches", func() {
+		var body *bytes.Buffer
+
+		BeforeEach(func() {
+			body = new(bytes.Buffer)
+		})
+
+		// batch writes the header of a BATCH request with n statements.
+		batch := func(typ uint8, n uint16) {
+			proto.WriteByte(body, typ)
+			proto.WriteShort(body, n)
+		}
+
+		// statement writes a statement of a BATCH request.
+		statement := func(stmt string, values ...[]byte) {
+			proto.WriteByte(body, batchQueryString)
+			proto.WriteLongString(body, stmt)
+			proto.WriteShort(body, uint16(len(values)))
+			for _, v := range values {
+				proto.WriteBytes(body, v)
+			}
+		}
+
+		It("executes the statements as a single batch", func() {
+			batch(0, 2)
+			statement("INSERT INTO ks.t (k, v) VALUES (?, ?)", []byte{1}, []byte{2})
+			statement("DELETE FROM ks.t WHERE k = ?;", []byte{3})
+			proto.WriteShort(body, uint16(proto.Quorum))
+			proto.WriteByte(body, uint8(qryDefaultTimestamp))
+			proto.WriteLong(body, 1500000000000000)
+
+			Expect(serve(proto.OpBatch, body.Bytes()).Opcode()).To(Equal(proto.OpResult))
+			Expect(queries).To(HaveLen(1))
+			Expect(queries[0].Statement()).To(Equal("BEGIN BATCH INSERT INTO ks.t (k, v) VALUES (?, ?); DELETE FROM ks.t WHERE k = ?; APPLY BATCH"))
+			Expect(queries[0].Consistency()).To(Equal(proto.Quorum))
+
+			values, set := queries[0].Values()
+			Expect(set).To(BeTrue())
+			Expect(values).To(Equal([][]byte{{1}, {2}, {3}}))
+
+			ts, set := queries[0].DefaultTimestamp()
+			Expect(set).To(BeTrue())
+			Expect(ts.UnixNano()).To(Equal(int64(1500000000000000000)))
+
+			parsed, err := queries[0].Parsed()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed).To(BeAssignableToTypeOf(&parser.Batch{}))
+			Expect(parsed.(*parser.Batch).Statements).To(HaveLen(2))
+		})
+
+		It("maps the batch type to logged, unlogged and counter batches", func() {
+			for typ, want := range map[uint8]parser.BatchType{0: parser.LoggedBatch, 1: parser.UnloggedBatch, 2: parser.CounterBatch} {
+				body.Reset()
+				batch(typ, 1)
+				statement("UPDATE ks.c SET n = n + 1 WHERE k = 1")
+				proto.WriteShort(body, uint16(proto.One))
+				proto.WriteByte(body, 0)
+
+				serve(proto.OpBatch, body.Bytes())
+				parsed, err := queries[len(queries)-1].Parsed()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(parsed.(*parser.Batch).Type).To(Equal(want))
+			}
+		})
+
+		It("executes prepared statements", func() {
+			prepare := new(bytes.Buffer)
+			proto.WriteLongString(prepare, "INSERT INTO ks.t (k) VALUES (?)")
+			r := bytes.NewReader(serve(proto.OpPrepare, prepare.Bytes()).Body())
+			var kind int32
+			Expect(proto.ReadInt(r, &kind)).To(Succeed())
+			id, err := proto.ReadShortBytes(r)
+			Expect(err).NotTo(HaveOccurred())
+
+			batch(1, 2)
+			proto.WriteByte(body, batchPreparedID)
+			proto.WriteShortBytes(body, id)
+			proto.WriteShort(body, 1)
+			proto.WriteBytes(body, []byte{1})
+			statement("INSERT INTO ks.t (k) VALUES (2)")
+			proto.WriteShort(body, uint16(proto.One))
+			proto.WriteByte(body, 0)
+
+			Expect(serve(proto.OpBatch, body.Bytes()).Opcode()).To(Equal(proto.OpResult))
+			Expect(queries).To(HaveLen(1))
+			Expect(queries[0].Statement()).To(Equal("BEGIN UNLOGGED BATCH INSERT INTO ks.t (k) VALUES (?); INSERT INTO ks.t (k) VALUES (2); APPLY BATCH"))
+		})
+
+		It("rejects statements that have not been prepared", func() {
+			batch(0, 1)
+			proto.WriteByte(body, batchPreparedID)
+			proto.WriteShortBytes(body, []byte{0xca, 0xfe})
+			proto.WriteShort(body, 0)
+			proto.WriteShort(body, uint16(proto.One))
+			proto.WriteByte(body, 0)
+
+			code, msg, _ := readError(serve(proto.OpBatch, body.Bytes()))
+			Expect(code).To(Equal(proto.ErrUnprepared))
+			Expect(msg).To(Equal("Prepared query with ID cafe not found"))
+			Expect(queries).To(BeEmpty())
+		})
+
+		It("rejects unknown batch types", func() {
+			batch(3, 0)
+			proto.WriteShort(body, uint16(proto.One))
+			proto.WriteByte(body, 0)
+
+			code, msg, _ := readError(serve(proto.OpBatch, body.Bytes()))
+			Expect(code).To(Equal(proto.ErrProtocol))
+			Expect(msg).To(Equal("Invalid BATCH message"))
+			Expect(queries).To(BeEmpty())
+		})
+	})
+})
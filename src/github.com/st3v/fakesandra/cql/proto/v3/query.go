@@ -3,10 +3,10 @@ package v3
 import (
 	"fmt"
 	"io"
-	"regexp"
 	"strings"
 	"time"
 
+	"github.com/st3v/fakesandra/cql/parser"
 	"github.com/st3v/fakesandra/cql/proto"
 )
 
@@ -67,8 +67,8 @@ var queryFlagNames = map[queryFlag]string{
 }
 
 type Query struct {
-	Statement         string
-	Consistency       proto.Consistency
+	statement         string
+	consistency       proto.Consistency
 	flagSet           queryFlagSet
 	values            [][]byte
 	valueNames        []string
@@ -76,6 +76,20 @@ type Query struct {
 	pagingState       []byte
 	serialConsistency proto.Consistency
 	defaultTimestamp  time.Time
+	parsed            parser.Statement
+	parseErr          error
+}
+
+func (q Query) Statement() string {
+	return q.TrimmedStatement()
+}
+
+func (q Query) Parsed() (parser.Statement, error) {
+	return q.parsed, q.parseErr
+}
+
+func (q Query) Consistency() proto.Consistency {
+	return q.consistency
 }
 
 func (q Query) Values() ([][]byte, bool) {
@@ -113,19 +127,13 @@ func (q Query) DefaultTimestamp() (time.Time, bool) {
 }
 
 func (q Query) TrimmedStatement() string {
-	newlines := regexp.MustCompile(`[\r\n]`)
-	stmt := newlines.ReplaceAllString(q.Statement, " ")
-
-	spaces := regexp.MustCompile(`[\s\t]+`)
-	stmt = spaces.ReplaceAllString(stmt, " ")
-
-	return strings.Trim(stmt, " ")
+	return proto.TrimStatement(q.statement)
 }
 
 func (q Query) String() string {
 	fields := []string{
 		fmt.Sprintf(`Statement: "%s"`, q.TrimmedStatement()),
-		fmt.Sprintf(`Consistency: "%s"`, q.Consistency),
+		fmt.Sprintf(`Consistency: "%s"`, q.consistency),
 		fmt.Sprintf(`Flags: "%s"`, q.flagSet),
 		fmt.Sprintf(`SkipMetadata: %t`, q.SkipMetadata()),
 	}
@@ -151,11 +159,20 @@ func (q Query) String() string {
 
 func readQuery(r io.Reader, q *Query) error {
 	var err error
-	if q.Statement, err = proto.ReadLongString(r); err != nil {
+	if q.statement, err = proto.ReadLongString(r); err != nil {
 		return err
 	}
 
-	if err := proto.ReadConsistency(r, &q.Consistency); err != nil {
+	return readQueryParameters(r, q)
+}
+
+// readQueryParameters reads the parameters following the statement of a
+// QUERY or the ID of an EXECUTE request. The statement has to be set.
+func readQueryParameters(r io.Reader, q *Query) error {
+	q.parsed, q.parseErr = parser.Parse(q.statement)
+
+	var err error
+	if err := proto.ReadConsistency(r, &q.consistency); err != nil {
 		return err
 	}
 
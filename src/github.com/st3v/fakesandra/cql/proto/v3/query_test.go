@@ -7,6 +7,7 @@ import (
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/st3v/fakesandra/cql/parser"
 	"github.com/st3v/fakesandra/cql/proto"
 )
 
@@ -56,7 +57,12 @@ var _ = Describe("readQuery", func() {
 			})
 
 			It("correctly parses the consistency", func() {
-				Expect(query.Consistency).To(Equal(consistency))
+				Expect(query.Consistency()).To(Equal(consistency))
+			})
+
+			It("keeps the syntax error of an invalid statement", func() {
+				_, err := query.Parsed()
+				Expect(err).To(MatchError("line 1:0 no viable alternative at input 'SOME'"))
 			})
 
 			It("does not set any query values", func() {
@@ -297,3 +303,16 @@ var _ = Describe("readQuery", func() {
 		})
 	})
 })
+
+var _ = Describe("Query.Parsed", func() {
+	It("returns the parsed statement", func() {
+		buf := bytes.NewBuffer([]byte{})
+		Expect(proto.WriteLongString(buf, "USE ks")).To(Succeed())
+		Expect(proto.WriteShort(buf, uint16(proto.One))).To(Succeed())
+		Expect(proto.WriteByte(buf, uint8(0))).To(Succeed())
+
+		var query Query
+		Expect(readQuery(buf, &query)).To(Succeed())
+		Expect(query.Parsed()).To(Equal(&parser.Use{Keyspace: "ks"}))
+	})
+})
@@ -2,8 +2,13 @@ package v3
 
 import (
 	"bytes"
+	"fmt"
+	"io"
+	"log"
 
 	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/cql/types"
 )
 
 type ResultCode int32
@@ -17,32 +22,289 @@ const (
 )
 
 func ReadyResponse(request proto.Frame) proto.Frame {
-	hdr := header{
-		Opcode:   proto.OpReady,
-		StreamID: request.StreamID(),
-		Length:   0,
-	}
+	return newResponse(request, proto.OpReady, make([]byte, 0))
+}
 
-	return &frame{
-		versionDir: proto.VersionDir(Version) | response,
-		header:     hdr,
-		body:       make([]byte, 0),
-	}
+// SupportedResponse lists the options clients can pass in STARTUP. Neither
+// compression algorithm is supported.
+func SupportedResponse(request proto.Frame) proto.Frame {
+	buf := new(bytes.Buffer)
+	proto.WriteShort(buf, 2)
+	proto.WriteString(buf, "CQL_VERSION")
+	proto.WriteShort(buf, 1)
+	proto.WriteString(buf, "3.0.0")
+	proto.WriteString(buf, "COMPRESSION")
+	proto.WriteShort(buf, 0)
+
+	return newResponse(request, proto.OpSupported, buf.Bytes())
 }
 
 func ResultVoidResponse(request proto.Frame) proto.Frame {
 	buf := new(bytes.Buffer)
 	proto.WriteBinary(buf, ResultVoid)
 
+	return newResponse(request, proto.OpResult, buf.Bytes())
+}
+
+// ResultResponse answers request with the given result.
+func ResultResponse(request proto.Frame, res result.Result) proto.Frame {
+	buf := new(bytes.Buffer)
+
+	var err error
+	switch r := res.(type) {
+	case *result.Rows:
+		err = writeRows(buf, r)
+	case result.SetKeyspace:
+		proto.WriteBinary(buf, ResultSetKeyspace)
+		err = proto.WriteString(buf, r.Keyspace)
+	case result.SchemaChange:
+		proto.WriteBinary(buf, ResultSchemaChange)
+		err = writeSchemaChange(buf, r)
+	default:
+		return ResultVoidResponse(request)
+	}
+
+	if err != nil {
+		log.Printf("Error encoding result: %s", err)
+		return ErrorResponse(request, proto.ErrServer, err.Error())
+	}
+
+	return newResponse(request, proto.OpResult, buf.Bytes())
+}
+
+// PreparedResponse answers a PREPARE request with the ID of the prepared
+// statement, its bind variables and the columns of the rows it returns.
+func PreparedResponse(request proto.Frame, id []byte, prepared *result.Prepared) proto.Frame {
+	buf := new(bytes.Buffer)
+	proto.WriteBinary(buf, ResultPrepared)
+	proto.WriteShortBytes(buf, id)
+
+	err := writeMetadata(buf, 0, prepared.Variables, nil)
+	if err == nil {
+		var flags int32
+		if prepared.Columns == nil {
+			flags |= rowsNoMetadata
+		}
+		err = writeMetadata(buf, flags, prepared.Columns, nil)
+	}
+
+	if err != nil {
+		log.Printf("Error encoding result: %s", err)
+		return ErrorResponse(request, proto.ErrServer, err.Error())
+	}
+
+	return newResponse(request, proto.OpResult, buf.Bytes())
+}
+
+const (
+	rowsGlobalTablesSpec int32 = 1 << iota
+	rowsHasMorePages
+	rowsNoMetadata
+)
+
+func writeRows(w io.Writer, rows *result.Rows) error {
+	proto.WriteBinary(w, ResultRows)
+
+	var flags int32
+	if rows.PagingState != nil {
+		flags |= rowsHasMorePages
+	}
+	if rows.NoMetadata {
+		flags |= rowsNoMetadata
+	}
+
+	if err := writeMetadata(w, flags, rows.Columns, rows.PagingState); err != nil {
+		return err
+	}
+
+	proto.WriteInt(w, int32(len(rows.Data)))
+	for _, row := range rows.Data {
+		for _, value := range row {
+			if err := writeValue(w, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeMetadata writes the specifications of columns, i.e. of the columns
+// of rows or of the bind variables of a prepared statement. Only their
+// number is written if flags contain rowsNoMetadata.
+func writeMetadata(w io.Writer, flags int32, columns []result.Column, pagingState []byte) error {
+	global := len(columns) > 0
+	for _, c := range columns {
+		first := columns[0]
+		global = global && c.Keyspace == first.Keyspace && c.Table == first.Table
+	}
+	if global {
+		flags |= rowsGlobalTablesSpec
+	}
+
+	proto.WriteInt(w, flags)
+	proto.WriteInt(w, int32(len(columns)))
+
+	if pagingState != nil {
+		proto.WriteBytes(w, pagingState)
+	}
+
+	if flags&rowsNoMetadata != 0 {
+		return nil
+	}
+
+	if global {
+		proto.WriteString(w, columns[0].Keyspace)
+		proto.WriteString(w, columns[0].Table)
+	}
+
+	for _, c := range columns {
+		if !global {
+			proto.WriteString(w, c.Keyspace)
+			proto.WriteString(w, c.Table)
+		}
+		proto.WriteString(w, c.Name)
+		if err := types.WriteOption(w, c.Type); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeValue writes a [bytes] value, using a negative length for null.
+func writeValue(w io.Writer, value []byte) error {
+	if value == nil {
+		return proto.WriteInt(w, -1)
+	}
+	return proto.WriteBytes(w, value)
+}
+
+func writeSchemaChange(w io.Writer, sc result.SchemaChange) error {
+	proto.WriteString(w, sc.Change)
+	proto.WriteString(w, sc.Target)
+
+	if err := proto.WriteString(w, sc.Keyspace); err != nil {
+		return err
+	}
+
+	if sc.Target == result.TargetKeyspace {
+		return nil
+	}
+
+	if err := proto.WriteString(w, sc.Name); err != nil {
+		return err
+	}
+
+	if sc.Target == result.TargetFunction || sc.Target == result.TargetAggregate {
+		proto.WriteShort(w, uint16(len(sc.Args)))
+		for _, a := range sc.Args {
+			if err := proto.WriteString(w, a); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ErrResponse answers request with err, which is reported as a server
+// error unless it is a *proto.Error, a *proto.AlreadyExistsError or a
+// *proto.FunctionFailureError.
+func ErrResponse(request proto.Frame, err error) proto.Frame {
+	switch e := err.(type) {
+	case *proto.Error:
+		return ErrorResponse(request, e.Code, e.Message)
+	case *proto.AlreadyExistsError:
+		return AlreadyExistsResponse(request, e.Error(), e.Keyspace, e.Table)
+	case *proto.FunctionFailureError:
+		// FUNCTION_FAILURE was introduced with v4. Like Cassandra, report
+		// failed functions as invalid requests to v3 clients.
+		return ErrorResponse(request, proto.ErrInvalid, e.Message)
+	}
+	return ErrorResponse(request, proto.ErrServer, err.Error())
+}
+
+func ErrorResponse(request proto.Frame, code proto.ErrorCode, message string) proto.Frame {
+	buf := new(bytes.Buffer)
+	proto.WriteBinary(buf, code)
+	proto.WriteString(buf, message)
+
+	return newResponse(request, proto.OpError, buf.Bytes())
+}
+
+// ProtocolErrorResponse returns a PROTOCOL_ERROR for a request that could
+// not be framed, e.g. because of its protocol version.
+func ProtocolErrorResponse(streamID uint16, message string) proto.Frame {
+	return ErrorResponse(&frame{header: header{StreamID: streamID}}, proto.ErrProtocol, message)
+}
+
+// UnpreparedResponse answers an EXECUTE or BATCH request for a statement
+// that has not been prepared.
+func UnpreparedResponse(request proto.Frame, id []byte) proto.Frame {
+	buf := new(bytes.Buffer)
+	proto.WriteBinary(buf, proto.ErrUnprepared)
+	proto.WriteString(buf, fmt.Sprintf("Prepared query with ID %x not found", id))
+	proto.WriteShortBytes(buf, id)
+
+	return newResponse(request, proto.OpError, buf.Bytes())
+}
+
+func AlreadyExistsResponse(request proto.Frame, message, keyspace, table string) proto.Frame {
+	buf := new(bytes.Buffer)
+	proto.WriteBinary(buf, proto.ErrAlreadyExists)
+	proto.WriteString(buf, message)
+	proto.WriteString(buf, keyspace)
+	proto.WriteString(buf, table)
+
+	return newResponse(request, proto.OpError, buf.Bytes())
+}
+
+func UnavailableResponse(request proto.Frame, message string, cl proto.Consistency, required, alive int32) proto.Frame {
+	buf := new(bytes.Buffer)
+	proto.WriteBinary(buf, proto.ErrUnavailable)
+	proto.WriteString(buf, message)
+	proto.WriteBinary(buf, cl)
+	proto.WriteInt(buf, required)
+	proto.WriteInt(buf, alive)
+
+	return newResponse(request, proto.OpError, buf.Bytes())
+}
+
+func WriteTimeoutResponse(request proto.Frame, message string, cl proto.Consistency, received, blockFor int32, writeType string) proto.Frame {
+	buf := new(bytes.Buffer)
+	proto.WriteBinary(buf, proto.ErrWriteTimeout)
+	proto.WriteString(buf, message)
+	proto.WriteBinary(buf, cl)
+	proto.WriteInt(buf, received)
+	proto.WriteInt(buf, blockFor)
+	proto.WriteString(buf, writeType)
+
+	return newResponse(request, proto.OpError, buf.Bytes())
+}
+
+func ReadTimeoutResponse(request proto.Frame, message string, cl proto.Consistency, received, blockFor int32, dataPresent bool) proto.Frame {
+	buf := new(bytes.Buffer)
+	proto.WriteBinary(buf, proto.ErrReadTimeout)
+	proto.WriteString(buf, message)
+	proto.WriteBinary(buf, cl)
+	proto.WriteInt(buf, received)
+	proto.WriteInt(buf, blockFor)
+	proto.WriteBinary(buf, dataPresent)
+
+	return newResponse(request, proto.OpError, buf.Bytes())
+}
+
+func newResponse(request proto.Frame, opcode proto.Opcode, body []byte) proto.Frame {
 	hdr := header{
-		Opcode:   proto.OpResult,
+		Opcode:   opcode,
 		StreamID: request.StreamID(),
-		Length:   uint32(buf.Len()),
+		Length:   uint32(len(body)),
 	}
 
 	return &frame{
 		versionDir: proto.VersionDir(Version) | response,
 		header:     hdr,
-		body:       buf.Bytes(),
+		body:       body,
 	}
 }
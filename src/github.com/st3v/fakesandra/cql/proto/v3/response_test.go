@@ -0,0 +1,152 @@
+package v3
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+var _ = Describe("ErrorResponse", func() {
+	var (
+		req  proto.Frame
+		resp proto.Frame
+	)
+
+	BeforeEach(func() {
+		req = &frame{header: header{StreamID: 42, Opcode: proto.OpQuery}}
+		resp = ErrorResponse(req, proto.ErrInvalid, "some message")
+	})
+
+	It("answers on the stream of the request", func() {
+		Expect(resp.StreamID()).To(Equal(uint16(42)))
+		Expect(resp.Response()).To(BeTrue())
+		Expect(resp.Opcode()).To(Equal(proto.OpError))
+	})
+
+	It("writes error code and message", func() {
+		r := bytes.NewReader(resp.Body())
+
+		var code int32
+		Expect(proto.ReadInt(r, &code)).To(Succeed())
+		Expect(proto.ErrorCode(code)).To(Equal(proto.ErrInvalid))
+
+		msg, err := proto.ReadString(r)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(msg).To(Equal("some message"))
+		Expect(r.Len()).To(BeZero())
+	})
+})
+
+var _ = Describe("ProtocolErrorResponse", func() {
+	It("answers on the given stream", func() {
+		resp := ProtocolErrorResponse(7, "Invalid or unsupported protocol version (5); supported versions are (3/v3)")
+		Expect(resp.StreamID()).To(Equal(uint16(7)))
+		Expect(resp.Version()).To(Equal(Version))
+		Expect(resp.Opcode()).To(Equal(proto.OpError))
+
+		r := bytes.NewReader(resp.Body())
+
+		var code int32
+		Expect(proto.ReadInt(r, &code)).To(Succeed())
+		Expect(proto.ErrorCode(code)).To(Equal(proto.ErrProtocol))
+
+		msg, err := proto.ReadString(r)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(msg).To(Equal("Invalid or unsupported protocol version (5); supported versions are (3/v3)"))
+	})
+})
+
+var _ = Describe("ErrResponse", func() {
+	It("writes keyspace and table of AlreadyExists errors", func() {
+		req := &frame{header: header{StreamID: 42, Opcode: proto.OpQuery}}
+		resp := ErrResponse(req, &proto.AlreadyExistsError{Keyspace: "ks", Table: "t"})
+		r := bytes.NewReader(resp.Body())
+
+		var code int32
+		Expect(proto.ReadInt(r, &code)).To(Succeed())
+		Expect(proto.ErrorCode(code)).To(Equal(proto.ErrAlreadyExists))
+
+		for _, expected := range []string{`Cannot add already existing table "t" to keyspace "ks"`, "ks", "t"} {
+			s, err := proto.ReadString(r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(Equal(expected))
+		}
+		Expect(r.Len()).To(BeZero())
+	})
+
+	It("reports function failures as invalid requests", func() {
+		req := &frame{header: header{StreamID: 42, Opcode: proto.OpQuery}}
+		resp := ErrResponse(req, &proto.FunctionFailureError{Keyspace: "ks", Function: "f", ArgTypes: []string{"int"}, Message: "boom"})
+		r := bytes.NewReader(resp.Body())
+
+		var code int32
+		Expect(proto.ReadInt(r, &code)).To(Succeed())
+		Expect(proto.ErrorCode(code)).To(Equal(proto.ErrInvalid))
+
+		msg, err := proto.ReadString(r)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(msg).To(Equal("boom"))
+		Expect(r.Len()).To(BeZero())
+	})
+})
+
+var _ = Describe("ResultResponse", func() {
+	var req proto.Frame
+
+	BeforeEach(func() {
+		req = &frame{header: header{StreamID: 7, Opcode: proto.OpQuery}}
+	})
+
+	It("encodes rows with global table spec", func() {
+		rows := &result.Rows{
+			Columns: []result.Column{
+				{Keyspace: "ks", Table: "t", Name: "id", Type: types.Native(types.Int)},
+				{Keyspace: "ks", Table: "t", Name: "tags", Type: types.SetOf(types.Native(types.Varchar))},
+			},
+			Data: [][][]byte{{{0, 0, 0, 1}, nil}},
+		}
+
+		r := bytes.NewReader(ResultResponse(req, rows).Body())
+
+		var kind, flags, count int32
+		Expect(proto.ReadInt(r, &kind)).To(Succeed())
+		Expect(ResultCode(kind)).To(Equal(ResultRows))
+		Expect(proto.ReadInt(r, &flags)).To(Succeed())
+		Expect(flags).To(Equal(int32(1)))
+		Expect(proto.ReadInt(r, &count)).To(Succeed())
+		Expect(count).To(Equal(int32(2)))
+
+		for _, expected := range []string{"ks", "t", "id"} {
+			Expect(proto.ReadString(r)).To(Equal(expected))
+		}
+		Expect(types.ReadOption(r)).To(Equal(types.Native(types.Int)))
+		Expect(proto.ReadString(r)).To(Equal("tags"))
+		Expect(types.ReadOption(r)).To(Equal(types.SetOf(types.Native(types.Varchar))))
+
+		Expect(proto.ReadInt(r, &count)).To(Succeed())
+		Expect(count).To(Equal(int32(1)))
+		Expect(proto.ReadBytes(r)).To(Equal([]byte{0, 0, 0, 1}))
+
+		var null int32
+		Expect(proto.ReadInt(r, &null)).To(Succeed())
+		Expect(null).To(Equal(int32(-1)))
+		Expect(r.Len()).To(BeZero())
+	})
+
+	It("encodes schema changes", func() {
+		sc := result.SchemaChange{Change: result.Created, Target: result.TargetTable, Keyspace: "ks", Name: "t"}
+		r := bytes.NewReader(ResultResponse(req, sc).Body())
+
+		var kind int32
+		Expect(proto.ReadInt(r, &kind)).To(Succeed())
+		Expect(ResultCode(kind)).To(Equal(ResultSchemaChange))
+		for _, expected := range []string{"CREATED", "TABLE", "ks", "t"} {
+			Expect(proto.ReadString(r)).To(Equal(expected))
+		}
+		Expect(r.Len()).To(BeZero())
+	})
+})
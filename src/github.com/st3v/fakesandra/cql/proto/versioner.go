@@ -1,6 +1,12 @@
 package proto
 
-import "io"
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
 
 // VersionDir represents the version AND direction of a CQL frame.
 type VersionDir uint8
@@ -9,6 +15,26 @@ const (
 	directionMask VersionDir = 0x80
 )
 
+// UnsupportedVersionError is returned by a versioner for request frames of
+// a protocol version it has no framer for. The frame has been discarded.
+type UnsupportedVersionError struct {
+	Version  Version
+	StreamID uint16
+
+	// Supported lists the offered request versions the versioner has
+	// framers for.
+	Supported []Version
+}
+
+// Error returns the message Cassandra 3.x answers such frames with.
+func (e *UnsupportedVersionError) Error() string {
+	supported := make([]string, len(e.Supported))
+	for i, v := range e.Supported {
+		supported[i] = fmt.Sprintf("%d/v%d", v, v)
+	}
+	return fmt.Sprintf("Invalid or unsupported protocol version (%d); supported versions are (%s)", e.Version, strings.Join(supported, ", "))
+}
+
 type versioner struct {
 	framers map[VersionDir]Framer
 }
@@ -20,12 +46,21 @@ func NewVersioner() *versioner {
 }
 
 func (v *versioner) Version(in io.Reader) (Framer, error) {
+	return v.Negotiate(in, v.versions())
+}
+
+// Negotiate is like Version but rejects request frames of versions that are
+// not offered.
+func (v *versioner) Negotiate(in io.Reader, offered []Version) (Framer, error) {
 	var version VersionDir
 	if err := readVersionDir(in, &version); err != nil {
 		return nil, err
 	}
 
 	framer, found := v.framers[version]
+	if version&directionMask == 0 && (!found || !contains(offered, Version(version))) {
+		return nil, v.reject(in, Version(version), offered)
+	}
 	if !found {
 		return nil, errUnsupportedProtocolVersion
 	}
@@ -33,6 +68,67 @@ func (v *versioner) Version(in io.Reader) (Framer, error) {
 	return framer, nil
 }
 
+func contains(versions []Version, version Version) bool {
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// reject discards the rest of a request frame of an unsupported version.
+// The header of protocol versions 1 and 2 has a single byte stream ID, later
+// versions use two bytes.
+func (v *versioner) reject(in io.Reader, version Version, offered []Version) error {
+	var hdr struct {
+		Flags    uint8
+		StreamID uint16
+		Opcode   uint8
+		Length   uint32
+	}
+
+	if version < Version3 {
+		var short struct {
+			Flags    uint8
+			StreamID uint8
+			Opcode   uint8
+			Length   uint32
+		}
+		if err := ReadBinary(in, &short); err != nil {
+			return err
+		}
+		hdr.StreamID, hdr.Length = uint16(short.StreamID), short.Length
+	} else if err := ReadBinary(in, &hdr); err != nil {
+		return err
+	}
+
+	if _, err := io.CopyN(ioutil.Discard, in, int64(hdr.Length)); err != nil {
+		return err
+	}
+
+	supported := []Version{}
+	for _, s := range v.versions() {
+		if contains(offered, s) {
+			supported = append(supported, s)
+		}
+	}
+
+	return &UnsupportedVersionError{Version: version, StreamID: hdr.StreamID, Supported: supported}
+}
+
+// versions returns the request versions with a framer in ascending order.
+func (v *versioner) versions() []Version {
+	versions := []Version{}
+	for vd := range v.framers {
+		if vd&directionMask == 0 {
+			versions = append(versions, Version(vd))
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions
+}
+
 func (v *versioner) SetRequestFramer(version Version, framer Framer) {
 	v.framers[VersionDir(version)] = framer
 }
@@ -0,0 +1,85 @@
+// Package result describes the results of CQL queries independent of the
+// protocol version used to send them to the client.
+package result
+
+import "github.com/st3v/fakesandra/cql/types"
+
+// Result is one of Void, Rows, SetKeyspace or SchemaChange.
+type Result interface {
+	result()
+}
+
+// Void is the result of queries that do not return anything.
+type Void struct{}
+
+func (Void) result() {}
+
+// Column describes a column of a Rows result.
+type Column struct {
+	Keyspace string
+	Table    string
+	Name     string
+	Type     types.Type
+}
+
+// Rows is the result of SELECT queries and conditional updates. Data holds
+// the encoded values of each row, one per column. Null values are nil.
+type Rows struct {
+	Columns []Column
+	Data    [][][]byte
+
+	// PagingState is set if there are more pages to fetch.
+	PagingState []byte
+
+	// NoMetadata omits the column specifications, e.g. if the client asked
+	// to skip them.
+	NoMetadata bool
+}
+
+func (*Rows) result() {}
+
+// Prepared describes a prepared statement: the bind variables it takes, in
+// the order of their markers, and the columns of the rows it returns.
+// Columns is nil for statements that do not return rows.
+type Prepared struct {
+	Variables []Column
+	Columns   []Column
+}
+
+// SetKeyspace is the result of USE queries.
+type SetKeyspace struct {
+	Keyspace string
+}
+
+func (SetKeyspace) result() {}
+
+// Kinds of schema changes.
+const (
+	Created = "CREATED"
+	Updated = "UPDATED"
+	Dropped = "DROPPED"
+)
+
+// Targets of schema changes.
+const (
+	TargetKeyspace  = "KEYSPACE"
+	TargetTable     = "TABLE"
+	TargetType      = "TYPE"
+	TargetFunction  = "FUNCTION"
+	TargetAggregate = "AGGREGATE"
+)
+
+// SchemaChange is the result of DDL queries.
+type SchemaChange struct {
+	Change   string
+	Target   string
+	Keyspace string
+
+	// Name of the table, type, function or aggregate. Empty for keyspaces.
+	Name string
+
+	// Argument types of functions and aggregates.
+	Args []string
+}
+
+func (SchemaChange) result() {}
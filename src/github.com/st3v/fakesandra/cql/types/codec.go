@@ -0,0 +1,897 @@
+package types
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/inf.v0"
+)
+
+// DurationValue is the value of the duration type.
+type DurationValue struct {
+	Months      int32
+	Days        int32
+	Nanoseconds int64
+}
+
+// Pair is a key-value pair of a map.
+type Pair struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// epochDay is the value of the date type that represents 1970-01-01.
+const epochDay = 1 << 31
+
+// Marshal encodes v as a value of type t. A nil v is encoded as null. Apart
+// from the types returned by Unmarshal, Marshal accepts any Go integer and
+// float as well as the string representations Cassandra accepts for uuids,
+// timestamps, dates, times, inet addresses, decimals and varints.
+func Marshal(t Type, v interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	switch t.ID {
+	case Ascii, Varchar:
+		switch s := v.(type) {
+		case string:
+			if t.ID == Ascii {
+				for _, c := range []byte(s) {
+					if c > 127 {
+						return nil, fmt.Errorf("Invalid byte for ascii: %d", c)
+					}
+				}
+			}
+			return []byte(s), nil
+		case []byte:
+			return s, nil
+		}
+	case Blob, Custom:
+		switch b := v.(type) {
+		case []byte:
+			return b, nil
+		case string:
+			return parseBlob(b)
+		}
+	case Boolean:
+		if b, ok := v.(bool); ok {
+			if b {
+				return []byte{1}, nil
+			}
+			return []byte{0}, nil
+		}
+	case Bigint, Counter:
+		if n, err := toInt(v, 64); err == nil {
+			return encodeInt(n, 8), nil
+		} else if err != errNotInteger {
+			return nil, err
+		}
+	case Int:
+		if n, err := toInt(v, 32); err == nil {
+			return encodeInt(n, 4), nil
+		} else if err != errNotInteger {
+			return nil, err
+		}
+	case Smallint:
+		if n, err := toInt(v, 16); err == nil {
+			return encodeInt(n, 2), nil
+		} else if err != errNotInteger {
+			return nil, err
+		}
+	case Tinyint:
+		if n, err := toInt(v, 8); err == nil {
+			return encodeInt(n, 1), nil
+		} else if err != errNotInteger {
+			return nil, err
+		}
+	case Double:
+		if f, ok := toFloat(v); ok {
+			return encodeInt(int64(math.Float64bits(f)), 8), nil
+		}
+	case Float:
+		if f, ok := toFloat(v); ok {
+			return encodeInt(int64(math.Float32bits(float32(f))), 4), nil
+		}
+	case Varint:
+		if n, ok := toBigInt(v); ok {
+			return encodeVarint(n), nil
+		}
+	case Decimal:
+		if d, ok := toDecimal(v); ok {
+			buf := encodeInt(int64(d.Scale()), 4)
+			return append(buf, encodeVarint(d.UnscaledBig())...), nil
+		}
+	case Timestamp:
+		if ts, err := toTimestamp(v); err == nil {
+			return encodeInt(ts, 8), nil
+		} else if err != errNotTimestamp {
+			return nil, err
+		}
+	case Date:
+		if days, err := toDate(v); err == nil {
+			return encodeInt(days+epochDay, 4), nil
+		} else if err != errNotTimestamp {
+			return nil, err
+		}
+	case Time:
+		if ns, err := toTime(v); err == nil {
+			return encodeInt(ns, 8), nil
+		} else if err != errNotTimestamp {
+			return nil, err
+		}
+	case Uuid, Timeuuid:
+		u, err := toUUID(v)
+		if err != nil {
+			return nil, err
+		}
+		if t.ID == Timeuuid && u.Version() != 1 {
+			return nil, fmt.Errorf("Unsupported UUID version %d for timeuuid", u.Version())
+		}
+		return u[:], nil
+	case Inet:
+		if ip, ok := toIP(v); ok {
+			if ip4 := ip.To4(); ip4 != nil {
+				return []byte(ip4), nil
+			}
+			return []byte(ip.To16()), nil
+		}
+	case Duration:
+		if str, ok := v.(string); ok {
+			var err error
+			if v, err = ParseDuration(str); err != nil {
+				return nil, err
+			}
+		}
+		if d, ok := v.(DurationValue); ok {
+			buf := appendVint(nil, int64(d.Months))
+			buf = appendVint(buf, int64(d.Days))
+			return appendVint(buf, d.Nanoseconds), nil
+		}
+	case List, Set:
+		elems, ok := toSlice(v)
+		if !ok {
+			break
+		}
+		encoded := make([][]byte, len(elems))
+		for i, e := range elems {
+			var err error
+			if encoded[i], err = marshalElem(t.Elems[0], e); err != nil {
+				return nil, err
+			}
+		}
+		if t.ID == Set {
+			encoded = sortUnique(t.Elems[0], encoded)
+		}
+		return encodeCollection(encoded), nil
+	case Map:
+		pairs, ok := toPairs(v)
+		if !ok {
+			break
+		}
+		keys := make([][]byte, len(pairs))
+		values := map[string][]byte{}
+		for i, p := range pairs {
+			var err error
+			if keys[i], err = marshalElem(t.Elems[0], p.Key); err != nil {
+				return nil, err
+			}
+			if values[string(keys[i])], err = marshalElem(t.Elems[1], p.Value); err != nil {
+				return nil, err
+			}
+		}
+		keys = sortUnique(t.Elems[0], keys)
+		encoded := [][]byte{}
+		for _, k := range keys {
+			encoded = append(encoded, k, values[string(k)])
+		}
+		buf := encodeInt(int64(len(keys)), 4)
+		for _, e := range encoded {
+			buf = append(buf, encodeBytes(e)...)
+		}
+		return buf, nil
+	case Tuple:
+		elems, ok := toSlice(v)
+		if !ok {
+			break
+		}
+		if len(elems) > len(t.Elems) {
+			return nil, fmt.Errorf("Invalid tuple literal: too many elements. Type %s expects %d but got %d", t, len(t.Elems), len(elems))
+		}
+		return marshalComponents(t.Elems, elems)
+	case UDT:
+		fields, err := toFields(t, v)
+		if err != nil {
+			return nil, err
+		}
+		return marshalComponents(t.Elems, fields)
+	}
+
+	return nil, fmt.Errorf("Cannot marshal %T into %s", v, t)
+}
+
+func marshalElem(t Type, v interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, fmt.Errorf("null is not supported inside collections")
+	}
+	return Marshal(t, v)
+}
+
+func marshalComponents(types []Type, values []interface{}) ([]byte, error) {
+	buf := []byte{}
+	for i, t := range types {
+		var v interface{}
+		if i < len(values) {
+			v = values[i]
+		}
+
+		b, err := Marshal(t, v)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, encodeBytes(b)...)
+	}
+	return buf, nil
+}
+
+// Unmarshal decodes b as a value of type t. Null values are returned as
+// nil. Values are decoded into string, []byte, bool, int64, int32, int16,
+// int8, float64, float32, *big.Int, *inf.Dec, time.Time (timestamp and
+// date), time.Duration (time), UUID, net.IP, DurationValue, []interface{}
+// (list, set and tuple), []Pair (map) and map[string]interface{} (UDT).
+func Unmarshal(t Type, b []byte) (interface{}, error) {
+	if b == nil {
+		return nil, nil
+	}
+
+	fixed := func(n int) error {
+		if len(b) != n {
+			return fmt.Errorf("Expected %d bytes for %s but got %d", n, t, len(b))
+		}
+		return nil
+	}
+
+	switch t.ID {
+	case Ascii, Varchar:
+		return string(b), nil
+	case Blob, Custom:
+		return append([]byte{}, b...), nil
+	case Boolean:
+		if err := fixed(1); err != nil {
+			return nil, err
+		}
+		return b[0] != 0, nil
+	case Bigint, Counter:
+		if err := fixed(8); err != nil {
+			return nil, err
+		}
+		return int64(binary.BigEndian.Uint64(b)), nil
+	case Int:
+		if err := fixed(4); err != nil {
+			return nil, err
+		}
+		return int32(binary.BigEndian.Uint32(b)), nil
+	case Smallint:
+		if err := fixed(2); err != nil {
+			return nil, err
+		}
+		return int16(binary.BigEndian.Uint16(b)), nil
+	case Tinyint:
+		if err := fixed(1); err != nil {
+			return nil, err
+		}
+		return int8(b[0]), nil
+	case Double:
+		if err := fixed(8); err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case Float:
+		if err := fixed(4); err != nil {
+			return nil, err
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), nil
+	case Varint:
+		return decodeVarint(b), nil
+	case Decimal:
+		if len(b) < 4 {
+			return nil, fmt.Errorf("Expected at least 4 bytes for decimal but got %d", len(b))
+		}
+		scale := int32(binary.BigEndian.Uint32(b))
+		return inf.NewDecBig(decodeVarint(b[4:]), inf.Scale(scale)), nil
+	case Timestamp:
+		if err := fixed(8); err != nil {
+			return nil, err
+		}
+		ms := int64(binary.BigEndian.Uint64(b))
+		return time.Unix(0, 0).Add(time.Duration(ms) * time.Millisecond).UTC(), nil
+	case Date:
+		if err := fixed(4); err != nil {
+			return nil, err
+		}
+		days := int64(binary.BigEndian.Uint32(b)) - epochDay
+		return time.Unix(days*86400, 0).UTC(), nil
+	case Time:
+		if err := fixed(8); err != nil {
+			return nil, err
+		}
+		return time.Duration(binary.BigEndian.Uint64(b)), nil
+	case Uuid, Timeuuid:
+		if err := fixed(16); err != nil {
+			return nil, err
+		}
+		var u UUID
+		copy(u[:], b)
+		return u, nil
+	case Inet:
+		if len(b) != 4 && len(b) != 16 {
+			return nil, fmt.Errorf("Invalid inet address of %d bytes", len(b))
+		}
+		return net.IP(append([]byte{}, b...)), nil
+	case Duration:
+		r := bytes.NewReader(b)
+		months, err := readVint(r)
+		if err != nil {
+			return nil, err
+		}
+		days, err := readVint(r)
+		if err != nil {
+			return nil, err
+		}
+		nanos, err := readVint(r)
+		if err != nil {
+			return nil, err
+		}
+		return DurationValue{int32(months), int32(days), nanos}, nil
+	case List, Set:
+		elems, err := SplitCollection(b)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, len(elems))
+		for i, e := range elems {
+			if values[i], err = Unmarshal(t.Elems[0], e); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	case Map:
+		elems, err := SplitCollection(b)
+		if err != nil {
+			return nil, err
+		}
+		pairs := make([]Pair, len(elems)/2)
+		for i := range pairs {
+			if pairs[i].Key, err = Unmarshal(t.Elems[0], elems[2*i]); err != nil {
+				return nil, err
+			}
+			if pairs[i].Value, err = Unmarshal(t.Elems[1], elems[2*i+1]); err != nil {
+				return nil, err
+			}
+		}
+		return pairs, nil
+	case Tuple, UDT:
+		components, err := SplitComponents(b, len(t.Elems))
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, len(t.Elems))
+		for i, c := range components {
+			if values[i], err = Unmarshal(t.Elems[i], c); err != nil {
+				return nil, err
+			}
+		}
+		if t.ID == Tuple {
+			return values, nil
+		}
+		fields := map[string]interface{}{}
+		for i, f := range t.Fields {
+			fields[f] = values[i]
+		}
+		return fields, nil
+	}
+
+	return nil, fmt.Errorf("Cannot unmarshal %s", t)
+}
+
+// SplitCollection splits an encoded list, set or map into its elements.
+// Maps are returned as alternating keys and values.
+func SplitCollection(b []byte) ([][]byte, error) {
+	if len(b) < 4 {
+		return nil, fmt.Errorf("Invalid collection of %d bytes", len(b))
+	}
+
+	n := int(int32(binary.BigEndian.Uint32(b)))
+	b = b[4:]
+
+	elems := [][]byte{}
+	for len(b) > 0 {
+		e, rest, err := splitBytes(b)
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, e)
+		b = rest
+	}
+
+	if len(elems) != n && len(elems) != 2*n {
+		return nil, fmt.Errorf("Invalid collection: expected %d elements but got %d", n, len(elems))
+	}
+
+	return elems, nil
+}
+
+// SplitComponents splits an encoded tuple or UDT into n components. Missing
+// trailing components are returned as null.
+func SplitComponents(b []byte, n int) ([][]byte, error) {
+	components := make([][]byte, n)
+	for i := 0; i < n && len(b) > 0; i++ {
+		var err error
+		if components[i], b, err = splitBytes(b); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(b) > 0 {
+		return nil, fmt.Errorf("Invalid value: %d unexpected trailing bytes", len(b))
+	}
+
+	return components, nil
+}
+
+// JoinCollection encodes the given elements as a list, set or map. Maps
+// are expected as alternating keys and values.
+func JoinCollection(elems [][]byte, n int) []byte {
+	buf := encodeInt(int64(n), 4)
+	for _, e := range elems {
+		buf = append(buf, encodeBytes(e)...)
+	}
+	return buf
+}
+
+// JoinComponents encodes the given components as a tuple or UDT.
+func JoinComponents(components [][]byte) []byte {
+	buf := []byte{}
+	for _, c := range components {
+		buf = append(buf, encodeBytes(c)...)
+	}
+	return buf
+}
+
+func splitBytes(b []byte) ([]byte, []byte, error) {
+	if len(b) < 4 {
+		return nil, nil, fmt.Errorf("Invalid value: truncated length")
+	}
+
+	n := int(int32(binary.BigEndian.Uint32(b)))
+	b = b[4:]
+	if n < 0 {
+		return nil, b, nil
+	}
+
+	if n > len(b) {
+		return nil, nil, fmt.Errorf("Invalid value: expected %d bytes but got %d", n, len(b))
+	}
+
+	return b[:n], b[n:], nil
+}
+
+func encodeCollection(elems [][]byte) []byte {
+	return JoinCollection(elems, len(elems))
+}
+
+func encodeBytes(b []byte) []byte {
+	if b == nil {
+		return encodeInt(-1, 4)
+	}
+	return append(encodeInt(int64(len(b)), 4), b...)
+}
+
+func encodeInt(n int64, size int) []byte {
+	b := make([]byte, size)
+	for i := size - 1; i >= 0; i-- {
+		b[i] = byte(n)
+		n >>= 8
+	}
+	return b
+}
+
+// encodeVarint returns the two's complement big-endian representation of n
+// using the minimum number of bytes.
+func encodeVarint(n *big.Int) []byte {
+	switch n.Sign() {
+	case 0:
+		return []byte{0}
+	case 1:
+		b := n.Bytes()
+		if b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+		return b
+	}
+
+	// two's complement of a negative number
+	bitLen := n.BitLen()/8*8 + 8
+	twos := new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), uint(bitLen)), n)
+	b := twos.Bytes()
+	for len(b) > 1 && b[0] == 0xFF && b[1]&0x80 != 0 {
+		b = b[1:]
+	}
+	return b
+}
+
+func decodeVarint(b []byte) *big.Int {
+	n := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(len(b)*8)))
+	}
+	return n
+}
+
+// appendVint appends n as a zig-zag encoded variable length integer.
+func appendVint(b []byte, n int64) []byte {
+	u := uint64(n>>63) ^ uint64(n<<1)
+
+	size := 1
+	for size < 9 && u >= 1<<uint(7*size) {
+		size++
+	}
+
+	if size == 9 {
+		b = append(b, 0xFF)
+		return append(b, encodeInt(int64(u), 8)...)
+	}
+
+	enc := encodeInt(int64(u), size)
+	enc[0] |= ^byte(0xFF >> uint(size-1))
+	return append(b, enc...)
+}
+
+func readVint(r *bytes.Reader) (int64, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, fmt.Errorf("Invalid duration: %s", err)
+	}
+
+	extra := 0
+	for extra < 8 && first&(0x80>>uint(extra)) != 0 {
+		extra++
+	}
+
+	u := uint64(first & (0xFF >> uint(extra+1)))
+	if extra == 8 {
+		u = 0
+	}
+
+	for i := 0; i < extra; i++ {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, fmt.Errorf("Invalid duration: %s", err)
+		}
+		u = u<<8 | uint64(c)
+	}
+
+	return int64(u>>1) ^ -int64(u&1), nil
+}
+
+func sortUnique(t Type, elems [][]byte) [][]byte {
+	sort.SliceStable(elems, func(i, j int) bool {
+		return Compare(t, elems[i], elems[j]) < 0
+	})
+
+	unique := [][]byte{}
+	for i, e := range elems {
+		if i == 0 || Compare(t, elems[i-1], e) != 0 {
+			unique = append(unique, e)
+		}
+	}
+	return unique
+}
+
+var (
+	errNotInteger   = fmt.Errorf("not an integer")
+	errNotTimestamp = fmt.Errorf("not a timestamp")
+)
+
+func toInt(v interface{}, bits uint) (int64, error) {
+	var n int64
+
+	switch x := v.(type) {
+	case int:
+		n = int64(x)
+	case int8:
+		n = int64(x)
+	case int16:
+		n = int64(x)
+	case int32:
+		n = int64(x)
+	case int64:
+		n = x
+	case uint8:
+		n = int64(x)
+	case uint16:
+		n = int64(x)
+	case uint32:
+		n = int64(x)
+	case uint:
+		n = int64(x)
+	case uint64:
+		if x > math.MaxInt64 {
+			return 0, fmt.Errorf("Value %d out of range for %d bit integer", x, bits)
+		}
+		n = int64(x)
+	case float64:
+		if x != math.Trunc(x) {
+			return 0, errNotInteger
+		}
+		n = int64(x)
+	case *big.Int:
+		if !x.IsInt64() {
+			return 0, fmt.Errorf("Value %s out of range for %d bit integer", x, bits)
+		}
+		n = x.Int64()
+	case json.Number:
+		i, err := x.Int64()
+		if err != nil {
+			return 0, errNotInteger
+		}
+		n = i
+	default:
+		return 0, errNotInteger
+	}
+
+	if bits < 64 {
+		max := int64(1)<<(bits-1) - 1
+		if n > max || n < -max-1 {
+			return 0, fmt.Errorf("Value %d out of range for %d bit integer", n, bits)
+		}
+	}
+
+	return n, nil
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case float32:
+		return float64(x), true
+	case json.Number:
+		f, err := x.Float64()
+		return f, err == nil
+	case *inf.Dec:
+		f, ok := new(big.Float).SetString(x.String())
+		if !ok {
+			return 0, false
+		}
+		r, _ := f.Float64()
+		return r, true
+	}
+
+	if n, err := toInt(v, 64); err == nil {
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func toBigInt(v interface{}) (*big.Int, bool) {
+	switch x := v.(type) {
+	case *big.Int:
+		return x, true
+	case string:
+		return new(big.Int).SetString(x, 10)
+	case json.Number:
+		return new(big.Int).SetString(string(x), 10)
+	}
+
+	if n, err := toInt(v, 64); err == nil {
+		return big.NewInt(n), true
+	}
+	return nil, false
+}
+
+func toDecimal(v interface{}) (*inf.Dec, bool) {
+	switch x := v.(type) {
+	case *inf.Dec:
+		return x, true
+	case string:
+		return new(inf.Dec).SetString(x)
+	case json.Number:
+		return new(inf.Dec).SetString(string(x))
+	case float64:
+		return new(inf.Dec).SetString(fmt.Sprint(x))
+	case float32:
+		return new(inf.Dec).SetString(fmt.Sprint(x))
+	case *big.Int:
+		return inf.NewDecBig(x, 0), true
+	}
+
+	if n, err := toInt(v, 64); err == nil {
+		return inf.NewDec(n, 0), true
+	}
+	return nil, false
+}
+
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999Z0700",
+	"2006-01-02 15:04:05.999Z07:00",
+	"2006-01-02 15:04:05.999",
+	"2006-01-02T15:04:05.999",
+	"2006-01-02 15:04Z0700",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func toTimestamp(v interface{}) (int64, error) {
+	switch x := v.(type) {
+	case time.Time:
+		return x.UnixNano() / int64(time.Millisecond), nil
+	case string:
+		for _, layout := range timestampLayouts {
+			if t, err := time.Parse(layout, x); err == nil {
+				return t.UnixNano() / int64(time.Millisecond), nil
+			}
+		}
+		return 0, fmt.Errorf("Unable to coerce '%s' to a formatted date (long)", x)
+	}
+
+	n, err := toInt(v, 64)
+	if err != nil {
+		return 0, errNotTimestamp
+	}
+	return n, nil
+}
+
+func toDate(v interface{}) (int64, error) {
+	switch x := v.(type) {
+	case time.Time:
+		return floorDiv(x.Unix(), 86400), nil
+	case string:
+		t, err := time.Parse("2006-01-02", x)
+		if err != nil {
+			return 0, fmt.Errorf("Unable to coerce '%s' to a formatted date (long)", x)
+		}
+		return floorDiv(t.Unix(), 86400), nil
+	}
+
+	n, err := toInt(v, 64)
+	if err != nil {
+		return 0, errNotTimestamp
+	}
+	return n - epochDay, nil
+}
+
+func toTime(v interface{}) (int64, error) {
+	switch x := v.(type) {
+	case time.Duration:
+		return int64(x), nil
+	case string:
+		t, err := time.Parse("15:04:05.999999999", x)
+		if err != nil {
+			return 0, fmt.Errorf("Unable to coerce '%s' to a formatted time (long)", x)
+		}
+		return int64(t.Sub(time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC))), nil
+	}
+
+	n, err := toInt(v, 64)
+	if err != nil {
+		return 0, errNotTimestamp
+	}
+	return n, nil
+}
+
+func toUUID(v interface{}) (UUID, error) {
+	switch x := v.(type) {
+	case UUID:
+		return x, nil
+	case [16]byte:
+		return UUID(x), nil
+	case string:
+		return ParseUUID(x)
+	}
+	return UUID{}, fmt.Errorf("Cannot marshal %T into uuid", v)
+}
+
+func toIP(v interface{}) (net.IP, bool) {
+	switch x := v.(type) {
+	case net.IP:
+		return x, true
+	case string:
+		ip := net.ParseIP(x)
+		return ip, ip != nil
+	}
+	return nil, false
+}
+
+func toSlice(v interface{}) ([]interface{}, bool) {
+	if s, ok := v.([]interface{}); ok {
+		return s, true
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+
+	s := make([]interface{}, rv.Len())
+	for i := range s {
+		s[i] = rv.Index(i).Interface()
+	}
+	return s, true
+}
+
+func toPairs(v interface{}) ([]Pair, bool) {
+	if p, ok := v.([]Pair); ok {
+		return p, true
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map {
+		return nil, false
+	}
+
+	pairs := []Pair{}
+	for _, k := range rv.MapKeys() {
+		pairs = append(pairs, Pair{k.Interface(), rv.MapIndex(k).Interface()})
+	}
+	return pairs, true
+}
+
+func toFields(t Type, v interface{}) ([]interface{}, error) {
+	if s, ok := toSlice(v); ok {
+		if len(s) > len(t.Elems) {
+			return nil, fmt.Errorf("Invalid user type literal for %s: too many fields", t.Name)
+		}
+		return s, nil
+	}
+
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Cannot marshal %T into %s", v, t)
+	}
+
+	index := map[string]int{}
+	for i, f := range t.Fields {
+		index[f] = i
+	}
+
+	fields := make([]interface{}, len(t.Fields))
+	for name, value := range m {
+		i, found := index[strings.ToLower(name)]
+		if !found {
+			return nil, fmt.Errorf("Unknown field '%s' in value of user defined type %s", name, t.Name)
+		}
+		fields[i] = value
+	}
+	return fields, nil
+}
+
+func parseBlob(s string) ([]byte, error) {
+	if !strings.HasPrefix(s, "0x") && !strings.HasPrefix(s, "0X") {
+		return nil, fmt.Errorf("Invalid blob %q, expected hex string starting with 0x", s)
+	}
+	b, err := hex.DecodeString(s[2:])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid blob %q: %s", s, err)
+	}
+	return b, nil
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
@@ -0,0 +1,127 @@
+package types_test
+
+import (
+	"math/big"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gopkg.in/inf.v0"
+
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+var _ = Describe("Codec", func() {
+	roundTrip := func(typ string, in interface{}) interface{} {
+		t := types.MustParse(typ)
+		b, err := types.Marshal(t, in)
+		Expect(err).ToNot(HaveOccurred())
+
+		out, err := types.Unmarshal(t, b)
+		Expect(err).ToNot(HaveOccurred())
+		return out
+	}
+
+	It("round-trips native values", func() {
+		Expect(roundTrip("int", 42)).To(Equal(int32(42)))
+		Expect(roundTrip("bigint", -1)).To(Equal(int64(-1)))
+		Expect(roundTrip("text", "foo")).To(Equal("foo"))
+		Expect(roundTrip("boolean", true)).To(Equal(true))
+		Expect(roundTrip("double", 1.5)).To(Equal(1.5))
+		Expect(roundTrip("blob", "0xcafe")).To(Equal([]byte{0xca, 0xfe}))
+		Expect(roundTrip("inet", "127.0.0.1")).To(Equal(net.IP{127, 0, 0, 1}))
+		Expect(roundTrip("timestamp", "2016-01-02T03:04:05Z")).To(Equal(time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)))
+		Expect(roundTrip("date", "1969-12-31")).To(Equal(time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC)))
+		Expect(roundTrip("decimal", "-12.345").(*inf.Dec).String()).To(Equal("-12.345"))
+		Expect(roundTrip("duration", types.DurationValue{Months: 1, Days: -2, Nanoseconds: 3000})).To(Equal(types.DurationValue{Months: 1, Days: -2, Nanoseconds: 3000}))
+	})
+
+	It("encodes varints with the minimum number of bytes", func() {
+		t := types.Native(types.Varint)
+		for n, expected := range map[int64][]byte{
+			0:    {0x00},
+			127:  {0x7F},
+			128:  {0x00, 0x80},
+			-1:   {0xFF},
+			-128: {0x80},
+			-129: {0xFF, 0x7F},
+		} {
+			b, err := types.Marshal(t, n)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b).To(Equal(expected))
+			out, err := types.Unmarshal(t, b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(out.(*big.Int).Cmp(big.NewInt(n))).To(BeZero())
+		}
+	})
+
+	It("rejects values out of range", func() {
+		_, err := types.Marshal(types.Native(types.Tinyint), 128)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("sorts and deduplicates sets", func() {
+		Expect(roundTrip("set<int>", []int{3, 1, 2, 1})).To(Equal([]interface{}{int32(1), int32(2), int32(3)}))
+	})
+
+	It("sorts maps by key", func() {
+		out := roundTrip("map<text, int>", map[string]int{"b": 2, "a": 1})
+		Expect(out).To(Equal([]types.Pair{{Key: "a", Value: int32(1)}, {Key: "b", Value: int32(2)}}))
+	})
+
+	It("round-trips user-defined types", func() {
+		t := types.UDTOf("ks", "address", []string{"street", "zip"}, []types.Type{
+			types.Native(types.Varchar),
+			types.Native(types.Int),
+		})
+
+		b, err := types.Marshal(t, map[string]interface{}{"street": "Main St"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(types.Unmarshal(t, b)).To(Equal(map[string]interface{}{"street": "Main St", "zip": nil}))
+	})
+})
+
+var _ = Describe("Compare", func() {
+	compare := func(typ string, a, b interface{}) int {
+		t := types.MustParse(typ)
+		x, err := types.Marshal(t, a)
+		Expect(err).ToNot(HaveOccurred())
+		y, err := types.Marshal(t, b)
+		Expect(err).ToNot(HaveOccurred())
+		return types.Compare(t, x, y)
+	}
+
+	It("compares signed integers numerically", func() {
+		Expect(compare("int", -1, 1)).To(BeNumerically("<", 0))
+		Expect(compare("bigint", 10, 9)).To(BeNumerically(">", 0))
+	})
+
+	It("compares text bytewise", func() {
+		Expect(compare("text", "a", "b")).To(BeNumerically("<", 0))
+	})
+
+	It("compares timeuuids by time", func() {
+		node := [6]byte{}
+		early := types.TimeUUID(time.Unix(100, 0), 0xFFF, node)
+		late := types.TimeUUID(time.Unix(200, 0), 0, node)
+		Expect(compare("timeuuid", early, late)).To(BeNumerically("<", 0))
+		Expect(early.Time()).To(Equal(time.Unix(100, 0).UTC()))
+	})
+})
+
+var _ = Describe("ParseDuration", func() {
+	It("parses unit and ISO 8601 formats", func() {
+		Expect(types.ParseDuration("1y2mo3w4d5h6m7s8ms")).To(Equal(types.DurationValue{
+			Months:      14,
+			Days:        25,
+			Nanoseconds: int64(5*time.Hour + 6*time.Minute + 7*time.Second + 8*time.Millisecond),
+		}))
+		Expect(types.ParseDuration("-P1DT2H")).To(Equal(types.DurationValue{Days: -1, Nanoseconds: -int64(2 * time.Hour)}))
+	})
+
+	It("rejects invalid durations", func() {
+		_, err := types.ParseDuration("1x")
+		Expect(err).To(MatchError("Unable to convert '1x' to a duration"))
+	})
+})
@@ -0,0 +1,134 @@
+package types
+
+import (
+	"bytes"
+	"math"
+
+	"gopkg.in/inf.v0"
+)
+
+// Compare compares two encoded values of type t in the order Cassandra
+// sorts them, e.g. for clustering columns and the elements of sets and
+// maps. Null and empty values sort first.
+func Compare(t Type, a, b []byte) int {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) - len(b)
+	}
+
+	switch t.ID {
+	case Bigint, Counter, Int, Smallint, Tinyint, Timestamp, Time:
+		return compareInt64(signed(a), signed(b))
+	case Double, Float:
+		x, _ := Unmarshal(t, a)
+		y, _ := Unmarshal(t, b)
+		return compareFloat(x, y)
+	case Varint:
+		return decodeVarint(a).Cmp(decodeVarint(b))
+	case Decimal:
+		x, errX := Unmarshal(t, a)
+		y, errY := Unmarshal(t, b)
+		if errX != nil || errY != nil {
+			return bytes.Compare(a, b)
+		}
+		return x.(*inf.Dec).Cmp(y.(*inf.Dec))
+	case Uuid, Timeuuid:
+		return compareUUID(t, a, b)
+	case List, Set:
+		return compareSequence(a, b, func(int) Type { return t.Elems[0] }, SplitCollection)
+	case Map:
+		return compareSequence(a, b, func(i int) Type { return t.Elems[i%2] }, SplitCollection)
+	case Tuple, UDT:
+		split := func(v []byte) ([][]byte, error) {
+			return SplitComponents(v, len(t.Elems))
+		}
+		return compareSequence(a, b, func(i int) Type { return t.Elems[i] }, split)
+	}
+
+	return bytes.Compare(a, b)
+}
+
+func signed(b []byte) int64 {
+	n := int64(int8(b[0]))
+	for _, c := range b[1:] {
+		n = n<<8 | int64(c)
+	}
+	return n
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareFloat(x, y interface{}) int {
+	var a, b float64
+	switch v := x.(type) {
+	case float64:
+		a, b = v, y.(float64)
+	case float32:
+		a, b = float64(v), float64(y.(float32))
+	}
+
+	// NaN sorts after everything else, as with Java's Double.compare
+	switch {
+	case math.IsNaN(a) || math.IsNaN(b):
+		return compareInt64(boolToInt(math.IsNaN(a)), boolToInt(math.IsNaN(b)))
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func compareUUID(t Type, a, b []byte) int {
+	if len(a) != 16 || len(b) != 16 {
+		return bytes.Compare(a, b)
+	}
+
+	var x, y UUID
+	copy(x[:], a)
+	copy(y[:], b)
+
+	if t.ID == Uuid {
+		if c := compareInt64(int64(x.Version()), int64(y.Version())); c != 0 {
+			return c
+		}
+	}
+
+	if x.Version() == 1 {
+		if c := compareInt64(x.Timestamp(), y.Timestamp()); c != 0 {
+			return c
+		}
+	}
+
+	return bytes.Compare(a, b)
+}
+
+func compareSequence(a, b []byte, elemType func(int) Type, split func([]byte) ([][]byte, error)) int {
+	x, errX := split(a)
+	y, errY := split(b)
+	if errX != nil || errY != nil {
+		return bytes.Compare(a, b)
+	}
+
+	for i := 0; i < len(x) && i < len(y); i++ {
+		if c := Compare(elemType(i), x[i], y[i]); c != 0 {
+			return c
+		}
+	}
+
+	return len(x) - len(y)
+}
@@ -0,0 +1,83 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	durationUnits   = regexp.MustCompile(`(?i)([0-9]+)(y|mo|w|d|h|ms|m|s|us|µs|ns)`)
+	durationFormat  = regexp.MustCompile(`(?i)^(([0-9]+)(y|mo|w|d|h|ms|m|s|us|µs|ns))+$`)
+	durationISO8601 = regexp.MustCompile(`(?i)^P(?:([0-9]+)Y)?(?:([0-9]+)M)?(?:([0-9]+)W)?(?:([0-9]+)D)?(?:T(?:([0-9]+)H)?(?:([0-9]+)M)?(?:([0-9]+)S)?)?$`)
+)
+
+// ParseDuration parses a duration literal such as 1h30m, 2mo10d or the ISO
+// 8601 form P1DT2H, optionally preceded by a minus sign.
+func ParseDuration(s string) (DurationValue, error) {
+	var d DurationValue
+
+	literal := s
+	negative := strings.HasPrefix(s, "-")
+	if negative {
+		s = s[1:]
+	}
+
+	switch {
+	case durationFormat.MatchString(s):
+		for _, m := range durationUnits.FindAllStringSubmatch(s, -1) {
+			n, err := strconv.ParseInt(m[1], 10, 64)
+			if err != nil {
+				return d, fmt.Errorf("Invalid duration %s: %s", literal, err)
+			}
+			d.add(strings.ToLower(m[2]), n)
+		}
+	case durationISO8601.MatchString(s) && len(s) > 1 && !strings.HasSuffix(strings.ToUpper(s), "T"):
+		m := durationISO8601.FindStringSubmatch(s)
+		for i, unit := range []string{"y", "mo", "w", "d", "h", "m", "s"} {
+			if m[i+1] == "" {
+				continue
+			}
+			n, err := strconv.ParseInt(m[i+1], 10, 64)
+			if err != nil {
+				return d, fmt.Errorf("Invalid duration %s: %s", literal, err)
+			}
+			d.add(unit, n)
+		}
+	default:
+		return d, fmt.Errorf("Unable to convert '%s' to a duration", literal)
+	}
+
+	if negative {
+		d = DurationValue{-d.Months, -d.Days, -d.Nanoseconds}
+	}
+
+	return d, nil
+}
+
+func (d *DurationValue) add(unit string, n int64) {
+	switch unit {
+	case "y":
+		d.Months += int32(n * 12)
+	case "mo":
+		d.Months += int32(n)
+	case "w":
+		d.Days += int32(n * 7)
+	case "d":
+		d.Days += int32(n)
+	case "h":
+		d.Nanoseconds += n * int64(time.Hour)
+	case "m":
+		d.Nanoseconds += n * int64(time.Minute)
+	case "s":
+		d.Nanoseconds += n * int64(time.Second)
+	case "ms":
+		d.Nanoseconds += n * int64(time.Millisecond)
+	case "us", "µs":
+		d.Nanoseconds += n * int64(time.Microsecond)
+	case "ns":
+		d.Nanoseconds += n
+	}
+}
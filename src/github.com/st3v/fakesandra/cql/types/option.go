@@ -0,0 +1,119 @@
+package types
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/st3v/fakesandra/cql/proto"
+)
+
+// WriteOption writes the [option] describing t as specified by the native
+// protocol.
+func WriteOption(w io.Writer, t Type) error {
+	if err := proto.WriteShort(w, uint16(t.ID)); err != nil {
+		return err
+	}
+
+	switch t.ID {
+	case Custom:
+		return proto.WriteString(w, t.Class)
+	case List, Set, Map:
+		for _, e := range t.Elems {
+			if err := WriteOption(w, e); err != nil {
+				return err
+			}
+		}
+	case UDT:
+		if len(t.Fields) != len(t.Elems) {
+			return fmt.Errorf("Unresolved user type %s", t.Name)
+		}
+		if err := proto.WriteString(w, t.Keyspace); err != nil {
+			return err
+		}
+		if err := proto.WriteString(w, t.Name); err != nil {
+			return err
+		}
+		if err := proto.WriteShort(w, uint16(len(t.Fields))); err != nil {
+			return err
+		}
+		for i, f := range t.Fields {
+			if err := proto.WriteString(w, f); err != nil {
+				return err
+			}
+			if err := WriteOption(w, t.Elems[i]); err != nil {
+				return err
+			}
+		}
+	case Tuple:
+		if err := proto.WriteShort(w, uint16(len(t.Elems))); err != nil {
+			return err
+		}
+		for _, e := range t.Elems {
+			if err := WriteOption(w, e); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ReadOption reads an [option] as specified by the native protocol.
+func ReadOption(r io.Reader) (Type, error) {
+	var id uint16
+	if err := proto.ReadShort(r, &id); err != nil {
+		return Type{}, err
+	}
+
+	t := Type{ID: ID(id)}
+	var err error
+
+	switch t.ID {
+	case Custom:
+		t.Class, err = proto.ReadString(r)
+	case List, Set:
+		t.Elems = make([]Type, 1)
+		t.Elems[0], err = ReadOption(r)
+	case Map:
+		t.Elems = make([]Type, 2)
+		if t.Elems[0], err = ReadOption(r); err == nil {
+			t.Elems[1], err = ReadOption(r)
+		}
+	case UDT:
+		if t.Keyspace, err = proto.ReadString(r); err != nil {
+			return t, err
+		}
+		if t.Name, err = proto.ReadString(r); err != nil {
+			return t, err
+		}
+		var n uint16
+		if err = proto.ReadShort(r, &n); err != nil {
+			return t, err
+		}
+		t.Fields = make([]string, n)
+		t.Elems = make([]Type, n)
+		for i := range t.Fields {
+			if t.Fields[i], err = proto.ReadString(r); err != nil {
+				return t, err
+			}
+			if t.Elems[i], err = ReadOption(r); err != nil {
+				return t, err
+			}
+		}
+		t.Frozen = true
+	case Tuple:
+		var n uint16
+		if err = proto.ReadShort(r, &n); err != nil {
+			return t, err
+		}
+		t.Elems = make([]Type, n)
+		for i := range t.Elems {
+			if t.Elems[i], err = ReadOption(r); err != nil {
+				return t, err
+			}
+		}
+		t.Frozen = true
+	}
+
+	return t, err
+}
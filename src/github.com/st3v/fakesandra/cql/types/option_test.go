@@ -0,0 +1,52 @@
+package types_test
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+var _ = Describe("Option", func() {
+	roundTrip := func(t types.Type) types.Type {
+		buf := &bytes.Buffer{}
+		Expect(types.WriteOption(buf, t)).To(Succeed())
+
+		read, err := types.ReadOption(buf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buf.Len()).To(BeZero())
+		return read
+	}
+
+	It("encodes user-defined types with keyspace, name and fields", func() {
+		money := types.UDTOf("ks", "money", []string{"amount", "currency"}, []types.Type{
+			types.Native(types.Decimal),
+			types.Native(types.Varchar),
+		}).Freeze()
+		address := types.UDTOf("ks", "address", []string{"street", "price"}, []types.Type{
+			types.Native(types.Varchar),
+			money,
+		}).Freeze()
+
+		Expect(roundTrip(address)).To(Equal(address))
+
+		buf := &bytes.Buffer{}
+		Expect(types.WriteOption(buf, money)).To(Succeed())
+		Expect(buf.Bytes()).To(Equal([]byte{
+			0x00, 0x30,
+			0x00, 0x02, 'k', 's',
+			0x00, 0x05, 'm', 'o', 'n', 'e', 'y',
+			0x00, 0x02,
+			0x00, 0x06, 'a', 'm', 'o', 'u', 'n', 't', 0x00, 0x06,
+			0x00, 0x08, 'c', 'u', 'r', 'r', 'e', 'n', 'c', 'y', 0x00, 0x0D,
+		}))
+	})
+
+	It("encodes tuples and collections of them", func() {
+		// The protocol does not tell frozen and non-frozen collections apart.
+		t := types.ListOf(types.TupleOf(types.Native(types.Int), types.SetOf(types.Native(types.Varchar)).Freeze()).Freeze())
+		Expect(roundTrip(t).String()).To(Equal("list<tuple<int, set<text>>>"))
+	})
+})
@@ -0,0 +1,185 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Parse parses a CQL type such as "map<text, frozen<list<int>>>". Names
+// that do not refer to a native or collection type are parsed as
+// unresolved user-defined types.
+func Parse(s string) (Type, error) {
+	p := &typeParser{input: s}
+
+	t, err := p.parse()
+	if err != nil {
+		return Type{}, err
+	}
+
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return Type{}, p.errorf("unexpected %q", p.input[p.pos:])
+	}
+
+	return t, nil
+}
+
+// MustParse is like Parse but panics if s cannot be parsed.
+func MustParse(s string) Type {
+	t, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+type typeParser struct {
+	input string
+	pos   int
+}
+
+func (p *typeParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("Invalid type %q: %s", p.input, fmt.Sprintf(format, args...))
+}
+
+func (p *typeParser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *typeParser) peek() byte {
+	p.skipSpaces()
+	if p.pos >= len(p.input) {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *typeParser) expect(c byte) error {
+	if p.peek() != c {
+		return p.errorf("expected '%c' at position %d", c, p.pos)
+	}
+	p.pos++
+	return nil
+}
+
+// name reads an identifier, a quoted identifier or a custom type class.
+func (p *typeParser) name() (string, bool, error) {
+	p.skipSpaces()
+
+	if p.pos < len(p.input) && (p.input[p.pos] == '"' || p.input[p.pos] == '\'') {
+		quote := p.input[p.pos]
+		end := strings.IndexByte(p.input[p.pos+1:], quote)
+		if end < 0 {
+			return "", false, p.errorf("unterminated quote")
+		}
+		name := p.input[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return name, true, nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.input) {
+		c := rune(p.input[p.pos])
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_' && c != '.' {
+			break
+		}
+		p.pos++
+	}
+
+	if start == p.pos {
+		return "", false, p.errorf("expected type name at position %d", start)
+	}
+
+	return p.input[start:p.pos], false, nil
+}
+
+func (p *typeParser) params() ([]Type, error) {
+	if err := p.expect('<'); err != nil {
+		return nil, err
+	}
+
+	params := []Type{}
+	for {
+		t, err := p.parse()
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, t)
+
+		if p.peek() != ',' {
+			break
+		}
+		p.pos++
+	}
+
+	if err := p.expect('>'); err != nil {
+		return nil, err
+	}
+
+	return params, nil
+}
+
+func (p *typeParser) parse() (Type, error) {
+	name, quoted, err := p.name()
+	if err != nil {
+		return Type{}, err
+	}
+
+	if quoted {
+		if p.input[p.pos-1] == '\'' {
+			return Type{ID: Custom, Class: name}, nil
+		}
+		return Type{ID: UDT, Name: name}, nil
+	}
+
+	lower := strings.ToLower(name)
+	if id, found := nativeIDs[lower]; found {
+		return Type{ID: id}, nil
+	}
+
+	var arity int
+	var t Type
+
+	switch lower {
+	case "frozen":
+		params, err := p.params()
+		if err != nil {
+			return Type{}, err
+		}
+		if len(params) != 1 {
+			return Type{}, p.errorf("frozen takes exactly one type")
+		}
+		return params[0].Freeze(), nil
+	case "list":
+		t, arity = Type{ID: List}, 1
+	case "set":
+		t, arity = Type{ID: Set}, 1
+	case "map":
+		t, arity = Type{ID: Map}, 2
+	case "tuple":
+		t, arity = Type{ID: Tuple, Frozen: true}, -1
+	default:
+		t = Type{ID: UDT, Name: lower}
+		if i := strings.LastIndex(lower, "."); i >= 0 {
+			t.Keyspace, t.Name = lower[:i], lower[i+1:]
+		}
+		return t, nil
+	}
+
+	if t.Elems, err = p.params(); err != nil {
+		return Type{}, err
+	}
+
+	if arity > 0 && len(t.Elems) != arity {
+		return Type{}, p.errorf("%s takes %d types", lower, arity)
+	}
+
+	if t.ID == Tuple {
+		t = t.Freeze()
+	}
+
+	return t, nil
+}
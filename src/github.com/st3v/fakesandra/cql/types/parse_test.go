@@ -0,0 +1,50 @@
+package types_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+var _ = Describe("Parse", func() {
+	It("parses native types", func() {
+		Expect(types.Parse("int")).To(Equal(types.Native(types.Int)))
+		Expect(types.Parse("VARCHAR")).To(Equal(types.Native(types.Varchar)))
+		Expect(types.Parse("text")).To(Equal(types.Native(types.Varchar)))
+	})
+
+	It("parses nested collections", func() {
+		t, err := types.Parse("map<text, frozen<list<int>>>")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(t.ID).To(Equal(types.Map))
+		Expect(t.Frozen).To(BeFalse())
+		Expect(t.Elems[1].ID).To(Equal(types.List))
+		Expect(t.Elems[1].Frozen).To(BeTrue())
+		Expect(t.String()).To(Equal("map<text, frozen<list<int>>>"))
+	})
+
+	It("parses tuples as frozen", func() {
+		t, err := types.Parse("tuple<int, text>")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(t.Frozen).To(BeTrue())
+		Expect(t.String()).To(Equal("tuple<int, text>"))
+	})
+
+	It("parses user-defined types", func() {
+		t, err := types.Parse("frozen<ks.address>")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(t.ID).To(Equal(types.UDT))
+		Expect(t.Keyspace).To(Equal("ks"))
+		Expect(t.Name).To(Equal("address"))
+		Expect(t.Frozen).To(BeTrue())
+	})
+
+	It("rejects invalid types", func() {
+		_, err := types.Parse("map<int>")
+		Expect(err).To(HaveOccurred())
+
+		_, err = types.Parse("list<int")
+		Expect(err).To(HaveOccurred())
+	})
+})
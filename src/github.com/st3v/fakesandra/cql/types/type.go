@@ -0,0 +1,224 @@
+// Package types implements the CQL data types, i.e. type descriptors, the
+// binary encoding of values and the ordering Cassandra applies to them.
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ID is the option id used to identify a type on the wire.
+type ID uint16
+
+const (
+	Custom    ID = 0x0000
+	Ascii     ID = 0x0001
+	Bigint    ID = 0x0002
+	Blob      ID = 0x0003
+	Boolean   ID = 0x0004
+	Counter   ID = 0x0005
+	Decimal   ID = 0x0006
+	Double    ID = 0x0007
+	Float     ID = 0x0008
+	Int       ID = 0x0009
+	Timestamp ID = 0x000B
+	Uuid      ID = 0x000C
+	Varchar   ID = 0x000D
+	Varint    ID = 0x000E
+	Timeuuid  ID = 0x000F
+	Inet      ID = 0x0010
+	Date      ID = 0x0011
+	Time      ID = 0x0012
+	Smallint  ID = 0x0013
+	Tinyint   ID = 0x0014
+	Duration  ID = 0x0015
+	List      ID = 0x0020
+	Map       ID = 0x0021
+	Set       ID = 0x0022
+	UDT       ID = 0x0030
+	Tuple     ID = 0x0031
+)
+
+var nativeNames = map[ID]string{
+	Ascii:     "ascii",
+	Bigint:    "bigint",
+	Blob:      "blob",
+	Boolean:   "boolean",
+	Counter:   "counter",
+	Decimal:   "decimal",
+	Double:    "double",
+	Float:     "float",
+	Int:       "int",
+	Timestamp: "timestamp",
+	Uuid:      "uuid",
+	Varchar:   "text",
+	Varint:    "varint",
+	Timeuuid:  "timeuuid",
+	Inet:      "inet",
+	Date:      "date",
+	Time:      "time",
+	Smallint:  "smallint",
+	Tinyint:   "tinyint",
+	Duration:  "duration",
+}
+
+var nativeIDs = func() map[string]ID {
+	ids := map[string]ID{"varchar": Varchar}
+	for id, name := range nativeNames {
+		ids[name] = id
+	}
+	return ids
+}()
+
+func (id ID) String() string {
+	if name, found := nativeNames[id]; found {
+		return name
+	}
+
+	switch id {
+	case Custom:
+		return "custom"
+	case List:
+		return "list"
+	case Map:
+		return "map"
+	case Set:
+		return "set"
+	case UDT:
+		return "udt"
+	case Tuple:
+		return "tuple"
+	}
+
+	return "unknown"
+}
+
+// Type describes a CQL data type.
+type Type struct {
+	ID ID
+
+	// Class is the Java class implementing a custom type.
+	Class string
+
+	// Elems holds the element type of lists and sets, the key and value
+	// types of maps, the component types of tuples and the field types of
+	// user-defined types.
+	Elems []Type
+
+	// Keyspace, Name and Fields identify a user-defined type. A UDT that
+	// has been parsed but not yet resolved against a schema has a name but
+	// no fields.
+	Keyspace string
+	Name     string
+	Fields   []string
+
+	// Frozen is set for frozen collections and user-defined types.
+	Frozen bool
+}
+
+// Native returns the native type with the given id.
+func Native(id ID) Type {
+	return Type{ID: id}
+}
+
+func ListOf(elem Type) Type {
+	return Type{ID: List, Elems: []Type{elem}}
+}
+
+func SetOf(elem Type) Type {
+	return Type{ID: Set, Elems: []Type{elem}}
+}
+
+func MapOf(key, value Type) Type {
+	return Type{ID: Map, Elems: []Type{key, value}}
+}
+
+func TupleOf(elems ...Type) Type {
+	return Type{ID: Tuple, Elems: elems, Frozen: true}
+}
+
+func UDTOf(keyspace, name string, fields []string, types []Type) Type {
+	return Type{ID: UDT, Keyspace: keyspace, Name: name, Fields: fields, Elems: types}
+}
+
+// IsCollection returns true for lists, sets and maps.
+func (t Type) IsCollection() bool {
+	return t.ID == List || t.ID == Set || t.ID == Map
+}
+
+// IsMultiCell returns true for types whose values are stored as individual
+// cells, i.e. non-frozen collections and user-defined types.
+func (t Type) IsMultiCell() bool {
+	return (t.IsCollection() || t.ID == UDT) && !t.Frozen
+}
+
+// Freeze returns a frozen copy of t. Nested types are frozen as well, as
+// Cassandra does for anything nested inside a frozen type.
+func (t Type) Freeze() Type {
+	f := t
+	if t.IsCollection() || t.ID == UDT || t.ID == Tuple {
+		f.Frozen = true
+	}
+
+	if len(t.Elems) > 0 {
+		f.Elems = make([]Type, len(t.Elems))
+		for i, e := range t.Elems {
+			f.Elems[i] = e.Freeze()
+		}
+	}
+
+	return f
+}
+
+// Equal returns true if t and o describe the same type.
+func (t Type) Equal(o Type) bool {
+	if t.ID != o.ID || t.Frozen != o.Frozen || t.Class != o.Class ||
+		t.Keyspace != o.Keyspace || t.Name != o.Name ||
+		len(t.Elems) != len(o.Elems) || len(t.Fields) != len(o.Fields) {
+		return false
+	}
+
+	for i := range t.Elems {
+		if !t.Elems[i].Equal(o.Elems[i]) {
+			return false
+		}
+	}
+
+	for i := range t.Fields {
+		if t.Fields[i] != o.Fields[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String returns the CQL representation of t.
+func (t Type) String() string {
+	var s string
+
+	switch t.ID {
+	case Custom:
+		return fmt.Sprintf("'%s'", t.Class)
+	case List, Set, Tuple:
+		elems := make([]string, len(t.Elems))
+		for i, e := range t.Elems {
+			elems[i] = e.String()
+		}
+		s = fmt.Sprintf("%s<%s>", t.ID, strings.Join(elems, ", "))
+		if t.ID == Tuple {
+			return s
+		}
+	case Map:
+		s = fmt.Sprintf("map<%s, %s>", t.Elems[0], t.Elems[1])
+	case UDT:
+		s = t.Name
+	default:
+		return t.ID.String()
+	}
+
+	if t.Frozen {
+		return fmt.Sprintf("frozen<%s>", s)
+	}
+	return s
+}
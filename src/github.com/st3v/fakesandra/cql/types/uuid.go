@@ -0,0 +1,72 @@
+package types
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// UUID is a universally unique identifier as used by the uuid and timeuuid
+// types.
+type UUID [16]byte
+
+// ParseUUID parses the canonical string representation of a UUID.
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+
+	h := strings.Replace(s, "-", "", -1)
+	if len(h) != 32 || len(s) != 36 {
+		return u, fmt.Errorf("Invalid UUID %q", s)
+	}
+
+	if _, err := hex.Decode(u[:], []byte(h)); err != nil {
+		return u, fmt.Errorf("Invalid UUID %q", s)
+	}
+
+	return u, nil
+}
+
+func (u UUID) String() string {
+	h := hex.EncodeToString(u[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// Version returns the version of the UUID.
+func (u UUID) Version() int {
+	return int(u[6] >> 4)
+}
+
+// gregorianOffset is the number of 100ns intervals between the start of the
+// Gregorian calendar and the Unix epoch.
+const gregorianOffset = 0x01B21DD213814000
+
+// Timestamp returns the number of 100ns intervals since the start of the
+// Gregorian calendar encoded in a version 1 UUID.
+func (u UUID) Timestamp() int64 {
+	low := int64(u[0])<<24 | int64(u[1])<<16 | int64(u[2])<<8 | int64(u[3])
+	mid := int64(u[4])<<8 | int64(u[5])
+	high := int64(u[6]&0x0F)<<8 | int64(u[7])
+	return high<<48 | mid<<32 | low
+}
+
+// Time returns the time encoded in a version 1 UUID.
+func (u UUID) Time() time.Time {
+	ts := u.Timestamp() - gregorianOffset
+	return time.Unix(ts/1e7, (ts%1e7)*100).UTC()
+}
+
+// TimeUUID returns a version 1 UUID for the given timestamp, clock sequence
+// and node.
+func TimeUUID(t time.Time, clockSeq uint16, node [6]byte) UUID {
+	var u UUID
+
+	ts := t.UnixNano()/100 + gregorianOffset
+	u[0], u[1], u[2], u[3] = byte(ts>>24), byte(ts>>16), byte(ts>>8), byte(ts)
+	u[4], u[5] = byte(ts>>40), byte(ts>>32)
+	u[6], u[7] = byte(ts>>56)&0x0F|0x10, byte(ts>>48)
+	u[8], u[9] = byte(clockSeq>>8)&0x3F|0x80, byte(clockSeq)
+	copy(u[10:], node[:])
+
+	return u
+}
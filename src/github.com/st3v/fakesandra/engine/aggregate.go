@@ -0,0 +1,195 @@
+package engine
+
+import (
+	"math/big"
+
+	"gopkg.in/inf.v0"
+
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+// accumulator computes an aggregate over the rows of a group.
+type accumulator interface {
+	// add adds the arguments of a row, which may be null.
+	add(e *Engine, args [][]byte) error
+
+	// result returns the aggregate over all rows added.
+	result(e *Engine) ([]byte, error)
+}
+
+// nativeTypes are the types count, min and max are defined for.
+var nativeTypes = append([]types.ID{types.Blob}, blobConversionTypes...)
+
+func init() {
+	register(&function{name: "countrows", returns: bigintType, aggregate: func() accumulator {
+		return &countAccumulator{rows: true}
+	}})
+
+	for _, id := range nativeTypes {
+		t := types.Native(id)
+		register(&function{name: "count", args: []types.Type{t}, returns: bigintType, aggregate: func() accumulator {
+			return &countAccumulator{}
+		}})
+		register(&function{name: "min", args: []types.Type{t}, returns: t, aggregate: func() accumulator {
+			return &extremeAccumulator{typ: t, max: false}
+		}})
+		register(&function{name: "max", args: []types.Type{t}, returns: t, aggregate: func() accumulator {
+			return &extremeAccumulator{typ: t, max: true}
+		}})
+
+		if !numericTypes[id] {
+			continue
+		}
+		register(&function{name: "sum", args: []types.Type{t}, returns: t, aggregate: func() accumulator {
+			return newNumberAccumulator(t, false)
+		}})
+		register(&function{name: "avg", args: []types.Type{t}, returns: t, aggregate: func() accumulator {
+			return newNumberAccumulator(t, true)
+		}})
+	}
+}
+
+// countAccumulator counts rows or non-null values.
+type countAccumulator struct {
+	rows  bool
+	count int64
+}
+
+func (a *countAccumulator) add(e *Engine, args [][]byte) error {
+	if a.rows || args[0] != nil {
+		a.count++
+	}
+	return nil
+}
+
+func (a *countAccumulator) result(e *Engine) ([]byte, error) {
+	return types.Marshal(bigintType, a.count)
+}
+
+// extremeAccumulator computes min or max. It is null if all values are.
+type extremeAccumulator struct {
+	typ   types.Type
+	max   bool
+	value []byte
+}
+
+func (a *extremeAccumulator) add(e *Engine, args [][]byte) error {
+	v := args[0]
+	if v == nil {
+		return nil
+	}
+
+	c := types.Compare(a.typ, v, a.value)
+	if a.value == nil || a.max && c > 0 || !a.max && c < 0 {
+		a.value = v
+	}
+	return nil
+}
+
+func (a *extremeAccumulator) result(e *Engine) ([]byte, error) {
+	return a.value, nil
+}
+
+// numberAccumulator computes sum or avg. Like in Cassandra, sums have the
+// type of their values and wrap around, while averages of integers are
+// computed without overflow and truncated. Both are zero without values.
+type numberAccumulator struct {
+	typ   types.Type
+	avg   bool
+	count int64
+
+	sum   int64
+	big   *big.Int
+	float float64
+	dec   *inf.Dec
+}
+
+func newNumberAccumulator(t types.Type, avg bool) *numberAccumulator {
+	return &numberAccumulator{typ: t, avg: avg, big: new(big.Int), dec: new(inf.Dec)}
+}
+
+func (a *numberAccumulator) add(e *Engine, args [][]byte) error {
+	if args[0] == nil {
+		return nil
+	}
+
+	v, err := types.Unmarshal(a.typ, args[0])
+	if err != nil {
+		return invalid("%s", err)
+	}
+
+	a.count++
+	switch x := v.(type) {
+	case int8:
+		a.addInt(int64(x))
+	case int16:
+		a.addInt(int64(x))
+	case int32:
+		a.addInt(int64(x))
+	case int64:
+		a.addInt(x)
+	case *big.Int:
+		a.big.Add(a.big, x)
+	case float32:
+		a.float += float64(x)
+	case float64:
+		a.float += x
+	case *inf.Dec:
+		a.dec.Add(a.dec, x)
+	}
+	return nil
+}
+
+func (a *numberAccumulator) addInt(n int64) {
+	a.sum += n
+	a.big.Add(a.big, big.NewInt(n))
+}
+
+func (a *numberAccumulator) result(e *Engine) ([]byte, error) {
+	count := a.count
+	if count == 0 {
+		count = 1
+	}
+
+	switch a.typ.ID {
+	case types.Varint:
+		if a.avg {
+			return types.Marshal(a.typ, new(big.Int).Quo(a.big, big.NewInt(count)))
+		}
+		return types.Marshal(a.typ, a.big)
+	case types.Float, types.Double:
+		f := a.float
+		if a.avg {
+			f /= float64(count)
+		}
+		if a.typ.ID == types.Float {
+			return types.Marshal(a.typ, float32(f))
+		}
+		return types.Marshal(a.typ, f)
+	case types.Decimal:
+		if a.avg {
+			avg := new(inf.Dec).QuoRound(a.dec, inf.NewDec(count, 0), a.dec.Scale(), inf.RoundHalfEven)
+			return types.Marshal(a.typ, avg)
+		}
+		return types.Marshal(a.typ, a.dec)
+	}
+
+	if a.avg {
+		return marshalInt(a.typ, new(big.Int).Quo(a.big, big.NewInt(count)).Int64())
+	}
+	return marshalInt(a.typ, a.sum)
+}
+
+// marshalInt serializes n as a value of the integer type t, wrapping it
+// around if it does not fit.
+func marshalInt(t types.Type, n int64) ([]byte, error) {
+	switch t.ID {
+	case types.Tinyint:
+		return types.Marshal(t, int8(n))
+	case types.Smallint:
+		return types.Marshal(t, int16(n))
+	case types.Int:
+		return types.Marshal(t, int32(n))
+	}
+	return types.Marshal(t, n)
+}
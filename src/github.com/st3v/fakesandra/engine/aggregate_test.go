@@ -0,0 +1,143 @@
+package engine_test
+
+import (
+	"gopkg.in/inf.v0"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/engine"
+)
+
+var _ = Describe("Aggregates", func() {
+	var e *engine.Engine
+
+	BeforeEach(func() {
+		e = engine.New()
+		exec(e, "CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}")
+		exec(e, "CREATE TABLE ks.t (p int, c int, v int, d decimal, s text static, PRIMARY KEY (p, c))")
+		exec(e, "INSERT INTO ks.t (p, c, v, d, s) VALUES (1, 1, 10, 1.5, 'x')")
+		exec(e, "INSERT INTO ks.t (p, c, v, d) VALUES (1, 2, 20, 2.25)")
+		exec(e, "INSERT INTO ks.t (p, c) VALUES (1, 3)")
+		exec(e, "INSERT INTO ks.t (p, c, v) VALUES (2, 1, 5)")
+	})
+
+	It("computes aggregates over all rows", func() {
+		res, err := e.Execute("SELECT count(*), count(v), min(v), max(v), sum(v), avg(v), avg(d) FROM ks.t")
+		Expect(err).NotTo(HaveOccurred())
+
+		rows := res.(*result.Rows)
+		Expect(rows.Columns[0].Name).To(Equal("count"))
+		Expect(rows.Columns[1].Name).To(Equal("system.count(v)"))
+		row := decode(rows)[0]
+		Expect(row[:6]).To(Equal([]interface{}{int64(4), int64(3), int32(5), int32(20), int32(35), int32(11)}))
+		Expect(row[6].(*inf.Dec).String()).To(Equal("1.88"))
+	})
+
+	It("returns a single row without matching rows", func() {
+		Expect(values(e, "SELECT count(*), sum(v), avg(v), max(v) FROM ks.t WHERE p = 3")).To(Equal([][]interface{}{
+			{int64(0), int32(0), int32(0), nil},
+		}))
+	})
+
+	It("wraps sums around like Cassandra", func() {
+		exec(e, "INSERT INTO ks.t (p, c, v) VALUES (3, 1, 2147483647)")
+		exec(e, "INSERT INTO ks.t (p, c, v) VALUES (3, 2, 1)")
+
+		Expect(values(e, "SELECT sum(v), avg(v) FROM ks.t WHERE p = 3")).To(Equal([][]interface{}{
+			{int32(-2147483648), int32(1073741824)},
+		}))
+	})
+
+	It("takes non-aggregated values from the first row", func() {
+		Expect(values(e, "SELECT p, c, count(*) FROM ks.t WHERE p = 1")).To(Equal([][]interface{}{
+			{int32(1), int32(1), int64(3)},
+		}))
+	})
+
+	It("groups rows by primary key prefixes", func() {
+		Expect(values(e, "SELECT p, count(*), max(c) FROM ks.t GROUP BY p")).To(ConsistOf(
+			[]interface{}{int32(1), int64(3), int32(3)},
+			[]interface{}{int32(2), int64(1), int32(1)},
+		))
+		Expect(values(e, "SELECT p, c, count(*) FROM ks.t WHERE p = 1 GROUP BY p, c LIMIT 2")).To(Equal([][]interface{}{
+			{int32(1), int32(1), int64(1)},
+			{int32(1), int32(2), int64(1)},
+		}))
+
+		expectInvalid(e, "SELECT count(*) FROM ks.t GROUP BY v", "Group by is currently only supported on the columns of the PRIMARY KEY, got v")
+		expectInvalid(e, "SELECT count(*) FROM ks.t GROUP BY c", "Group by currently only support groups of columns following their declared order in the PRIMARY KEY")
+	})
+
+	It("rejects nested aggregates", func() {
+		expectInvalid(e, "SELECT max(count(v)) FROM ks.t", "aggregate functions cannot be used as arguments of aggregate functions")
+	})
+
+	It("pages grouped results by group", func() {
+		page := func(state []byte) ([][]interface{}, []byte) {
+			res, err := e.ExecuteQuery(query{
+				statement:   "SELECT p, count(*) FROM ks.t GROUP BY p",
+				pageSize:    1,
+				pagingState: state,
+			}, proto.NewSession())
+			Expect(err).NotTo(HaveOccurred())
+			rows := res.(*result.Rows)
+			return decode(rows), rows.PagingState
+		}
+
+		first, state := page(nil)
+		Expect(state).NotTo(BeNil())
+		second, state := page(state)
+		Expect(state).To(BeNil())
+		Expect(append(first, second...)).To(ConsistOf(
+			[]interface{}{int32(1), int64(3)},
+			[]interface{}{int32(2), int64(1)},
+		))
+
+		res, err := e.ExecuteQuery(query{statement: "SELECT count(*) FROM ks.t", pageSize: 1}, proto.NewSession())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.(*result.Rows).PagingState).To(BeNil())
+		Expect(decode(res.(*result.Rows))).To(Equal([][]interface{}{{int64(4)}}))
+	})
+
+	It("pages rows", func() {
+		all := [][]interface{}{}
+		var state []byte
+		for {
+			res, err := e.ExecuteQuery(query{
+				statement:   "SELECT p, c FROM ks.t",
+				pageSize:    3,
+				pagingState: state,
+			}, proto.NewSession())
+			Expect(err).NotTo(HaveOccurred())
+
+			rows := res.(*result.Rows)
+			Expect(len(rows.Data)).To(BeNumerically("<=", 3))
+			all = append(all, decode(rows)...)
+
+			if state = rows.PagingState; state == nil {
+				break
+			}
+		}
+		Expect(all).To(Equal(values(e, "SELECT p, c FROM ks.t")))
+		Expect(all).To(HaveLen(4))
+	})
+
+	Describe("DISTINCT", func() {
+		It("selects partition keys and static columns once per partition", func() {
+			Expect(values(e, "SELECT DISTINCT p, s FROM ks.t")).To(ConsistOf(
+				[]interface{}{int32(1), "x"},
+				[]interface{}{int32(2), nil},
+			))
+			Expect(values(e, "SELECT DISTINCT p FROM ks.t WHERE p = 1")).To(Equal([][]interface{}{{int32(1)}}))
+		})
+
+		It("rejects other columns", func() {
+			expectInvalid(e, "SELECT DISTINCT p, v FROM ks.t", "SELECT DISTINCT queries must only request partition key columns and/or static columns (not v)")
+			expectInvalid(e, "SELECT DISTINCT s FROM ks.t", "SELECT DISTINCT queries must request all the partition key columns (missing p)")
+			expectInvalid(e, "SELECT DISTINCT p FROM ks.t WHERE p = 1 AND c = 1", "SELECT DISTINCT with WHERE clause only supports restriction by partition key and/or static columns.")
+		})
+	})
+})
@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"github.com/st3v/fakesandra/cql/parser"
+	"github.com/st3v/fakesandra/cql/result"
+)
+
+// batch executes BEGIN BATCH ... APPLY BATCH. The statements share a
+// timestamp unless they set their own. Batches with conditions are executed
+// as a single lightweight transaction and must not span multiple
+// partitions.
+func (e *Engine) batch(r *request, s *parser.Batch) (result.Result, error) {
+	if s.Using.TTL != nil {
+		return nil, invalid("Global TTL on the BATCH statement is not supported.")
+	}
+
+	timestamp := e.defaultTimestamp(r)
+	if s.Using.Timestamp != nil {
+		if s.Type == parser.CounterBatch {
+			return nil, invalid("Cannot provide custom timestamp for counter BATCH")
+		}
+
+		var err error
+		if timestamp, err = r.bindTimestamp(s.Using.Timestamp); err != nil {
+			return nil, err
+		}
+	}
+
+	br := *r
+	br.batch, br.batchTimestamp = s, timestamp
+
+	mods := []*modification{}
+	conditional, counters, others := false, false, false
+	for _, stmt := range s.Statements {
+		mod, err := e.modification(&br, stmt)
+		if err != nil {
+			return nil, err
+		}
+
+		counter := mod.table.IsCounter()
+		counters, others = counters || counter, others || !counter
+		switch {
+		case s.Type == parser.CounterBatch && !counter:
+			return nil, invalid("Cannot include non-counter statement in a counter batch")
+		case s.Type == parser.LoggedBatch && counter:
+			return nil, invalid("Cannot include a counter statement in a logged batch")
+		case counters && others:
+			return nil, invalid("Counter and non-counter mutations cannot exist in the same batch")
+		}
+
+		conditional = conditional || mod.conditions != nil
+		mods = append(mods, mod)
+	}
+
+	if err := r.checkConsistency(conditional); err != nil {
+		return nil, err
+	}
+
+	if conditional {
+		return e.casBatch(s, mods)
+	}
+
+	for _, mod := range mods {
+		for _, m := range mod.mutations {
+			e.apply(mod.table, m)
+		}
+	}
+	return result.Void{}, nil
+}
+
+// casBatch executes a batch with conditions as a lightweight transaction.
+func (e *Engine) casBatch(s *parser.Batch, mods []*modification) (result.Result, error) {
+	if s.Using.Timestamp != nil {
+		return nil, invalid("Cannot provide custom timestamp for conditional BATCH")
+	}
+
+	t := mods[0].table
+	id := partitionID(mods[0].mutations[0].key)
+
+	muts := []*mutation{}
+	conds := []*conditions{}
+	for _, mod := range mods {
+		if mod.table.Keyspace != t.Keyspace || mod.table.Name != t.Name {
+			return nil, invalid("Batch with conditions cannot span multiple tables")
+		}
+
+		for _, m := range mod.mutations {
+			if partitionID(m.key) != id {
+				return nil, invalid("Batch with conditions cannot span multiple partitions")
+			}
+			muts = append(muts, m)
+		}
+
+		if mod.conditions != nil {
+			conds = append(conds, mod.conditions)
+		}
+	}
+
+	return e.cas(t, muts, conds, true), nil
+}
@@ -0,0 +1,110 @@
+package engine_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/engine"
+)
+
+var _ = Describe("BATCH", func() {
+	var e *engine.Engine
+
+	BeforeEach(func() {
+		e = engine.New()
+		exec(e, "CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}")
+		exec(e, "CREATE TABLE ks.t (p text, c int, v text, PRIMARY KEY (p, c))")
+		exec(e, "CREATE TABLE ks.hits (p text PRIMARY KEY, n counter)")
+	})
+
+	It("applies all statements with a shared timestamp", func() {
+		exec(e, `BEGIN BATCH USING TIMESTAMP 100
+			INSERT INTO ks.t (p, c, v) VALUES ('a', 1, 'x');
+			UPDATE ks.t SET v = 'y' WHERE p = 'b' AND c = 1;
+			DELETE FROM ks.t WHERE p = 'c';
+		APPLY BATCH`)
+
+		Expect(values(e, "SELECT p, writetime(v) FROM ks.t")).To(ConsistOf(
+			[]interface{}{"a", int64(100)},
+			[]interface{}{"b", int64(100)},
+		))
+	})
+
+	It("executes counter batches", func() {
+		exec(e, `BEGIN COUNTER BATCH
+			UPDATE ks.hits SET n = n + 2 WHERE p = 'a';
+			UPDATE ks.hits SET n = n + 3 WHERE p = 'a';
+		APPLY BATCH`)
+		Expect(values(e, "SELECT n FROM ks.hits")).To(Equal([][]interface{}{{int64(5)}}))
+
+		exec(e, "BEGIN UNLOGGED BATCH UPDATE ks.hits SET n = n - 1 WHERE p = 'a' APPLY BATCH")
+		Expect(values(e, "SELECT n FROM ks.hits")).To(Equal([][]interface{}{{int64(4)}}))
+	})
+
+	It("rejects counter statements outside of counter batches", func() {
+		expectInvalid(e, "BEGIN COUNTER BATCH INSERT INTO ks.t (p, c) VALUES ('a', 1) APPLY BATCH", "Cannot include non-counter statement in a counter batch")
+		expectInvalid(e, "BEGIN BATCH UPDATE ks.hits SET n = n + 1 WHERE p = 'a' APPLY BATCH", "Cannot include a counter statement in a logged batch")
+		expectInvalid(e, "BEGIN UNLOGGED BATCH INSERT INTO ks.t (p, c) VALUES ('a', 1) UPDATE ks.hits SET n = n + 1 WHERE p = 'a' APPLY BATCH", "Counter and non-counter mutations cannot exist in the same batch")
+		expectInvalid(e, "BEGIN COUNTER BATCH USING TIMESTAMP 1 UPDATE ks.hits SET n = n + 1 WHERE p = 'a' APPLY BATCH", "Cannot provide custom timestamp for counter BATCH")
+		Expect(values(e, "SELECT * FROM ks.t")).To(BeEmpty())
+	})
+
+	It("rejects timestamps on both the batch and its statements", func() {
+		expectInvalid(e, "BEGIN BATCH USING TIMESTAMP 1 INSERT INTO ks.t (p, c) VALUES ('a', 1) USING TIMESTAMP 2 APPLY BATCH", "Timestamp must be set either on BATCH or individual statements")
+		expectInvalid(e, "BEGIN BATCH USING TTL 1 INSERT INTO ks.t (p, c) VALUES ('a', 1) APPLY BATCH", "Global TTL on the BATCH statement is not supported.")
+	})
+
+	Describe("with conditions", func() {
+		BeforeEach(func() {
+			exec(e, "INSERT INTO ks.t (p, c, v) VALUES ('a', 1, 'x')")
+		})
+
+		It("applies all statements if all conditions hold", func() {
+			Expect(values(e, `BEGIN BATCH
+				UPDATE ks.t SET v = 'y' WHERE p = 'a' AND c = 1 IF v = 'x';
+				INSERT INTO ks.t (p, c, v) VALUES ('a', 2, 'z') IF NOT EXISTS;
+			APPLY BATCH`)).To(Equal([][]interface{}{{true}}))
+
+			Expect(values(e, "SELECT v FROM ks.t WHERE p = 'a'")).To(Equal([][]interface{}{{"y"}, {"z"}}))
+		})
+
+		It("returns the current rows if a condition does not hold", func() {
+			res, err := e.Execute(`BEGIN BATCH
+				UPDATE ks.t SET v = 'y' WHERE p = 'a' AND c = 1 IF v = 'y';
+				UPDATE ks.t SET v = 'y' WHERE p = 'a' AND c = 2 IF v = 'x';
+			APPLY BATCH`)
+			Expect(err).NotTo(HaveOccurred())
+
+			names := []string{}
+			for _, c := range res.(*result.Rows).Columns {
+				names = append(names, c.Name)
+			}
+			Expect(names).To(Equal([]string{"[applied]", "p", "c", "v"}))
+
+			Expect(values(e, `BEGIN BATCH
+				UPDATE ks.t SET v = 'y' WHERE p = 'a' AND c = 1 IF v = 'y';
+				UPDATE ks.t SET v = 'y' WHERE p = 'a' AND c = 2 IF v = 'x';
+			APPLY BATCH`)).To(Equal([][]interface{}{{false, "a", int32(1), "x"}}))
+
+			Expect(values(e, "SELECT v FROM ks.t WHERE p = 'a'")).To(Equal([][]interface{}{{"x"}}))
+		})
+
+		It("must not span multiple partitions or tables", func() {
+			expectInvalid(e, `BEGIN BATCH
+				UPDATE ks.t SET v = 'y' WHERE p = 'a' AND c = 1 IF v = 'x';
+				INSERT INTO ks.t (p, c) VALUES ('b', 1);
+			APPLY BATCH`, "Batch with conditions cannot span multiple partitions")
+
+			exec(e, "CREATE TABLE ks.u (p text, c int, v text, PRIMARY KEY (p, c))")
+			expectInvalid(e, `BEGIN BATCH
+				UPDATE ks.t SET v = 'y' WHERE p = 'a' AND c = 1 IF v = 'x';
+				INSERT INTO ks.u (p, c) VALUES ('a', 1);
+			APPLY BATCH`, "Batch with conditions cannot span multiple tables")
+
+			expectInvalid(e, `BEGIN BATCH USING TIMESTAMP 1
+				UPDATE ks.t SET v = 'y' WHERE p = 'a' AND c = 1 IF v = 'x';
+			APPLY BATCH`, "Cannot provide custom timestamp for conditional BATCH")
+		})
+	})
+})
@@ -0,0 +1,308 @@
+package engine
+
+import (
+	"github.com/st3v/fakesandra/cql/parser"
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+// conditions are the IF clause of a lightweight transaction. They apply to
+// the row with the given clustering, or to the partition if clustering is
+// nil.
+type conditions struct {
+	exists     bool
+	notExists  bool
+	relations  []*condition
+	clustering [][]byte
+}
+
+// condition is a single IF condition on a column. IN conditions have
+// multiple values, all other operators exactly one. Values may be null.
+type condition struct {
+	column   *Column
+	operator parser.Operator
+	values   [][]byte
+}
+
+// conditions evaluates the IF clause of an UPDATE or DELETE statement. It
+// returns nil if the statement is not conditional.
+func (r *request) conditions(t *Table, ifExists bool, relations []parser.Relation) (*conditions, error) {
+	if !ifExists && len(relations) == 0 {
+		return nil, nil
+	}
+
+	if t.IsCounter() {
+		return nil, invalid("Conditional updates are not supported on counter tables")
+	}
+
+	cs := &conditions{exists: ifExists}
+	for _, rel := range relations {
+		left, ok := rel.Left.(*parser.Column)
+		if !ok {
+			return nil, invalid("Unsupported condition %s", rel)
+		}
+
+		c, found := t.Column(left.Name)
+		switch {
+		case !found:
+			return nil, invalid("Undefined column name %s", left.Name)
+		case c.IsPrimaryKey():
+			return nil, invalid("PRIMARY KEY column '%s' cannot have IF conditions", c.Name)
+		}
+
+		switch rel.Op {
+		case parser.Eq, parser.NotEq, parser.Lt, parser.Lte, parser.Gt, parser.Gte, parser.In:
+		default:
+			return nil, invalid("Unsupported condition %s", rel)
+		}
+
+		values, err := r.bindValues(rel, c.Name, c.Type)
+		if err != nil {
+			return nil, err
+		}
+
+		if rel.Op != parser.Eq && rel.Op != parser.NotEq && rel.Op != parser.In && values[0] == nil {
+			return nil, invalid("Invalid comparison with null for operator \"%s\"", rel.Op)
+		}
+
+		cs.relations = append(cs.relations, &condition{column: c, operator: rel.Op, values: values})
+	}
+
+	return cs, nil
+}
+
+// regular returns true if cs have conditions on regular columns, which
+// require a single row to be selected.
+func (cs *conditions) regular() bool {
+	for _, c := range cs.relations {
+		if c.column.Kind != Static {
+			return true
+		}
+	}
+	return false
+}
+
+// applies returns true if cs hold for the current static values and row.
+// The row is nil if it does not exist.
+func (cs *conditions) applies(exists bool, static map[string]*cell, rw *row) bool {
+	switch {
+	case cs.exists:
+		return exists
+	case cs.notExists:
+		return !exists
+	}
+
+	for _, c := range cs.relations {
+		var current []byte
+		switch {
+		case c.column.Kind == Static:
+			current = cellValue(static[c.column.Name])
+		case rw != nil:
+			current = cellValue(rw.cells[c.column.Name])
+		}
+
+		if !c.match(current) {
+			return false
+		}
+	}
+	return true
+}
+
+// match returns true if the condition holds for the current value of its
+// column, which is nil if the column is null.
+func (c *condition) match(current []byte) bool {
+	equal := func(v []byte) bool {
+		if current == nil || v == nil {
+			return current == nil && v == nil
+		}
+		return types.Compare(c.column.Type, current, v) == 0
+	}
+
+	switch c.operator {
+	case parser.Eq:
+		return equal(c.values[0])
+	case parser.NotEq:
+		return !equal(c.values[0])
+	case parser.In:
+		for _, v := range c.values {
+			if equal(v) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if current == nil {
+		return false
+	}
+
+	cmp := types.Compare(c.column.Type, current, c.values[0])
+	switch c.operator {
+	case parser.Lt:
+		return cmp < 0
+	case parser.Lte:
+		return cmp <= 0
+	case parser.Gt:
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+// checkConsistency validates the consistency levels of a write. The serial
+// consistencies are reserved for the Paxos phase of conditional writes.
+func (r *request) checkConsistency(conditional bool) error {
+	if r.query == nil {
+		return nil
+	}
+
+	cl := r.query.Consistency()
+	isSerial := cl == proto.Serial || cl == proto.LocalSerial
+
+	switch {
+	case !conditional && isSerial:
+		return invalid("You must use conditional updates for serializable writes")
+	case !conditional:
+		return nil
+	case isSerial:
+		return invalid("%s is not supported as conditional update commit consistency. Use ANY if you mean \"make sure it is accepted but I don't care how many replicas commit it for non-SERIAL reads\"", cl)
+	}
+
+	if serial, set := r.query.SerialConsistency(); set && serial != proto.Serial && serial != proto.LocalSerial {
+		return invalid("Invalid consistency for conditional update. Must be one of SERIAL or LOCAL_SERIAL")
+	}
+	return nil
+}
+
+// cas executes a lightweight transaction. The conditions are evaluated and
+// the mutations applied while holding the lock of the table's data, which
+// makes the transaction atomic. All mutations and conditions belong to the
+// same partition. Like the Paxos ballot in Cassandra, the timestamp of the
+// mutations is taken from the engine clock.
+//
+// If the conditions do not hold, the current values of the rows they apply
+// to are returned. Batches include the primary key to tell rows apart.
+func (e *Engine) cas(t *Table, muts []*mutation, conds []*conditions, batch bool) result.Result {
+	timestamp, now := e.timestamp(), e.nowInSeconds()
+	for _, m := range muts {
+		m.timestamp, m.now = timestamp, now
+	}
+
+	views := e.views(t)
+
+	t.data.mu.Lock()
+	defer t.data.mu.Unlock()
+
+	key := muts[0].key
+
+	var (
+		static map[string]*cell
+		live   []*row
+	)
+	if p, found := t.data.partition(key); found {
+		static, live = p.live(t, now)
+	}
+
+	// current returns the row the conditions apply to and whether it
+	// exists.
+	current := func(cs *conditions) (*row, bool) {
+		if cs.clustering == nil {
+			return nil, len(static) > 0 || len(live) > 0
+		}
+		for _, rw := range live {
+			if compareClustering(t, rw.clustering, cs.clustering) == 0 {
+				return rw, true
+			}
+		}
+		return nil, false
+	}
+
+	applied := true
+	for _, cs := range conds {
+		rw, exists := current(cs)
+		applied = applied && cs.applies(exists, static, rw)
+	}
+
+	if applied {
+		for _, m := range muts {
+			t.data.update(t, views, m)
+		}
+	}
+
+	rows := &result.Rows{
+		Columns: []result.Column{{Keyspace: t.Keyspace, Table: t.Name, Name: "[applied]", Type: types.Native(types.Boolean)}},
+		Data:    [][][]byte{},
+	}
+	appliedValue, _ := types.Marshal(types.Native(types.Boolean), applied)
+
+	if applied {
+		rows.Data = append(rows.Data, [][]byte{appliedValue})
+		return rows
+	}
+
+	selections := []selection{}
+	for _, c := range casColumns(t, conds, batch) {
+		selections = append(selections, selection{column: c, name: c.Name, typ: c.Type})
+		rows.Columns = append(rows.Columns, result.Column{Keyspace: t.Keyspace, Table: t.Name, Name: c.Name, Type: c.Type})
+	}
+
+	seen := map[string]bool{}
+	for _, cs := range conds {
+		id := string(types.JoinComponents(cs.clustering))
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		rw, exists := current(cs)
+		if !exists && len(static) == 0 {
+			continue
+		}
+
+		// Projecting plain columns does not fail.
+		values, _ := e.project(selections, match{key: key, static: static, row: rw}, now)
+		rows.Data = append(rows.Data, append([][]byte{appliedValue}, values...))
+	}
+
+	if len(rows.Data) == 0 {
+		rows.Columns = rows.Columns[:1]
+		rows.Data = append(rows.Data, [][]byte{appliedValue})
+	}
+
+	return rows
+}
+
+// casColumns returns the columns reported along with [applied] if the
+// conditions of a transaction do not hold. These are all columns for
+// IF EXISTS and IF NOT EXISTS, otherwise the columns with conditions in
+// the order of the IF clauses, preceded by the primary key for batches.
+func casColumns(t *Table, conds []*conditions, batch bool) []*Column {
+	columns := []*Column{}
+	seen := map[string]bool{}
+	add := func(c *Column) {
+		if !seen[c.Name] {
+			seen[c.Name] = true
+			columns = append(columns, c)
+		}
+	}
+
+	if batch {
+		for _, c := range t.PartitionKey {
+			add(c)
+		}
+		for _, c := range t.ClusteringKey {
+			add(c)
+		}
+	}
+
+	for _, cs := range conds {
+		if cs.exists || cs.notExists {
+			return t.Columns
+		}
+		for _, c := range cs.relations {
+			add(c.column)
+		}
+	}
+	return columns
+}
@@ -0,0 +1,187 @@
+package engine_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/cql/types"
+	"github.com/st3v/fakesandra/engine"
+)
+
+var _ = Describe("Lightweight transactions", func() {
+	var e *engine.Engine
+
+	// cas executes stmt and returns the names of the result columns and its
+	// single row, decoded using the column types.
+	cas := func(stmt string) ([]string, []interface{}) {
+		res, err := e.Execute(stmt)
+		Expect(err).NotTo(HaveOccurred())
+
+		rows := res.(*result.Rows)
+		Expect(rows.Data).To(HaveLen(1))
+
+		names := []string{}
+		values := []interface{}{}
+		for i, c := range rows.Columns {
+			Expect(c.Keyspace).To(Equal("ks"))
+			Expect(c.Table).To(Equal("t"))
+			names = append(names, c.Name)
+
+			var v interface{}
+			if b := rows.Data[0][i]; b != nil {
+				v, err = types.Unmarshal(c.Type, b)
+				Expect(err).NotTo(HaveOccurred())
+			}
+			values = append(values, v)
+		}
+		return names, values
+	}
+
+	applied := func(stmt string) bool {
+		_, values := cas(stmt)
+		return values[0].(bool)
+	}
+
+	BeforeEach(func() {
+		e = engine.New()
+		exec(e, "CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}")
+		exec(e, "CREATE TABLE ks.t (p text, c int, s int STATIC, v int, w text, PRIMARY KEY (p, c))")
+	})
+
+	Describe("INSERT IF NOT EXISTS", func() {
+		It("inserts rows that do not exist", func() {
+			names, values := cas("INSERT INTO ks.t (p, c, v) VALUES ('a', 1, 10) IF NOT EXISTS")
+			Expect(names).To(Equal([]string{"[applied]"}))
+			Expect(values).To(Equal([]interface{}{true}))
+			Expect(value(e, "SELECT v FROM ks.t WHERE p = 'a' AND c = 1")).To(Equal(int32(10)))
+		})
+
+		It("returns the existing row", func() {
+			exec(e, "INSERT INTO ks.t (p, c, s, v, w) VALUES ('a', 1, 5, 10, 'x')")
+
+			names, values := cas("INSERT INTO ks.t (p, c, v) VALUES ('a', 1, 20) IF NOT EXISTS")
+			Expect(names).To(Equal([]string{"[applied]", "p", "c", "s", "v", "w"}))
+			Expect(values).To(Equal([]interface{}{false, "a", int32(1), int32(5), int32(10), "x"}))
+			Expect(value(e, "SELECT v FROM ks.t WHERE p = 'a' AND c = 1")).To(Equal(int32(10)))
+		})
+
+		It("inserts rows next to existing static values", func() {
+			exec(e, "INSERT INTO ks.t (p, s) VALUES ('a', 5)")
+			Expect(applied("INSERT INTO ks.t (p, c, v) VALUES ('a', 1, 10) IF NOT EXISTS")).To(BeTrue())
+		})
+
+		It("rejects custom timestamps", func() {
+			expectInvalid(e, "INSERT INTO ks.t (p, c) VALUES ('a', 1) IF NOT EXISTS USING TIMESTAMP 1", "Cannot provide custom timestamp for conditional updates")
+		})
+	})
+
+	Describe("UPDATE with conditions", func() {
+		BeforeEach(func() {
+			exec(e, "INSERT INTO ks.t (p, c, s, v, w) VALUES ('a', 1, 5, 10, 'x')")
+		})
+
+		It("applies if all conditions hold", func() {
+			Expect(applied("UPDATE ks.t SET v = 11 WHERE p = 'a' AND c = 1 IF v = 10 AND w IN ('x', 'y')")).To(BeTrue())
+			Expect(applied("UPDATE ks.t SET v = 12 WHERE p = 'a' AND c = 1 IF v > 10 AND v <= 11 AND w != 'y'")).To(BeTrue())
+			Expect(value(e, "SELECT v FROM ks.t WHERE p = 'a' AND c = 1")).To(Equal(int32(12)))
+		})
+
+		It("returns the current values of the columns with conditions", func() {
+			names, values := cas("UPDATE ks.t SET v = 11 WHERE p = 'a' AND c = 1 IF w = 'y' AND v = 10 AND w != 'z'")
+			Expect(names).To(Equal([]string{"[applied]", "w", "v"}))
+			Expect(values).To(Equal([]interface{}{false, "x", int32(10)}))
+			Expect(value(e, "SELECT v FROM ks.t WHERE p = 'a' AND c = 1")).To(Equal(int32(10)))
+		})
+
+		It("compares with null", func() {
+			Expect(applied("UPDATE ks.t SET v = 11 WHERE p = 'b' AND c = 1 IF v = null")).To(BeTrue())
+			Expect(applied("UPDATE ks.t SET w = 'z' WHERE p = 'b' AND c = 1 IF w != null")).To(BeFalse())
+			Expect(applied("UPDATE ks.t SET w = 'z' WHERE p = 'b' AND c = 1 IF w < 'z'")).To(BeFalse())
+		})
+
+		It("checks existence", func() {
+			Expect(applied("UPDATE ks.t SET v = 11 WHERE p = 'a' AND c = 1 IF EXISTS")).To(BeTrue())
+
+			names, values := cas("UPDATE ks.t SET v = 11 WHERE p = 'a' AND c = 2 IF EXISTS")
+			Expect(names).To(Equal([]string{"[applied]", "p", "c", "s", "v", "w"}))
+			Expect(values).To(Equal([]interface{}{false, "a", nil, int32(5), nil, nil}))
+
+			names, values = cas("UPDATE ks.t SET v = 11 WHERE p = 'b' AND c = 2 IF EXISTS")
+			Expect(names).To(Equal([]string{"[applied]"}))
+			Expect(values).To(Equal([]interface{}{false}))
+			Expect(value(e, "SELECT v FROM ks.t WHERE p = 'b'")).To(BeNil())
+		})
+
+		It("updates static columns with conditions on static columns", func() {
+			Expect(applied("UPDATE ks.t SET s = 6 WHERE p = 'a' IF s = 5")).To(BeTrue())
+			Expect(value(e, "SELECT s FROM ks.t WHERE p = 'a'")).To(Equal(int32(6)))
+		})
+
+		It("rejects invalid conditions", func() {
+			expectInvalid(e, "UPDATE ks.t SET v = 1 WHERE p = 'a' AND c = 1 IF c = 1", "PRIMARY KEY column 'c' cannot have IF conditions")
+			expectInvalid(e, "UPDATE ks.t SET v = 1 WHERE p = 'a' AND c = 1 IF x = 1", "Undefined column name x")
+			expectInvalid(e, "UPDATE ks.t SET v = 1 WHERE p = 'a' AND c = 1 IF v > null", `Invalid comparison with null for operator ">"`)
+			expectInvalid(e, "UPDATE ks.t SET v = 1 WHERE p IN ('a', 'b') AND c = 1 IF v = 1", "IN on the partition key is not supported with conditional updates")
+			expectInvalid(e, "UPDATE ks.t SET v = 1 WHERE p = 'a' AND c IN (1, 2) IF v = 1", "IN on the clustering key columns is not supported with conditional updates")
+			expectInvalid(e, "UPDATE ks.t SET s = 1 WHERE p = 'a' IF v = 1", "UPDATE statements must restrict all PRIMARY KEY columns with equality relations in order to use IF conditions")
+		})
+	})
+
+	Describe("DELETE with conditions", func() {
+		BeforeEach(func() {
+			exec(e, "INSERT INTO ks.t (p, c, v) VALUES ('a', 1, 10)")
+		})
+
+		It("deletes rows if the conditions hold", func() {
+			Expect(applied("DELETE FROM ks.t WHERE p = 'a' AND c = 1 IF v = 11")).To(BeFalse())
+			Expect(applied("DELETE w FROM ks.t WHERE p = 'a' AND c = 1 IF EXISTS")).To(BeTrue())
+			Expect(applied("DELETE FROM ks.t WHERE p = 'a' AND c = 1 IF v = 10")).To(BeTrue())
+			Expect(value(e, "SELECT v FROM ks.t WHERE p = 'a'")).To(BeNil())
+		})
+
+		It("deletes partitions if they exist", func() {
+			Expect(applied("DELETE FROM ks.t WHERE p = 'b' IF EXISTS")).To(BeFalse())
+			Expect(applied("DELETE FROM ks.t WHERE p = 'a' IF EXISTS")).To(BeTrue())
+			Expect(value(e, "SELECT v FROM ks.t WHERE p = 'a'")).To(BeNil())
+		})
+
+		It("requires the row to be selected for conditions on regular columns", func() {
+			expectInvalid(e, "DELETE FROM ks.t WHERE p = 'a' IF v = 10", "DELETE statements must restrict all PRIMARY KEY columns with equality relations in order to use IF conditions")
+		})
+	})
+
+	Describe("consistency", func() {
+		It("requires a serial consistency for the Paxos phase", func() {
+			_, err := e.ExecuteQuery(query{
+				statement:   "INSERT INTO ks.t (p, c) VALUES ('a', 1) IF NOT EXISTS",
+				consistency: proto.Quorum,
+				serial:      proto.Quorum,
+			}, proto.NewSession())
+			Expect(err).To(Equal(proto.NewError(proto.ErrInvalid, "Invalid consistency for conditional update. Must be one of SERIAL or LOCAL_SERIAL")))
+
+			res, err := e.ExecuteQuery(query{
+				statement:   "INSERT INTO ks.t (p, c) VALUES ('a', 1) IF NOT EXISTS",
+				consistency: proto.Quorum,
+				serial:      proto.LocalSerial,
+			}, proto.NewSession())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.(*result.Rows).Columns[0].Name).To(Equal("[applied]"))
+		})
+
+		It("rejects serial consistencies for commits and regular writes", func() {
+			_, err := e.ExecuteQuery(query{
+				statement:   "INSERT INTO ks.t (p, c) VALUES ('a', 1) IF NOT EXISTS",
+				consistency: proto.Serial,
+			}, proto.NewSession())
+			Expect(err).To(MatchError(ContainSubstring("SERIAL is not supported as conditional update commit consistency")))
+
+			_, err = e.ExecuteQuery(query{
+				statement:   "INSERT INTO ks.t (p, c) VALUES ('a', 1)",
+				consistency: proto.LocalSerial,
+			}, proto.NewSession())
+			Expect(err).To(Equal(proto.NewError(proto.ErrInvalid, "You must use conditional updates for serializable writes")))
+		})
+	})
+})
@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"strconv"
+	"time"
+
+	"gopkg.in/inf.v0"
+
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+// numericTypes can be cast to each other.
+var numericTypes = map[types.ID]bool{
+	types.Tinyint: true, types.Smallint: true, types.Int: true, types.Bigint: true,
+	types.Counter: true, types.Varint: true, types.Float: true, types.Double: true,
+	types.Decimal: true,
+}
+
+// castFunction returns the function converting values of type from to
+// type to for CAST(x AS to), where x is called name. Like in Cassandra,
+// numbers can be cast to each other, anything native can be cast to text
+// and timeuuids, timestamps and dates can be converted into each other.
+func castFunction(name string, from, to types.Type) (*function, error) {
+	f := &function{name: "castas" + to.String(), args: []types.Type{from}, returns: to}
+
+	switch {
+	case from.Equal(to):
+		f.execute = func(e *Engine, args [][]byte) ([]byte, error) {
+			return args[0], nil
+		}
+	case numericTypes[from.ID] && numericTypes[to.ID]:
+		f.execute = func(e *Engine, args [][]byte) ([]byte, error) {
+			return castNumber(from, to, args[0])
+		}
+	case (to.ID == types.Varchar || to.ID == types.Ascii) && !from.IsCollection() && from.ID != types.Tuple && from.ID != types.UDT:
+		f.execute = func(e *Engine, args [][]byte) ([]byte, error) {
+			s, err := formatValue(from, args[0])
+			if err != nil {
+				return nil, invalid("%s", err)
+			}
+			return []byte(s), nil
+		}
+	case from.ID == types.Timeuuid && (to.ID == types.Timestamp || to.ID == types.Date),
+		from.ID == types.Timestamp && to.ID == types.Date,
+		from.ID == types.Date && to.ID == types.Timestamp:
+		f.execute = func(e *Engine, args [][]byte) ([]byte, error) {
+			return convertTime(from, to, args[0])
+		}
+	default:
+		return nil, invalid("%s cannot be cast to %s", name, to)
+	}
+
+	return f, nil
+}
+
+// castNumber converts a number between numeric types. Like Java's
+// narrowing conversions, which Cassandra uses, integers wrap around and
+// fractions are truncated.
+func castNumber(from, to types.Type, b []byte) ([]byte, error) {
+	v, err := types.Unmarshal(from, b)
+	if err != nil {
+		return nil, invalid("%s", err)
+	}
+
+	var (
+		n *big.Int
+		d *inf.Dec
+		f float64
+	)
+	switch x := v.(type) {
+	case int8:
+		n = big.NewInt(int64(x))
+	case int16:
+		n = big.NewInt(int64(x))
+	case int32:
+		n = big.NewInt(int64(x))
+	case int64:
+		n = big.NewInt(x)
+	case *big.Int:
+		n = x
+	case float32:
+		f = float64(x)
+	case float64:
+		f = x
+	case *inf.Dec:
+		d = x
+	}
+
+	switch {
+	case n != nil:
+		f, _ = new(big.Float).SetInt(n).Float64()
+		d = inf.NewDecBig(n, 0)
+	case d != nil:
+		n = new(inf.Dec).Round(d, 0, inf.RoundDown).UnscaledBig()
+		f, _ = strconv.ParseFloat(d.String(), 64)
+	default:
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			n = big.NewInt(0)
+		} else {
+			n, _ = big.NewFloat(math.Trunc(f)).Int(nil)
+		}
+		d, _ = new(inf.Dec).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+	}
+
+	switch to.ID {
+	case types.Tinyint, types.Smallint, types.Int, types.Bigint, types.Counter:
+		return marshalInt(to, n.Int64())
+	case types.Varint:
+		return types.Marshal(to, n)
+	case types.Float:
+		return types.Marshal(to, float32(f))
+	case types.Double:
+		return types.Marshal(to, f)
+	}
+	return types.Marshal(to, d)
+}
+
+// formatValue returns the text representation of a value of a native
+// type, as returned by CAST(x AS text).
+func formatValue(t types.Type, b []byte) (string, error) {
+	v, err := types.Unmarshal(t, b)
+	if err != nil {
+		return "", err
+	}
+
+	switch x := v.(type) {
+	case time.Time:
+		if t.ID == types.Date {
+			return x.Format("2006-01-02"), nil
+		}
+		return x.Format("2006-01-02T15:04:05.000Z"), nil
+	case time.Duration:
+		d := time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC).Add(x)
+		return d.Format("15:04:05.000000000"), nil
+	case []byte:
+		return "0x" + hex.EncodeToString(x), nil
+	case net.IP:
+		return x.String(), nil
+	case float32:
+		return strconv.FormatFloat(float64(x), 'g', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64), nil
+	}
+	return fmt.Sprint(v), nil
+}
@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the time source of an engine, used for write timestamps and to
+// expire cells. It follows the system clock, shifted by the durations it
+// has been advanced by, unless it has been set to a fixed time. This allows
+// tests to observe expiring data without waiting.
+type Clock struct {
+	mu     sync.Mutex
+	offset time.Duration
+	fixed  time.Time
+	frozen bool
+
+	// last is the last write timestamp handed out in microseconds.
+	last int64
+}
+
+func NewClock() *Clock {
+	return &Clock{}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.frozen {
+		return c.fixed
+	}
+	return time.Now().Add(c.offset)
+}
+
+// timestamp returns the timestamp of a write in microseconds. Like
+// Cassandra, timestamps are strictly increasing, so that consecutive writes
+// are ordered even if the clock stands still or is moved backwards.
+func (c *Clock) timestamp() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now().Add(c.offset)
+	if c.frozen {
+		now = c.fixed
+	}
+
+	ts := now.UnixNano() / int64(time.Microsecond)
+	if ts <= c.last {
+		ts = c.last + 1
+	}
+	c.last = ts
+	return ts
+}
+
+// Advance moves the clock forward by d, or backwards if d is negative.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.frozen {
+		c.fixed = c.fixed.Add(d)
+		return
+	}
+	c.offset += d
+}
+
+// Set stops the clock at t. It only moves again when advanced.
+func (c *Clock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.fixed = t
+	c.frozen = true
+}
+
+// Frozen returns true if the clock has been set to a fixed time.
+func (c *Clock) Frozen() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.frozen
+}
+
+// Reset makes the clock follow the system clock again.
+func (c *Clock) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.offset = 0
+	c.fixed = time.Time{}
+	c.frozen = false
+}
@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+// Node is a node of the cluster as listed in system.local and system.peers.
+type Node struct {
+	// Address is the broadcast address of the node, which identifies it
+	// in system.peers.
+	Address    string
+	RPCAddress string
+
+	DataCenter string
+	Rack       string
+	HostID     string
+	Tokens     []string
+
+	// ReleaseVersion and NativeProtocolVersion are taken from the profile
+	// of the engine if empty.
+	ReleaseVersion        string
+	NativeProtocolVersion string
+
+	// SchemaVersion is the schema version the node reports. If empty, the
+	// node reports the version of the schema of the engine, i.e. it agrees
+	// with the local node.
+	SchemaVersion string
+}
+
+// Cluster describes the cluster the engine pretends to be part of. The
+// engine answers as the local node, peers are merely listed in
+// system.peers for drivers to discover them.
+type Cluster struct {
+	Name  string
+	Local Node
+	Peers []Node
+}
+
+// DefaultCluster returns a single node cluster that looks like a freshly
+// installed Cassandra node of the release the engine pretends to be.
+func DefaultCluster() Cluster {
+	return Cluster{
+		Name: "Test Cluster",
+		Local: Node{
+			Address:    "127.0.0.1",
+			RPCAddress: "127.0.0.1",
+			DataCenter: "datacenter1",
+			Rack:       "rack1",
+			HostID:     "2c0b9a4e-7dc7-4a5e-9b39-4a4cf1b2e6d1",
+			Tokens:     []string{"-9223372036854775808"},
+		},
+	}
+}
+
+// Cluster returns the cluster the engine pretends to be part of.
+func (e *Engine) Cluster() Cluster {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.cluster
+}
+
+// SetCluster changes the cluster the engine pretends to be part of.
+func (e *Engine) SetCluster(c Cluster) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.cluster = c
+}
+
+// node returns n with the versions it leaves empty taken from the profile
+// of the engine.
+func (e *Engine) node(n Node) Node {
+	p := e.Profile()
+	if n.ReleaseVersion == "" {
+		n.ReleaseVersion = p.ReleaseVersion
+	}
+	if n.NativeProtocolVersion == "" {
+		n.NativeProtocolVersion = fmt.Sprint(p.NativeProtocolVersion())
+	}
+	return n
+}
+
+// schemaVersion returns the version of the schema. Like in Cassandra it is
+// a name-based UUID derived from a description of the schema, so that it
+// changes with every schema change.
+func (e *Engine) schemaVersion() types.UUID {
+	h := &bytes.Buffer{}
+	for _, ks := range e.Keyspaces() {
+		replication := []string{}
+		for k, v := range ks.Replication {
+			replication = append(replication, k+"="+v)
+		}
+		sort.Strings(replication)
+		fmt.Fprintf(h, "keyspace %s %v %t\n", ks.Name, replication, ks.DurableWrites)
+
+		for _, t := range ks.sortedTables() {
+			fmt.Fprintf(h, "table %s %t %+v\n", t.Name, t.CompactStorage, t.Options)
+			if t.View != nil {
+				fmt.Fprintf(h, "view of %s %t where %s\n", t.View.Base, t.View.IncludeAll, t.View.WhereClause())
+			}
+			for _, c := range t.Columns {
+				fmt.Fprintf(h, "column %+v\n", *c)
+			}
+			for _, idx := range t.Indexes {
+				fmt.Fprintf(h, "index %+v\n", *idx)
+			}
+		}
+		for _, t := range ks.Types() {
+			fmt.Fprintf(h, "type %+v\n", t)
+		}
+		for _, f := range ks.Functions() {
+			fmt.Fprintf(h, "function %+v\n", *f)
+		}
+		for _, a := range ks.Aggregates() {
+			fmt.Fprintf(h, "aggregate %+v\n", *a)
+		}
+	}
+
+	return nameUUID(h.Bytes())
+}
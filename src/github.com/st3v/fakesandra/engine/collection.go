@@ -0,0 +1,489 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"github.com/st3v/fakesandra/cql/parser"
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+// collectionMutation changes the elements of a non-frozen collection or
+// the fields of a non-frozen user-defined type. Like in Cassandra, these
+// are stored as individual cells with their own timestamps and TTLs.
+// Elements are keyed by the set element, the map key, the field position
+// or, for lists, a key that sorts in list order. Null element values write
+// tombstones.
+//
+// Overwriting a collection deletes its existing elements with a tombstone
+// just before the timestamp of the mutation, so that the new elements
+// survive it, which is what Cassandra does.
+type collectionMutation struct {
+	deleted     bool
+	overwritten bool
+	elements    map[string][]byte
+	appended    [][]byte
+	prepended   [][]byte
+}
+
+// collection returns the changes m makes to the multi-cell column with
+// the given name.
+func (m *mutation) collection(name string) *collectionMutation {
+	cm, found := m.collections[name]
+	if !found {
+		cm = &collectionMutation{elements: map[string][]byte{}}
+		m.collections[name] = cm
+	}
+	return cm
+}
+
+// set writes the value v of column c. A nil value deletes the column.
+func (m *mutation) set(c *Column, v []byte) {
+	switch {
+	case c.Type.IsMultiCell():
+		m.collection(c.Name).overwrite(c.Type, v)
+	case c.Kind == Static:
+		m.statics[c.Name] = v
+	default:
+		m.cells[c.Name] = v
+	}
+}
+
+// overwrite replaces the elements of a collection or user-defined type t
+// with the elements of v, or deletes them all if v is nil.
+func (cm *collectionMutation) overwrite(t types.Type, v []byte) {
+	if v == nil {
+		cm.deleted = true
+		return
+	}
+
+	cm.overwritten = true
+	cm.add(t, v)
+}
+
+// add adds the elements of the encoded collection or user-defined type v
+// of type t. Elements are appended to lists and override existing elements
+// of sets and maps. Null fields are left untouched.
+func (cm *collectionMutation) add(t types.Type, v []byte) {
+	if t.ID == types.UDT {
+		fields, _ := types.SplitComponents(v, len(t.Fields))
+		for i, f := range fields {
+			if f != nil {
+				cm.elements[fieldKey(i)] = f
+			}
+		}
+		return
+	}
+
+	elems, _ := types.SplitCollection(v)
+	switch t.ID {
+	case types.List:
+		cm.appended = append(cm.appended, elems...)
+	case types.Set:
+		for _, e := range elems {
+			cm.elements[string(e)] = []byte{}
+		}
+	case types.Map:
+		for i := 0; i+1 < len(elems); i += 2 {
+			cm.elements[string(elems[i])] = elems[i+1]
+		}
+	}
+}
+
+// collectionOpKind is the kind of an element-level collection operation.
+type collectionOpKind int
+
+const (
+	// opAdd is c = c + v, which appends to lists.
+	opAdd collectionOpKind = iota
+	// opPrepend is c = v + c on lists.
+	opPrepend
+	// opDiscard is c = c - v. On maps v is the set of keys to remove.
+	opDiscard
+	// opSetElement is c[k] = v on lists and maps and c.f = v on
+	// user-defined types.
+	opSetElement
+	// opDeleteElement is DELETE c[k] or DELETE c.f.
+	opDeleteElement
+)
+
+// collectionOp is an element-level operation on a non-frozen collection or
+// user-defined type. Key is the list index, map key, set element or field
+// key the operation applies to, value its operand.
+type collectionOp struct {
+	column *Column
+	kind   collectionOpKind
+	key    []byte
+	value  []byte
+}
+
+// collectionAssignment evaluates an operation on the collection column c
+// in the SET clause of an UPDATE, e.g. c = c + ?, c = ? + c or c = c - ?.
+func (r *request) collectionAssignment(c *Column, op *parser.Operation) (*collectionOp, error) {
+	if !c.Type.IsMultiCell() {
+		return nil, invalid("Invalid operation (%s = %s) for frozen collection column %s", c.Name, op, c.Name)
+	}
+
+	left, leftIsColumn := op.Left.(*parser.Column)
+	right, rightIsColumn := op.Right.(*parser.Column)
+
+	var (
+		kind    collectionOpKind
+		operand parser.Term
+	)
+	switch {
+	case leftIsColumn && left.Name == c.Name && op.Op == "+":
+		kind, operand = opAdd, op.Right
+	case leftIsColumn && left.Name == c.Name && op.Op == "-":
+		kind, operand = opDiscard, op.Right
+	case rightIsColumn && right.Name == c.Name && op.Op == "+":
+		if c.Type.ID != types.List {
+			return nil, invalid("Invalid operation (%s = %s) for non list column %s", c.Name, op, c.Name)
+		}
+		kind, operand = opPrepend, op.Left
+	case op.Op == "+":
+		return nil, invalid("Only expressions of the form X = <value> + X or X = X + <value> are supported.")
+	default:
+		return nil, invalid("Only expressions of the form X = X %s<value> are supported.", op.Op)
+	}
+
+	typ := c.Type
+	if kind == opDiscard && typ.ID == types.Map {
+		typ = types.SetOf(typ.Elems[0])
+	}
+
+	value, err := r.bindAs(operand, c.Name, typ)
+	if err != nil {
+		return nil, err
+	}
+	return &collectionOp{column: c, kind: kind, value: value}, nil
+}
+
+// elementAssignment evaluates c[k] = v in the SET clause of an UPDATE.
+func (r *request) elementAssignment(c *Column, target *parser.Index, value parser.Term) (*collectionOp, error) {
+	expr := target.String() + " = " + value.String()
+	switch {
+	case !c.Type.IsCollection():
+		return nil, invalid("Invalid operation (%s) for non collection column %s", expr, c.Name)
+	case !c.Type.IsMultiCell():
+		return nil, invalid("Invalid operation (%s) for frozen collection column %s", expr, c.Name)
+	case c.Type.ID == types.Set:
+		return nil, invalid("Invalid operation (%s) for set column %s", expr, c.Name)
+	}
+
+	op := &collectionOp{column: c, kind: opSetElement}
+
+	var err error
+	if op.key, err = r.elementKey(c, target.Key); err != nil {
+		return nil, err
+	}
+
+	valueType := c.Type.Elems[len(c.Type.Elems)-1]
+	if op.value, err = r.bindAs(value, c.Name, valueType); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// elementDeletion evaluates DELETE c[k].
+func (r *request) elementDeletion(c *Column, target *parser.Index) (*collectionOp, error) {
+	switch {
+	case !c.Type.IsCollection():
+		return nil, invalid("Invalid deletion operation for non collection column %s", c.Name)
+	case !c.Type.IsMultiCell():
+		return nil, invalid("Invalid deletion operation for frozen collection column %s", c.Name)
+	}
+
+	key, err := r.elementKey(c, target.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &collectionOp{column: c, kind: opDeleteElement, key: key}, nil
+}
+
+// fieldAssignment evaluates c.f = v in the SET clause of an UPDATE.
+func (r *request) fieldAssignment(c *Column, target *parser.Field, value parser.Term) (*collectionOp, error) {
+	expr := target.String() + " = " + value.String()
+	switch {
+	case c.Type.ID != types.UDT:
+		return nil, invalid("Invalid operation (%s) for non-UDT column %s", expr, c.Name)
+	case !c.Type.IsMultiCell():
+		return nil, invalid("Invalid operation (%s) for frozen UDT column %s", expr, c.Name)
+	}
+
+	i := fieldIndex(c.Type, target.Name)
+	if i < 0 {
+		return nil, invalid("UDT column %s does not have a field named %s", c.Name, target.Name)
+	}
+
+	v, err := r.bindAs(value, c.Name+"."+target.Name, c.Type.Elems[i])
+	if err != nil {
+		return nil, err
+	}
+	return &collectionOp{column: c, kind: opSetElement, key: []byte(fieldKey(i)), value: v}, nil
+}
+
+// fieldDeletion evaluates DELETE c.f.
+func (r *request) fieldDeletion(c *Column, target *parser.Field) (*collectionOp, error) {
+	switch {
+	case c.Type.ID != types.UDT:
+		return nil, invalid("Invalid deletion operation for non-UDT column %s", c.Name)
+	case !c.Type.IsMultiCell():
+		return nil, invalid("Frozen UDT column %s does not support field deletions", c.Name)
+	}
+
+	i := fieldIndex(c.Type, target.Name)
+	if i < 0 {
+		return nil, invalid("UDT column %s does not have a field named %s", c.Name, target.Name)
+	}
+	return &collectionOp{column: c, kind: opDeleteElement, key: []byte(fieldKey(i))}, nil
+}
+
+// elementKey evaluates the list index, map key or set element of c[k].
+func (r *request) elementKey(c *Column, term parser.Term) ([]byte, error) {
+	if c.Type.ID == types.List {
+		b, err := r.bindAs(term, "idx("+c.Name+")", types.Native(types.Int))
+		if err != nil {
+			return nil, err
+		}
+		if b == nil {
+			return nil, invalid("Invalid null value for list index")
+		}
+		return b, nil
+	}
+
+	b, err := r.bindAs(term, "key("+c.Name+")", c.Type.Elems[0])
+	if err != nil {
+		return nil, err
+	}
+	if b == nil && c.Type.ID == types.Map {
+		return nil, invalid("Invalid null map key")
+	}
+	if b == nil {
+		return nil, invalid("Invalid null set element")
+	}
+	return b, nil
+}
+
+// apply adds op to the mutation m of table t. Operations that depend on
+// the elements of a list read the current list first, like Cassandra does.
+func (op *collectionOp) apply(t *Table, m *mutation) error {
+	c := op.column
+	cm := m.collection(c.Name)
+
+	switch op.kind {
+	case opAdd:
+		if op.value != nil {
+			cm.add(c.Type, op.value)
+		}
+		return nil
+	case opPrepend:
+		if op.value != nil {
+			elems, _ := types.SplitCollection(op.value)
+			cm.prepended = append(elems, cm.prepended...)
+		}
+		return nil
+	case opDiscard:
+		if op.value == nil {
+			return nil
+		}
+		elems, _ := types.SplitCollection(op.value)
+		if c.Type.ID != types.List {
+			for _, e := range elems {
+				cm.elements[string(e)] = nil
+			}
+			return nil
+		}
+		keys, values := t.data.elements(t, m, c)
+		for i, v := range values {
+			for _, e := range elems {
+				if types.Compare(c.Type.Elems[0], v, e) == 0 {
+					cm.elements[keys[i]] = nil
+					break
+				}
+			}
+		}
+		return nil
+	}
+
+	if c.Type.ID != types.List {
+		value := op.value
+		if op.kind == opDeleteElement {
+			value = nil
+		}
+		cm.elements[string(op.key)] = value
+		return nil
+	}
+
+	v, _ := types.Unmarshal(types.Native(types.Int), op.key)
+	idx := int(v.(int32))
+
+	keys, _ := t.data.elements(t, m, c)
+	switch {
+	case len(keys) == 0 && op.kind == opSetElement:
+		return invalid("Attempted to set an element on a list which is null")
+	case len(keys) == 0:
+		return invalid("Attempted to delete an element from a list which is null")
+	case idx < 0 || idx >= len(keys):
+		return invalid("List index %d out of bound, list has size %d", idx, len(keys))
+	}
+
+	if op.kind == opDeleteElement {
+		cm.elements[keys[idx]] = nil
+	} else {
+		cm.elements[keys[idx]] = op.value
+	}
+	return nil
+}
+
+// elements returns the keys and values of the live elements of collection
+// column c in the row written by m, in the order of the collection.
+func (s *store) elements(t *Table, m *mutation, c *Column) ([]string, [][]byte) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, found := s.partition(m.key)
+	if !found {
+		return nil, nil
+	}
+
+	cl, deletion := p.static[c.Name], p.deletion
+	if c.Kind != Static {
+		i, found := p.search(t, m.clustering)
+		if !found {
+			return nil, nil
+		}
+		cl, deletion = p.rows[i].cells[c.Name], p.rowDeletion(t, m.clustering)
+	}
+	if cl == nil {
+		return nil, nil
+	}
+
+	keys := cl.liveElements(c.Type, deletion, m.now)
+	values := make([][]byte, len(keys))
+	for i, k := range keys {
+		values[i] = cl.elements[k].value
+	}
+	return keys, values
+}
+
+// writeCollection applies the changes cm of m to the multi-cell c,
+// which is nil if the collection has never been written.
+func (s *store) writeCollection(m *mutation, c *cell, cm *collectionMutation) *cell {
+	if c == nil {
+		c = &cell{timestamp: noTimestamp, elements: map[string]*cell{}}
+	}
+
+	deletion := c.timestamp
+	switch {
+	case cm.deleted && m.timestamp > deletion:
+		deletion = m.timestamp
+	case cm.overwritten && m.timestamp-1 > deletion:
+		deletion = m.timestamp - 1
+	}
+
+	if deletion != c.timestamp {
+		c.timestamp = deletion
+		for k, e := range c.elements {
+			if e.timestamp <= deletion {
+				delete(c.elements, k)
+			}
+		}
+	}
+
+	for i := len(cm.prepended) - 1; i >= 0; i-- {
+		s.sequence++
+		c.elements[listKey(-s.sequence)] = m.cell(cm.prepended[i])
+	}
+	for _, v := range cm.appended {
+		s.sequence++
+		c.elements[listKey(s.sequence)] = m.cell(v)
+	}
+
+	m.setCells(c.elements, cm.elements)
+	return c
+}
+
+// fieldKey returns the key of the field at position i of a user-defined
+// type. Keys sort in the order of the fields.
+func fieldKey(i int) string {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, uint16(i))
+	return string(b)
+}
+
+// listKey returns the key of a list element. Keys sort in the order of
+// their sequence numbers, appended elements get increasing and prepended
+// elements decreasing numbers. Cassandra uses time-based UUIDs instead.
+func listKey(sequence int64) string {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(sequence)^(1<<63))
+	return string(b)
+}
+
+// liveElements returns the keys of the elements of the multi-cell c of
+// type t that have neither been deleted nor expired at now. Lists are
+// returned in list order, user-defined types in field order and sets and
+// maps sorted by their keys of type t.Elems[0].
+func (c *cell) liveElements(t types.Type, deletion, now int64) []string {
+	if c.timestamp > deletion {
+		deletion = c.timestamp
+	}
+
+	keys := []string{}
+	for k, e := range c.elements {
+		if e.timestamp > deletion && e.live(now) {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if t.ID == types.List || t.ID == types.UDT {
+			return bytes.Compare([]byte(keys[i]), []byte(keys[j])) < 0
+		}
+		return types.Compare(t.Elems[0], []byte(keys[i]), []byte(keys[j])) < 0
+	})
+	return keys
+}
+
+// liveValue returns a cell holding the encoded value of the multi-cell c
+// of type t, or nil if it has no live elements. Like in Cassandra, empty
+// collections are null, as are user-defined types without any fields set.
+// The timestamp is the latest timestamp of the elements.
+func (c *cell) liveValue(t types.Type, deletion, now int64) *cell {
+	keys := c.liveElements(t, deletion, now)
+	if len(keys) == 0 {
+		return nil
+	}
+
+	lc := &cell{timestamp: noTimestamp}
+	elems := [][]byte{}
+	fields := make([][]byte, len(t.Fields))
+	for _, k := range keys {
+		e := c.elements[k]
+		if e.timestamp > lc.timestamp {
+			lc.timestamp = e.timestamp
+		}
+
+		switch t.ID {
+		case types.List:
+			elems = append(elems, e.value)
+		case types.Set:
+			elems = append(elems, []byte(k))
+		case types.Map:
+			elems = append(elems, []byte(k), e.value)
+		case types.UDT:
+			if i := int(binary.BigEndian.Uint16([]byte(k))); i < len(fields) {
+				fields[i] = e.value
+			}
+		}
+	}
+
+	if t.ID == types.UDT {
+		lc.value = types.JoinComponents(fields)
+	} else {
+		lc.value = types.JoinCollection(elems, len(keys))
+	}
+	return lc
+}
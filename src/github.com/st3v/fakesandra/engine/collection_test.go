@@ -0,0 +1,149 @@
+package engine_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/cql/types"
+	"github.com/st3v/fakesandra/engine"
+)
+
+var _ = Describe("Collections", func() {
+	var e *engine.Engine
+
+	BeforeEach(func() {
+		e = engine.New()
+		exec(e, "CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}")
+		exec(e, "CREATE TABLE ks.t (p int PRIMARY KEY, l list<text>, s set<int>, m map<text, int>, f frozen<list<int>>)")
+	})
+
+	Describe("lists", func() {
+		BeforeEach(func() {
+			exec(e, "INSERT INTO ks.t (p, l) VALUES (1, ['b', 'c'])")
+		})
+
+		It("appends and prepends elements", func() {
+			exec(e, "UPDATE ks.t SET l = l + ['d'] WHERE p = 1")
+			exec(e, "UPDATE ks.t SET l = ['x', 'a'] + l WHERE p = 1")
+			exec(e, "UPDATE ks.t SET l += ['e'] WHERE p = 1")
+			Expect(value(e, "SELECT l FROM ks.t WHERE p = 1")).To(Equal([]interface{}{"x", "a", "b", "c", "d", "e"}))
+		})
+
+		It("keeps insertion order while the clock stands still", func() {
+			e.Clock().Set(e.Clock().Now())
+			exec(e, "UPDATE ks.t SET l = l + ['d'] WHERE p = 1")
+			exec(e, "UPDATE ks.t SET l = l + ['e'] WHERE p = 1")
+			Expect(value(e, "SELECT l FROM ks.t WHERE p = 1")).To(Equal([]interface{}{"b", "c", "d", "e"}))
+		})
+
+		It("sets and deletes elements by index", func() {
+			exec(e, "UPDATE ks.t SET l[1] = 'x' WHERE p = 1")
+			Expect(value(e, "SELECT l FROM ks.t WHERE p = 1")).To(Equal([]interface{}{"b", "x"}))
+
+			exec(e, "DELETE l[0] FROM ks.t WHERE p = 1")
+			Expect(value(e, "SELECT l FROM ks.t WHERE p = 1")).To(Equal([]interface{}{"x"}))
+
+			expectInvalid(e, "UPDATE ks.t SET l[3] = 'y' WHERE p = 1", "List index 3 out of bound, list has size 1")
+			expectInvalid(e, "UPDATE ks.t SET l[0] = 'y' WHERE p = 2", "Attempted to set an element on a list which is null")
+			expectInvalid(e, "DELETE l[0] FROM ks.t WHERE p = 2", "Attempted to delete an element from a list which is null")
+		})
+
+		It("removes all occurrences of values", func() {
+			exec(e, "UPDATE ks.t SET l = l + ['b', 'd'] WHERE p = 1")
+			exec(e, "UPDATE ks.t SET l = l - ['b'] WHERE p = 1")
+			Expect(value(e, "SELECT l FROM ks.t WHERE p = 1")).To(Equal([]interface{}{"c", "d"}))
+		})
+
+		It("replaces all elements when overwritten", func() {
+			exec(e, "UPDATE ks.t SET l = ['z'] WHERE p = 1")
+			Expect(value(e, "SELECT l FROM ks.t WHERE p = 1")).To(Equal([]interface{}{"z"}))
+
+			exec(e, "UPDATE ks.t SET l = [] WHERE p = 1")
+			Expect(value(e, "SELECT l FROM ks.t WHERE p = 1")).To(BeNil())
+		})
+	})
+
+	Describe("sets", func() {
+		It("adds and removes elements in key order", func() {
+			exec(e, "UPDATE ks.t SET s = s + {3, 1} WHERE p = 1")
+			exec(e, "UPDATE ks.t SET s = s + {2, 4} WHERE p = 1")
+			exec(e, "UPDATE ks.t SET s = s - {4} WHERE p = 1")
+			exec(e, "DELETE s[1] FROM ks.t WHERE p = 1")
+			Expect(value(e, "SELECT s FROM ks.t WHERE p = 1")).To(Equal([]interface{}{int32(2), int32(3)}))
+		})
+
+		It("rejects setting elements by index", func() {
+			expectInvalid(e, "UPDATE ks.t SET s[1] = 1 WHERE p = 1", "Invalid operation (s[1] = 1) for set column s")
+			expectInvalid(e, "UPDATE ks.t SET s = {1} + s WHERE p = 1", "Invalid operation (s = {1} + s) for non list column s")
+		})
+	})
+
+	Describe("maps", func() {
+		BeforeEach(func() {
+			exec(e, "INSERT INTO ks.t (p, m) VALUES (1, {'b': 2, 'a': 1})")
+		})
+
+		It("puts and deletes entries", func() {
+			exec(e, "UPDATE ks.t SET m['c'] = 3, m['a'] = 10 WHERE p = 1")
+			exec(e, "UPDATE ks.t SET m = m + {'d': 4} WHERE p = 1")
+			exec(e, "UPDATE ks.t SET m = m - {'b'} WHERE p = 1")
+			exec(e, "DELETE m['d'] FROM ks.t WHERE p = 1")
+			exec(e, "UPDATE ks.t SET m['e'] = null WHERE p = 1")
+
+			Expect(value(e, "SELECT m FROM ks.t WHERE p = 1")).To(Equal([]types.Pair{
+				{Key: "a", Value: int32(10)},
+				{Key: "c", Value: int32(3)},
+			}))
+		})
+
+		It("resolves concurrent writes of entries by timestamp", func() {
+			exec(e, "UPDATE ks.t USING TIMESTAMP 10 SET m['a'] = 5 WHERE p = 2")
+			exec(e, "UPDATE ks.t USING TIMESTAMP 20 SET m['x'] = 6 WHERE p = 2")
+			exec(e, "UPDATE ks.t USING TIMESTAMP 15 SET m = {'y': 7} WHERE p = 2")
+
+			Expect(value(e, "SELECT m FROM ks.t WHERE p = 2")).To(Equal([]types.Pair{
+				{Key: "x", Value: int32(6)},
+				{Key: "y", Value: int32(7)},
+			}))
+		})
+
+		It("expires entries individually", func() {
+			e.Clock().Set(e.Clock().Now())
+			exec(e, "UPDATE ks.t USING TTL 10 SET m['c'] = 3 WHERE p = 1")
+			e.Clock().Advance(11 * time.Second)
+
+			Expect(value(e, "SELECT m FROM ks.t WHERE p = 1")).To(HaveLen(2))
+		})
+
+		It("rejects null keys", func() {
+			expectInvalid(e, "UPDATE ks.t SET m[null] = 1 WHERE p = 1", "Invalid null map key")
+		})
+	})
+
+	It("keeps rows alive through collection elements", func() {
+		exec(e, "UPDATE ks.t SET s = s + {1} WHERE p = 2")
+		Expect(value(e, "SELECT p FROM ks.t WHERE p = 2")).To(Equal(int32(2)))
+
+		exec(e, "DELETE s[1] FROM ks.t WHERE p = 2")
+		Expect(value(e, "SELECT p FROM ks.t WHERE p = 2")).To(BeNil())
+	})
+
+	It("rejects element operations on frozen collections", func() {
+		expectInvalid(e, "UPDATE ks.t SET f = f + [1] WHERE p = 1", "Invalid operation (f = f + [1]) for frozen collection column f")
+		expectInvalid(e, "UPDATE ks.t SET f[0] = 1 WHERE p = 1", "Invalid operation (f[0] = 1) for frozen collection column f")
+		expectInvalid(e, "DELETE f[0] FROM ks.t WHERE p = 1", "Invalid deletion operation for frozen collection column f")
+	})
+
+	It("stores frozen collections inside user-defined types as a whole", func() {
+		exec(e, "CREATE TYPE ks.address (street text, tags frozen<set<text>>)")
+		exec(e, "CREATE TABLE ks.u (p int PRIMARY KEY, a frozen<address>)")
+		exec(e, "INSERT INTO ks.u (p, a) VALUES (1, {street: 'Main', tags: {'b', 'a'}})")
+
+		Expect(value(e, "SELECT a FROM ks.u WHERE p = 1")).To(Equal(map[string]interface{}{
+			"street": "Main",
+			"tags":   []interface{}{"a", "b"},
+		}))
+	})
+})
@@ -0,0 +1,64 @@
+package engine_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/engine"
+)
+
+var _ = Describe("Counters", func() {
+	var e *engine.Engine
+
+	BeforeEach(func() {
+		e = engine.New()
+		exec(e, "CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}")
+		exec(e, "CREATE TABLE ks.hits (page text, day int, views counter, clicks counter, PRIMARY KEY (page, day))")
+	})
+
+	It("increments and decrements counters", func() {
+		exec(e, "UPDATE ks.hits SET views = views + 3 WHERE page = 'a' AND day = 1")
+		exec(e, "UPDATE ks.hits SET views = views + 2, clicks = clicks + 1 WHERE page = 'a' AND day = 1")
+		exec(e, "UPDATE ks.hits SET clicks = clicks - 5 WHERE page = 'a' AND day = 1")
+		exec(e, "UPDATE ks.hits SET views = views + 1 WHERE page = 'a' AND day IN (1, 2)")
+
+		Expect(values(e, "SELECT views, clicks FROM ks.hits WHERE page = 'a'")).To(Equal([][]interface{}{
+			{int64(6), int64(-4)},
+			{int64(1), nil},
+		}))
+	})
+
+	It("starts over after a deletion", func() {
+		e.Clock().Set(e.Clock().Now())
+		exec(e, "UPDATE ks.hits SET views = views + 3 WHERE page = 'a' AND day = 1")
+		e.Clock().Advance(time.Millisecond)
+		exec(e, "DELETE views FROM ks.hits WHERE page = 'a' AND day = 1")
+		e.Clock().Advance(time.Millisecond)
+		exec(e, "UPDATE ks.hits SET views = views + 1 WHERE page = 'a' AND day = 1")
+
+		Expect(values(e, "SELECT views FROM ks.hits")).To(Equal([][]interface{}{{int64(1)}}))
+	})
+
+	It("enforces the rules for counter tables", func() {
+		expectInvalid(e, "CREATE TABLE ks.mixed (p int PRIMARY KEY, c counter, v int)", "Cannot mix counter and non counter columns in the same table")
+		expectInvalid(e, "CREATE TABLE ks.key (p counter PRIMARY KEY, c counter)", "counter type is not supported for PRIMARY KEY part p")
+		expectInvalid(e, "CREATE TABLE ks.ttl (p int PRIMARY KEY, c counter) WITH default_time_to_live = 10", "Cannot set default_time_to_live on a table with counters")
+		expectInvalid(e, "CREATE TABLE ks.list (p int PRIMARY KEY, c list<counter>)", "Counters are not allowed inside collections: list<counter>")
+		expectInvalid(e, "ALTER TABLE ks.hits ADD v int", "Cannot add a non counter column (v) in a counter column family")
+
+		exec(e, "CREATE TABLE ks.t (p int PRIMARY KEY, v int)")
+		expectInvalid(e, "ALTER TABLE ks.t ADD c counter", "Cannot add a counter column (c) in a non counter column family")
+	})
+
+	It("only allows increments and decrements", func() {
+		expectInvalid(e, "INSERT INTO ks.hits (page, day, views) VALUES ('a', 1, 1)", "INSERT statements are not allowed on counter tables, use UPDATE instead")
+		expectInvalid(e, "UPDATE ks.hits SET views = 1 WHERE page = 'a' AND day = 1", "Cannot set the value of counter column views (counters can only be incremented/decremented, not set)")
+		expectInvalid(e, "UPDATE ks.hits SET views = clicks + 1 WHERE page = 'a' AND day = 1", "Only expressions of the form X = X +<value> are supported.")
+		expectInvalid(e, "UPDATE ks.hits SET views = views + null WHERE page = 'a' AND day = 1", "Invalid null value for counter increment")
+		expectInvalid(e, "UPDATE ks.hits USING TTL 10 SET views = views + 1 WHERE page = 'a' AND day = 1", "Cannot provide custom TTL for counter updates")
+		expectInvalid(e, "UPDATE ks.hits USING TIMESTAMP 10 SET views = views + 1 WHERE page = 'a' AND day = 1", "Cannot provide custom timestamp for counter updates")
+		expectInvalid(e, "UPDATE ks.hits SET views = views + 1 WHERE page = 'a' AND day = 1 IF EXISTS", "Conditional updates are not supported on counter tables")
+	})
+})
@@ -0,0 +1,774 @@
+package engine
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/st3v/fakesandra/cql/parser"
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+// createKeyspace executes CREATE KEYSPACE.
+func (e *Engine) createKeyspace(s *parser.CreateKeyspace) (result.Result, error) {
+	if isSystemKeyspace(s.Keyspace) {
+		return nil, invalid("%s keyspace is not user-modifiable", s.Keyspace)
+	}
+
+	ks := newKeyspace(s.Keyspace)
+	if err := ks.setOptions(s.Options); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, found := e.keyspaces[ks.Name]; found {
+		if s.IfNotExists {
+			return result.Void{}, nil
+		}
+		return nil, &proto.AlreadyExistsError{Keyspace: ks.Name}
+	}
+	e.keyspaces[ks.Name] = ks
+
+	return keyspaceChange(result.Created, ks.Name), nil
+}
+
+// alterKeyspace executes ALTER KEYSPACE.
+func (e *Engine) alterKeyspace(s *parser.AlterKeyspace) (result.Result, error) {
+	if isSystemKeyspace(s.Keyspace) {
+		return nil, invalid("%s keyspace is not user-modifiable", s.Keyspace)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ks, found := e.keyspaces[s.Keyspace]
+	if !found {
+		return nil, invalid("Unknown keyspace %s", s.Keyspace)
+	}
+
+	ks = ks.clone()
+	if err := ks.setOptions(s.Options); err != nil {
+		return nil, err
+	}
+	e.keyspaces[ks.Name] = ks
+
+	return keyspaceChange(result.Updated, ks.Name), nil
+}
+
+// dropKeyspace executes DROP KEYSPACE.
+func (e *Engine) dropKeyspace(s *parser.DropKeyspace) (result.Result, error) {
+	if isSystemKeyspace(s.Keyspace) {
+		return nil, invalid("%s keyspace is not user-modifiable", s.Keyspace)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, found := e.keyspaces[s.Keyspace]; !found {
+		if s.IfExists {
+			return result.Void{}, nil
+		}
+		return nil, configError("Cannot drop non existing keyspace '%s'.", s.Keyspace)
+	}
+	delete(e.keyspaces, s.Keyspace)
+
+	return keyspaceChange(result.Dropped, s.Keyspace), nil
+}
+
+func keyspaceChange(change, keyspace string) result.SchemaChange {
+	return result.SchemaChange{
+		Change:   change,
+		Target:   result.TargetKeyspace,
+		Keyspace: keyspace,
+	}
+}
+
+// locatorPackage is the package of Cassandra's replication strategies.
+const locatorPackage = "org.apache.cassandra.locator."
+
+func (ks *Keyspace) setOptions(options parser.Properties) error {
+	for _, o := range options {
+		switch o.Name {
+		case "replication":
+			m, err := mapOption(o)
+			if err != nil {
+				return err
+			}
+			ks.Replication = m
+		case "durable_writes":
+			ks.DurableWrites = strings.EqualFold(constant(o.Value), "true")
+		default:
+			return syntaxError("Unknown property '%s'", o.Name)
+		}
+	}
+
+	if ks.Replication["class"] == "" {
+		return configError("Missing mandatory replication strategy class")
+	}
+
+	if !strings.Contains(ks.Replication["class"], ".") {
+		ks.Replication["class"] = locatorPackage + ks.Replication["class"]
+	}
+
+	return ks.validateReplication()
+}
+
+// validateReplication rejects replication strategies other than
+// SimpleStrategy and NetworkTopologyStrategy and validates their options
+// like Cassandra does.
+func (ks *Keyspace) validateReplication() error {
+	class := ks.Replication["class"]
+
+	switch class {
+	case locatorPackage + "SimpleStrategy":
+		rf, found := ks.Replication["replication_factor"]
+		if !found {
+			return configError("SimpleStrategy requires a replication_factor strategy option.")
+		}
+		for name := range ks.Replication {
+			if name != "class" && name != "replication_factor" {
+				return configError("Unrecognized strategy option {%s} passed to SimpleStrategy for keyspace %s", name, ks.Name)
+			}
+		}
+		return validateReplicationFactor(rf)
+
+	case locatorPackage + "NetworkTopologyStrategy":
+		for name, rf := range ks.Replication {
+			switch name {
+			case "class":
+				continue
+			case "replication_factor":
+				return configError("replication_factor is an option for SimpleStrategy, not NetworkTopologyStrategy")
+			}
+			if err := validateReplicationFactor(rf); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case locatorPackage + "LocalStrategy":
+		return configError("Unable to use given strategy class: LocalStrategy is reserved for internal use.")
+	}
+
+	return configError("Unable to find replication strategy class '%s'", class)
+}
+
+// validateReplicationFactor checks that rf is a non-negative integer.
+func validateReplicationFactor(rf string) error {
+	n, err := strconv.Atoi(rf)
+	if err != nil {
+		return configError("Replication factor must be numeric; found %s", rf)
+	}
+	if n < 0 {
+		return configError("Replication factor must be non-negative; found %s", rf)
+	}
+	return nil
+}
+
+// constant returns the value of a literal as a string.
+func constant(t parser.Term) string {
+	if l, ok := t.(*parser.Literal); ok {
+		return l.Value
+	}
+	return t.String()
+}
+
+// modifiableKeyspace returns the keyspace a schema statement on name refers
+// to. The caller has to hold the write lock.
+func (e *Engine) modifiableKeyspace(r *request, name parser.Name) (*Keyspace, error) {
+	ksName, err := r.keyspaceName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if isSystemKeyspace(ksName) {
+		return nil, invalid("%s keyspace is not user-modifiable", ksName)
+	}
+
+	ks, found := e.keyspaces[ksName]
+	if !found {
+		return nil, invalid("Keyspace %s does not exist", ksName)
+	}
+	return ks, nil
+}
+
+// createTable executes CREATE TABLE.
+func (e *Engine) createTable(r *request, s *parser.CreateTable) (result.Result, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ks, err := e.modifiableKeyspace(r, s.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := buildTable(ks, s)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, found := ks.tables[t.Name]; found {
+		if s.IfNotExists {
+			return result.Void{}, nil
+		}
+		return nil, &proto.AlreadyExistsError{Keyspace: ks.Name, Table: t.Name}
+	}
+
+	ks = ks.clone()
+	ks.tables[t.Name] = t
+	e.keyspaces[ks.Name] = ks
+
+	return tableChange(result.Created, t), nil
+}
+
+// alterTable executes ALTER TABLE.
+func (e *Engine) alterTable(r *request, s *parser.AlterTable) (result.Result, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ks, err := e.modifiableKeyspace(r, s.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	t, found := ks.tables[s.Table.Name]
+	switch {
+	case !found:
+		return nil, invalid("unconfigured table %s", s.Table.Name)
+	case t.View != nil:
+		return nil, invalid("Cannot use ALTER TABLE on Materialized View")
+	}
+	t = t.clone()
+
+	views := ks.views(t.Name)
+	var dropped []string
+
+	switch {
+	case len(s.Add) > 0:
+		err = addColumns(ks, t, s.Add)
+	case len(s.Drop) > 0 && len(views) > 0:
+		err = invalid("Cannot drop column %s on base table %s with materialized views.", s.Drop[0], t.Name)
+	case len(s.Drop) > 0:
+		err = dropColumns(t, s.Drop)
+		dropped = s.Drop
+	case len(s.Rename) > 0:
+		err = renameColumns(ks, t, s.Rename)
+	case s.Alter != nil:
+		err = invalid("Altering of types is not allowed")
+	default:
+		if err = t.Options.set(s.Options); err == nil {
+			err = t.checkCounters()
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, v := range views {
+		if views[i], err = r.followBase(v, t, s); err != nil {
+			return nil, err
+		}
+	}
+
+	ks = ks.clone()
+	ks.tables[t.Name] = t
+	for _, v := range views {
+		ks.tables[v.Name] = v
+	}
+	e.keyspaces[ks.Name] = ks
+
+	for _, name := range dropped {
+		t.data.dropColumn(name)
+	}
+
+	return tableChange(result.Updated, t), nil
+}
+
+func addColumns(ks *Keyspace, t *Table, defs []parser.ColumnDef) error {
+	columns := t.Columns
+	for _, d := range defs {
+		if _, found := t.Column(d.Name); found {
+			return invalid("Invalid column name %s because it conflicts with an existing column", d.Name)
+		}
+
+		typ, err := resolveType(ks, d.Type)
+		if err != nil {
+			return err
+		}
+
+		switch counter := typ.ID == types.Counter; {
+		case counter && !t.IsCounter():
+			return invalid("Cannot add a counter column (%s) in a non counter column family", d.Name)
+		case !counter && t.IsCounter():
+			return invalid("Cannot add a non counter column (%s) in a counter column family", d.Name)
+		}
+
+		c := &Column{Name: d.Name, Type: typ, Kind: Regular, Position: -1}
+		if d.Static {
+			if len(t.ClusteringKey) == 0 {
+				return invalid("Static columns are only useful (and thus allowed) if the table has at least one clustering column")
+			}
+			c.Kind = Static
+		}
+
+		columns = append(columns, c)
+		t.setColumns(columns)
+	}
+	return nil
+}
+
+func dropColumns(t *Table, names []string) error {
+	drop := map[string]bool{}
+	for _, name := range names {
+		c, found := t.Column(name)
+		if !found {
+			return invalid("Column %s was not found in table %s", name, t.Name)
+		}
+		if c.IsPrimaryKey() {
+			return invalid("Cannot drop PRIMARY KEY part %s", name)
+		}
+		if idx, found := t.indexOn(c); found {
+			return invalid("Cannot drop column %s because it has dependent secondary indexes (%s)", name, idx.Name)
+		}
+		drop[name] = true
+	}
+
+	columns := []*Column{}
+	for _, c := range t.Columns {
+		if !drop[c.Name] {
+			columns = append(columns, c)
+		}
+	}
+	t.setColumns(columns)
+
+	return nil
+}
+
+func renameColumns(ks *Keyspace, t *Table, renames []parser.Rename) error {
+	for _, rn := range renames {
+		c, found := t.Column(rn.From)
+		if !found {
+			return invalid("Cannot rename unknown column %s in keyspace %s", rn.From, ks.Name)
+		}
+		if !c.IsPrimaryKey() {
+			return invalid("Cannot rename non PRIMARY KEY part %s", rn.From)
+		}
+		if _, found := t.Column(rn.To); found {
+			return invalid("Cannot rename column %s to %s in keyspace %s; another column of that name already exist", rn.From, rn.To, ks.Name)
+		}
+
+		for i, idx := range t.Indexes {
+			if idx.Column == rn.From {
+				renamed := *idx
+				renamed.Column = rn.To
+				t.Indexes[i] = &renamed
+			}
+		}
+
+		c.Name = rn.To
+		t.setColumns(t.Columns)
+	}
+	return nil
+}
+
+// dropTable executes DROP TABLE.
+func (e *Engine) dropTable(r *request, s *parser.DropTable) (result.Result, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ks, err := e.modifiableKeyspace(r, s.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	t, found := ks.tables[s.Table.Name]
+	if !found {
+		if s.IfExists {
+			return result.Void{}, nil
+		}
+		return nil, configError("Cannot drop non existing table '%s' in keyspace '%s'.", s.Table.Name, ks.Name)
+	}
+
+	if t.View != nil {
+		return nil, invalid("Cannot use DROP TABLE on Materialized View")
+	}
+
+	if views := ks.views(t.Name); len(views) > 0 {
+		names := make([]string, len(views))
+		for i, v := range views {
+			names[i] = v.Name
+		}
+		return nil, invalid("Cannot drop table when materialized views still depend on it (%s.{%s})", ks.Name, strings.Join(names, ","))
+	}
+
+	ks = ks.clone()
+	delete(ks.tables, t.Name)
+	e.keyspaces[ks.Name] = ks
+
+	return tableChange(result.Dropped, t), nil
+}
+
+// truncate executes TRUNCATE. The materialized views of the table are
+// truncated as well.
+func (e *Engine) truncate(r *request, s *parser.Truncate) (result.Result, error) {
+	t, err := e.table(r, s.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.View != nil {
+		return nil, invalid("Cannot TRUNCATE materialized view directly; must truncate base table instead")
+	}
+
+	t.data.truncate()
+	for _, v := range e.views(t) {
+		v.data.truncate()
+	}
+	return result.Void{}, nil
+}
+
+func tableChange(change string, t *Table) result.SchemaChange {
+	return result.SchemaChange{
+		Change:   change,
+		Target:   result.TargetTable,
+		Keyspace: t.Keyspace,
+		Name:     t.Name,
+	}
+}
+
+// buildTable validates the definition of a table and builds its columns.
+func buildTable(ks *Keyspace, s *parser.CreateTable) (*Table, error) {
+	if s.PartitionKey == nil {
+		return nil, invalid("No PRIMARY KEY specifed (exactly one required)")
+	}
+
+	defs := map[string]parser.ColumnDef{}
+	for _, d := range s.Columns {
+		if _, found := defs[d.Name]; found {
+			return nil, invalid("Multiple definition of identifier %s", d.Name)
+		}
+		defs[d.Name] = d
+	}
+
+	columns := []*Column{}
+	keys := map[string]bool{}
+
+	addKey := func(name string, kind ColumnKind, position int) error {
+		d, found := defs[name]
+		if !found {
+			return invalid("Unknown definition %s referenced in PRIMARY KEY", name)
+		}
+		if keys[name] {
+			return invalid("Multiple definition of identifier %s", name)
+		}
+		if d.Static {
+			return invalid("Static column %s cannot be part of the PRIMARY KEY", name)
+		}
+
+		typ, err := resolveType(ks, d.Type)
+		if err != nil {
+			return err
+		}
+		switch {
+		case typ.IsCollection() && typ.IsMultiCell():
+			return invalid("Invalid non-frozen collection type for PRIMARY KEY component %s", name)
+		case typ.IsMultiCell():
+			return invalid("Invalid non-frozen user-defined type for PRIMARY KEY component %s", name)
+		}
+
+		keys[name] = true
+		columns = append(columns, &Column{Name: name, Type: typ, Kind: kind, Position: position})
+		return nil
+	}
+
+	for i, name := range s.PartitionKey {
+		if err := addKey(name, PartitionKey, i); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, name := range s.ClusteringKey {
+		if err := addKey(name, Clustering, i); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, d := range s.Columns {
+		if keys[d.Name] {
+			continue
+		}
+
+		typ, err := resolveType(ks, d.Type)
+		if err != nil {
+			return nil, err
+		}
+
+		c := &Column{Name: d.Name, Type: typ, Kind: Regular, Position: -1}
+		if d.Static {
+			if len(s.ClusteringKey) == 0 {
+				return nil, invalid("Static columns are only useful (and thus allowed) if the table has at least one clustering column")
+			}
+			c.Kind = Static
+		}
+		columns = append(columns, c)
+	}
+
+	if err := clusteringOrder(columns, s); err != nil {
+		return nil, err
+	}
+
+	t := newTable(ks.Name, s.Table.Name, columns)
+	t.CompactStorage = s.CompactStorage
+	if err := t.Options.set(s.Options); err != nil {
+		return nil, err
+	}
+
+	if err := t.checkCounters(); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// clusteringOrder applies the CLUSTERING ORDER BY clause to the clustering
+// columns.
+func clusteringOrder(columns []*Column, s *parser.CreateTable) error {
+	if len(s.ClusteringOrder) == 0 {
+		return nil
+	}
+
+	byName := map[string]*Column{}
+	for _, c := range columns {
+		byName[c.Name] = c
+	}
+
+	for i, o := range s.ClusteringOrder {
+		c, found := byName[o.Column]
+		if !found || c.Kind != Clustering {
+			return invalid("Only clustering key columns can be defined in CLUSTERING ORDER directive")
+		}
+		if i >= len(s.ClusteringKey) || s.ClusteringKey[i] != o.Column {
+			return invalid("The order of columns in the CLUSTERING ORDER directive must be the one of the clustering key")
+		}
+		c.Descending = o.Descending
+	}
+
+	return nil
+}
+
+// createType executes CREATE TYPE.
+func (e *Engine) createType(r *request, s *parser.CreateType) (result.Result, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ks, err := e.modifiableKeyspace(r, s.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, found := ks.types[s.Type.Name]; found {
+		if s.IfNotExists {
+			return result.Void{}, nil
+		}
+		return nil, invalid("A user type of name %s.%s already exists", ks.Name, s.Type.Name)
+	}
+
+	names := []string{}
+	fields := []types.Type{}
+	for _, f := range s.Fields {
+		if fieldIndex(types.Type{Fields: names}, f.Name) >= 0 {
+			return nil, invalid("Duplicate field name %s in type %s", f.Name, s.Type.Name)
+		}
+
+		typ, err := fieldType(ks, s.Type.Name, f)
+		if err != nil {
+			return nil, err
+		}
+
+		names = append(names, f.Name)
+		fields = append(fields, typ)
+	}
+
+	ks = ks.clone()
+	ks.types[s.Type.Name] = types.UDTOf(ks.Name, s.Type.Name, names, fields)
+	e.keyspaces[ks.Name] = ks
+
+	return typeChange(result.Created, ks.Name, s.Type.Name), nil
+}
+
+// fieldType resolves the type of a field of the user-defined type udt.
+func fieldType(ks *Keyspace, udt string, f parser.ColumnDef) (types.Type, error) {
+	if f.Type.Name == udt && (f.Type.Keyspace == "" || f.Type.Keyspace == ks.Name) {
+		return types.Type{}, invalid("Cannot create type %s that references itself", udt)
+	}
+
+	typ, err := resolveType(ks, f.Type)
+	if err != nil {
+		return types.Type{}, err
+	}
+
+	if typ.ID == types.UDT && !typ.Frozen {
+		return types.Type{}, invalid("A user type cannot contain non-frozen UDTs")
+	}
+	return typ.Freeze(), nil
+}
+
+// alterType executes ALTER TYPE. Tables and types using the altered type
+// are updated as well.
+func (e *Engine) alterType(r *request, s *parser.AlterType) (result.Result, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ks, err := e.modifiableKeyspace(r, s.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	udt, found := ks.types[s.Type.Name]
+	if !found {
+		return nil, invalid("No user type named %s exists.", s.Type.Name)
+	}
+
+	names := append([]string{}, udt.Fields...)
+	fields := append([]types.Type{}, udt.Elems...)
+
+	switch {
+	case len(s.Add) > 0:
+		for _, f := range s.Add {
+			if fieldIndex(types.Type{Fields: names}, f.Name) >= 0 {
+				return nil, invalid("Cannot add new field %s to type %s: a field of the same name already exists", f.Name, s.Type.Name)
+			}
+			typ, err := fieldType(ks, s.Type.Name, f)
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, f.Name)
+			fields = append(fields, typ)
+		}
+	case len(s.Rename) > 0:
+		for _, rn := range s.Rename {
+			i := fieldIndex(types.Type{Fields: names}, rn.From)
+			if i < 0 {
+				return nil, invalid("Unknown field %s in type %s", rn.From, s.Type.Name)
+			}
+			if fieldIndex(types.Type{Fields: names}, rn.To) >= 0 {
+				return nil, invalid("Cannot rename field %s to %s in type %s: a field of the same name already exists", rn.From, rn.To, s.Type.Name)
+			}
+			names[i] = rn.To
+		}
+	default:
+		return nil, invalid("Altering of types is not allowed")
+	}
+
+	udt = types.UDTOf(ks.Name, s.Type.Name, names, fields)
+
+	ks = ks.clone()
+	for name, other := range ks.types {
+		ks.types[name] = replaceUDT(other, udt)
+	}
+	ks.types[udt.Name] = udt
+	for name, t := range ks.tables {
+		if uses(t, udt.Name) {
+			t = t.clone()
+			for _, c := range t.Columns {
+				c.Type = replaceUDT(c.Type, udt)
+			}
+			ks.tables[name] = t
+		}
+	}
+	e.keyspaces[ks.Name] = ks
+
+	return typeChange(result.Updated, ks.Name, udt.Name), nil
+}
+
+// replaceUDT replaces all occurrences of the user-defined type udt in t,
+// keeping whether they are frozen.
+func replaceUDT(t types.Type, udt types.Type) types.Type {
+	if t.ID == types.UDT && t.Keyspace == udt.Keyspace && t.Name == udt.Name {
+		if t.Frozen {
+			return udt.Freeze()
+		}
+		return udt
+	}
+
+	if len(t.Elems) > 0 {
+		elems := make([]types.Type, len(t.Elems))
+		for i, e := range t.Elems {
+			elems[i] = replaceUDT(e, udt)
+		}
+		t.Elems = elems
+	}
+	return t
+}
+
+// references returns true if t is or contains the user-defined type name.
+func references(t types.Type, name string) bool {
+	if t.ID == types.UDT && t.Name == name {
+		return true
+	}
+	for _, e := range t.Elems {
+		if references(e, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// uses returns true if a column of t references the user-defined type name.
+func uses(t *Table, name string) bool {
+	for _, c := range t.Columns {
+		if references(c.Type, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// dropType executes DROP TYPE.
+func (e *Engine) dropType(r *request, s *parser.DropType) (result.Result, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ks, err := e.modifiableKeyspace(r, s.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, found := ks.types[s.Type.Name]; !found {
+		if s.IfExists {
+			return result.Void{}, nil
+		}
+		return nil, invalid("No user type named %s exists.", s.Type.Name)
+	}
+
+	for _, other := range ks.Types() {
+		if other.Name != s.Type.Name && references(other, s.Type.Name) {
+			return nil, invalid("Cannot drop user type %s.%s as it is still used by user type %s", ks.Name, s.Type.Name, other.Name)
+		}
+	}
+
+	for _, t := range ks.Tables() {
+		if uses(t, s.Type.Name) {
+			return nil, invalid("Cannot drop user type %s.%s as it is still used by table %s.%s", ks.Name, s.Type.Name, ks.Name, t.Name)
+		}
+	}
+
+	ks = ks.clone()
+	delete(ks.types, s.Type.Name)
+	e.keyspaces[ks.Name] = ks
+
+	return typeChange(result.Dropped, ks.Name, s.Type.Name), nil
+}
+
+func typeChange(change, keyspace, name string) result.SchemaChange {
+	return result.SchemaChange{
+		Change:   change,
+		Target:   result.TargetType,
+		Keyspace: keyspace,
+		Name:     name,
+	}
+}
@@ -0,0 +1,219 @@
+package engine_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/cql/types"
+	"github.com/st3v/fakesandra/engine"
+)
+
+var _ = Describe("DDL", func() {
+	var e *engine.Engine
+
+	table := func(ks, name string) *engine.Table {
+		k, found := e.Keyspace(ks)
+		Expect(found).To(BeTrue())
+		t, found := k.Table(name)
+		Expect(found).To(BeTrue())
+		return t
+	}
+
+	columnNames := func(t *engine.Table) []string {
+		names := []string{}
+		for _, c := range t.Columns {
+			names = append(names, c.Name)
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		e = engine.New()
+		Expect(e.Exec("CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}")).To(Succeed())
+		Expect(e.Exec("CREATE TABLE ks.t (id int, c int, v text, PRIMARY KEY (id, c))")).To(Succeed())
+	})
+
+	Describe("keyspaces", func() {
+		It("returns AlreadyExists for existing keyspaces", func() {
+			_, err := e.Execute("CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}")
+			Expect(err).To(Equal(&proto.AlreadyExistsError{Keyspace: "ks"}))
+		})
+
+		It("ignores existing keyspaces with IF NOT EXISTS", func() {
+			res, err := e.Execute("CREATE KEYSPACE IF NOT EXISTS ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal(result.Void{}))
+		})
+
+		It("alters replication and durable writes", func() {
+			res, err := e.Execute("ALTER KEYSPACE ks WITH replication = {'class': 'NetworkTopologyStrategy', 'dc1': 3} AND durable_writes = false")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal(result.SchemaChange{Change: result.Updated, Target: result.TargetKeyspace, Keyspace: "ks"}))
+
+			ks, _ := e.Keyspace("ks")
+			Expect(ks.Replication).To(Equal(map[string]string{
+				"class": "org.apache.cassandra.locator.NetworkTopologyStrategy",
+				"dc1":   "3",
+			}))
+			Expect(ks.DurableWrites).To(BeFalse())
+		})
+
+		It("drops keyspaces", func() {
+			res, err := e.Execute("DROP KEYSPACE ks")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal(result.SchemaChange{Change: result.Dropped, Target: result.TargetKeyspace, Keyspace: "ks"}))
+
+			_, found := e.Keyspace("ks")
+			Expect(found).To(BeFalse())
+
+			expectError(e, "DROP KEYSPACE ks", proto.ErrConfig, "Cannot drop non existing keyspace 'ks'.")
+			Expect(e.Exec("DROP KEYSPACE IF EXISTS ks")).To(Succeed())
+		})
+
+		It("rejects unknown properties", func() {
+			expectError(e, "CREATE KEYSPACE x WITH replication = {'class': 'SimpleStrategy'} AND foo = 1", proto.ErrSyntax, "Unknown property 'foo'")
+		})
+
+		It("validates the replication options", func() {
+			expectError(e, "CREATE KEYSPACE x WITH replication = {'class': 'SimpleStrategy'}", proto.ErrConfig, "SimpleStrategy requires a replication_factor strategy option.")
+			expectError(e, "CREATE KEYSPACE x WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 'three'}", proto.ErrConfig, "Replication factor must be numeric; found three")
+			expectError(e, "CREATE KEYSPACE x WITH replication = {'class': 'SimpleStrategy', 'replication_factor': -1}", proto.ErrConfig, "Replication factor must be non-negative; found -1")
+			expectError(e, "CREATE KEYSPACE x WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1, 'dc1': 1}", proto.ErrConfig, "Unrecognized strategy option {dc1} passed to SimpleStrategy for keyspace x")
+			expectError(e, "CREATE KEYSPACE x WITH replication = {'class': 'NetworkTopologyStrategy', 'dc1': 'many'}", proto.ErrConfig, "Replication factor must be numeric; found many")
+			expectError(e, "CREATE KEYSPACE x WITH replication = {'class': 'NetworkTopologyStrategy', 'replication_factor': 3}", proto.ErrConfig, "replication_factor is an option for SimpleStrategy, not NetworkTopologyStrategy")
+			expectError(e, "ALTER KEYSPACE ks WITH replication = {'class': 'SimpleStrategy'}", proto.ErrConfig, "SimpleStrategy requires a replication_factor strategy option.")
+			Expect(e.Exec("CREATE KEYSPACE x WITH replication = {'class': 'org.apache.cassandra.locator.NetworkTopologyStrategy', 'dc1': 3, 'dc2': 0}")).To(Succeed())
+		})
+
+		It("rejects unknown replication strategies", func() {
+			expectError(e, "CREATE KEYSPACE x WITH replication = {'class': 'Bogus', 'replication_factor': 1}", proto.ErrConfig, "Unable to find replication strategy class 'org.apache.cassandra.locator.Bogus'")
+			expectError(e, "CREATE KEYSPACE x WITH replication = {'class': 'LocalStrategy'}", proto.ErrConfig, "Unable to use given strategy class: LocalStrategy is reserved for internal use.")
+		})
+
+		It("rejects system keyspaces", func() {
+			expectError(e, "DROP KEYSPACE system", proto.ErrInvalid, "system keyspace is not user-modifiable")
+		})
+	})
+
+	Describe("tables", func() {
+		It("returns AlreadyExists for existing tables", func() {
+			_, err := e.Execute("CREATE TABLE ks.t (id int PRIMARY KEY)")
+			Expect(err).To(Equal(&proto.AlreadyExistsError{Keyspace: "ks", Table: "t"}))
+			Expect(e.Exec("CREATE TABLE IF NOT EXISTS ks.t (id int PRIMARY KEY)")).To(Succeed())
+		})
+
+		It("sets table options", func() {
+			Expect(e.Exec("CREATE TABLE ks.o (id int PRIMARY KEY) WITH compaction = {'class': 'LeveledCompactionStrategy'} AND default_time_to_live = 60 AND comment = 'hi'")).To(Succeed())
+
+			o := table("ks", "o").Options
+			Expect(o.Compaction).To(Equal(map[string]string{"class": "org.apache.cassandra.db.compaction.LeveledCompactionStrategy"}))
+			Expect(o.DefaultTimeToLive).To(Equal(60))
+			Expect(o.Comment).To(Equal("hi"))
+			Expect(o.GCGraceSeconds).To(Equal(864000))
+		})
+
+		It("validates table options", func() {
+			expectError(e, "CREATE TABLE ks.o (id int PRIMARY KEY) WITH compaction = {'min_threshold': 2}", proto.ErrConfig, "Missing sub-option 'class' for the 'compaction' option.")
+			expectError(e, "CREATE TABLE ks.o (id int PRIMARY KEY) WITH default_time_to_live = -1", proto.ErrConfig, "default_time_to_live must be greater than or equal to 0 (got -1)")
+			expectError(e, "CREATE TABLE ks.o (id int PRIMARY KEY) WITH foo = 1", proto.ErrSyntax, "Unknown property 'foo'")
+		})
+
+		It("adds, drops and renames columns", func() {
+			Expect(e.Exec("INSERT INTO ks.t (id, c, v) VALUES (1, 1, 'a')")).To(Succeed())
+
+			res, err := e.Execute("ALTER TABLE ks.t ADD w int")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal(result.SchemaChange{Change: result.Updated, Target: result.TargetTable, Keyspace: "ks", Name: "t"}))
+
+			Expect(e.Exec("ALTER TABLE ks.t DROP v")).To(Succeed())
+			Expect(e.Exec("ALTER TABLE ks.t RENAME c TO ck")).To(Succeed())
+			Expect(columnNames(table("ks", "t"))).To(Equal([]string{"id", "ck", "w"}))
+
+			Expect(e.Exec("ALTER TABLE ks.t ADD v text")).To(Succeed())
+			res, err = e.Execute("SELECT ck, v FROM ks.t")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.(*result.Rows).Data).To(Equal([][][]byte{{{0, 0, 0, 1}, nil}}))
+		})
+
+		It("validates alterations", func() {
+			expectError(e, "ALTER TABLE ks.t ADD v int", proto.ErrInvalid, "Invalid column name v because it conflicts with an existing column")
+			expectError(e, "ALTER TABLE ks.t DROP id", proto.ErrInvalid, "Cannot drop PRIMARY KEY part id")
+			expectError(e, "ALTER TABLE ks.t DROP x", proto.ErrInvalid, "Column x was not found in table t")
+			expectError(e, "ALTER TABLE ks.t RENAME v TO w", proto.ErrInvalid, "Cannot rename non PRIMARY KEY part v")
+			expectError(e, "ALTER TABLE ks.t RENAME c TO v", proto.ErrInvalid, "Cannot rename column c to v in keyspace ks; another column of that name already exist")
+		})
+
+		It("truncates and drops tables", func() {
+			Expect(e.Exec("INSERT INTO ks.t (id, c) VALUES (1, 1)")).To(Succeed())
+			Expect(e.Exec("TRUNCATE ks.t")).To(Succeed())
+
+			res, err := e.Execute("SELECT * FROM ks.t")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.(*result.Rows).Data).To(BeEmpty())
+
+			res, err = e.Execute("DROP TABLE ks.t")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal(result.SchemaChange{Change: result.Dropped, Target: result.TargetTable, Keyspace: "ks", Name: "t"}))
+
+			expectError(e, "DROP TABLE ks.t", proto.ErrConfig, "Cannot drop non existing table 't' in keyspace 'ks'.")
+			Expect(e.Exec("DROP TABLE IF EXISTS ks.t")).To(Succeed())
+		})
+	})
+
+	Describe("types", func() {
+		BeforeEach(func() {
+			Expect(e.Exec("CREATE TYPE ks.address (street text, zip int)")).To(Succeed())
+		})
+
+		It("creates user-defined types", func() {
+			ks, _ := e.Keyspace("ks")
+			udt, found := ks.Type("address")
+			Expect(found).To(BeTrue())
+			Expect(udt).To(Equal(types.UDTOf("ks", "address", []string{"street", "zip"}, []types.Type{
+				types.Native(types.Varchar),
+				types.Native(types.Int),
+			})))
+
+			expectError(e, "CREATE TYPE ks.address (x int)", proto.ErrInvalid, "A user type of name ks.address already exists")
+			Expect(e.Exec("CREATE TYPE IF NOT EXISTS ks.address (x int)")).To(Succeed())
+		})
+
+		It("resolves types of columns", func() {
+			Expect(e.Exec("CREATE TABLE ks.u (id int PRIMARY KEY, home frozen<address>)")).To(Succeed())
+			c, _ := table("ks", "u").Column("home")
+			Expect(c.Type.Name).To(Equal("address"))
+			Expect(c.Type.Frozen).To(BeTrue())
+
+			expectError(e, "CREATE TABLE ks.v (id int PRIMARY KEY, home nope)", proto.ErrInvalid, "Unknown type ks.nope")
+			expectError(e, "CREATE TABLE ks.v (id address PRIMARY KEY)", proto.ErrInvalid, "Invalid non-frozen user-defined type for PRIMARY KEY component id")
+		})
+
+		It("updates tables when altering types", func() {
+			Expect(e.Exec("CREATE TABLE ks.u (id int PRIMARY KEY, home frozen<address>)")).To(Succeed())
+
+			res, err := e.Execute("ALTER TYPE ks.address ADD city text")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal(result.SchemaChange{Change: result.Updated, Target: result.TargetType, Keyspace: "ks", Name: "address"}))
+
+			Expect(e.Exec("ALTER TYPE ks.address RENAME zip TO postcode")).To(Succeed())
+
+			c, _ := table("ks", "u").Column("home")
+			Expect(c.Type.Fields).To(Equal([]string{"street", "postcode", "city"}))
+			Expect(c.Type.Frozen).To(BeTrue())
+		})
+
+		It("drops unused types", func() {
+			Expect(e.Exec("CREATE TABLE ks.u (id int PRIMARY KEY, home frozen<address>)")).To(Succeed())
+			expectError(e, "DROP TYPE ks.address", proto.ErrInvalid, "Cannot drop user type ks.address as it is still used by table ks.u")
+
+			Expect(e.Exec("DROP TABLE ks.u")).To(Succeed())
+			res, err := e.Execute("DROP TYPE ks.address")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal(result.SchemaChange{Change: result.Dropped, Target: result.TargetType, Keyspace: "ks", Name: "address"}))
+
+			expectError(e, "DROP TYPE ks.address", proto.ErrInvalid, "No user type named address exists.")
+		})
+	})
+})
@@ -0,0 +1,316 @@
+// Package engine implements an in-memory storage engine. It keeps a schema
+// catalog of keyspaces and tables and executes parsed CQL statements against
+// it, so that rows written with INSERT can be read back with SELECT.
+//
+// Schema objects are never modified once they have been published. Schema
+// changes replace keyspaces and tables with updated copies, which allows
+// readers to use them without holding a lock. The data of each table is
+// guarded by a lock of its own.
+package engine
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/st3v/fakesandra/cql/parser"
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/proto/v3"
+	"github.com/st3v/fakesandra/cql/result"
+)
+
+// errNotHandled is returned for statements the engine does not execute.
+// They are passed on to the next query handler.
+var errNotHandled = errors.New("statement not handled by the engine")
+
+// Engine stores keyspaces, tables and their data. The zero value is not
+// usable, use New.
+type Engine struct {
+	mu        sync.RWMutex
+	keyspaces map[string]*Keyspace
+	clock     *Clock
+	uuids     *uuidGenerator
+	cluster   Cluster
+	profile   Profile
+
+	// implementations holds the Go implementations of user-defined
+	// functions by their qualified names.
+	implementations map[string][]*implementation
+}
+
+func New() *Engine {
+	return &Engine{
+		keyspaces:       map[string]*Keyspace{},
+		clock:           NewClock(),
+		uuids:           newUUIDGenerator(time.Now().UnixNano()),
+		cluster:         DefaultCluster(),
+		profile:         DefaultProfile(),
+		implementations: map[string][]*implementation{},
+	}
+}
+
+// Clock returns the clock of the engine.
+func (e *Engine) Clock() *Clock {
+	return e.clock
+}
+
+// Seed makes the UUIDs generated by now() and uuid() reproducible. Given
+// the same seed and clock, the engine generates the same UUIDs.
+func (e *Engine) Seed(seed int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.uuids = newUUIDGenerator(seed)
+}
+
+// generator returns the current UUID generator.
+func (e *Engine) generator() *uuidGenerator {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.uuids
+}
+
+// ServeQuery executes qry. Statements that cannot be parsed or are not
+// supported by the engine, e.g. queries against system tables it does not
+// implement, are left to the rest of the query handler chain.
+func (e *Engine) ServeQuery(qry proto.Query, req proto.Frame, rw proto.ResponseWriter) {
+	stmt, err := qry.Parsed()
+	if err != nil {
+		return
+	}
+
+	res, err := e.execute(e.newRequest(proto.SessionOf(rw), qry), stmt)
+	switch {
+	case err == errNotHandled:
+		return
+	case err != nil:
+		rw.WriteFrame(v3.ErrResponse(req, err))
+		return
+	}
+
+	if rows, ok := res.(*result.Rows); ok && qry.SkipMetadata() {
+		rows.NoMetadata = true
+	}
+
+	rw.WriteFrame(v3.ResultResponse(req, res))
+}
+
+// Execute parses and executes a single statement without bound values.
+func (e *Engine) Execute(stmt string) (result.Result, error) {
+	parsed, err := parser.Parse(stmt)
+	if err != nil {
+		return nil, proto.NewError(proto.ErrSyntax, "%s", err)
+	}
+
+	return e.run(e.newRequest(proto.NewSession(), nil), parsed, stmt)
+}
+
+// ExecuteQuery executes qry, including its bound values and options,
+// within the given session.
+func (e *Engine) ExecuteQuery(qry proto.Query, session *proto.Session) (result.Result, error) {
+	parsed, err := qry.Parsed()
+	if err != nil {
+		return nil, proto.NewError(proto.ErrSyntax, "%s", err)
+	}
+
+	return e.run(e.newRequest(session, qry), parsed, qry.Statement())
+}
+
+// run executes a statement and reports statements the engine does not
+// handle as invalid.
+func (e *Engine) run(r *request, parsed parser.Statement, stmt string) (result.Result, error) {
+	res, err := e.execute(r, parsed)
+	if err == errNotHandled {
+		return nil, proto.NewError(proto.ErrInvalid, "Unsupported statement: %s", proto.TrimStatement(stmt))
+	}
+	return res, err
+}
+
+// Exec is like Execute but discards the result, e.g. to create a schema.
+func (e *Engine) Exec(stmt string) error {
+	_, err := e.Execute(stmt)
+	return err
+}
+
+// execute executes stmt as the Cassandra release of the profile of the
+// engine would.
+func (e *Engine) execute(r *request, stmt parser.Statement) (result.Result, error) {
+	p := e.Profile()
+	if err := p.checkFeatures(r, stmt); err != nil {
+		return nil, err
+	}
+
+	res, err := e.dispatch(r, stmt)
+	if err != nil {
+		return nil, p.reword(err)
+	}
+	return res, nil
+}
+
+func (e *Engine) dispatch(r *request, stmt parser.Statement) (result.Result, error) {
+	switch s := stmt.(type) {
+	case *parser.Use:
+		return e.use(r, s)
+	case *parser.CreateKeyspace:
+		return e.createKeyspace(s)
+	case *parser.AlterKeyspace:
+		return e.alterKeyspace(s)
+	case *parser.DropKeyspace:
+		return e.dropKeyspace(s)
+	case *parser.CreateTable:
+		return e.createTable(r, s)
+	case *parser.AlterTable:
+		return e.alterTable(r, s)
+	case *parser.DropTable:
+		return e.dropTable(r, s)
+	case *parser.Truncate:
+		return e.truncate(r, s)
+	case *parser.CreateIndex:
+		return e.createIndex(r, s)
+	case *parser.DropIndex:
+		return e.dropIndex(r, s)
+	case *parser.CreateType:
+		return e.createType(r, s)
+	case *parser.AlterType:
+		return e.alterType(r, s)
+	case *parser.DropType:
+		return e.dropType(r, s)
+	case *parser.CreateFunction:
+		return e.createFunction(r, s)
+	case *parser.DropFunction:
+		return e.dropFunction(r, s)
+	case *parser.CreateAggregate:
+		return e.createAggregate(r, s)
+	case *parser.DropAggregate:
+		return e.dropAggregate(r, s)
+	case *parser.CreateView:
+		return e.createView(r, s)
+	case *parser.AlterView:
+		return e.alterView(r, s)
+	case *parser.DropView:
+		return e.dropView(r, s)
+	case *parser.Insert, *parser.Update, *parser.Delete:
+		return e.modify(r, s)
+	case *parser.Batch:
+		return e.batch(r, s)
+	case *parser.Select:
+		return e.selectRows(r, s)
+	}
+	return nil, errNotHandled
+}
+
+func (e *Engine) use(r *request, s *parser.Use) (result.Result, error) {
+	if isSystemKeyspace(s.Keyspace) {
+		return nil, errNotHandled
+	}
+
+	if _, err := e.keyspace(s.Keyspace); err != nil {
+		return nil, err
+	}
+
+	r.session.SetKeyspace(s.Keyspace)
+	return result.SetKeyspace{Keyspace: s.Keyspace}, nil
+}
+
+// Keyspace returns the keyspace with the given name.
+func (e *Engine) Keyspace(name string) (*Keyspace, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	ks, found := e.keyspaces[name]
+	return ks, found
+}
+
+// Keyspaces returns all keyspaces sorted by name.
+func (e *Engine) Keyspaces() []*Keyspace {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	keyspaces := []*Keyspace{}
+	for _, ks := range e.keyspaces {
+		keyspaces = append(keyspaces, ks)
+	}
+	sort.Slice(keyspaces, func(i, j int) bool {
+		return keyspaces[i].Name < keyspaces[j].Name
+	})
+	return keyspaces
+}
+
+// Truncate removes all data but keeps the schema.
+func (e *Engine) Truncate() {
+	for _, ks := range e.Keyspaces() {
+		for _, t := range ks.sortedTables() {
+			t.data.truncate()
+		}
+	}
+}
+
+// Reset removes all keyspaces.
+func (e *Engine) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.keyspaces = map[string]*Keyspace{}
+}
+
+func (e *Engine) keyspace(name string) (*Keyspace, error) {
+	ks, found := e.Keyspace(name)
+	if !found {
+		return nil, invalid("Keyspace %s does not exist", name)
+	}
+	return ks, nil
+}
+
+// keyspaceName returns the keyspace of name or the one of the session if
+// name is not qualified.
+func (r *request) keyspaceName(name parser.Name) (string, error) {
+	if name.Keyspace != "" {
+		return name.Keyspace, nil
+	}
+
+	if ks := r.session.Keyspace(); ks != "" {
+		return ks, nil
+	}
+
+	return "", invalid("No keyspace has been specified. USE a keyspace, or explicitly specify keyspace.tablename")
+}
+
+func (e *Engine) table(r *request, name parser.Name) (*Table, error) {
+	ksName, err := r.keyspaceName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if isSystemKeyspace(ksName) {
+		return nil, errNotHandled
+	}
+
+	ks, err := e.keyspace(ksName)
+	if err != nil {
+		return nil, err
+	}
+
+	t, found := ks.Table(name.Name)
+	if !found {
+		return nil, invalid("unconfigured table %s", name.Name)
+	}
+	return t, nil
+}
+
+// timestamp returns the timestamp of a write without a client-side
+// timestamp in microseconds.
+func (e *Engine) timestamp() int64 {
+	return e.clock.timestamp()
+}
+
+// nowInSeconds returns the current time of the server in seconds, which is
+// the precision of expiration times.
+func (e *Engine) nowInSeconds() int64 {
+	return e.clock.Now().Unix()
+}
+
+// isSystemKeyspace returns true for the keyspaces Cassandra maintains
+// itself. The engine only implements some of their tables for reading, see
+// systemTables.
+func isSystemKeyspace(name string) bool {
+	return name == "system" || strings.HasPrefix(name, "system_")
+}
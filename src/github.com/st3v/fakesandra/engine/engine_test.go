@@ -0,0 +1,152 @@
+package engine_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/cql/types"
+	"github.com/st3v/fakesandra/engine"
+)
+
+var _ = Describe("Engine", func() {
+	var e *engine.Engine
+
+	BeforeEach(func() {
+		e = engine.New()
+		Expect(e.Exec("CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}")).To(Succeed())
+		Expect(e.Exec("CREATE TABLE ks.events (id int, seq int, tag text STATIC, payload text, PRIMARY KEY (id, seq)) WITH CLUSTERING ORDER BY (seq DESC)")).To(Succeed())
+	})
+
+	Describe("CREATE KEYSPACE", func() {
+		It("returns a schema change", func() {
+			res, err := e.Execute("CREATE KEYSPACE other WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal(result.SchemaChange{
+				Change:   result.Created,
+				Target:   result.TargetKeyspace,
+				Keyspace: "other",
+			}))
+
+			ks, found := e.Keyspace("other")
+			Expect(found).To(BeTrue())
+			Expect(ks.Replication).To(HaveKeyWithValue("class", "org.apache.cassandra.locator.SimpleStrategy"))
+		})
+
+		It("requires a replication class", func() {
+			_, err := e.Execute("CREATE KEYSPACE other WITH replication = {'replication_factor': 1}")
+			Expect(err).To(Equal(proto.NewError(proto.ErrConfig, "Missing mandatory replication strategy class")))
+		})
+	})
+
+	Describe("CREATE TABLE", func() {
+		It("orders columns like SELECT *", func() {
+			ks, _ := e.Keyspace("ks")
+			t, found := ks.Table("events")
+			Expect(found).To(BeTrue())
+
+			names := []string{}
+			for _, c := range t.Columns {
+				names = append(names, c.Name)
+			}
+			Expect(names).To(Equal([]string{"id", "seq", "tag", "payload"}))
+		})
+
+		It("rejects tables without primary key", func() {
+			expectInvalid(e, "CREATE TABLE ks.t (id int)", "No PRIMARY KEY specifed (exactly one required)")
+		})
+
+		It("rejects unknown primary key columns", func() {
+			expectInvalid(e, "CREATE TABLE ks.t (id int PRIMARY KEY, v int) WITH CLUSTERING ORDER BY (v ASC)", "Only clustering key columns can be defined in CLUSTERING ORDER directive")
+			expectInvalid(e, "CREATE TABLE ks.t (id int, PRIMARY KEY (id, x))", "Unknown definition x referenced in PRIMARY KEY")
+		})
+
+		It("rejects tables in unknown keyspaces", func() {
+			expectInvalid(e, "CREATE TABLE nope.t (id int PRIMARY KEY)", "Keyspace nope does not exist")
+		})
+	})
+
+	Describe("INSERT and SELECT", func() {
+		BeforeEach(func() {
+			Expect(e.Exec("INSERT INTO ks.events (id, seq, payload) VALUES (1, 1, 'a')")).To(Succeed())
+			Expect(e.Exec("INSERT INTO ks.events (id, seq, payload) VALUES (1, 2, 'b')")).To(Succeed())
+			Expect(e.Exec("INSERT INTO ks.events (id, seq) VALUES (2, 1)")).To(Succeed())
+			Expect(e.Exec("UPDATE ks.events SET tag = 'x' WHERE id = 1")).To(Succeed())
+		})
+
+		It("returns rows in clustering order", func() {
+			Expect(values(e, "SELECT id, seq, tag, payload FROM ks.events WHERE id = 1")).To(Equal([][]interface{}{
+				{int32(1), int32(2), "x", "b"},
+				{int32(1), int32(1), "x", "a"},
+			}))
+		})
+
+		It("returns all partitions without restrictions", func() {
+			Expect(values(e, "SELECT * FROM ks.events")).To(HaveLen(3))
+		})
+
+		It("restricts clustering columns", func() {
+			Expect(values(e, "SELECT payload AS p FROM ks.events WHERE id = 1 AND seq = 1")).To(Equal([][]interface{}{{"a"}}))
+		})
+
+		It("applies the limit", func() {
+			Expect(values(e, "SELECT seq FROM ks.events WHERE id = 1 LIMIT 1")).To(Equal([][]interface{}{{int32(2)}}))
+		})
+
+		It("returns aliases as column names", func() {
+			res, err := e.Execute("SELECT payload AS p FROM ks.events")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.(*result.Rows).Columns).To(Equal([]result.Column{
+				{Keyspace: "ks", Table: "events", Name: "p", Type: types.Native(types.Varchar)},
+			}))
+		})
+
+		It("updates existing rows", func() {
+			Expect(e.Exec("UPDATE ks.events SET payload = 'c' WHERE id = 2 AND seq = 1")).To(Succeed())
+			Expect(values(e, "SELECT payload FROM ks.events WHERE id = 2")).To(Equal([][]interface{}{{"c"}}))
+		})
+
+		It("returns a single row for partitions with static values only", func() {
+			Expect(e.Exec("UPDATE ks.events SET tag = 'y' WHERE id = 3")).To(Succeed())
+			Expect(values(e, "SELECT id, seq, tag FROM ks.events WHERE id = 3")).To(Equal([][]interface{}{
+				{int32(3), nil, "y"},
+			}))
+		})
+
+		It("keeps the schema on Truncate", func() {
+			e.Truncate()
+			Expect(values(e, "SELECT * FROM ks.events")).To(BeEmpty())
+		})
+	})
+
+	Describe("errors", func() {
+		It("rejects missing key parts", func() {
+			expectInvalid(e, "INSERT INTO ks.events (id, payload) VALUES (1, 'a')", "Some clustering keys are missing: seq")
+			expectInvalid(e, "INSERT INTO ks.events (seq) VALUES (1)", "Some partition key parts are missing: id")
+		})
+
+		It("rejects unknown columns and tables", func() {
+			expectInvalid(e, "INSERT INTO ks.events (id, seq, nope) VALUES (1, 1, 1)", "Undefined column name nope")
+			expectInvalid(e, "SELECT * FROM ks.nope", "unconfigured table nope")
+		})
+
+		It("rejects constants of the wrong type", func() {
+			expectInvalid(e, "INSERT INTO ks.events (id, seq) VALUES ('a', 1)", `Invalid STRING constant (a) for "id" of type int`)
+		})
+
+		It("requires a keyspace for unqualified tables", func() {
+			expectInvalid(e, "SELECT * FROM events", "No keyspace has been specified. USE a keyspace, or explicitly specify keyspace.tablename")
+		})
+
+		It("rejects filtering on regular columns", func() {
+			expectInvalid(e, "SELECT * FROM ks.events WHERE payload = 'a'", "Cannot execute this query as it might involve data filtering and thus may have unpredictable performance. If you want to execute this query despite the performance unpredictability, use ALLOW FILTERING")
+		})
+	})
+
+	It("does not handle statements against other system tables", func() {
+		_, err := e.Execute("SELECT * FROM system_traces.sessions")
+		Expect(err).To(HaveOccurred())
+		Expect(err.(*proto.Error).Message).To(HavePrefix("Unsupported statement"))
+	})
+})
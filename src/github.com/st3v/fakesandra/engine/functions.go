@@ -0,0 +1,352 @@
+package engine
+
+import (
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/st3v/fakesandra/cql/parser"
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+// function is a native scalar or aggregate function. Functions of the same
+// name are overloads, which are told apart by the types of their
+// arguments.
+type function struct {
+	keyspace string
+	name     string
+	args     []types.Type
+	returns  types.Type
+
+	// calledOnNullInput is set for user-defined functions that are
+	// called with null arguments rather than returning null.
+	calledOnNullInput bool
+
+	// execute computes the result of a scalar function from the
+	// serialized arguments, none of which is null.
+	execute func(e *Engine, args [][]byte) ([]byte, error)
+
+	// aggregate is set for aggregate functions and returns a new
+	// accumulator for each group of rows.
+	aggregate func() accumulator
+}
+
+// call executes f. Unless f is called on null input, null arguments yield
+// null.
+func (f *function) call(e *Engine, args [][]byte) ([]byte, error) {
+	for _, a := range args {
+		if a == nil && !f.calledOnNullInput {
+			return nil, nil
+		}
+	}
+	return f.execute(e, args)
+}
+
+// qualifiedName returns the name of f qualified with its keyspace, which
+// is system for native functions.
+func (f *function) qualifiedName() string {
+	if f.keyspace == "" {
+		return "system." + f.name
+	}
+	return f.keyspace + "." + f.name
+}
+
+// signature returns the signature of f as reported in error messages.
+func (f *function) signature() string {
+	args := make([]string, len(f.args))
+	for i, a := range f.args {
+		args[i] = a.String()
+	}
+	return f.qualifiedName() + " : (" + strings.Join(args, ", ") + ") -> " + f.returns.String()
+}
+
+// nativeFunctions holds the native functions by their lower-case names.
+var nativeFunctions = map[string][]*function{}
+
+func register(f *function) {
+	nativeFunctions[f.name] = append(nativeFunctions[f.name], f)
+}
+
+var (
+	blobType      = types.Native(types.Blob)
+	bigintType    = types.Native(types.Bigint)
+	dateType      = types.Native(types.Date)
+	timestampType = types.Native(types.Timestamp)
+	timeuuidType  = types.Native(types.Timeuuid)
+	uuidType      = types.Native(types.Uuid)
+)
+
+// blobConversionTypes are the types with typeAsBlob and blobAsType
+// functions.
+var blobConversionTypes = []types.ID{
+	types.Ascii, types.Bigint, types.Boolean, types.Counter, types.Date,
+	types.Decimal, types.Double, types.Duration, types.Float, types.Inet,
+	types.Int, types.Smallint, types.Time, types.Timestamp, types.Timeuuid,
+	types.Tinyint, types.Uuid, types.Varchar, types.Varint,
+}
+
+func init() {
+	register(&function{name: "now", returns: timeuuidType, execute: func(e *Engine, args [][]byte) ([]byte, error) {
+		u := e.generator().timeUUID(e.clock.Now())
+		return u[:], nil
+	}})
+	register(&function{name: "uuid", returns: uuidType, execute: func(e *Engine, args [][]byte) ([]byte, error) {
+		u := e.generator().randomUUID()
+		return u[:], nil
+	}})
+
+	register(&function{name: "mintimeuuid", args: []types.Type{timestampType}, returns: timeuuidType, execute: func(e *Engine, args [][]byte) ([]byte, error) {
+		return boundaryTimeUUID(args[0], false), nil
+	}})
+	register(&function{name: "maxtimeuuid", args: []types.Type{timestampType}, returns: timeuuidType, execute: func(e *Engine, args [][]byte) ([]byte, error) {
+		return boundaryTimeUUID(args[0], true), nil
+	}})
+
+	// Conversions between timeuuids, timestamps and dates.
+	conversion := func(name string, from, to types.Type) {
+		register(&function{name: name, args: []types.Type{from}, returns: to, execute: func(e *Engine, args [][]byte) ([]byte, error) {
+			return convertTime(from, to, args[0])
+		}})
+	}
+	conversion("dateof", timeuuidType, timestampType)
+	conversion("unixtimestampof", timeuuidType, bigintType)
+	conversion("todate", timeuuidType, dateType)
+	conversion("todate", timestampType, dateType)
+	conversion("totimestamp", timeuuidType, timestampType)
+	conversion("totimestamp", dateType, timestampType)
+	conversion("tounixtimestamp", timeuuidType, bigintType)
+	conversion("tounixtimestamp", timestampType, bigintType)
+	conversion("tounixtimestamp", dateType, bigintType)
+
+	for _, id := range blobConversionTypes {
+		t := types.Native(id)
+		blobConversions(t.String(), t)
+	}
+	blobConversions("varchar", types.Native(types.Varchar))
+}
+
+// blobConversions registers typeAsBlob and blobAsType for type t, which is
+// called typeName in the function names.
+func blobConversions(typeName string, t types.Type) {
+	register(&function{name: typeName + "asblob", args: []types.Type{t}, returns: blobType, execute: func(e *Engine, args [][]byte) ([]byte, error) {
+		return args[0], nil
+	}})
+
+	name := "blobas" + typeName
+	register(&function{name: name, args: []types.Type{blobType}, returns: t, execute: func(e *Engine, args [][]byte) ([]byte, error) {
+		if _, err := types.Unmarshal(t, args[0]); err != nil {
+			return nil, invalid("In call to function system.%s, value 0x%s is not a valid binary representation for type %s", name, hex.EncodeToString(args[0]), t)
+		}
+		return args[0], nil
+	}})
+}
+
+// boundaryTimeUUID returns the smallest or greatest timeuuid for the given
+// timestamp, which is useful to query timeuuid columns by time. The clock
+// sequence and node bytes are the ones Cassandra uses.
+func boundaryTimeUUID(timestamp []byte, max bool) []byte {
+	v, _ := types.Unmarshal(timestampType, timestamp)
+	t := v.(time.Time)
+	if max {
+		t = t.Add(time.Millisecond - 100*time.Nanosecond)
+	}
+
+	u := types.TimeUUID(t, 0, [6]byte{})
+	for i := 8; i < 16; i++ {
+		if max {
+			u[i] = 0x7f
+		} else {
+			u[i] = 0x80
+		}
+	}
+	return u[:]
+}
+
+// convertTime converts between timeuuids, timestamps and dates. Unix
+// timestamps are in milliseconds.
+func convertTime(from, to types.Type, b []byte) ([]byte, error) {
+	var t time.Time
+	switch from.ID {
+	case types.Timeuuid:
+		var u types.UUID
+		copy(u[:], b)
+		t = u.Time()
+	default:
+		v, err := types.Unmarshal(from, b)
+		if err != nil {
+			return nil, invalid("%s", err)
+		}
+		t = v.(time.Time)
+	}
+
+	if to.ID == types.Bigint {
+		return types.Marshal(to, t.UnixNano()/int64(time.Millisecond))
+	}
+	return types.Marshal(to, t)
+}
+
+// functionName returns the name of a function call as written, qualified
+// with its keyspace if it has one.
+func functionName(x *parser.FunctionCall) string {
+	if x.Keyspace != "" {
+		return x.Keyspace + "." + x.Name
+	}
+	return x.Name
+}
+
+// lookupFunction returns the overloads of the function called by x.
+// Native functions may be qualified with the system keyspace. Unqualified
+// names that are not native refer to the user-defined functions and
+// aggregates of the keyspace of the session.
+func (r *request) lookupFunction(x *parser.FunctionCall) ([]*function, error) {
+	if x.Keyspace == "" || x.Keyspace == "system" {
+		if overloads, found := nativeFunctions[x.Name]; found {
+			return overloads, nil
+		}
+	}
+
+	keyspace := x.Keyspace
+	if keyspace == "" {
+		keyspace = r.session.Keyspace()
+	}
+	if ks, found := r.engine.Keyspace(keyspace); found && keyspace != "system" {
+		if overloads := ks.userFunctions(x.Name); len(overloads) > 0 {
+			return overloads, nil
+		}
+	}
+
+	return nil, invalid("Unknown function %s called", functionName(x))
+}
+
+// resolveFunction picks the overload matching the arguments of a call.
+// typeOf returns the type of an argument if it is known, e.g. for columns
+// and nested function calls. Arguments of unknown type, e.g. literals and
+// bind markers, match all overloads they can be assigned to.
+func resolveFunction(overloads []*function, args []parser.Term, typeOf func(i int) (types.Type, bool), assignable func(i int, t types.Type) bool) (*function, error) {
+	name := overloads[0].qualifiedName()
+	nargs := len(args)
+
+	if len(overloads) == 1 {
+		f := overloads[0]
+		if len(f.args) != nargs {
+			return nil, invalid("Invalid number of arguments in call to function %s: %d required but %d provided", name, len(f.args), nargs)
+		}
+		for i, a := range f.args {
+			if t, known := typeOf(i); known && !assignableType(a, t) || !known && !assignable(i, a) {
+				return nil, invalid("Type error: %s cannot be passed as argument %d of function %s of type %s", args[i], i, name, a)
+			}
+		}
+		return f, nil
+	}
+
+	candidates := []*function{}
+	signatures := []string{}
+	for _, f := range overloads {
+		signatures = append(signatures, f.signature())
+		if len(f.args) != nargs {
+			continue
+		}
+
+		exact, match := true, true
+		for i, a := range f.args {
+			t, known := typeOf(i)
+			switch {
+			case known && !assignableType(a, t), !known && !assignable(i, a):
+				match = false
+			case !known || !a.Equal(t):
+				exact = false
+			}
+		}
+
+		if match && exact {
+			return f, nil
+		}
+		if match {
+			candidates = append(candidates, f)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, invalid("Invalid call to function %s, none of its type signatures match (known type signatures: %s)", name, strings.Join(signatures, ", "))
+	case 1:
+		return candidates[0], nil
+	}
+
+	matching := []string{}
+	for _, f := range candidates {
+		matching = append(matching, f.signature())
+	}
+	return nil, invalid("Ambiguous call to function %s (can be matched by following signatures: %s): use type casts to disambiguate", name, strings.Join(matching, ", "))
+}
+
+// assignableType returns true if values of type from can be assigned to a
+// receiver of type to. Blobs accept anything, uuids accept timeuuids and
+// text accepts ascii.
+func assignableType(to, from types.Type) bool {
+	switch {
+	case to.Equal(from), to.Freeze().Equal(from.Freeze()):
+		return true
+	case to.ID == types.Blob:
+		return true
+	case to.ID == types.Uuid && from.ID == types.Timeuuid:
+		return true
+	case to.ID == types.Varchar && from.ID == types.Ascii:
+		return true
+	}
+	return false
+}
+
+// termType returns the type of term if it can be told without a receiver.
+func (r *request) termType(term parser.Term) (types.Type, bool) {
+	switch x := term.(type) {
+	case *parser.FunctionCall:
+		f, err := r.resolveCall(x)
+		if err != nil {
+			return types.Type{}, false
+		}
+		return f.returns, true
+	case *parser.TypeHint:
+		t, err := types.Parse(x.Type.String())
+		return t, err == nil
+	}
+	return types.Type{}, false
+}
+
+// resolveCall resolves a function call whose arguments are terms, e.g. in
+// the VALUES of an INSERT.
+func (r *request) resolveCall(x *parser.FunctionCall) (*function, error) {
+	overloads, err := r.lookupFunction(x)
+	if err != nil {
+		return nil, err
+	}
+
+	return resolveFunction(overloads, x.Args, func(i int) (types.Type, bool) {
+		return r.termType(x.Args[i])
+	}, func(i int, t types.Type) bool {
+		_, err := r.bindAs(x.Args[i], "", t)
+		return err == nil
+	})
+}
+
+// call evaluates a function call whose arguments are terms and returns
+// its result along with the function called.
+func (r *request) call(x *parser.FunctionCall) ([]byte, *function, error) {
+	f, err := r.resolveCall(x)
+	if err != nil {
+		return nil, nil, err
+	}
+	if f.aggregate != nil {
+		return nil, nil, invalid("Aggregate function %s cannot be used here", functionName(x))
+	}
+
+	args := make([][]byte, len(x.Args))
+	for i, a := range x.Args {
+		if args[i], err = r.bindAs(a, "", f.args[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	b, err := f.call(r.engine, args)
+	return b, f, err
+}
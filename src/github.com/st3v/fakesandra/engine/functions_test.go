@@ -0,0 +1,108 @@
+package engine_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/cql/types"
+	"github.com/st3v/fakesandra/engine"
+)
+
+var _ = Describe("Functions", func() {
+	var e *engine.Engine
+
+	epoch := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	BeforeEach(func() {
+		e = engine.New()
+		e.Clock().Set(epoch)
+		exec(e, "CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}")
+		exec(e, "CREATE TABLE ks.t (p int, c timeuuid, v text, PRIMARY KEY (p, c))")
+	})
+
+	Describe("now()", func() {
+		It("generates unique timeuuids at the time of the clock", func() {
+			exec(e, "INSERT INTO ks.t (p, c, v) VALUES (1, now(), 'a')")
+			exec(e, "INSERT INTO ks.t (p, c, v) VALUES (1, now(), 'b')")
+
+			rows := rows(e, "SELECT c, toTimestamp(c) FROM ks.t WHERE p = 1")
+			Expect(rows.Data).To(HaveLen(2))
+			Expect(rows.Data[0][0]).NotTo(Equal(rows.Data[1][0]))
+
+			ts, err := types.Unmarshal(rows.Columns[1].Type, rows.Data[0][1])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ts.(time.Time).Equal(epoch)).To(BeTrue())
+		})
+
+		It("generates the same timeuuids for the same seed", func() {
+			generate := func() interface{} {
+				e.Seed(42)
+				return value(e, "SELECT now() FROM ks.t")
+			}
+
+			exec(e, "INSERT INTO ks.t (p, c) VALUES (1, now())")
+			Expect(generate()).To(Equal(generate()))
+		})
+	})
+
+	It("selects timeuuids by time with minTimeuuid and maxTimeuuid", func() {
+		for i := 0; i < 3; i++ {
+			exec(e, "INSERT INTO ks.t (p, c) VALUES (1, now())")
+			e.Clock().Advance(time.Minute)
+		}
+
+		rows := rows(e, "SELECT c FROM ks.t WHERE p = 1 AND c > maxTimeuuid('2020-01-02 03:04:05+0000') AND c < minTimeuuid('2020-01-02 03:06:05+0000')")
+		Expect(rows.Data).To(HaveLen(1))
+	})
+
+	It("converts between timeuuids, timestamps and dates", func() {
+		exec(e, "INSERT INTO ks.t (p, c) VALUES (1, now())")
+
+		Expect(value(e, "SELECT toDate(c) FROM ks.t WHERE p = 1")).To(Equal(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)))
+		Expect(value(e, "SELECT toUnixTimestamp(c) FROM ks.t WHERE p = 1")).To(Equal(epoch.UnixNano() / int64(time.Millisecond)))
+		Expect(value(e, "SELECT unixTimestampOf(c) FROM ks.t WHERE p = 1")).To(Equal(epoch.UnixNano() / int64(time.Millisecond)))
+		Expect(value(e, "SELECT toUnixTimestamp(toDate(c)) FROM ks.t WHERE p = 1")).To(Equal(int64(1577923200000)))
+	})
+
+	It("converts values from and to blobs", func() {
+		exec(e, "CREATE TABLE ks.b (p int PRIMARY KEY, b blob)")
+		exec(e, "INSERT INTO ks.b (p, b) VALUES (1, intAsBlob(7))")
+
+		Expect(value(e, "SELECT b FROM ks.b WHERE p = 1")).To(Equal([]byte{0, 0, 0, 7}))
+		Expect(value(e, "SELECT blobAsInt(b) FROM ks.b WHERE p = 1")).To(Equal(int32(7)))
+		Expect(value(e, "SELECT textAsBlob('a') FROM ks.b WHERE p = 1")).To(Equal([]byte("a")))
+
+		exec(e, "INSERT INTO ks.b (p, b) VALUES (2, 0x01)")
+		expectInvalid(e, "SELECT blobAsInt(b) FROM ks.b WHERE p = 2", "In call to function system.blobasint, value 0x01 is not a valid binary representation for type int")
+	})
+
+	It("computes tokens with the Murmur3 partitioner", func() {
+		exec(e, "INSERT INTO ks.t (p, c) VALUES (1, now())")
+
+		rows := rows(e, "SELECT token(p) FROM ks.t")
+		Expect(rows.Columns[0].Name).To(Equal("system.token(p)"))
+		Expect(value(e, "SELECT token(p) FROM ks.t")).To(Equal(int64(-4069959284402364209)))
+	})
+
+	It("casts values", func() {
+		exec(e, "CREATE TABLE ks.n (p int PRIMARY KEY, d double, ts timestamp)")
+		exec(e, "INSERT INTO ks.n (p, d, ts) VALUES (1, 3.9, '2020-01-02 03:04:05+0000')")
+
+		rows := rows(e, "SELECT CAST(d AS int) FROM ks.n")
+		Expect(rows.Columns[0].Name).To(Equal("cast(d as int)"))
+		Expect(value(e, "SELECT CAST(d AS int) FROM ks.n")).To(Equal(int32(3)))
+		Expect(value(e, "SELECT CAST(p AS text) FROM ks.n")).To(Equal("1"))
+		Expect(value(e, "SELECT CAST(ts AS date) FROM ks.n")).To(Equal(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)))
+
+		expectInvalid(e, "SELECT CAST(ts AS int) FROM ks.n", "ts cannot be cast to int")
+	})
+
+	It("rejects unknown functions and invalid calls", func() {
+		expectInvalid(e, "SELECT nope(p) FROM ks.t", "Unknown function nope called")
+		expectInvalid(e, "SELECT toDate(v) FROM ks.t", "Invalid call to function system.todate, none of its type signatures match (known type signatures: system.todate : (timeuuid) -> date, system.todate : (timestamp) -> date)")
+		expectInvalid(e, "SELECT now(p) FROM ks.t", "Invalid number of arguments in call to function system.now: 0 required but 1 provided")
+		expectInvalid(e, "INSERT INTO ks.t (p, c) VALUES (1, uuid())", "Type error: cannot assign result of function system.uuid (type uuid) to c (type timeuuid)")
+	})
+})
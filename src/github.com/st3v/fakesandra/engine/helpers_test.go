@@ -0,0 +1,114 @@
+package engine_test
+
+import (
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/cql/parser"
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/cql/types"
+	"github.com/st3v/fakesandra/engine"
+)
+
+// query is a proto.Query with bound values and query parameters.
+type query struct {
+	statement   string
+	values      [][]byte
+	timestamp   time.Time
+	consistency proto.Consistency
+	serial      proto.Consistency
+	pageSize    int32
+	pagingState []byte
+}
+
+func (q query) String() string                               { return q.statement }
+func (q query) Statement() string                            { return q.statement }
+func (q query) Parsed() (parser.Statement, error)            { return parser.Parse(q.statement) }
+func (q query) Consistency() proto.Consistency               { return q.consistency }
+func (q query) Values() ([][]byte, bool)                     { return q.values, q.values != nil }
+func (q query) NamedValues() (map[string][]byte, bool)       { return nil, false }
+func (q query) SkipMetadata() bool                           { return false }
+func (q query) PageSize() (int32, bool)                      { return q.pageSize, q.pageSize != 0 }
+func (q query) PagingState() ([]byte, bool)                  { return q.pagingState, q.pagingState != nil }
+func (q query) SerialConsistency() (proto.Consistency, bool) { return q.serial, q.serial != proto.Any }
+func (q query) DefaultTimestamp() (time.Time, bool)          { return q.timestamp, !q.timestamp.IsZero() }
+
+// exec executes stmt, which must succeed.
+func exec(e *engine.Engine, stmt string) {
+	ExpectWithOffset(1, e.Exec(stmt)).To(Succeed())
+}
+
+// rows executes stmt, which must return rows.
+func rows(e *engine.Engine, stmt string) *result.Rows {
+	res, err := e.Execute(stmt)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	ExpectWithOffset(1, res).To(BeAssignableToTypeOf(&result.Rows{}))
+	return res.(*result.Rows)
+}
+
+// decode decodes the rows of a result using the types of their columns.
+// Null values are decoded as nil.
+func decode(rows *result.Rows) [][]interface{} {
+	decoded := [][]interface{}{}
+	for _, data := range rows.Data {
+		row := make([]interface{}, len(data))
+		for i, b := range data {
+			if b != nil {
+				v, err := types.Unmarshal(rows.Columns[i].Type, b)
+				ExpectWithOffset(1, err).NotTo(HaveOccurred())
+				row[i] = v
+			}
+		}
+		decoded = append(decoded, row)
+	}
+	return decoded
+}
+
+// values executes stmt and returns its decoded rows.
+func values(e *engine.Engine, stmt string) [][]interface{} {
+	res, err := e.Execute(stmt)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	ExpectWithOffset(1, res).To(BeAssignableToTypeOf(&result.Rows{}))
+	return decode(res.(*result.Rows))
+}
+
+// column executes stmt and returns the decoded values of its first column.
+func column(e *engine.Engine, stmt string) []interface{} {
+	res, err := e.Execute(stmt)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	ExpectWithOffset(1, res).To(BeAssignableToTypeOf(&result.Rows{}))
+
+	values := []interface{}{}
+	for _, row := range decode(res.(*result.Rows)) {
+		values = append(values, row[0])
+	}
+	return values
+}
+
+// value executes stmt and returns the first value of its first row, or nil
+// if there is no such row.
+func value(e *engine.Engine, stmt string) interface{} {
+	res, err := e.Execute(stmt)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	ExpectWithOffset(1, res).To(BeAssignableToTypeOf(&result.Rows{}))
+
+	decoded := decode(res.(*result.Rows))
+	if len(decoded) == 0 {
+		return nil
+	}
+	return decoded[0][0]
+}
+
+// expectError executes stmt, which must fail with the given error.
+func expectError(e *engine.Engine, stmt string, code proto.ErrorCode, message string) {
+	_, err := e.Execute(stmt)
+	ExpectWithOffset(1, err).To(Equal(proto.NewError(code, "%s", message)))
+}
+
+// expectInvalid executes stmt, which must fail with an Invalid error.
+func expectInvalid(e *engine.Engine, stmt, message string) {
+	_, err := e.Execute(stmt)
+	ExpectWithOffset(1, err).To(Equal(proto.NewError(proto.ErrInvalid, "%s", message)))
+}
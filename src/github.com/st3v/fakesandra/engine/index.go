@@ -0,0 +1,549 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/st3v/fakesandra/cql/parser"
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+// sasiIndex is the class of SASI indexes, which also support LIKE queries.
+const sasiIndex = "org.apache.cassandra.index.sasi.SASIIndex"
+
+// Index is a secondary index on a column of a table. The engine keeps an
+// entry for every value written to the column and uses them to find the
+// partitions of queries restricting it.
+type Index struct {
+	Name   string
+	Column string
+
+	// Kind is empty for indexes on columns that are not collections and
+	// one of "values", "keys", "entries" or "full" for collections.
+	Kind string
+
+	// Class is set for custom indexes, e.g. to the class of SASI indexes.
+	// Options holds the options given to custom indexes.
+	Class   string
+	Options map[string]string
+}
+
+// Target returns the indexed column as written in CREATE INDEX, e.g. v or
+// keys(m).
+func (idx *Index) Target() string {
+	column := parser.QuoteIdent(idx.Column)
+	if idx.Kind == "" {
+		return column
+	}
+	return idx.Kind + "(" + column + ")"
+}
+
+func (idx *Index) isSASI() bool {
+	return idx.Class == sasiIndex
+}
+
+// mode returns the mode of a SASI index, which determines the LIKE
+// queries it supports.
+func (idx *Index) mode() string {
+	if mode := idx.Options["mode"]; mode != "" {
+		return strings.ToUpper(mode)
+	}
+	return "PREFIX"
+}
+
+// supportsLike returns true if idx can answer LIKE queries of kind k.
+func (idx *Index) supportsLike(k likeKind) bool {
+	if !idx.isSASI() {
+		return false
+	}
+
+	switch idx.mode() {
+	case "CONTAINS":
+		return true
+	case "PREFIX":
+		return k == likePrefix || k == likeExact
+	}
+	return false
+}
+
+// supports returns true if idx can find the rows matching res.
+func (idx *Index) supports(res *restriction) bool {
+	switch {
+	case idx.isSASI():
+		return res.eq && len(res.values) == 1 || res.lower != nil || res.upper != nil || res.like != nil
+	case idx.Class != "":
+		return false
+	case idx.Kind == "values":
+		return len(res.contains) > 0
+	case idx.Kind == "keys":
+		return len(res.containsKeys) > 0
+	case idx.Kind == "entries":
+		return len(res.entries) > 0
+	}
+	return res.eq && len(res.values) == 1
+}
+
+// term returns the entry res looks up, or nil if the entries have to be
+// matched against res one by one, which is how SASI indexes are searched.
+func (idx *Index) term(res *restriction) []byte {
+	switch {
+	case idx.isSASI():
+		return nil
+	case idx.Kind == "values":
+		return res.contains[0]
+	case idx.Kind == "keys":
+		return res.containsKeys[0]
+	case idx.Kind == "entries":
+		return types.JoinComponents(res.entries[0][:])
+	}
+	return res.values[0]
+}
+
+// terms returns the entries idx holds for partition p and, unless nil, its
+// row r.
+func (idx *Index) terms(t *Table, p *partition, r *row) [][]byte {
+	c, found := t.Column(idx.Column)
+	if !found {
+		return nil
+	}
+
+	switch c.Kind {
+	case PartitionKey:
+		return [][]byte{p.key[c.Position]}
+	case Clustering:
+		if r == nil {
+			return nil
+		}
+		return [][]byte{r.clustering[c.Position]}
+	case Static:
+		return idx.cellTerms(c, p.static[c.Name])
+	}
+
+	if r == nil {
+		return nil
+	}
+	return idx.cellTerms(c, r.cells[c.Name])
+}
+
+// cellTerms returns the entries idx holds for the cell of column c. The
+// elements of non-frozen collections are indexed individually.
+func (idx *Index) cellTerms(c *Column, cl *cell) [][]byte {
+	if cl == nil {
+		return nil
+	}
+
+	if cl.elements == nil {
+		if cl.value == nil {
+			return nil
+		}
+		return [][]byte{cl.value}
+	}
+
+	terms := [][]byte{}
+	for k, e := range cl.elements {
+		if e.value == nil {
+			continue
+		}
+
+		switch {
+		case idx.Kind == "keys", idx.Kind == "values" && c.Type.ID == types.Set:
+			terms = append(terms, []byte(k))
+		case idx.Kind == "entries":
+			terms = append(terms, types.JoinComponents([][]byte{[]byte(k), e.value}))
+		default:
+			terms = append(terms, e.value)
+		}
+	}
+	return terms
+}
+
+// postings maps the entries of an index to the IDs of the partitions they
+// have been written to.
+type postings map[string]map[string]bool
+
+func (ps postings) add(term []byte, id string) {
+	ids, found := ps[string(term)]
+	if !found {
+		ids = map[string]bool{}
+		ps[string(term)] = ids
+	}
+	ids[id] = true
+}
+
+// index adds the entries of partition p and, unless nil, its row r to the
+// indexes of t. The caller has to hold the write lock. Entries are not
+// removed when values are overwritten, deleted or expire. Like Cassandra
+// does with stale entries, readers skip the partitions that no longer
+// match.
+func (s *store) index(t *Table, p *partition, r *row) {
+	for _, idx := range t.Indexes {
+		entries, found := s.indexes[idx.Name]
+		if !found {
+			entries = postings{}
+			s.indexes[idx.Name] = entries
+		}
+
+		for _, term := range idx.terms(t, p, r) {
+			entries.add(term, partitionID(p.key))
+		}
+	}
+}
+
+// buildIndex adds the entries of all data written so far to idx.
+func (s *store) buildIndex(t *Table, idx *Index) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := postings{}
+	for id, p := range s.partitions {
+		for _, term := range idx.terms(t, p, nil) {
+			entries.add(term, id)
+		}
+		for _, r := range p.rows {
+			for _, term := range idx.terms(t, p, r) {
+				entries.add(term, id)
+			}
+		}
+	}
+	s.indexes[idx.Name] = entries
+}
+
+// dropIndex discards the entries of the index with the given name.
+func (s *store) dropIndex(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.indexes, name)
+}
+
+// indexed returns the partitions idx finds for res in token order. The
+// caller has to hold the read lock.
+func (s *store) indexed(idx *Index, res *restriction) []*partition {
+	entries := s.indexes[idx.Name]
+
+	ids := map[string]bool{}
+	if term := idx.term(res); term != nil {
+		ids = entries[string(term)]
+	} else {
+		for term, partitions := range entries {
+			if res.match([]byte(term)) {
+				for id := range partitions {
+					ids[id] = true
+				}
+			}
+		}
+	}
+
+	candidates := []*partition{}
+	for _, p := range s.ring {
+		if ids[partitionID(p.key)] {
+			candidates = append(candidates, p)
+		}
+	}
+	return candidates
+}
+
+// chooseIndex returns the index used to find the rows of a query, which is
+// the first index that supports the restrictions on its column, or nil if
+// there is none.
+func (rs *restrictions) chooseIndex() *Index {
+	for _, c := range rs.table.Columns {
+		res, found := rs.columns[c.Name]
+		if !found {
+			continue
+		}
+		for _, idx := range rs.table.Indexes {
+			if idx.Column == c.Name && idx.supports(res) {
+				return idx
+			}
+		}
+	}
+	return nil
+}
+
+// likeKind is the kind of match a LIKE pattern asks for.
+type likeKind int
+
+const (
+	likeExact likeKind = iota
+	likePrefix
+	likeSuffix
+	likeContains
+)
+
+// likePattern is the pattern of a LIKE restriction, e.g. 'abc%' for
+// values starting with abc. Patterns of case insensitive SASI indexes fold
+// the case of the values they are matched against.
+type likePattern struct {
+	kind likeKind
+	text []byte
+	fold bool
+}
+
+// parseLike parses the pattern of a LIKE restriction. Only leading and
+// trailing wildcards are supported.
+func parseLike(v []byte) (*likePattern, error) {
+	p := &likePattern{text: v}
+	prefix, suffix := bytes.HasPrefix(v, []byte("%")), len(v) > 1 && bytes.HasSuffix(v, []byte("%"))
+
+	switch {
+	case prefix && suffix:
+		p.kind, p.text = likeContains, v[1:len(v)-1]
+	case prefix:
+		p.kind, p.text = likeSuffix, v[1:]
+	case suffix:
+		p.kind, p.text = likePrefix, v[:len(v)-1]
+	}
+
+	if len(p.text) == 0 {
+		return nil, invalid("LIKE value can't be empty.")
+	}
+	return p, nil
+}
+
+func (p *likePattern) match(v []byte) bool {
+	text := p.text
+	if p.fold {
+		v, text = bytes.ToLower(v), bytes.ToLower(text)
+	}
+
+	switch p.kind {
+	case likePrefix:
+		return bytes.HasPrefix(v, text)
+	case likeSuffix:
+		return bytes.HasSuffix(v, text)
+	case likeContains:
+		return bytes.Contains(v, text)
+	}
+	return bytes.Equal(v, text)
+}
+
+// restrictLike adds a LIKE relation on column c, which requires a SASI
+// index that supports the pattern.
+func (r *request) restrictLike(rs *restrictions, res *restriction, rel parser.Relation) error {
+	c := res.column
+	if res.like != nil || res.eq {
+		return invalid("%s cannot be restricted by more than one relation if it includes a LIKE", c.Name)
+	}
+
+	var (
+		pattern *likePattern
+		idx     *Index
+	)
+	switch c.Type.ID {
+	case types.Ascii, types.Varchar:
+		v, err := r.bind(rel.Right, c)
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			return invalid("Invalid null value in condition for column %s", c.Name)
+		}
+		if pattern, err = parseLike(v); err != nil {
+			return err
+		}
+
+		for _, i := range rs.table.Indexes {
+			if i.Column == c.Name && i.supportsLike(pattern.kind) {
+				idx = i
+				break
+			}
+		}
+	}
+	if idx == nil {
+		return invalid("LIKE restriction is only supported on properly indexed columns. %s is not valid.", rel)
+	}
+
+	pattern.fold = strings.EqualFold(idx.Options["case_sensitive"], "false")
+	res.like = pattern
+	return nil
+}
+
+// createIndex executes CREATE INDEX.
+func (e *Engine) createIndex(r *request, s *parser.CreateIndex) (result.Result, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ks, err := e.modifiableKeyspace(r, s.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	t, found := ks.tables[s.Table.Name]
+	if !found {
+		return nil, invalid("unconfigured table %s", s.Table.Name)
+	}
+
+	idx, err := buildIndex(t, s)
+	if err != nil {
+		return nil, err
+	}
+
+	if idx.Name == "" {
+		idx.Name = ks.indexName(t.Name + "_" + idx.Column + "_idx")
+	} else if _, _, found := ks.Index(idx.Name); found {
+		if s.IfNotExists {
+			return result.Void{}, nil
+		}
+		return nil, invalid("Index %s already exists", idx.Name)
+	}
+
+	for _, other := range t.Indexes {
+		if other.Column == idx.Column && other.Kind == idx.Kind && other.Class == idx.Class {
+			if s.IfNotExists {
+				return result.Void{}, nil
+			}
+			return nil, invalid("Index %s is a duplicate of existing index %s", idx.Name, other.Name)
+		}
+	}
+
+	t = t.clone()
+	t.Indexes = append(t.Indexes, idx)
+
+	ks = ks.clone()
+	ks.tables[t.Name] = t
+	e.keyspaces[ks.Name] = ks
+
+	t.data.buildIndex(t, idx)
+
+	return tableChange(result.Updated, t), nil
+}
+
+// buildIndex validates the definition of an index on table t.
+func buildIndex(t *Table, s *parser.CreateIndex) (*Index, error) {
+	if t.View != nil {
+		return nil, invalid("Secondary indexes are not supported on materialized views")
+	}
+	if t.IsCounter() {
+		return nil, invalid("Secondary indexes are not supported on counter tables")
+	}
+	if t.CompactStorage && len(t.ClusteringKey) > 0 {
+		return nil, invalid("Secondary indexes are not supported on COMPACT STORAGE tables that have clustering columns")
+	}
+
+	c, found := t.Column(s.Target.Column)
+	if !found {
+		return nil, invalid("No column definition found for column %s", s.Target.Column)
+	}
+
+	idx := &Index{Name: s.Index, Column: c.Name, Kind: s.Target.Kind, Class: s.Class, Options: map[string]string{}}
+	if p, found := s.Options.Get("options"); found {
+		options, err := mapOption(parser.Property{Name: "options", Value: p})
+		if err != nil {
+			return nil, err
+		}
+		idx.Options = options
+	}
+
+	typ := c.Type
+	switch {
+	case c.Kind == Static:
+		return nil, invalid("Secondary indexes are not allowed on static columns")
+	case c.Kind == PartitionKey && len(t.PartitionKey) == 1:
+		return nil, invalid("Cannot create secondary index on partition key column %s", c.Name)
+	case typ.ID == types.Duration:
+		return nil, invalid("Secondary indexes are not supported on duration columns")
+	case typ.ID == types.UDT && typ.IsMultiCell():
+		return nil, invalid("Secondary indexes are not supported on non-frozen user-defined types")
+	case idx.Kind == "full" && !(typ.IsCollection() && typ.Frozen):
+		return nil, invalid("full() indexes can only be created on frozen collections")
+	case idx.Kind != "" && idx.Kind != "full" && !typ.IsCollection():
+		return nil, invalid("Cannot create %s() index on %s. Non-collection columns support only simple indexes", idx.Kind, c.Name)
+	case idx.Kind == "keys" && typ.ID != types.Map:
+		return nil, invalid("Cannot create index on keys of column %s with non-map type", c.Name)
+	case idx.Kind == "entries" && typ.ID != types.Map:
+		return nil, invalid("Cannot create index on entries of column %s with non-map type", c.Name)
+	case idx.Kind != "" && idx.Kind != "full" && typ.Frozen:
+		return nil, invalid("Cannot create %s() index on frozen column %s. Frozen collections only support full() indexes", idx.Kind, c.Name)
+	case idx.Kind == "" && typ.IsCollection() && typ.Frozen:
+		return nil, invalid("Frozen collections currently only support full-collection indexes. For example, 'CREATE INDEX ON <table>(full(<columnName>))'.")
+	case idx.Kind == "" && typ.IsCollection():
+		// Like Cassandra, index the values of collections by default.
+		idx.Kind = "values"
+	}
+
+	if idx.isSASI() {
+		if typ.IsCollection() {
+			return nil, invalid("Cannot create SASI index on collection column %s", c.Name)
+		}
+		switch idx.mode() {
+		case "PREFIX", "CONTAINS", "SPARSE":
+		default:
+			return nil, invalid("Incorrect index mode: %s", idx.Options["mode"])
+		}
+	}
+
+	return idx, nil
+}
+
+// dropIndex executes DROP INDEX.
+func (e *Engine) dropIndex(r *request, s *parser.DropIndex) (result.Result, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ks, err := e.modifiableKeyspace(r, s.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, t, found := ks.Index(s.Index.Name)
+	if !found {
+		if s.IfExists {
+			return result.Void{}, nil
+		}
+		return nil, invalid("Index '%s' could not be found in any of the tables of keyspace '%s'", s.Index.Name, ks.Name)
+	}
+
+	t = t.clone()
+	indexes := []*Index{}
+	for _, other := range t.Indexes {
+		if other != idx {
+			indexes = append(indexes, other)
+		}
+	}
+	t.Indexes = indexes
+
+	ks = ks.clone()
+	ks.tables[t.Name] = t
+	e.keyspaces[ks.Name] = ks
+
+	t.data.dropIndex(idx.Name)
+
+	return tableChange(result.Updated, t), nil
+}
+
+// Index returns the index with the given name together with its table.
+// Index names are unique within a keyspace.
+func (ks *Keyspace) Index(name string) (*Index, *Table, bool) {
+	for _, t := range ks.tables {
+		for _, idx := range t.Indexes {
+			if idx.Name == name {
+				return idx, t, true
+			}
+		}
+	}
+	return nil, nil, false
+}
+
+// indexName returns name or, if an index of that name exists, name
+// followed by the first free number.
+func (ks *Keyspace) indexName(name string) string {
+	candidate := name
+	for i := 1; ; i++ {
+		if _, _, found := ks.Index(candidate); !found {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s_%d", name, i)
+	}
+}
+
+// indexOn returns the index on column c of t, if any.
+func (t *Table) indexOn(c *Column) (*Index, bool) {
+	for _, idx := range t.Indexes {
+		if idx.Column == c.Name {
+			return idx, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,125 @@
+package engine_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/cql/types"
+	"github.com/st3v/fakesandra/engine"
+)
+
+var _ = Describe("Secondary indexes", func() {
+	var e *engine.Engine
+
+	BeforeEach(func() {
+		e = engine.New()
+		exec(e, "CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}")
+		exec(e, "CREATE TABLE ks.users (id int, c int, name text, city text, tags set<text>, scores list<int>, attrs map<text, int>, PRIMARY KEY (id, c))")
+		exec(e, "INSERT INTO ks.users (id, c, name, city, tags, scores, attrs) VALUES (1, 0, 'Alice', 'Berlin', {'admin', 'dev'}, [1, 2], {'age': 30})")
+		exec(e, "INSERT INTO ks.users (id, c, name, city, tags, scores, attrs) VALUES (2, 0, 'Bob', 'Paris', {'dev'}, [3], {'height': 180})")
+		exec(e, "INSERT INTO ks.users (id, c, name, city, tags, scores, attrs) VALUES (3, 1, 'Carol', 'Berlin', {'ops'}, [2], {'age': 41})")
+	})
+
+	It("answers equality queries on indexed columns", func() {
+		expectInvalid(e, "SELECT id FROM ks.users WHERE city = 'Berlin'", "Cannot execute this query as it might involve data filtering and thus may have unpredictable performance. If you want to execute this query despite the performance unpredictability, use ALLOW FILTERING")
+
+		exec(e, "CREATE INDEX ON ks.users (city)")
+		Expect(column(e, "SELECT id FROM ks.users WHERE city = 'Berlin'")).To(ConsistOf(int32(1), int32(3)))
+
+		exec(e, "UPDATE ks.users SET city = 'Rome' WHERE id = 1 AND c = 0")
+		exec(e, "INSERT INTO ks.users (id, c, city) VALUES (4, 0, 'Berlin')")
+		exec(e, "DELETE FROM ks.users WHERE id = 3")
+		Expect(column(e, "SELECT id FROM ks.users WHERE city = 'Berlin'")).To(Equal([]interface{}{int32(4)}))
+		Expect(column(e, "SELECT id FROM ks.users WHERE city = 'Rome'")).To(Equal([]interface{}{int32(1)}))
+
+		Expect(column(e, "SELECT id FROM ks.users WHERE city = 'Paris' AND c = 0")).To(Equal([]interface{}{int32(2)}))
+		expectInvalid(e, "SELECT id FROM ks.users WHERE city = 'Paris' AND name = 'Bob'", "Cannot execute this query as it might involve data filtering and thus may have unpredictable performance. If you want to execute this query despite the performance unpredictability, use ALLOW FILTERING")
+		Expect(column(e, "SELECT id FROM ks.users WHERE city = 'Paris' AND name = 'Bob' ALLOW FILTERING")).To(Equal([]interface{}{int32(2)}))
+
+		exec(e, "TRUNCATE ks.users")
+		Expect(column(e, "SELECT id FROM ks.users WHERE city = 'Berlin'")).To(BeEmpty())
+	})
+
+	It("answers CONTAINS and CONTAINS KEY queries on collection indexes", func() {
+		exec(e, "CREATE INDEX ON ks.users (tags)")
+		exec(e, "CREATE INDEX ON ks.users (values(scores))")
+		exec(e, "CREATE INDEX ON ks.users (keys(attrs))")
+
+		Expect(column(e, "SELECT id FROM ks.users WHERE tags CONTAINS 'dev'")).To(ConsistOf(int32(1), int32(2)))
+		Expect(column(e, "SELECT id FROM ks.users WHERE scores CONTAINS 2")).To(ConsistOf(int32(1), int32(3)))
+		Expect(column(e, "SELECT id FROM ks.users WHERE attrs CONTAINS KEY 'age'")).To(ConsistOf(int32(1), int32(3)))
+
+		exec(e, "UPDATE ks.users SET tags = tags - {'dev'} WHERE id = 1 AND c = 0")
+		Expect(column(e, "SELECT id FROM ks.users WHERE tags CONTAINS 'dev'")).To(Equal([]interface{}{int32(2)}))
+
+		expectInvalid(e, "SELECT id FROM ks.users WHERE attrs CONTAINS 30", "Cannot execute this query as it might involve data filtering and thus may have unpredictable performance. If you want to execute this query despite the performance unpredictability, use ALLOW FILTERING")
+		Expect(column(e, "SELECT id FROM ks.users WHERE attrs CONTAINS 30 ALLOW FILTERING")).To(Equal([]interface{}{int32(1)}))
+		expectInvalid(e, "SELECT id FROM ks.users WHERE city CONTAINS 'x'", "Cannot use CONTAINS on non-collection column city")
+		expectInvalid(e, "SELECT id FROM ks.users WHERE tags CONTAINS KEY 'x'", "Cannot use CONTAINS KEY on non-map column tags")
+	})
+
+	It("answers queries on map entries and frozen collections", func() {
+		exec(e, "CREATE INDEX ON ks.users (entries(attrs))")
+		Expect(column(e, "SELECT id FROM ks.users WHERE attrs['age'] = 41")).To(Equal([]interface{}{int32(3)}))
+
+		exec(e, "CREATE TABLE ks.f (p int PRIMARY KEY, v frozen<list<int>>)")
+		exec(e, "INSERT INTO ks.f (p, v) VALUES (1, [1, 2])")
+		exec(e, "INSERT INTO ks.f (p, v) VALUES (2, [2, 1])")
+		exec(e, "CREATE INDEX ON ks.f (full(v))")
+		Expect(column(e, "SELECT p FROM ks.f WHERE v = [2, 1]")).To(Equal([]interface{}{int32(2)}))
+	})
+
+	It("answers LIKE queries on SASI indexes", func() {
+		expectInvalid(e, "SELECT id FROM ks.users WHERE name LIKE 'A%' ALLOW FILTERING", "LIKE restriction is only supported on properly indexed columns. name LIKE 'A%' is not valid.")
+
+		exec(e, "CREATE CUSTOM INDEX ON ks.users (name) USING 'org.apache.cassandra.index.sasi.SASIIndex'")
+		Expect(column(e, "SELECT id FROM ks.users WHERE name LIKE 'Ca%'")).To(Equal([]interface{}{int32(3)}))
+		Expect(column(e, "SELECT id FROM ks.users WHERE name LIKE 'Bob'")).To(Equal([]interface{}{int32(2)}))
+		Expect(column(e, "SELECT id FROM ks.users WHERE name = 'Alice'")).To(Equal([]interface{}{int32(1)}))
+		expectInvalid(e, "SELECT id FROM ks.users WHERE name LIKE '%ol'", "LIKE restriction is only supported on properly indexed columns. name LIKE '%ol' is not valid.")
+		expectInvalid(e, "SELECT id FROM ks.users WHERE name LIKE '%'", "LIKE value can't be empty.")
+
+		exec(e, "CREATE CUSTOM INDEX ON ks.users (city) USING 'org.apache.cassandra.index.sasi.SASIIndex' WITH OPTIONS = {'mode': 'CONTAINS', 'case_sensitive': 'false'}")
+		Expect(column(e, "SELECT id FROM ks.users WHERE city LIKE '%LIN'")).To(ConsistOf(int32(1), int32(3)))
+		Expect(column(e, "SELECT id FROM ks.users WHERE city LIKE '%ari%'")).To(Equal([]interface{}{int32(2)}))
+		Expect(column(e, "SELECT id FROM ks.users WHERE city LIKE 'ber%'")).To(ConsistOf(int32(1), int32(3)))
+	})
+
+	It("uses indexes on primary key columns", func() {
+		exec(e, "CREATE TABLE ks.events (a int, b int, c int, v int, PRIMARY KEY ((a, b), c))")
+		exec(e, "INSERT INTO ks.events (a, b, c, v) VALUES (1, 1, 1, 1)")
+		exec(e, "INSERT INTO ks.events (a, b, c, v) VALUES (1, 2, 2, 2)")
+		exec(e, "INSERT INTO ks.events (a, b, c, v) VALUES (2, 2, 2, 3)")
+
+		exec(e, "CREATE INDEX ON ks.events (b)")
+		exec(e, "CREATE INDEX ON ks.events (c)")
+		Expect(column(e, "SELECT v FROM ks.events WHERE b = 2")).To(ConsistOf(int32(2), int32(3)))
+		Expect(column(e, "SELECT v FROM ks.events WHERE a = 1 AND b = 2")).To(Equal([]interface{}{int32(2)}))
+		Expect(column(e, "SELECT v FROM ks.events WHERE c = 1")).To(Equal([]interface{}{int32(1)}))
+	})
+
+	It("validates and drops indexes", func() {
+		exec(e, "CREATE INDEX city_idx ON ks.users (city)")
+		exec(e, "CREATE INDEX IF NOT EXISTS city_idx ON ks.users (name)")
+		expectInvalid(e, "CREATE INDEX city_idx ON ks.users (name)", "Index city_idx already exists")
+		expectInvalid(e, "CREATE INDEX other ON ks.users (city)", "Index other is a duplicate of existing index city_idx")
+		expectInvalid(e, "CREATE INDEX ON ks.users (nope)", "No column definition found for column nope")
+		expectInvalid(e, "CREATE INDEX ON ks.users (id)", "Cannot create secondary index on partition key column id")
+		expectInvalid(e, "CREATE INDEX ON ks.users (keys(tags))", "Cannot create index on keys of column tags with non-map type")
+		expectInvalid(e, "CREATE INDEX ON ks.users (keys(city))", "Cannot create keys() index on city. Non-collection columns support only simple indexes")
+		expectInvalid(e, "CREATE INDEX ON ks.users (full(tags))", "full() indexes can only be created on frozen collections")
+		expectInvalid(e, "ALTER TABLE ks.users DROP city", "Cannot drop column city because it has dependent secondary indexes (city_idx)")
+
+		exec(e, "CREATE INDEX ON ks.users (keys(attrs))")
+		Expect(column(e, "SELECT options FROM system_schema.indexes WHERE keyspace_name = 'ks' AND table_name = 'users'")).To(Equal([]interface{}{
+			[]types.Pair{{Key: "target", Value: "city"}},
+			[]types.Pair{{Key: "target", Value: "keys(attrs)"}},
+		}))
+		Expect(column(e, "SELECT index_name FROM system_schema.indexes")).To(Equal([]interface{}{"city_idx", "users_attrs_idx"}))
+
+		exec(e, "DROP INDEX ks.city_idx")
+		expectInvalid(e, "DROP INDEX ks.city_idx", "Index 'city_idx' could not be found in any of the tables of keyspace 'ks'")
+		exec(e, "DROP INDEX IF EXISTS ks.city_idx")
+		expectInvalid(e, "SELECT id FROM ks.users WHERE city = 'Berlin'", "Cannot execute this query as it might involve data filtering and thus may have unpredictable performance. If you want to execute this query despite the performance unpredictability, use ALLOW FILTERING")
+	})
+})
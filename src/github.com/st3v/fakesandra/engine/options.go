@@ -0,0 +1,168 @@
+package engine
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/st3v/fakesandra/cql/parser"
+)
+
+// maxTTL is the largest TTL Cassandra accepts, 20 years in seconds.
+const maxTTL = 20 * 365 * 24 * 60 * 60
+
+// TableOptions are the options of a table as set with WITH.
+type TableOptions struct {
+	Comment           string
+	DefaultTimeToLive int
+	GCGraceSeconds    int
+
+	Caching     map[string]string
+	Compaction  map[string]string
+	Compression map[string]string
+
+	// Other holds the remaining options, e.g. speculative_retry, as they
+	// are listed in system_schema.tables.
+	Other map[string]string
+}
+
+func defaultTableOptions() TableOptions {
+	return TableOptions{
+		GCGraceSeconds: 864000,
+		Caching: map[string]string{
+			"keys":               "ALL",
+			"rows_per_partition": "NONE",
+		},
+		Compaction: map[string]string{
+			"class":         "org.apache.cassandra.db.compaction.SizeTieredCompactionStrategy",
+			"max_threshold": "32",
+			"min_threshold": "4",
+		},
+		Compression: map[string]string{
+			"chunk_length_in_kb": "64",
+			"class":              "org.apache.cassandra.io.compress.LZ4Compressor",
+		},
+		Other: map[string]string{
+			"bloom_filter_fp_chance":      "0.01",
+			"crc_check_chance":            "1.0",
+			"dclocal_read_repair_chance":  "0.1",
+			"max_index_interval":          "2048",
+			"memtable_flush_period_in_ms": "0",
+			"min_index_interval":          "128",
+			"read_repair_chance":          "0.0",
+			"speculative_retry":           "99PERCENTILE",
+		},
+	}
+}
+
+func (o TableOptions) clone() TableOptions {
+	c := o
+	c.Caching = copyMap(o.Caching)
+	c.Compaction = copyMap(o.Compaction)
+	c.Compression = copyMap(o.Compression)
+	c.Other = copyMap(o.Other)
+	return c
+}
+
+func copyMap(m map[string]string) map[string]string {
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// set applies the given properties. Options that are not given keep their
+// current value.
+func (o *TableOptions) set(properties parser.Properties) error {
+	for _, p := range properties {
+		var err error
+
+		switch p.Name {
+		case "comment":
+			o.Comment, err = stringOption(p)
+		case "default_time_to_live":
+			o.DefaultTimeToLive, err = intOption(p, 0, maxTTL)
+		case "gc_grace_seconds":
+			o.GCGraceSeconds, err = intOption(p, 0, -1)
+		case "caching":
+			o.Caching, err = mapOption(p)
+		case "compaction":
+			if o.Compaction, err = mapOption(p); err == nil {
+				err = classOption(o.Compaction, p.Name, "org.apache.cassandra.db.compaction.")
+			}
+		case "compression":
+			if o.Compression, err = mapOption(p); err == nil && o.Compression["enabled"] != "false" {
+				err = classOption(o.Compression, p.Name, "org.apache.cassandra.io.compress.")
+			}
+		default:
+			if _, found := o.Other[p.Name]; !found {
+				return syntaxError("Unknown property '%s'", p.Name)
+			}
+			o.Other[p.Name], err = stringOption(p)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func stringOption(p parser.Property) (string, error) {
+	switch p.Value.(type) {
+	case *parser.Map, *parser.Set, *parser.List:
+		return "", syntaxError("Invalid value for property '%s'. It should be a string", p.Name)
+	}
+	return constant(p.Value), nil
+}
+
+// intOption returns the value of an integer option within [min, max]. A
+// negative max means there is no upper bound.
+func intOption(p parser.Property, min, max int) (int, error) {
+	s, err := stringOption(p)
+	if err != nil {
+		return 0, err
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, syntaxError("Invalid integer value %s for '%s'", s, p.Name)
+	}
+
+	if v < min {
+		return 0, configError("%s must be greater than or equal to %d (got %d)", p.Name, min, v)
+	}
+	if max >= 0 && v > max {
+		return 0, configError("%s must be less than or equal to %d (got %d)", p.Name, max, v)
+	}
+
+	return v, nil
+}
+
+func mapOption(p parser.Property) (map[string]string, error) {
+	m, ok := p.Value.(*parser.Map)
+	if !ok {
+		return nil, syntaxError("Invalid value for property '%s'. It should be a map.", p.Name)
+	}
+
+	values := map[string]string{}
+	for _, e := range m.Entries {
+		values[constant(e.Key)] = constant(e.Value)
+	}
+	return values, nil
+}
+
+// classOption requires the class sub-option and qualifies short class names
+// with the given package.
+func classOption(m map[string]string, name, pkg string) error {
+	class, found := m["class"]
+	if !found {
+		return configError("Missing sub-option 'class' for the '%s' option.", name)
+	}
+
+	if !strings.Contains(class, ".") {
+		m["class"] = pkg + class
+	}
+	return nil
+}
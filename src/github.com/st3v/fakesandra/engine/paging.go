@@ -0,0 +1,87 @@
+package engine
+
+import "github.com/st3v/fakesandra/cql/types"
+
+// pageSize returns the number of rows per page the client asked for or 0
+// if the result is not to be paged.
+func (r *request) pageSize() int {
+	if r.query == nil {
+		return 0
+	}
+	size, set := r.query.PageSize()
+	if !set || size <= 0 {
+		return 0
+	}
+	return int(size)
+}
+
+// pagingState returns the paging state the client sent to fetch the next
+// page or nil if it asked for the first page.
+func (r *request) pagingState() []byte {
+	if r.query == nil {
+		return nil
+	}
+	state, set := r.query.PagingState()
+	if !set || len(state) == 0 {
+		return nil
+	}
+	return state
+}
+
+// position is the position of a row in the order rows are returned. The
+// clustering is nil for partitions with static values only.
+type position struct {
+	key        [][]byte
+	token      int64
+	clustering [][]byte
+}
+
+// encodePagingState returns the paging state of a page ending with m. It
+// holds the partition key and the clustering of m.
+func encodePagingState(m match) []byte {
+	return types.JoinComponents(append(append([][]byte{}, m.key...), m.clustering()...))
+}
+
+// decodePagingState decodes the paging state sent by the client.
+func decodePagingState(t *Table, state []byte) (position, error) {
+	nkey, nclustering := len(t.PartitionKey), len(t.ClusteringKey)
+
+	components, err := types.SplitComponents(state, nkey+nclustering)
+	if err != nil || components[nkey-1] == nil {
+		return position{}, invalid("Invalid value for the paging state")
+	}
+
+	pos := position{key: components[:nkey], token: token(components[:nkey])}
+	if nclustering > 0 && components[nkey] != nil {
+		pos.clustering = components[nkey:]
+	}
+	return pos, nil
+}
+
+// resume drops the groups of rows up to and including the position the
+// previous page ended at. Rows are ordered by partition and clustering or,
+// if the rows of multiple partitions are merged, by clustering first.
+func resume(t *Table, groups [][]match, pos position, reversed, merged bool) [][]match {
+	compare := func(m match) int {
+		p := comparePartitions(t, m.token, m.key, pos.token, pos.key)
+		c := compareClustering(t, m.clustering(), pos.clustering)
+		if reversed {
+			c = -c
+		}
+
+		switch {
+		case merged && c != 0:
+			return c
+		case merged, p != 0:
+			return p
+		}
+		return c
+	}
+
+	for i, g := range groups {
+		if len(g) > 0 && compare(g[len(g)-1]) > 0 {
+			return groups[i:]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+package engine
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/st3v/fakesandra/cql/parser"
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+// Prepare describes stmt the way Cassandra does when a client prepares it:
+// the bind variables of the statement and the columns of the rows it
+// returns. Only the schema the statement refers to is checked, bound values
+// are validated when the statement is executed.
+func (e *Engine) Prepare(stmt string, session *proto.Session) (*result.Prepared, error) {
+	parsed, err := parser.Parse(stmt)
+	if err != nil {
+		return nil, proto.NewError(proto.ErrSyntax, "%s", err)
+	}
+
+	r := e.newRequest(session, nil)
+	r.variables = map[int]result.Column{}
+
+	columns, err := e.describe(r, parsed)
+	if err != nil {
+		return nil, e.Profile().reword(err)
+	}
+
+	n := 0
+	for i := range r.variables {
+		if i >= n {
+			n = i + 1
+		}
+	}
+
+	variables := make([]result.Column, n)
+	for i := range variables {
+		v, found := r.variables[i]
+		if !found {
+			// Markers the engine does not bind take any value.
+			v = result.Column{Name: "[" + strconv.Itoa(i) + "]", Type: types.Native(types.Blob)}
+		}
+		variables[i] = v
+	}
+
+	return &result.Prepared{Variables: variables, Columns: columns}, nil
+}
+
+// describe declares the bind variables of stmt on r and returns the columns
+// of the rows stmt returns, if any. The values of the markers are null, so
+// errors binding them are left to the execution of the statement.
+func (e *Engine) describe(r *request, stmt parser.Statement) ([]result.Column, error) {
+	switch s := stmt.(type) {
+	case *parser.Select:
+		return e.describeSelect(r, s)
+	case *parser.Insert:
+		return nil, e.describeInsert(r, s)
+	case *parser.Update:
+		return nil, e.describeUpdate(r, s)
+	case *parser.Delete:
+		return nil, e.describeDelete(r, s)
+	case *parser.Batch:
+		r.describeUsing(s.Using)
+		for _, stmt := range s.Statements {
+			if _, err := e.describe(r, stmt); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (e *Engine) describeSelect(r *request, s *parser.Select) ([]result.Column, error) {
+	t, err := e.table(r, s.Table)
+	if err == errNotHandled {
+		t, err = e.systemTable(r, s.Table)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.preparing = t
+
+	selections, err := r.selectColumns(t, s.Selectors)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.describeRelations(t, s.Where); err != nil {
+		return nil, err
+	}
+	r.describeTerm(s.PerPartitionLimit, "[per_partition_limit]", types.Native(types.Int))
+	r.describeTerm(s.Limit, "[limit]", types.Native(types.Int))
+
+	return resultColumns(t, selections), nil
+}
+
+func (e *Engine) describeInsert(r *request, s *parser.Insert) error {
+	t, err := e.writableTable(r, s.Table)
+	if err != nil {
+		return err
+	}
+	r.preparing = t
+
+	for i, name := range s.Columns {
+		c, found := t.Column(name)
+		if !found {
+			return invalid("Undefined column name %s", name)
+		}
+		if i < len(s.Values) {
+			r.bind(s.Values[i], c)
+		}
+	}
+	r.describeTerm(s.JSON, "[json]", types.Native(types.Varchar))
+	r.describeUsing(s.Using)
+	return nil
+}
+
+func (e *Engine) describeUpdate(r *request, s *parser.Update) error {
+	t, err := e.writableTable(r, s.Table)
+	if err != nil {
+		return err
+	}
+	r.preparing = t
+	r.describeUsing(s.Using)
+
+	for _, a := range s.Assignments {
+		var target *parser.Column
+		switch x := a.Target.(type) {
+		case *parser.Column:
+			target = x
+		case *parser.Index:
+			target, _ = x.Expr.(*parser.Column)
+		case *parser.Field:
+			target, _ = x.Expr.(*parser.Column)
+		}
+		if target == nil {
+			return invalid("Invalid operation %s for non collection column", a.Target)
+		}
+
+		c, found := t.Column(target.Name)
+		if !found {
+			return invalid("Undefined column name %s", target.Name)
+		}
+
+		switch x := a.Target.(type) {
+		case *parser.Index:
+			if c.Type.IsCollection() {
+				r.describeElement(c, x.Key)
+				r.bindAs(a.Value, c.Name, c.Type.Elems[len(c.Type.Elems)-1])
+			}
+		case *parser.Field:
+			if i := fieldIndex(c.Type, x.Name); c.Type.ID == types.UDT && i >= 0 {
+				r.bindAs(a.Value, c.Name+"."+x.Name, c.Type.Elems[i])
+			}
+		default:
+			r.describeAssignment(c, a.Value)
+		}
+	}
+
+	if err := r.describeRelations(t, s.Where); err != nil {
+		return err
+	}
+	return r.describeRelations(t, s.If)
+}
+
+func (e *Engine) describeDelete(r *request, s *parser.Delete) error {
+	t, err := e.writableTable(r, s.Table)
+	if err != nil {
+		return err
+	}
+	r.preparing = t
+
+	for _, term := range s.Columns {
+		x, ok := term.(*parser.Index)
+		if !ok {
+			continue
+		}
+		col, ok := x.Expr.(*parser.Column)
+		if !ok {
+			return invalid("Invalid deletion operation %s", term)
+		}
+		c, found := t.Column(col.Name)
+		if !found {
+			return invalid("Undefined column name %s", col.Name)
+		}
+		if c.Type.IsCollection() {
+			r.describeElement(c, x.Key)
+		}
+	}
+	r.describeUsing(s.Using)
+
+	if err := r.describeRelations(t, s.Where); err != nil {
+		return err
+	}
+	return r.describeRelations(t, s.If)
+}
+
+// describeTerm declares the bind variables of an optional term.
+func (r *request) describeTerm(term parser.Term, name string, t types.Type) {
+	if term != nil {
+		r.bindAs(term, name, t)
+	}
+}
+
+// describeUsing declares the bind variables of a USING clause.
+func (r *request) describeUsing(using parser.Using) {
+	r.describeTerm(using.Timestamp, "[timestamp]", bigintType)
+	r.describeTerm(using.TTL, "[ttl]", types.Native(types.Int))
+}
+
+// describeElement declares the bind variable of the list index or map key
+// of c[k].
+func (r *request) describeElement(c *Column, key parser.Term) {
+	if c.Type.ID == types.List {
+		r.bindAs(key, "idx("+c.Name+")", types.Native(types.Int))
+		return
+	}
+	r.bindAs(key, "key("+c.Name+")", c.Type.Elems[0])
+}
+
+// describeAssignment declares the bind variables of c = v in the SET clause
+// of an UPDATE, including increments of counters and operations on
+// collections, e.g. c = c + ? or c = ? + c.
+func (r *request) describeAssignment(c *Column, value parser.Term) {
+	op, ok := value.(*parser.Operation)
+	switch {
+	case !ok:
+		r.bind(value, c)
+	case c.Type.ID == types.Counter:
+		r.bindAs(op.Right, c.Name, bigintType)
+	case c.Type.IsCollection():
+		typ := c.Type
+		if op.Op == "-" && typ.ID == types.Map {
+			typ = types.SetOf(typ.Elems[0])
+		}
+
+		operand := op.Right
+		if _, prepended := op.Right.(*parser.Column); prepended {
+			operand = op.Left
+		}
+		r.bindAs(operand, c.Name, typ)
+	}
+}
+
+// describeRelations declares the bind variables of the relations of a WHERE
+// or an IF clause.
+func (r *request) describeRelations(t *Table, relations []parser.Relation) error {
+	for _, rel := range relations {
+		_, marker := rel.Right.(*parser.BindMarker)
+
+		switch left := rel.Left.(type) {
+		case *parser.Column:
+			c, found := t.Column(left.Name)
+			if !found {
+				return invalid("Undefined column name %s", left.Name)
+			}
+
+			switch {
+			case rel.Op == parser.Contains || rel.Op == parser.ContainsKey:
+				r.elementValue(c, rel)
+			case rel.Op == parser.In && marker:
+				r.bindAs(rel.Right, "in("+c.Name+")", types.ListOf(c.Type))
+			default:
+				r.bindValues(rel, c.Name, c.Type)
+			}
+		case *parser.Index:
+			col, ok := left.Expr.(*parser.Column)
+			if !ok {
+				return invalid("Unsupported restriction: %s", rel)
+			}
+			c, found := t.Column(col.Name)
+			if !found {
+				return invalid("Undefined column name %s", col.Name)
+			}
+			if c.Type.ID == types.Map {
+				r.bindAs(left.Key, "key("+c.Name+")", c.Type.Elems[0])
+				r.bindAs(rel.Right, "value("+c.Name+")", c.Type.Elems[1])
+			}
+		case *parser.Tuple:
+			names := make([]string, len(left.Elems))
+			elems := make([]types.Type, len(left.Elems))
+			for i, e := range left.Elems {
+				col, ok := e.(*parser.Column)
+				if !ok {
+					return invalid("Unsupported restriction: %s", rel)
+				}
+				c, found := t.Column(col.Name)
+				if !found {
+					return invalid("Undefined column name %s", col.Name)
+				}
+				names[i], elems[i] = c.Name, c.Type
+			}
+
+			name, tuple := "("+strings.Join(names, ",")+")", types.TupleOf(elems...)
+			if rel.Op == parser.In && marker {
+				r.bindAs(rel.Right, "in"+name, types.ListOf(tuple))
+				break
+			}
+			r.bindValues(rel, name, tuple)
+		case *parser.FunctionCall:
+			r.tokenValue(t, rel.Right, "partition key token")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package engine_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/engine"
+)
+
+var _ = Describe("Prepare", func() {
+	var e *engine.Engine
+
+	// specs prepares stmt and returns the specifications of its bind
+	// variables and result columns as "keyspace.table.name type".
+	specs := func(stmt string) ([]string, []string) {
+		prepared, err := e.Prepare(stmt, proto.NewSession())
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+
+		describe := func(columns []result.Column) []string {
+			if columns == nil {
+				return nil
+			}
+			specs := []string{}
+			for _, c := range columns {
+				specs = append(specs, c.Keyspace+"."+c.Table+"."+c.Name+" "+c.Type.String())
+			}
+			return specs
+		}
+		return describe(prepared.Variables), describe(prepared.Columns)
+	}
+
+	BeforeEach(func() {
+		e = engine.New()
+		exec(e, "CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}")
+		exec(e, "CREATE TABLE ks.t (p int, c text, v bigint, l list<int>, m map<text, int>, PRIMARY KEY (p, c))")
+		exec(e, "CREATE TABLE ks.counts (p int PRIMARY KEY, n counter)")
+	})
+
+	It("describes the bind variables of INSERT", func() {
+		variables, columns := specs("INSERT INTO ks.t (p, c, l) VALUES (?, ?, [?, 1]) USING TTL ? AND TIMESTAMP ?")
+		Expect(variables).To(Equal([]string{
+			"ks.t.p int",
+			"ks.t.c text",
+			"ks.t.l int",
+			"ks.t.[ttl] int",
+			"ks.t.[timestamp] bigint",
+		}))
+		Expect(columns).To(BeNil())
+	})
+
+	It("describes the bind variables and result columns of SELECT", func() {
+		variables, columns := specs("SELECT c, writetime(v), v AS value FROM ks.t WHERE p IN ? AND c > ? AND m CONTAINS KEY ? LIMIT ? ALLOW FILTERING")
+		Expect(variables).To(Equal([]string{
+			"ks.t.in(p) list<int>",
+			"ks.t.c text",
+			"ks.t.key(m) text",
+			"ks.t.[limit] int",
+		}))
+		Expect(columns).To(Equal([]string{
+			"ks.t.c text",
+			"ks.t.writetime(v) bigint",
+			"ks.t.value bigint",
+		}))
+
+		variables, columns = specs("SELECT * FROM ks.t WHERE token(p) > token(?) AND token(p) <= ?")
+		Expect(variables).To(Equal([]string{
+			"ks.t.p int",
+			"ks.t.partition key token bigint",
+		}))
+		Expect(columns).To(HaveLen(5))
+	})
+
+	It("describes the bind variables of UPDATE and DELETE", func() {
+		variables, _ := specs("UPDATE ks.t SET v = ?, l = ? + l, m[?] = ? WHERE p = ? AND c IN (?, ?) IF v = ?")
+		Expect(variables).To(Equal([]string{
+			"ks.t.v bigint",
+			"ks.t.l list<int>",
+			"ks.t.key(m) text",
+			"ks.t.m int",
+			"ks.t.p int",
+			"ks.t.c text",
+			"ks.t.c text",
+			"ks.t.v bigint",
+		}))
+
+		variables, _ = specs("UPDATE ks.counts SET n = n + ? WHERE p = ?")
+		Expect(variables).To(Equal([]string{"ks.counts.n bigint", "ks.counts.p int"}))
+
+		variables, _ = specs("DELETE l[?] FROM ks.t USING TIMESTAMP ? WHERE p = ? AND (c) > ?")
+		Expect(variables).To(Equal([]string{
+			"ks.t.idx(l) int",
+			"ks.t.[timestamp] bigint",
+			"ks.t.p int",
+			"ks.t.(c) tuple<text>",
+		}))
+	})
+
+	It("describes the bind variables of the statements of batches", func() {
+		variables, columns := specs("BEGIN BATCH USING TIMESTAMP ? INSERT INTO ks.t (p, c) VALUES (?, ?); UPDATE ks.counts SET n = n + 1 WHERE p = ?; APPLY BATCH")
+		Expect(variables).To(Equal([]string{
+			"..[timestamp] bigint",
+			"ks.t.p int",
+			"ks.t.c text",
+			"ks.counts.p int",
+		}))
+		Expect(columns).To(BeNil())
+	})
+
+	It("describes named bind variables by their names", func() {
+		variables, _ := specs("SELECT * FROM ks.t WHERE p = :key AND c = :clustering")
+		Expect(variables).To(Equal([]string{"ks.t.key int", "ks.t.clustering text"}))
+	})
+
+	It("refuses statements on unknown tables and columns", func() {
+		_, err := e.Prepare("SELECT * FROM ks.unknown WHERE p = ?", proto.NewSession())
+		Expect(err).To(HaveOccurred())
+
+		_, err = e.Prepare("INSERT INTO ks.t (p, x) VALUES (?, ?)", proto.NewSession())
+		Expect(err).To(MatchError("Undefined column name x"))
+
+		_, err = e.Prepare("SELECT * FROM", proto.NewSession())
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,299 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/st3v/fakesandra/cql/parser"
+	"github.com/st3v/fakesandra/cql/proto"
+)
+
+// Profile describes the Cassandra release the engine pretends to be. It
+// determines the versions listed in system.local, the layout of the system
+// tables, the protocol versions offered to clients, the wording of some
+// errors and which CQL features are available.
+type Profile struct {
+	// Version is the release series, e.g. 3.11.
+	Version        string
+	ReleaseVersion string
+	CQLVersion     string
+
+	// ProtocolVersions lists the native protocol versions the release
+	// supports in ascending order.
+	ProtocolVersions []proto.Version
+
+	// aliases are further names the profile can be looked up by.
+	aliases []string
+}
+
+var profiles = []Profile{
+	{
+		Version:          "2.1",
+		ReleaseVersion:   "2.1.22",
+		CQLVersion:       "3.2.1",
+		ProtocolVersions: []proto.Version{1, 2, 3},
+	},
+	{
+		Version:          "3.11",
+		ReleaseVersion:   "3.11.4",
+		CQLVersion:       "3.4.4",
+		ProtocolVersions: []proto.Version{3, 4},
+		aliases:          []string{"3"},
+	},
+	{
+		Version:          "4.0",
+		ReleaseVersion:   "4.0.1",
+		CQLVersion:       "3.4.5",
+		ProtocolVersions: []proto.Version{3, 4, 5},
+		aliases:          []string{"4"},
+	},
+}
+
+// DefaultProfile returns the profile of Cassandra 3.11.
+func DefaultProfile() Profile {
+	p, _ := LookupProfile("3.11")
+	return p
+}
+
+// LookupProfile returns the profile of the given Cassandra version. Release
+// series such as 3.11 or 4.x as well as releases such as 3.11.4 or 4.0.1
+// are accepted. Releases are matched by their major and minor version and
+// listed as release version.
+func LookupProfile(version string) (Profile, error) {
+	name := strings.TrimSuffix(version, ".x")
+	series := name
+	if parts := strings.SplitN(name, ".", 3); len(parts) == 3 {
+		series = parts[0] + "." + parts[1]
+	}
+
+	for _, p := range profiles {
+		if series == p.Version {
+			if series != name {
+				p.ReleaseVersion = name
+			}
+			return p, nil
+		}
+		for _, alias := range p.aliases {
+			if name == alias {
+				return p, nil
+			}
+		}
+	}
+
+	supported := make([]string, len(profiles))
+	for i, p := range profiles {
+		supported[i] = p.Version
+	}
+	return Profile{}, fmt.Errorf("unsupported Cassandra version %s, supported versions are %s", version, strings.Join(supported, ", "))
+}
+
+// Profile returns the profile of the Cassandra release the engine pretends
+// to be.
+func (e *Engine) Profile() Profile {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.profile
+}
+
+// SetProfile changes the Cassandra release the engine pretends to be. The
+// schema and data are kept.
+func (e *Engine) SetProfile(p Profile) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.profile = p
+}
+
+// atLeast returns true if the release of the profile is the given version
+// or a later one.
+func (p Profile) atLeast(version string) bool {
+	have, want := strings.Split(p.ReleaseVersion, "."), strings.Split(version, ".")
+	for i := range want {
+		if i >= len(have) {
+			return false
+		}
+		h, _ := strconv.Atoi(have[i])
+		w, _ := strconv.Atoi(want[i])
+		if h != w {
+			return h > w
+		}
+	}
+	return true
+}
+
+// NativeProtocolVersion returns the highest protocol version supported by
+// both the release and the proto package.
+func (p Profile) NativeProtocolVersion() proto.Version {
+	supported := p.supportedVersions(proto.Versions)
+	if len(supported) == 0 {
+		return 0
+	}
+	return supported[len(supported)-1]
+}
+
+// supportedVersions returns the versions of the release that are also in
+// implemented.
+func (p Profile) supportedVersions(implemented []proto.Version) []proto.Version {
+	supported := []proto.Version{}
+	for _, v := range p.ProtocolVersions {
+		for _, i := range implemented {
+			if v == i {
+				supported = append(supported, v)
+				break
+			}
+		}
+	}
+	return supported
+}
+
+// UnsupportedProtocolVersion returns the message the release answers a
+// frame of an unsupported protocol version with. Only versions in
+// implemented are offered to the client.
+func (p Profile) UnsupportedProtocolVersion(version proto.Version, implemented []proto.Version) string {
+	if !p.atLeast("3.0") {
+		return fmt.Sprintf("Invalid or unsupported protocol version: %d", version)
+	}
+
+	return (&proto.UnsupportedVersionError{
+		Version:   version,
+		Supported: p.supportedVersions(implemented),
+	}).Error()
+}
+
+// checkFeatures rejects statements that use CQL features the release does
+// not provide.
+func (p Profile) checkFeatures(r *request, stmt parser.Statement) error {
+	switch s := stmt.(type) {
+	case *parser.Select:
+		if len(s.GroupBy) > 0 && !p.atLeast("3.10") {
+			return syntaxError("no viable alternative at input 'GROUP'")
+		}
+		if s.PerPartitionLimit != nil && !p.atLeast("3.6") {
+			return syntaxError("no viable alternative at input 'PER'")
+		}
+		if s.JSON && !p.atLeast("2.2") {
+			return syntaxError("no viable alternative at input 'JSON'")
+		}
+		for _, rel := range s.Where {
+			if rel.Op == parser.Like && !p.atLeast("3.4") {
+				return syntaxError("no viable alternative at input 'LIKE'")
+			}
+		}
+		for _, sel := range s.Selectors {
+			c, ok := sel.Expr.(*parser.Cast)
+			if !ok {
+				continue
+			}
+			if !p.atLeast("3.0") {
+				return syntaxError("no viable alternative at input 'AS'")
+			}
+			if err := p.checkTypes(r, s.Table, c.Type); err != nil {
+				return err
+			}
+		}
+	case *parser.CreateIndex:
+		if s.Class == sasiIndex && !p.atLeast("3.4") {
+			return invalid("Unable to find custom indexer class '%s'", s.Class)
+		}
+	case *parser.Insert:
+		if s.JSON != nil && !p.atLeast("2.2") {
+			return syntaxError("no viable alternative at input 'JSON'")
+		}
+	case *parser.CreateFunction, *parser.DropFunction:
+		if !p.atLeast("2.2") {
+			return syntaxError("no viable alternative at input 'FUNCTION'")
+		}
+	case *parser.CreateAggregate, *parser.DropAggregate:
+		if !p.atLeast("2.2") {
+			return syntaxError("no viable alternative at input 'AGGREGATE'")
+		}
+	case *parser.CreateView, *parser.AlterView, *parser.DropView:
+		if !p.atLeast("3.0") {
+			return syntaxError("no viable alternative at input 'MATERIALIZED'")
+		}
+	case *parser.CreateTable:
+		for _, c := range s.Columns {
+			if err := p.checkTypes(r, s.Table, c.Type); err != nil {
+				return err
+			}
+		}
+	case *parser.AlterTable:
+		for _, c := range s.Add {
+			if err := p.checkTypes(r, s.Table, c.Type); err != nil {
+				return err
+			}
+		}
+		if s.Alter != nil {
+			return p.checkTypes(r, s.Table, s.Alter.Type)
+		}
+	case *parser.CreateType:
+		for _, f := range s.Fields {
+			if err := p.checkTypes(r, s.Type, f.Type); err != nil {
+				return err
+			}
+		}
+	case *parser.AlterType:
+		for _, f := range s.Add {
+			if err := p.checkTypes(r, s.Type, f.Type); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// typeSince lists the native types that were added after 2.1 with the
+// release that introduced them.
+var typeSince = map[string]string{
+	"smallint": "2.2",
+	"tinyint":  "2.2",
+	"date":     "2.2",
+	"time":     "2.2",
+	"duration": "3.10",
+}
+
+// checkTypes rejects native types the release does not know. Like in
+// Cassandra they are taken for unknown user-defined types of the keyspace
+// of name.
+func (p Profile) checkTypes(r *request, name parser.Name, t parser.Type) error {
+	if since, found := typeSince[t.Name]; found && t.Keyspace == "" && !t.Custom && !p.atLeast(since) {
+		ks, err := r.keyspaceName(name)
+		if err != nil {
+			return err
+		}
+		return invalid("Unknown type %s.%s", ks, t.Name)
+	}
+
+	for _, param := range t.Params {
+		if err := p.checkTypes(r, name, param); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reword changes the wording of errors that differ between releases.
+func (p Profile) reword(err error) error {
+	e, ok := err.(*proto.Error)
+	if !ok || e.Code != proto.ErrInvalid {
+		return err
+	}
+
+	msg := e.Message
+	switch {
+	case !p.atLeast("3.0"):
+		if strings.HasPrefix(msg, "unconfigured table ") {
+			msg = "unconfigured columnfamily " + strings.TrimPrefix(msg, "unconfigured table ")
+		}
+		msg = strings.Replace(msg, " (unless you use the token() function or allow filtering)", " (unless you use the token() function)", 1)
+	case p.atLeast("4.0"):
+		if strings.HasPrefix(msg, "unconfigured table ") {
+			msg = "table " + strings.TrimPrefix(msg, "unconfigured table ") + " does not exist"
+		}
+	}
+
+	if msg == e.Message {
+		return err
+	}
+	return proto.NewError(e.Code, "%s", msg)
+}
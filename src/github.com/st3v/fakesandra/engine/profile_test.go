@@ -0,0 +1,135 @@
+package engine_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/cql/types"
+	"github.com/st3v/fakesandra/engine"
+)
+
+var _ = Describe("Profile", func() {
+	var e *engine.Engine
+
+	use := func(version string) {
+		p, err := engine.LookupProfile(version)
+		Expect(err).NotTo(HaveOccurred())
+		e.SetProfile(p)
+	}
+
+	// local returns the value of column of system.local.
+	local := func(column string) interface{} {
+		res, err := e.Execute("SELECT " + column + " FROM system.local")
+		Expect(err).NotTo(HaveOccurred())
+
+		rows := res.(*result.Rows)
+		Expect(rows.Data).To(HaveLen(1))
+		v, err := types.Unmarshal(rows.Columns[0].Type, rows.Data[0][0])
+		Expect(err).NotTo(HaveOccurred())
+		return v
+	}
+
+	BeforeEach(func() {
+		e = engine.New()
+		exec(e, "CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}")
+		exec(e, "CREATE TABLE ks.t (p int, c int, v int, PRIMARY KEY (p, c))")
+	})
+
+	It("looks up profiles by release series and release", func() {
+		p, err := engine.LookupProfile("4.x")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.Version).To(Equal("4.0"))
+		Expect(p.ProtocolVersions).To(Equal([]proto.Version{3, 4, 5}))
+
+		p, err = engine.LookupProfile("3.11.10")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.Version).To(Equal("3.11"))
+		Expect(p.ReleaseVersion).To(Equal("3.11.10"))
+
+		for release, series := range map[string]string{"2.1.22": "2.1", "3.11.4": "3.11", "4.0.1": "4.0"} {
+			p, err = engine.LookupProfile(release)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.Version).To(Equal(series))
+			Expect(p.ReleaseVersion).To(Equal(release))
+		}
+
+		_, err = engine.LookupProfile("3.1.1")
+		Expect(err).To(MatchError("unsupported Cassandra version 3.1.1, supported versions are 2.1, 3.11, 4.0"))
+
+		_, err = engine.LookupProfile("3.0")
+		Expect(err).To(MatchError("unsupported Cassandra version 3.0, supported versions are 2.1, 3.11, 4.0"))
+
+		Expect(e.Profile()).To(Equal(engine.DefaultProfile()))
+		Expect(engine.DefaultProfile().Version).To(Equal("3.11"))
+	})
+
+	It("lists the versions of the release in system.local", func() {
+		Expect(local("release_version")).To(Equal("3.11.4"))
+		Expect(local("cql_version")).To(Equal("3.4.4"))
+
+		use("2.1")
+		Expect(local("release_version")).To(Equal("2.1.22"))
+		Expect(local("cql_version")).To(Equal("3.2.1"))
+		Expect(local("native_protocol_version")).To(Equal("3"))
+
+		cluster := e.Cluster()
+		cluster.Local.ReleaseVersion = "2.1.9"
+		e.SetCluster(cluster)
+		Expect(local("release_version")).To(Equal("2.1.9"))
+	})
+
+	It("has the system tables of the release", func() {
+		Expect(e.Exec("SELECT * FROM system_schema.tables")).To(Succeed())
+		expectError(e, "SELECT * FROM system.schema_columnfamilies", proto.ErrInvalid, "unconfigured table schema_columnfamilies")
+		expectError(e, "SELECT * FROM system.peers_v2", proto.ErrInvalid, "unconfigured table peers_v2")
+
+		use("2.1")
+		Expect(e.Exec("SELECT * FROM system.schema_columnfamilies")).To(Succeed())
+		expectError(e, "SELECT * FROM system_schema.tables", proto.ErrInvalid, "Keyspace system_schema does not exist")
+
+		use("4.x")
+		cluster := e.Cluster()
+		cluster.Peers = []engine.Node{{Address: "10.0.0.2", RPCAddress: "10.0.0.2"}}
+		e.SetCluster(cluster)
+
+		res, err := e.Execute("SELECT peer, native_port, release_version FROM system.peers_v2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.(*result.Rows).Data).To(HaveLen(1))
+		Expect(types.Unmarshal(types.Native(types.Varchar), res.(*result.Rows).Data[0][2])).To(Equal("4.0.1"))
+	})
+
+	It("words errors like the release", func() {
+		expectError(e, "SELECT * FROM ks.nope", proto.ErrInvalid, "unconfigured table nope")
+
+		use("2.1")
+		expectError(e, "SELECT * FROM ks.nope", proto.ErrInvalid, "unconfigured columnfamily nope")
+		expectError(e, "SELECT * FROM ks.t WHERE p > 1", proto.ErrInvalid, "Only EQ and IN relation are supported on the partition key (unless you use the token() function)")
+
+		use("4.0")
+		expectError(e, "SELECT * FROM ks.nope", proto.ErrInvalid, "table nope does not exist")
+	})
+
+	It("provides the features of the release", func() {
+		exec(e, "SELECT p, count(*) FROM ks.t GROUP BY p")
+		exec(e, "CREATE TABLE ks.d (p int PRIMARY KEY, v duration)")
+
+		use("2.1")
+		expectError(e, "SELECT p, count(*) FROM ks.t GROUP BY p", proto.ErrSyntax, "no viable alternative at input 'GROUP'")
+		expectError(e, "SELECT * FROM ks.t PER PARTITION LIMIT 1", proto.ErrSyntax, "no viable alternative at input 'PER'")
+		expectError(e, "CREATE TABLE ks.s (p int PRIMARY KEY, v map<int, smallint>)", proto.ErrInvalid, "Unknown type ks.smallint")
+		expectError(e, "CREATE FUNCTION ks.f (x int) RETURNS NULL ON NULL INPUT RETURNS int LANGUAGE java AS 'return x;'", proto.ErrSyntax, "no viable alternative at input 'FUNCTION'")
+		expectError(e, "ALTER TABLE ks.t ADD e duration", proto.ErrInvalid, "Unknown type ks.duration")
+		exec(e, "CREATE TABLE ks.s (p int PRIMARY KEY, v map<int, text>)")
+	})
+
+	It("describes unsupported protocol versions like the release", func() {
+		implemented := []proto.Version{proto.Version3}
+
+		Expect(e.Profile().UnsupportedProtocolVersion(5, implemented)).To(Equal("Invalid or unsupported protocol version (5); supported versions are (3/v3)"))
+
+		use("2.1")
+		Expect(e.Profile().UnsupportedProtocolVersion(4, implemented)).To(Equal("Invalid or unsupported protocol version: 4"))
+	})
+})
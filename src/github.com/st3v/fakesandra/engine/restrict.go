@@ -0,0 +1,853 @@
+package engine
+
+import (
+	"strings"
+
+	"github.com/st3v/fakesandra/cql/parser"
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+const filteringMessage = "Cannot execute this query as it might involve data filtering and thus may have unpredictable performance. If you want to execute this query despite the performance unpredictability, use ALLOW FILTERING"
+
+// bound is one end of a slice restriction.
+type bound struct {
+	value     []byte
+	inclusive bool
+}
+
+// restriction holds all restrictions on a single column.
+type restriction struct {
+	column *Column
+
+	// eq is set for EQ and IN restrictions, values holds the value of an
+	// EQ or the values of an IN restriction.
+	eq     bool
+	values [][]byte
+
+	lower, upper *bound
+
+	// contains and containsKeys hold the values of CONTAINS and CONTAINS
+	// KEY relations on collections, entries the keys and values of
+	// m[key] = value relations on maps.
+	contains     [][]byte
+	containsKeys [][]byte
+	entries      [][2][]byte
+
+	// like is the pattern of a LIKE relation.
+	like *likePattern
+}
+
+// match returns true if v satisfies the restriction. Null values never do.
+func (rs *restriction) match(v []byte) bool {
+	if v == nil {
+		return false
+	}
+
+	t := rs.column.Type
+
+	if rs.eq {
+		found := false
+		for _, value := range rs.values {
+			if types.Compare(t, v, value) == 0 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if rs.lower != nil {
+		c := types.Compare(t, v, rs.lower.value)
+		if c < 0 || c == 0 && !rs.lower.inclusive {
+			return false
+		}
+	}
+
+	if rs.upper != nil {
+		c := types.Compare(t, v, rs.upper.value)
+		if c > 0 || c == 0 && !rs.upper.inclusive {
+			return false
+		}
+	}
+
+	if rs.like != nil && !rs.like.match(v) {
+		return false
+	}
+
+	return rs.matchElements(v)
+}
+
+// matchElements returns true if the collection v satisfies the CONTAINS,
+// CONTAINS KEY and map entry relations of the restriction.
+func (rs *restriction) matchElements(v []byte) bool {
+	if len(rs.contains) == 0 && len(rs.containsKeys) == 0 && len(rs.entries) == 0 {
+		return true
+	}
+
+	t := rs.column.Type
+	elems, err := types.SplitCollection(v)
+	if err != nil {
+		return false
+	}
+
+	keys, values := elems, elems
+	if t.ID == types.Map {
+		keys, values = nil, nil
+		for i := 0; i+1 < len(elems); i += 2 {
+			keys = append(keys, elems[i])
+			values = append(values, elems[i+1])
+		}
+	}
+
+	has := func(elems [][]byte, typ types.Type, v []byte) bool {
+		for _, e := range elems {
+			if types.Compare(typ, e, v) == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	valueType := t.Elems[len(t.Elems)-1]
+	for _, c := range rs.contains {
+		if !has(values, valueType, c) {
+			return false
+		}
+	}
+
+	for _, k := range rs.containsKeys {
+		if !has(keys, t.Elems[0], k) {
+			return false
+		}
+	}
+
+	for _, entry := range rs.entries {
+		found := false
+		for i, k := range keys {
+			if types.Compare(t.Elems[0], k, entry[0]) == 0 {
+				found = types.Compare(valueType, values[i], entry[1]) == 0
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// tupleBound is one end of a multi-column slice restriction.
+type tupleBound struct {
+	values    [][]byte
+	inclusive bool
+}
+
+// multiRestriction is a multi-column restriction on a prefix of the
+// clustering columns, e.g. (c1, c2) > (1, 2). Tuples are compared in the
+// natural order of the column types.
+type multiRestriction struct {
+	columns []*Column
+
+	eq     bool
+	values [][][]byte
+
+	lower, upper *tupleBound
+}
+
+func (m *multiRestriction) compare(clustering, values [][]byte) int {
+	for i, c := range m.columns {
+		if cmp := types.Compare(c.Type, clustering[c.Position], values[i]); cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+// match returns true if the clustering of a row satisfies the restriction.
+func (m *multiRestriction) match(clustering [][]byte) bool {
+	if clustering == nil {
+		return false
+	}
+
+	if m.eq {
+		for _, values := range m.values {
+			if m.compare(clustering, values) == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	if m.lower != nil {
+		c := m.compare(clustering, m.lower.values)
+		if c < 0 || c == 0 && !m.lower.inclusive {
+			return false
+		}
+	}
+
+	if m.upper != nil {
+		c := m.compare(clustering, m.upper.values)
+		if c > 0 || c == 0 && !m.upper.inclusive {
+			return false
+		}
+	}
+
+	return true
+}
+
+// restrictions are the restrictions of the WHERE clause of a SELECT.
+type restrictions struct {
+	table   *Table
+	columns map[string]*restriction
+	multi   []*multiRestriction
+
+	// keys holds the partition keys if the partition key is restricted by
+	// EQ or IN and is nil otherwise.
+	keys [][][]byte
+
+	// token restricts the tokens of the partitions if the WHERE clause
+	// has token relations.
+	token *restriction
+
+	// index is the secondary index used to find the partitions, if any.
+	index *Index
+
+	// filtering is set if the query has to filter rows that are not
+	// selected by the primary key alone.
+	filtering bool
+}
+
+// restrict builds and validates the restrictions of a SELECT statement.
+// Aliases of the selection are only used to report their misuse.
+func (r *request) restrict(t *Table, s *parser.Select, aliases map[string]bool) (*restrictions, error) {
+	rs := &restrictions{table: t, columns: map[string]*restriction{}}
+
+	for _, rel := range s.Where {
+		var err error
+		switch left := rel.Left.(type) {
+		case *parser.Column:
+			c, found := t.Column(left.Name)
+			if !found {
+				if aliases[left.Name] {
+					return nil, invalid("Aliases aren't allowed in the where clause ('%s')", rel)
+				}
+				return nil, invalid("Undefined column name %s", left.Name)
+			}
+			err = r.restrictColumn(rs, c, rel)
+		case *parser.Index:
+			err = r.restrictEntry(rs, left, rel)
+		case *parser.Tuple:
+			err = r.restrictTuple(rs, left, rel)
+		case *parser.FunctionCall:
+			err = r.restrictToken(rs, left, rel)
+		default:
+			err = invalid("Unsupported restriction: %s", rel)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rs.index = rs.chooseIndex()
+
+	if err := rs.validatePartitionKey(s.AllowFiltering); err != nil {
+		return nil, err
+	}
+
+	// Queries using an index may restrict any part of the primary key.
+	if err := rs.validateClustering(s.AllowFiltering || rs.index != nil); err != nil {
+		return nil, err
+	}
+
+	if rs.index != nil {
+		rs.filtering = false
+	}
+
+	for _, c := range t.Columns {
+		if _, found := rs.columns[c.Name]; found && !c.IsPrimaryKey() && (rs.index == nil || c.Name != rs.index.Column) {
+			rs.filtering = true
+		}
+	}
+
+	if rs.filtering && !s.AllowFiltering {
+		return nil, invalid(filteringMessage)
+	}
+
+	return rs, nil
+}
+
+func (r *request) restrictColumn(rs *restrictions, c *Column, rel parser.Relation) error {
+	existing, found := rs.columns[c.Name]
+	if !found {
+		existing = &restriction{column: c}
+	}
+
+	switch rel.Op {
+	case parser.Eq, parser.In:
+		if found {
+			if rel.Op == parser.In {
+				return invalid("%s cannot be restricted by more than one relation if it includes a IN", c.Name)
+			}
+			return invalid("%s cannot be restricted by more than one relation if it includes an Equal", c.Name)
+		}
+
+		if rel.Op == parser.In && !c.IsPrimaryKey() {
+			return invalid("IN predicates on non-primary-key columns (%s) is not yet supported", c.Name)
+		}
+
+		values, err := r.relationValues(rel, c.Name, c.Type)
+		if err != nil {
+			return err
+		}
+		existing.eq = true
+		existing.values = values
+	case parser.Lt, parser.Lte, parser.Gt, parser.Gte:
+		if existing.eq {
+			return invalid("%s cannot be restricted by more than one relation if it includes an Equal", c.Name)
+		}
+
+		v, err := r.bind(rel.Right, c)
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			return invalid("Invalid null value in condition for column %s", c.Name)
+		}
+
+		b := &bound{value: v, inclusive: rel.Op == parser.Lte || rel.Op == parser.Gte}
+		if rel.Op == parser.Gt || rel.Op == parser.Gte {
+			if existing.lower != nil {
+				return invalid("More than one restriction was found for the start bound on %s", c.Name)
+			}
+			existing.lower = b
+		} else {
+			if existing.upper != nil {
+				return invalid("More than one restriction was found for the end bound on %s", c.Name)
+			}
+			existing.upper = b
+		}
+	case parser.Contains, parser.ContainsKey:
+		v, err := r.elementValue(c, rel)
+		if err != nil {
+			return err
+		}
+		if rel.Op == parser.Contains {
+			existing.contains = append(existing.contains, v)
+		} else {
+			existing.containsKeys = append(existing.containsKeys, v)
+		}
+	case parser.Like:
+		if err := r.restrictLike(rs, existing, rel); err != nil {
+			return err
+		}
+	case parser.NotEq:
+		return invalid("Unsupported \"!=\" relation: %s", rel)
+	default:
+		return invalid("Unsupported restriction: %s", rel)
+	}
+
+	rs.columns[c.Name] = existing
+	return nil
+}
+
+// elementValue returns the value of a CONTAINS or CONTAINS KEY relation on
+// collection column c.
+func (r *request) elementValue(c *Column, rel parser.Relation) ([]byte, error) {
+	t := c.Type
+
+	var (
+		v   []byte
+		err error
+	)
+	switch {
+	case rel.Op == parser.ContainsKey && t.ID != types.Map:
+		return nil, invalid("Cannot use CONTAINS KEY on non-map column %s", c.Name)
+	case rel.Op == parser.ContainsKey:
+		v, err = r.bindAs(rel.Right, "key("+c.Name+")", t.Elems[0])
+	case !t.IsCollection():
+		return nil, invalid("Cannot use CONTAINS on non-collection column %s", c.Name)
+	default:
+		v, err = r.bindAs(rel.Right, "value("+c.Name+")", t.Elems[len(t.Elems)-1])
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if v == nil {
+		return nil, invalid("Unsupported null value for column %s", c.Name)
+	}
+	return v, nil
+}
+
+// restrictEntry adds a relation on the value of a map entry, e.g.
+// m['key'] = 'value'.
+func (r *request) restrictEntry(rs *restrictions, left *parser.Index, rel parser.Relation) error {
+	col, ok := left.Expr.(*parser.Column)
+	if !ok || rel.Op != parser.Eq {
+		return invalid("Unsupported restriction: %s", rel)
+	}
+
+	c, found := rs.table.Column(col.Name)
+	if !found {
+		return invalid("Undefined column name %s", col.Name)
+	}
+	if c.Type.ID != types.Map {
+		return invalid("Column %s cannot be used as a map", c.Name)
+	}
+
+	key, err := r.bindAs(left.Key, "key("+c.Name+")", c.Type.Elems[0])
+	if err != nil {
+		return err
+	}
+	value, err := r.bindAs(rel.Right, "value("+c.Name+")", c.Type.Elems[1])
+	if err != nil {
+		return err
+	}
+	if key == nil || value == nil {
+		return invalid("Unsupported null value for column %s", c.Name)
+	}
+
+	existing, found := rs.columns[c.Name]
+	if !found {
+		existing = &restriction{column: c}
+		rs.columns[c.Name] = existing
+	}
+	existing.entries = append(existing.entries, [2][]byte{key, value})
+	return nil
+}
+
+// relationValues returns the value of an EQ or the values of an IN
+// relation. Null values are rejected.
+func (r *request) relationValues(rel parser.Relation, name string, t types.Type) ([][]byte, error) {
+	values, err := r.bindValues(rel, name, t)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range values {
+		if v == nil {
+			return nil, invalid("Invalid null value in condition for column %s", name)
+		}
+	}
+
+	return values, nil
+}
+
+// bindValues returns the value of the right side of a relation or, for IN
+// relations, its candidates.
+func (r *request) bindValues(rel parser.Relation, name string, t types.Type) ([][]byte, error) {
+	var values [][]byte
+
+	switch x := rel.Right.(type) {
+	case *parser.Tuple:
+		if rel.Op != parser.In {
+			v, err := r.bindAs(x, name, t)
+			if err != nil {
+				return nil, err
+			}
+			values = [][]byte{v}
+			break
+		}
+
+		values = [][]byte{}
+		for _, e := range x.Elems {
+			v, err := r.bindAs(e, name, t)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+	case *parser.BindMarker:
+		if rel.Op != parser.In {
+			v, err := r.bindAs(x, name, t)
+			if err != nil {
+				return nil, err
+			}
+			values = [][]byte{v}
+			break
+		}
+
+		b, err := r.bindAs(x, name, types.ListOf(t))
+		if err != nil {
+			return nil, err
+		}
+		if b == nil {
+			return nil, invalid("Invalid null value for IN restriction")
+		}
+		if values, err = types.SplitCollection(b); err != nil {
+			return nil, invalid("%s", err)
+		}
+	default:
+		v, err := r.bindAs(x, name, t)
+		if err != nil {
+			return nil, err
+		}
+		values = [][]byte{v}
+	}
+
+	return values, nil
+}
+
+func (r *request) restrictTuple(rs *restrictions, left *parser.Tuple, rel parser.Relation) error {
+	t := rs.table
+
+	m := &multiRestriction{}
+	names := make([]string, len(left.Elems))
+	elems := make([]types.Type, len(left.Elems))
+
+	for i, e := range left.Elems {
+		name := e.(*parser.Column).Name
+		c, found := t.Column(name)
+		if !found {
+			return invalid("Undefined column name %s", name)
+		}
+		if c.Kind != Clustering {
+			return invalid("Multi-column relations can only be applied to clustering columns but was applied to: %s", name)
+		}
+		if c.Position != i {
+			return invalid("Clustering columns must appear in the PRIMARY KEY order in multi-column relations: %s", rel)
+		}
+
+		m.columns = append(m.columns, c)
+		names[i] = name
+		elems[i] = c.Type
+	}
+
+	tuple := types.TupleOf(elems...)
+	name := "(" + strings.Join(names, ",") + ")"
+
+	split := func(b []byte) ([][]byte, error) {
+		values, err := types.SplitComponents(b, len(elems))
+		if err != nil {
+			return nil, invalid("%s", err)
+		}
+		for i, v := range values {
+			if v == nil {
+				return nil, invalid("Invalid null value in condition for column %s", names[i])
+			}
+		}
+		return values, nil
+	}
+
+	switch rel.Op {
+	case parser.Eq, parser.In:
+		if len(rs.multi) > 0 {
+			return invalid("%s cannot be restricted by more than one relation if it includes an Equal", names[0])
+		}
+
+		values, err := r.relationValues(rel, name, tuple)
+		if err != nil {
+			return err
+		}
+
+		m.eq = true
+		for _, v := range values {
+			components, err := split(v)
+			if err != nil {
+				return err
+			}
+			m.values = append(m.values, components)
+		}
+	case parser.Lt, parser.Lte, parser.Gt, parser.Gte:
+		v, err := r.bindAs(rel.Right, name, tuple)
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			return invalid("Invalid null value in condition for column %s", name)
+		}
+		components, err := split(v)
+		if err != nil {
+			return err
+		}
+
+		b := &tupleBound{values: components, inclusive: rel.Op == parser.Lte || rel.Op == parser.Gte}
+		if rel.Op == parser.Gt || rel.Op == parser.Gte {
+			m.lower = b
+		} else {
+			m.upper = b
+		}
+	default:
+		return invalid("Unsupported restriction: %s", rel)
+	}
+
+	rs.multi = append(rs.multi, m)
+	return nil
+}
+
+// restrictToken adds a relation on the token of the partition key, e.g.
+// token(p) > ? or token(p) > token(?). The arguments have to be the
+// partition key columns.
+func (r *request) restrictToken(rs *restrictions, left *parser.FunctionCall, rel parser.Relation) error {
+	t := rs.table
+
+	if left.Keyspace != "" && left.Keyspace != "system" || left.Name != "token" {
+		return invalid("Unsupported restriction: %s", rel)
+	}
+
+	names := make([]string, len(t.PartitionKey))
+	for i, c := range t.PartitionKey {
+		names[i] = c.Name
+	}
+
+	ordered := true
+	for i, arg := range left.Args {
+		c, ok := arg.(*parser.Column)
+		if !ok {
+			return invalid("Unsupported restriction: %s", rel)
+		}
+		if _, found := t.Column(c.Name); !found {
+			return invalid("Undefined column name %s", c.Name)
+		}
+		ordered = ordered && i < len(names) && c.Name == names[i]
+	}
+	if len(left.Args) != len(names) {
+		return invalid("The token() function must be applied to all partition key components or none of them")
+	}
+	if !ordered {
+		return invalid("The token function arguments must be in the partition key order: %s", strings.Join(names, ", "))
+	}
+
+	existing := rs.token
+	if existing == nil {
+		existing = &restriction{column: &Column{Name: "partition key token", Type: bigintType}}
+	}
+
+	name := "token(" + strings.Join(names, ", ") + ")"
+
+	switch rel.Op {
+	case parser.Eq:
+		if rs.token != nil {
+			return invalid("%s cannot be restricted by more than one relation if it includes an Equal", name)
+		}
+		v, err := r.tokenValue(t, rel.Right, existing.column.Name)
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			return invalid("Invalid null value in condition for column %s", existing.column.Name)
+		}
+		existing.eq = true
+		existing.values = [][]byte{v}
+	case parser.Lt, parser.Lte, parser.Gt, parser.Gte:
+		if existing.eq {
+			return invalid("%s cannot be restricted by more than one relation if it includes an Equal", name)
+		}
+		v, err := r.tokenValue(t, rel.Right, existing.column.Name)
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			return invalid("Invalid null value in condition for column %s", existing.column.Name)
+		}
+
+		b := &bound{value: v, inclusive: rel.Op == parser.Lte || rel.Op == parser.Gte}
+		if rel.Op == parser.Gt || rel.Op == parser.Gte {
+			if existing.lower != nil {
+				return invalid("More than one restriction was found for the start bound on %s", name)
+			}
+			existing.lower = b
+		} else {
+			if existing.upper != nil {
+				return invalid("More than one restriction was found for the end bound on %s", name)
+			}
+			existing.upper = b
+		}
+	default:
+		return invalid("Unsupported restriction: %s", rel)
+	}
+
+	rs.token = existing
+	return nil
+}
+
+// tokenValue returns the token a token relation compares to. Like in
+// Cassandra, it is either a bigint or the token of a partition key given
+// as token() over values, e.g. token(p) > token(?), which is how drivers
+// page across the token ring.
+func (r *request) tokenValue(t *Table, term parser.Term, name string) ([]byte, error) {
+	x, ok := term.(*parser.FunctionCall)
+	if !ok || x.Keyspace != "" && x.Keyspace != "system" || x.Name != "token" {
+		return r.bindAs(term, name, bigintType)
+	}
+
+	if len(x.Args) != len(t.PartitionKey) {
+		return nil, invalid("Invalid number of arguments in call to function token: %d required but %d provided", len(t.PartitionKey), len(x.Args))
+	}
+
+	key := make([][]byte, len(x.Args))
+	for i, arg := range x.Args {
+		v, err := r.bind(arg, t.PartitionKey[i])
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			return nil, nil
+		}
+		key[i] = v
+	}
+
+	return types.Marshal(bigintType, token(key))
+}
+
+// validatePartitionKey determines the partition keys selected by the
+// restrictions. The partition key has to be fully restricted by EQ or IN
+// unless the query allows filtering.
+func (rs *restrictions) validatePartitionKey(allowFiltering bool) error {
+	restricted := 0
+	keys := [][][]byte{{}}
+
+	for _, c := range rs.table.PartitionKey {
+		res, found := rs.columns[c.Name]
+		if !found {
+			continue
+		}
+		restricted++
+
+		if rs.token != nil {
+			return invalid("Columns \"%s\" cannot be restricted by both a normal relation and a token relation", c.Name)
+		}
+
+		if !res.eq {
+			if !allowFiltering {
+				return invalid("Only EQ and IN relation are supported on the partition key (unless you use the token() function or allow filtering)")
+			}
+			continue
+		}
+
+		keys = product(keys, res.values)
+	}
+
+	switch {
+	case restricted == 0:
+	case len(keys) > 0 && len(keys[0]) == len(rs.table.PartitionKey):
+		rs.keys = keys
+	default:
+		rs.filtering = true
+	}
+
+	return nil
+}
+
+// validateClustering checks that clustering columns are restricted in
+// order, i.e. by EQ or IN on a prefix followed by an optional slice.
+func (rs *restrictions) validateClustering(allowFiltering bool) error {
+	if len(rs.multi) > 0 {
+		for _, c := range rs.table.ClusteringKey {
+			if _, found := rs.columns[c.Name]; found {
+				return invalid("Mixing single column relations and multi column relations on clustering columns is not allowed")
+			}
+		}
+		if rs.keys == nil && rs.token == nil {
+			rs.filtering = true
+		}
+		return nil
+	}
+
+	var gap, slice *Column
+	for _, c := range rs.table.ClusteringKey {
+		res, found := rs.columns[c.Name]
+		if !found {
+			if gap == nil {
+				gap = c
+			}
+			continue
+		}
+
+		if rs.keys == nil && rs.token == nil {
+			rs.filtering = true
+		}
+
+		switch {
+		case gap != nil:
+			if !allowFiltering {
+				return invalid("PRIMARY KEY column \"%s\" cannot be restricted as preceding column \"%s\" is not restricted", c.Name, gap.Name)
+			}
+			rs.filtering = true
+		case slice != nil:
+			if !allowFiltering {
+				return invalid("Clustering column \"%s\" cannot be restricted (preceding column \"%s\" is restricted by a non-EQ relation)", c.Name, slice.Name)
+			}
+			rs.filtering = true
+		case !res.eq:
+			slice = c
+		}
+	}
+
+	return nil
+}
+
+// matchPartition returns true if the key and live static values of a
+// partition satisfy the restrictions.
+func (rs *restrictions) matchPartition(key [][]byte, static map[string]*cell) bool {
+	if rs.token != nil {
+		// Marshaling a bigint does not fail.
+		v, _ := types.Marshal(bigintType, token(key))
+		if !rs.token.match(v) {
+			return false
+		}
+	}
+
+	for _, c := range rs.table.PartitionKey {
+		if res, found := rs.columns[c.Name]; found && !res.match(key[c.Position]) {
+			return false
+		}
+	}
+
+	for _, c := range rs.table.Columns {
+		if c.Kind != Static {
+			continue
+		}
+		if res, found := rs.columns[c.Name]; found && !res.match(cellValue(static[c.Name])) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchRow returns true if the clustering and regular values of rw satisfy
+// the restrictions. rw is nil for partitions with static values only.
+func (rs *restrictions) matchRow(rw *row) bool {
+	var clustering [][]byte
+	cells := map[string]*cell{}
+	if rw != nil {
+		clustering, cells = rw.clustering, rw.cells
+	}
+
+	for _, m := range rs.multi {
+		if !m.match(clustering) {
+			return false
+		}
+	}
+
+	for _, c := range rs.table.Columns {
+		res, found := rs.columns[c.Name]
+		if !found {
+			continue
+		}
+
+		switch c.Kind {
+		case Clustering:
+			if clustering == nil || !res.match(clustering[c.Position]) {
+				return false
+			}
+		case Regular:
+			if !res.match(cellValue(cells[c.Name])) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func cellValue(c *cell) []byte {
+	if c == nil {
+		return nil
+	}
+	return c.value
+}
@@ -0,0 +1,409 @@
+package engine
+
+import (
+	"sort"
+
+	"github.com/st3v/fakesandra/cql/parser"
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+// ColumnKind is the role of a column within its table.
+type ColumnKind int
+
+const (
+	PartitionKey ColumnKind = iota
+	Clustering
+	Static
+	Regular
+)
+
+// String returns the kind as listed in system_schema.columns.
+func (k ColumnKind) String() string {
+	switch k {
+	case PartitionKey:
+		return "partition_key"
+	case Clustering:
+		return "clustering"
+	case Static:
+		return "static"
+	default:
+		return "regular"
+	}
+}
+
+// Column describes a column of a table.
+type Column struct {
+	Name string
+	Type types.Type
+	Kind ColumnKind
+
+	// Position is the index of a partition key or clustering column within
+	// its key and -1 for static and regular columns.
+	Position int
+
+	// Descending is set for clustering columns sorted in descending order.
+	Descending bool
+}
+
+// IsPrimaryKey returns true for partition key and clustering columns.
+func (c *Column) IsPrimaryKey() bool {
+	return c.Kind == PartitionKey || c.Kind == Clustering
+}
+
+// Keyspace is a keyspace of the schema catalog.
+type Keyspace struct {
+	Name          string
+	Replication   map[string]string
+	DurableWrites bool
+
+	tables     map[string]*Table
+	types      map[string]types.Type
+	functions  map[string][]*Function
+	aggregates map[string][]*Aggregate
+}
+
+func newKeyspace(name string) *Keyspace {
+	return &Keyspace{
+		Name:          name,
+		Replication:   map[string]string{},
+		DurableWrites: true,
+		tables:        map[string]*Table{},
+		types:         map[string]types.Type{},
+		functions:     map[string][]*Function{},
+		aggregates:    map[string][]*Aggregate{},
+	}
+}
+
+// clone returns a copy of ks that can be modified without affecting ks.
+// Tables are shared.
+func (ks *Keyspace) clone() *Keyspace {
+	c := *ks
+
+	c.Replication = map[string]string{}
+	for k, v := range ks.Replication {
+		c.Replication[k] = v
+	}
+
+	c.tables = map[string]*Table{}
+	for name, t := range ks.tables {
+		c.tables[name] = t
+	}
+
+	c.types = map[string]types.Type{}
+	for name, t := range ks.types {
+		c.types[name] = t
+	}
+
+	c.functions = map[string][]*Function{}
+	for name, overloads := range ks.functions {
+		c.functions[name] = append([]*Function{}, overloads...)
+	}
+
+	c.aggregates = map[string][]*Aggregate{}
+	for name, overloads := range ks.aggregates {
+		c.aggregates[name] = append([]*Aggregate{}, overloads...)
+	}
+
+	return &c
+}
+
+// Table returns the table or materialized view with the given name.
+func (ks *Keyspace) Table(name string) (*Table, bool) {
+	t, found := ks.tables[name]
+	return t, found
+}
+
+// Tables returns all tables of the keyspace sorted by name. Materialized
+// views are not included, see Views.
+func (ks *Keyspace) Tables() []*Table {
+	tables := []*Table{}
+	for _, t := range ks.sortedTables() {
+		if t.View == nil {
+			tables = append(tables, t)
+		}
+	}
+	return tables
+}
+
+// sortedTables returns all tables and materialized views of the keyspace
+// sorted by name.
+func (ks *Keyspace) sortedTables() []*Table {
+	tables := []*Table{}
+	for _, t := range ks.tables {
+		tables = append(tables, t)
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		return tables[i].Name < tables[j].Name
+	})
+	return tables
+}
+
+// Type returns the user-defined type with the given name.
+func (ks *Keyspace) Type(name string) (types.Type, bool) {
+	t, found := ks.types[name]
+	return t, found
+}
+
+// Types returns all user-defined types of the keyspace sorted by name.
+func (ks *Keyspace) Types() []types.Type {
+	udts := []types.Type{}
+	for _, t := range ks.types {
+		udts = append(udts, t)
+	}
+	sort.Slice(udts, func(i, j int) bool {
+		return udts[i].Name < udts[j].Name
+	})
+	return udts
+}
+
+// Table is a table of the schema catalog together with its data.
+type Table struct {
+	Keyspace string
+	Name     string
+
+	// Columns lists all columns in the order of SELECT *, i.e. partition
+	// key, clustering, static and regular columns, the latter two sorted
+	// by name.
+	Columns       []*Column
+	PartitionKey  []*Column
+	ClusteringKey []*Column
+
+	CompactStorage bool
+	Options        TableOptions
+
+	// Indexes lists the secondary indexes of the table in the order they
+	// were created.
+	Indexes []*Index
+
+	// View is set for materialized views and describes how their rows are
+	// derived from the base table.
+	View *View
+
+	columns map[string]*Column
+	data    *store
+}
+
+// clone returns a copy of t with copies of its columns. The data is shared,
+// indexes and the view definition are never modified and shared as well.
+func (t *Table) clone() *Table {
+	c := *t
+	c.Options = t.Options.clone()
+	c.Indexes = append([]*Index{}, t.Indexes...)
+
+	columns := make([]*Column, len(t.Columns))
+	for i, col := range t.Columns {
+		cc := *col
+		columns[i] = &cc
+	}
+	c.setColumns(columns)
+
+	return &c
+}
+
+// Column returns the column with the given name.
+func (t *Table) Column(name string) (*Column, bool) {
+	c, found := t.columns[name]
+	return c, found
+}
+
+// HasStatic returns true if the table has static columns.
+func (t *Table) HasStatic() bool {
+	for _, c := range t.Columns {
+		if c.Kind == Static {
+			return true
+		}
+	}
+	return false
+}
+
+// IsCounter returns true if the columns outside the primary key are
+// counters. Cassandra does not allow to mix them with other columns.
+func (t *Table) IsCounter() bool {
+	for _, c := range t.Columns {
+		if !c.IsPrimaryKey() {
+			return c.Type.ID == types.Counter
+		}
+	}
+	return false
+}
+
+// checkCounters validates the use of counter columns in t.
+func (t *Table) checkCounters() error {
+	counter := t.IsCounter()
+	for _, c := range t.Columns {
+		switch {
+		case c.IsPrimaryKey() && c.Type.ID == types.Counter:
+			return invalid("counter type is not supported for PRIMARY KEY part %s", c.Name)
+		case !c.IsPrimaryKey() && (c.Type.ID == types.Counter) != counter:
+			return invalid("Cannot mix counter and non counter columns in the same table")
+		}
+	}
+
+	if counter && t.Options.DefaultTimeToLive > 0 {
+		return invalid("Cannot set default_time_to_live on a table with counters")
+	}
+	return nil
+}
+
+func newTable(keyspace, name string, columns []*Column) *Table {
+	t := &Table{
+		Keyspace: keyspace,
+		Name:     name,
+		Options:  defaultTableOptions(),
+		columns:  map[string]*Column{},
+		data:     newStore(),
+	}
+	t.setColumns(columns)
+	return t
+}
+
+// setColumns sorts columns into SELECT * order and indexes them.
+func (t *Table) setColumns(columns []*Column) {
+	t.PartitionKey, t.ClusteringKey = nil, nil
+	t.columns = map[string]*Column{}
+
+	var statics, regulars []*Column
+	for _, c := range columns {
+		t.columns[c.Name] = c
+		switch c.Kind {
+		case PartitionKey:
+			t.PartitionKey = append(t.PartitionKey, c)
+		case Clustering:
+			t.ClusteringKey = append(t.ClusteringKey, c)
+		case Static:
+			statics = append(statics, c)
+		default:
+			regulars = append(regulars, c)
+		}
+	}
+
+	byPosition := func(cols []*Column) {
+		sort.Slice(cols, func(i, j int) bool { return cols[i].Position < cols[j].Position })
+	}
+	byName := func(cols []*Column) {
+		sort.Slice(cols, func(i, j int) bool { return cols[i].Name < cols[j].Name })
+	}
+
+	byPosition(t.PartitionKey)
+	byPosition(t.ClusteringKey)
+	byName(statics)
+	byName(regulars)
+
+	t.Columns = nil
+	t.Columns = append(t.Columns, t.PartitionKey...)
+	t.Columns = append(t.Columns, t.ClusteringKey...)
+	t.Columns = append(t.Columns, statics...)
+	t.Columns = append(t.Columns, regulars...)
+}
+
+// resolveType turns a type as written in a statement into a type
+// descriptor. User-defined types are looked up in ks.
+func resolveType(ks *Keyspace, t parser.Type) (types.Type, error) {
+	if t.Custom {
+		return types.Type{ID: types.Custom, Class: t.Name}, nil
+	}
+
+	params := make([]types.Type, len(t.Params))
+	for i, p := range t.Params {
+		var err error
+		if params[i], err = resolveType(ks, p); err != nil {
+			return types.Type{}, err
+		}
+	}
+
+	arity := func(n int) error {
+		if len(params) != n {
+			return invalid("Invalid type %s", t)
+		}
+		return nil
+	}
+
+	// Collections can only contain frozen collections and UDTs.
+	elems := func() error {
+		for _, p := range params {
+			if p.ID == types.Counter {
+				return invalid("Counters are not allowed inside collections: %s", t)
+			}
+			if p.IsCollection() && p.IsMultiCell() {
+				return invalid("Non-frozen collections are not allowed inside collections: %s", t)
+			}
+			if p.IsMultiCell() {
+				return invalid("Non-frozen UDTs are not allowed inside collections: %s", t)
+			}
+		}
+		return nil
+	}
+
+	switch t.Name {
+	case "frozen":
+		if err := arity(1); err != nil {
+			return types.Type{}, err
+		}
+		return params[0].Freeze(), nil
+	case "list":
+		if err := arity(1); err != nil {
+			return types.Type{}, err
+		}
+		if err := elems(); err != nil {
+			return types.Type{}, err
+		}
+		return types.ListOf(params[0]), nil
+	case "set":
+		if err := arity(1); err != nil {
+			return types.Type{}, err
+		}
+		if err := elems(); err != nil {
+			return types.Type{}, err
+		}
+		return types.SetOf(params[0]), nil
+	case "map":
+		if err := arity(2); err != nil {
+			return types.Type{}, err
+		}
+		if err := elems(); err != nil {
+			return types.Type{}, err
+		}
+		return types.MapOf(params[0], params[1]), nil
+	case "tuple":
+		if len(params) == 0 {
+			return types.Type{}, invalid("Invalid type %s", t)
+		}
+		for i := range params {
+			params[i] = params[i].Freeze()
+		}
+		return types.TupleOf(params...), nil
+	}
+
+	if len(params) > 0 {
+		return types.Type{}, invalid("Unknown type %s", t)
+	}
+
+	if t.Keyspace == "" {
+		if native, err := types.Parse(t.Name); err == nil && native.ID != types.UDT {
+			return native, nil
+		}
+	}
+
+	if t.Keyspace != "" && t.Keyspace != ks.Name {
+		return types.Type{}, invalid("Statement on keyspace %s cannot refer to a user type in keyspace %s; user types can only be used in the keyspace they are defined in", ks.Name, t.Keyspace)
+	}
+
+	udt, found := ks.types[t.Name]
+	if !found {
+		return types.Type{}, invalid("Unknown type %s.%s", ks.Name, t.Name)
+	}
+	return udt, nil
+}
+
+func invalid(format string, args ...interface{}) error {
+	return proto.NewError(proto.ErrInvalid, format, args...)
+}
+
+func syntaxError(format string, args ...interface{}) error {
+	return proto.NewError(proto.ErrSyntax, format, args...)
+}
+
+func configError(format string, args ...interface{}) error {
+	return proto.NewError(proto.ErrConfig, format, args...)
+}
@@ -0,0 +1,726 @@
+package engine
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/st3v/fakesandra/cql/parser"
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+// selectionKind is what a selection returns for its column.
+type selectionKind int
+
+const (
+	selectValue selectionKind = iota
+	selectTTL
+	selectWritetime
+	selectField
+	selectFunction
+	selectConstant
+	selectAggregate
+)
+
+// selection is a column of a result set. Field is the position of the
+// selected field of a user-defined type. Function selections apply fn to
+// the values of args, constants return value. Aggregates apply fn to the
+// values of args of all rows of a group.
+type selection struct {
+	column *Column
+	name   string
+	kind   selectionKind
+	typ    types.Type
+	field  int
+	fn     *function
+	args   []selection
+	value  []byte
+}
+
+// isAggregate returns true if sel is or contains an aggregate.
+func (sel selection) isAggregate() bool {
+	if sel.kind == selectAggregate {
+		return true
+	}
+	for _, a := range sel.args {
+		if a.isAggregate() {
+			return true
+		}
+	}
+	return false
+}
+
+// match is a live row selected by a query together with the key and token
+// of its partition. Row is nil for partitions with static values only.
+type match struct {
+	key    [][]byte
+	token  int64
+	static map[string]*cell
+	row    *row
+}
+
+func (m match) clustering() [][]byte {
+	if m.row == nil {
+		return nil
+	}
+	return m.row.clustering
+}
+
+// selectRows executes SELECT.
+func (e *Engine) selectRows(r *request, s *parser.Select) (result.Result, error) {
+	t, err := e.table(r, s.Table)
+	if err == errNotHandled {
+		t, err = e.systemTable(r, s.Table)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.JSON {
+		return nil, invalid("Unsupported SELECT clause")
+	}
+
+	selections, err := r.selectColumns(t, s.Selectors)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregated := false
+	for _, sel := range selections {
+		aggregated = aggregated || sel.isAggregate()
+	}
+
+	grouped, err := groupBy(t, s.GroupBy)
+	if err != nil {
+		return nil, err
+	}
+
+	aliases := map[string]bool{}
+	for _, sel := range s.Selectors {
+		if sel.Alias != "" {
+			aliases[sel.Alias] = true
+		}
+	}
+
+	rs, err := r.restrict(t, s, aliases)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Distinct {
+		if err := distinct(t, selections, rs); err != nil {
+			return nil, err
+		}
+	}
+
+	reversed, err := orderBy(t, s.OrderBy, rs)
+	if err != nil {
+		return nil, err
+	}
+
+	limit, err := r.limit(s.Limit, "LIMIT")
+	if err != nil {
+		return nil, err
+	}
+
+	perPartitionLimit, err := r.limit(s.PerPartitionLimit, "PER PARTITION LIMIT")
+	if err != nil {
+		return nil, err
+	}
+
+	rows := &result.Rows{Columns: resultColumns(t, selections), Data: [][][]byte{}}
+
+	t.data.mu.RLock()
+	defer t.data.mu.RUnlock()
+
+	now := e.nowInSeconds()
+
+	matches := []match{}
+	for _, p := range rs.partitions(t) {
+		static, live := p.live(t, now)
+		if len(static) == 0 && len(live) == 0 || !rs.matchPartition(p.key, static) {
+			continue
+		}
+		if s.Distinct {
+			matches = append(matches, match{key: p.key, token: p.token, static: static})
+			continue
+		}
+		matches = append(matches, rs.matchRows(p, static, live, reversed, perPartitionLimit)...)
+	}
+
+	// Rows of multiple partitions are merged if they are to be ordered.
+	merged := len(s.OrderBy) > 0 && len(rs.keys) > 1
+	if merged {
+		sort.SliceStable(matches, func(i, j int) bool {
+			c := compareClustering(t, matches[i].clustering(), matches[j].clustering())
+			if reversed {
+				return c > 0
+			}
+			return c < 0
+		})
+	}
+
+	groups := groupMatches(matches, aggregated, grouped)
+	if limit >= 0 && len(groups) > limit {
+		groups = groups[:limit]
+	}
+
+	// Like in Cassandra 3.10 and later, pages of grouped results hold whole
+	// groups, while aggregates over all rows always fit a single page.
+	if !aggregated || grouped > 0 {
+		if state := r.pagingState(); state != nil {
+			pos, err := decodePagingState(t, state)
+			if err != nil {
+				return nil, err
+			}
+			groups = resume(t, groups, pos, reversed, merged)
+		}
+
+		if size := r.pageSize(); size > 0 && len(groups) > size {
+			groups = groups[:size]
+			last := groups[size-1]
+			rows.PagingState = encodePagingState(last[len(last)-1])
+		}
+	}
+
+	for _, g := range groups {
+		values, err := e.projectGroup(selections, g, now)
+		if err != nil {
+			return nil, err
+		}
+		rows.Data = append(rows.Data, values)
+	}
+
+	return rows, nil
+}
+
+// groupBy validates the GROUP BY clause and returns the number of primary
+// key columns rows are grouped by.
+func groupBy(t *Table, columns []string) (int, error) {
+	primaryKey := append(append([]*Column{}, t.PartitionKey...), t.ClusteringKey...)
+
+	for i, name := range columns {
+		c, found := t.Column(name)
+		switch {
+		case !found:
+			return 0, invalid("Undefined column name %s", name)
+		case !c.IsPrimaryKey():
+			return 0, invalid("Group by is currently only supported on the columns of the PRIMARY KEY, got %s", name)
+		case i >= len(primaryKey) || primaryKey[i] != c:
+			return 0, invalid("Group by currently only support groups of columns following their declared order in the PRIMARY KEY")
+		}
+	}
+
+	return len(columns), nil
+}
+
+// distinct validates a SELECT DISTINCT, which may only select and restrict
+// partition key and static columns and has to select the whole partition
+// key.
+func distinct(t *Table, selections []selection, rs *restrictions) error {
+	selected := map[*Column]bool{}
+
+	var visit func(sel selection) error
+	visit = func(sel selection) error {
+		if c := sel.column; c != nil {
+			if c.Kind != PartitionKey && c.Kind != Static {
+				return invalid("SELECT DISTINCT queries must only request partition key columns and/or static columns (not %s)", c.Name)
+			}
+			selected[c] = true
+		}
+		for _, a := range sel.args {
+			if err := visit(a); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, sel := range selections {
+		if err := visit(sel); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range t.PartitionKey {
+		if !selected[c] {
+			return invalid("SELECT DISTINCT queries must request all the partition key columns (missing %s)", c.Name)
+		}
+	}
+
+	if len(rs.multi) > 0 {
+		return invalid("SELECT DISTINCT with WHERE clause only supports restriction by partition key and/or static columns.")
+	}
+	for name := range rs.columns {
+		if c, _ := t.Column(name); c.Kind != PartitionKey && c.Kind != Static {
+			return invalid("SELECT DISTINCT with WHERE clause only supports restriction by partition key and/or static columns.")
+		}
+	}
+	return nil
+}
+
+// groupMatches splits matches into the groups of rows that make up a row
+// of the result. Without aggregates and GROUP BY, each row is a group of
+// its own. Aggregates without GROUP BY aggregate all rows, even if there
+// are none. Otherwise, rows are grouped by the first grouped primary key
+// columns.
+func groupMatches(matches []match, aggregated bool, grouped int) [][]match {
+	switch {
+	case grouped == 0 && aggregated:
+		return [][]match{matches}
+	case grouped == 0:
+		groups := make([][]match, len(matches))
+		for i, m := range matches {
+			groups[i] = []match{m}
+		}
+		return groups
+	}
+
+	groupKey := func(m match) [][]byte {
+		pk := append(append([][]byte{}, m.key...), m.clustering()...)
+		if len(pk) > grouped {
+			pk = pk[:grouped]
+		}
+		return pk
+	}
+
+	groups := [][]match{}
+	var last []byte
+	for i, m := range matches {
+		key := types.JoinComponents(groupKey(m))
+		if i == 0 || !bytes.Equal(key, last) {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], m)
+		last = key
+	}
+	return groups
+}
+
+// limit evaluates a LIMIT or PER PARTITION LIMIT clause. It returns -1 if
+// there is no limit.
+func (r *request) limit(term parser.Term, clause string) (int, error) {
+	if term == nil {
+		return -1, nil
+	}
+
+	n, err := r.bindInt(term, "["+clause+"]")
+	if err != nil {
+		return 0, err
+	}
+	if n <= 0 {
+		return 0, invalid("%s must be strictly positive", clause)
+	}
+	return int(n), nil
+}
+
+// orderBy validates the ORDER BY clause and returns whether the rows of a
+// partition are to be returned in reverse clustering order.
+func orderBy(t *Table, orderings []parser.Ordering, rs *restrictions) (bool, error) {
+	if len(orderings) == 0 {
+		return false, nil
+	}
+
+	if rs.keys == nil {
+		return false, invalid("ORDER BY is only supported when the partition key is restricted by an EQ or an IN.")
+	}
+
+	reversed := false
+	for i, o := range orderings {
+		c, found := t.Column(o.Column)
+		if !found {
+			return false, invalid("Undefined column name %s", o.Column)
+		}
+		if c.Kind != Clustering {
+			return false, invalid("Order by is currently only supported on the clustered columns of the PRIMARY KEY, got %s", o.Column)
+		}
+		if c.Position != i {
+			return false, invalid("Order by currently only supports the ordering of columns following their declared order in the PRIMARY KEY")
+		}
+
+		r := o.Descending != c.Descending
+		if i > 0 && r != reversed {
+			return false, invalid("Unsupported order by relation")
+		}
+		reversed = r
+	}
+
+	return reversed, nil
+}
+
+// partitions returns the partitions selected by the partition key in
+// partition order. Their content still has to be matched. The caller has to
+// hold the read lock of the data.
+func (rs *restrictions) partitions(t *Table) []*partition {
+	var candidates []*partition
+
+	if rs.keys != nil {
+		seen := map[string]bool{}
+		for _, key := range rs.keys {
+			id := partitionID(key)
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			if p, found := t.data.partition(key); found {
+				candidates = append(candidates, p)
+			}
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].compare(t, candidates[j]) < 0
+		})
+	} else if rs.index != nil {
+		candidates = t.data.indexed(rs.index, rs.columns[rs.index.Column])
+	} else {
+		candidates = t.data.ring
+	}
+
+	return candidates
+}
+
+// matchRows returns the live rows of a partition that satisfy the
+// restrictions. A partition with static values only yields a single row
+// with null clustering and regular columns unless rows are restricted.
+func (rs *restrictions) matchRows(p *partition, static map[string]*cell, rows []*row, reversed bool, limit int) []match {
+	matches := []match{}
+
+	if len(rows) == 0 {
+		if rs.matchRow(nil) {
+			matches = append(matches, match{key: p.key, token: p.token, static: static})
+		}
+		return matches
+	}
+
+	for i := range rows {
+		if limit >= 0 && len(matches) >= limit {
+			break
+		}
+
+		rw := rows[i]
+		if reversed {
+			rw = rows[len(rows)-1-i]
+		}
+
+		if rs.matchRow(rw) {
+			matches = append(matches, match{key: p.key, token: p.token, static: static, row: rw})
+		}
+	}
+
+	return matches
+}
+
+// resultColumns describes the columns selections of table t return.
+func resultColumns(t *Table, selections []selection) []result.Column {
+	var columns []result.Column
+	for _, sel := range selections {
+		columns = append(columns, result.Column{
+			Keyspace: t.Keyspace,
+			Table:    t.Name,
+			Name:     sel.name,
+			Type:     sel.typ,
+		})
+	}
+	return columns
+}
+
+// selectColumns resolves the selectors of a SELECT statement. No
+// selectors select all columns.
+func (r *request) selectColumns(t *Table, selectors []parser.Selector) ([]selection, error) {
+	selections := []selection{}
+	if len(selectors) == 0 {
+		for _, c := range t.Columns {
+			selections = append(selections, selection{column: c, name: c.Name, typ: c.Type})
+		}
+		return selections, nil
+	}
+
+	for _, s := range selectors {
+		sel, err := r.selectColumn(t, s.Expr)
+		if err != nil {
+			return nil, err
+		}
+		if s.Alias != "" {
+			sel.name = s.Alias
+		}
+		selections = append(selections, sel)
+	}
+	return selections, nil
+}
+
+// selectColumn resolves a single selector, which is either a column, a
+// field of a user-defined type, ttl() or writetime() of a column, a
+// function call or a cast.
+func (r *request) selectColumn(t *Table, expr parser.Term) (selection, error) {
+	switch x := expr.(type) {
+	case *parser.Column:
+		c, found := t.Column(x.Name)
+		if !found {
+			return selection{}, invalid("Undefined column name %s", x.Name)
+		}
+		return selection{column: c, name: c.Name, typ: c.Type}, nil
+	case *parser.Field:
+		col, ok := x.Expr.(*parser.Column)
+		if !ok {
+			return selection{}, invalid("Unsupported selector %s", expr)
+		}
+		c, found := t.Column(col.Name)
+		switch {
+		case !found:
+			return selection{}, invalid("Undefined column name %s", col.Name)
+		case c.Type.ID != types.UDT:
+			return selection{}, invalid("Invalid field selection: %s of type %s is not a user type", c.Name, c.Type)
+		}
+		i := fieldIndex(c.Type, x.Name)
+		if i < 0 {
+			return selection{}, invalid("%s of type %s has no field %s", c.Name, c.Type, x.Name)
+		}
+		return selection{column: c, name: x.String(), kind: selectField, typ: c.Type.Elems[i], field: i}, nil
+	case *parser.FunctionCall:
+		if x.Keyspace == "" && (x.Name == "ttl" || x.Name == "writetime") {
+			return selectMetadata(t, x)
+		}
+		return r.selectFunction(t, x)
+	case *parser.Cast:
+		arg, err := r.selectColumn(t, x.Expr)
+		if err != nil {
+			return selection{}, err
+		}
+		to, err := types.Parse(x.Type.String())
+		if err != nil {
+			return selection{}, invalid("%s", err)
+		}
+		f, err := castFunction(arg.name, arg.typ, to)
+		if err != nil {
+			return selection{}, err
+		}
+		name := "cast(" + arg.name + " as " + to.String() + ")"
+		return selection{name: name, kind: selectFunction, typ: to, fn: f, args: []selection{arg}}, nil
+	}
+	return selection{}, invalid("Unsupported selector %s", expr)
+}
+
+// selectMetadata resolves ttl() or writetime() of a column.
+func selectMetadata(t *Table, x *parser.FunctionCall) (selection, error) {
+	var sel selection
+	function := "ttl"
+	if x.Name == "ttl" {
+		sel.kind, sel.typ = selectTTL, types.Native(types.Int)
+	} else {
+		sel.kind, sel.typ, function = selectWritetime, types.Native(types.Bigint), "writeTime"
+	}
+
+	if len(x.Args) != 1 {
+		return selection{}, invalid("Unsupported selector %s", x)
+	}
+	arg, ok := x.Args[0].(*parser.Column)
+	if !ok {
+		return selection{}, invalid("Unsupported selector %s", x)
+	}
+
+	c, found := t.Column(arg.Name)
+	switch {
+	case !found:
+		return selection{}, invalid("Undefined column name %s", arg.Name)
+	case c.IsPrimaryKey():
+		return selection{}, invalid("Cannot use selection function %s on PRIMARY KEY part %s", function, c.Name)
+	case c.Type.IsMultiCell():
+		return selection{}, invalid("Cannot use selection function %s on collections", function)
+	}
+
+	sel.column = c
+	sel.name = x.Name + "(" + parser.QuoteIdent(c.Name) + ")"
+	return sel, nil
+}
+
+// selectFunction resolves a call of a native function. Its arguments are
+// selectors themselves, except for literals and bind markers, which are
+// bound to the argument types of the resolved overload.
+func (r *request) selectFunction(t *Table, x *parser.FunctionCall) (selection, error) {
+	var overloads []*function
+	switch {
+	case x.Keyspace == "" && x.Name == "token":
+		overloads = []*function{tokenFunction(t)}
+	case countsRows(x):
+		f := nativeFunctions["countrows"][0]
+		return selection{name: "count", kind: selectAggregate, typ: f.returns, fn: f}, nil
+	default:
+		var err error
+		if overloads, err = r.lookupFunction(x); err != nil {
+			return selection{}, err
+		}
+	}
+
+	args := make([]selection, len(x.Args))
+	known := make([]bool, len(x.Args))
+	for i, a := range x.Args {
+		switch a.(type) {
+		case *parser.Column, *parser.Field, *parser.FunctionCall, *parser.Cast:
+			sel, err := r.selectColumn(t, a)
+			if err != nil {
+				return selection{}, err
+			}
+			args[i], known[i] = sel, true
+		}
+	}
+
+	f, err := resolveFunction(overloads, x.Args, func(i int) (types.Type, bool) {
+		return args[i].typ, known[i]
+	}, func(i int, typ types.Type) bool {
+		_, err := r.bindAs(x.Args[i], "", typ)
+		return err == nil
+	})
+	if err != nil {
+		return selection{}, err
+	}
+
+	names := make([]string, len(args))
+	for i, a := range x.Args {
+		if !known[i] {
+			v, err := r.bindAs(a, "", f.args[i])
+			if err != nil {
+				return selection{}, err
+			}
+			args[i] = selection{name: a.String(), kind: selectConstant, typ: f.args[i], value: v}
+		}
+		names[i] = args[i].name
+	}
+
+	sel := selection{name: f.qualifiedName() + "(" + strings.Join(names, ", ") + ")", kind: selectFunction, typ: f.returns, fn: f, args: args}
+	if f.aggregate != nil {
+		for _, a := range args {
+			if a.isAggregate() {
+				return selection{}, invalid("aggregate functions cannot be used as arguments of aggregate functions")
+			}
+		}
+		sel.kind = selectAggregate
+	}
+	return sel, nil
+}
+
+// countsRows returns true for count(*) and count(1), which count rows
+// rather than values.
+func countsRows(x *parser.FunctionCall) bool {
+	if x.Name != "count" || x.Keyspace != "" && x.Keyspace != "system" || len(x.Args) != 1 {
+		return false
+	}
+	switch a := x.Args[0].(type) {
+	case *parser.Star:
+		return true
+	case *parser.Literal:
+		return a.String() == "1"
+	}
+	return false
+}
+
+// projectGroup returns the selected values of a group of matches.
+// Selections without aggregates return the values of the first row.
+func (e *Engine) projectGroup(selections []selection, group []match, now int64) ([][]byte, error) {
+	values := make([][]byte, len(selections))
+	for i, sel := range selections {
+		v, err := e.groupValue(sel, group, now)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func (e *Engine) groupValue(sel selection, group []match, now int64) ([]byte, error) {
+	switch {
+	case sel.kind == selectAggregate:
+		acc := sel.fn.aggregate()
+		for _, m := range group {
+			args, err := e.project(sel.args, m, now)
+			if err != nil {
+				return nil, err
+			}
+			if err := acc.add(e, args); err != nil {
+				return nil, err
+			}
+		}
+		return acc.result(e)
+	case sel.isAggregate():
+		args := make([][]byte, len(sel.args))
+		for i, a := range sel.args {
+			v, err := e.groupValue(a, group, now)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = v
+		}
+		return sel.fn.call(e, args)
+	case len(group) == 0:
+		return nil, nil
+	}
+	return e.selectionValue(sel, group[0], now)
+}
+
+// project returns the selected values of a match. TTLs are computed
+// relative to now.
+func (e *Engine) project(selections []selection, m match, now int64) ([][]byte, error) {
+	values := make([][]byte, len(selections))
+	for i, sel := range selections {
+		v, err := e.selectionValue(sel, m, now)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// selectionValue returns the value of a single selection for a match.
+func (e *Engine) selectionValue(sel selection, m match, now int64) ([]byte, error) {
+	switch sel.kind {
+	case selectConstant:
+		return sel.value, nil
+	case selectFunction:
+		args, err := e.project(sel.args, m, now)
+		if err != nil {
+			return nil, err
+		}
+		return sel.fn.call(e, args)
+	}
+
+	c := sel.column
+
+	var v []byte
+	switch {
+	case c.Kind == PartitionKey:
+		v = m.key[c.Position]
+	case m.row == nil && c.Kind != Static:
+		return nil, nil
+	case c.Kind == Clustering:
+		v = m.row.clustering[c.Position]
+	default:
+		var cl *cell
+		if c.Kind == Static {
+			cl = m.static[c.Name]
+		} else {
+			cl = m.row.cells[c.Name]
+		}
+		if cl == nil {
+			return nil, nil
+		}
+
+		switch sel.kind {
+		case selectTTL:
+			if cl.ttl > 0 {
+				return types.Marshal(sel.typ, int32(cl.expires-now))
+			}
+			return nil, nil
+		case selectWritetime:
+			return types.Marshal(sel.typ, cl.timestamp)
+		}
+		v = cl.value
+	}
+
+	if sel.kind == selectField && v != nil {
+		fields, _ := types.SplitComponents(v, len(c.Type.Fields))
+		return fields[sel.field], nil
+	}
+	return v, nil
+}
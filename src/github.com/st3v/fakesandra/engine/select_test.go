@@ -0,0 +1,124 @@
+package engine_test
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/cql/types"
+	"github.com/st3v/fakesandra/engine"
+)
+
+var _ = Describe("SELECT", func() {
+	var e *engine.Engine
+
+	// ints executes stmt and returns its rows decoded as ints.
+	ints := func(stmt string) [][]int32 {
+		res, err := e.Execute(stmt)
+		Expect(err).NotTo(HaveOccurred())
+
+		rows := [][]int32{}
+		for _, data := range res.(*result.Rows).Data {
+			row := make([]int32, len(data))
+			for i, b := range data {
+				v, err := types.Unmarshal(types.Native(types.Int), b)
+				Expect(err).NotTo(HaveOccurred())
+				row[i] = v.(int32)
+			}
+			rows = append(rows, row)
+		}
+		return rows
+	}
+
+	BeforeEach(func() {
+		e = engine.New()
+		Expect(e.Exec("CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}")).To(Succeed())
+		Expect(e.Exec("CREATE TABLE ks.t (p int, c1 int, c2 int, v int, PRIMARY KEY (p, c1, c2))")).To(Succeed())
+
+		for p := 1; p <= 2; p++ {
+			for c1 := 1; c1 <= 2; c1++ {
+				for c2 := 1; c2 <= 3; c2++ {
+					Expect(e.Exec(fmt.Sprintf("INSERT INTO ks.t (p, c1, c2, v) VALUES (%d, %d, %d, %d)", p, c1, c2, p*100+c1*10+c2))).To(Succeed())
+				}
+			}
+		}
+	})
+
+	It("restricts the partition key with IN", func() {
+		Expect(ints("SELECT p, v FROM ks.t WHERE p IN (2, 1) AND c1 = 1 AND c2 = 1")).To(Equal([][]int32{
+			{1, 111},
+			{2, 211},
+		}))
+	})
+
+	It("selects clustering slices", func() {
+		Expect(ints("SELECT v FROM ks.t WHERE p = 1 AND c1 = 2 AND c2 > 1")).To(Equal([][]int32{{122}, {123}}))
+		Expect(ints("SELECT v FROM ks.t WHERE p = 1 AND c1 >= 2")).To(Equal([][]int32{{121}, {122}, {123}}))
+		Expect(ints("SELECT v FROM ks.t WHERE p = 1 AND c1 = 1 AND c2 > 1 AND c2 <= 2")).To(Equal([][]int32{{112}}))
+		Expect(ints("SELECT v FROM ks.t WHERE p = 1 AND c1 IN (1, 2) AND c2 = 3")).To(Equal([][]int32{{113}, {123}}))
+	})
+
+	It("supports multi-column slices", func() {
+		Expect(ints("SELECT v FROM ks.t WHERE p = 1 AND (c1, c2) > (1, 2) AND (c1, c2) < (2, 2)")).To(Equal([][]int32{{113}, {121}}))
+		Expect(ints("SELECT v FROM ks.t WHERE p = 1 AND (c1, c2) IN ((2, 1), (1, 3))")).To(Equal([][]int32{{113}, {121}}))
+	})
+
+	It("reverses the clustering order with ORDER BY", func() {
+		Expect(ints("SELECT v FROM ks.t WHERE p = 1 AND c1 = 1 ORDER BY c1 DESC, c2 DESC")).To(Equal([][]int32{{113}, {112}, {111}}))
+	})
+
+	It("merges partitions selected with IN when ordering", func() {
+		Expect(ints("SELECT v FROM ks.t WHERE p IN (1, 2) AND c1 = 2 AND c2 = 3 ORDER BY c1 DESC")).To(Equal([][]int32{{123}, {223}}))
+	})
+
+	It("applies LIMIT and PER PARTITION LIMIT", func() {
+		Expect(ints("SELECT v FROM ks.t LIMIT 2")).To(Equal([][]int32{{111}, {112}}))
+		Expect(ints("SELECT v FROM ks.t PER PARTITION LIMIT 1")).To(Equal([][]int32{{111}, {211}}))
+		Expect(ints("SELECT v FROM ks.t WHERE p = 2 ORDER BY c1 DESC PER PARTITION LIMIT 2 LIMIT 1")).To(Equal([][]int32{{223}}))
+	})
+
+	It("filters non-key columns with ALLOW FILTERING", func() {
+		Expect(ints("SELECT v FROM ks.t WHERE v > 200 AND c2 = 3 ALLOW FILTERING")).To(Equal([][]int32{{213}, {223}}))
+		Expect(ints("SELECT v FROM ks.t WHERE c1 = 2 AND c2 = 1 ALLOW FILTERING")).To(Equal([][]int32{{121}, {221}}))
+	})
+
+	Describe("refused queries", func() {
+		const filtering = "Cannot execute this query as it might involve data filtering and thus may have unpredictable performance. If you want to execute this query despite the performance unpredictability, use ALLOW FILTERING"
+
+		It("requires ALLOW FILTERING for filtering", func() {
+			expectInvalid(e, "SELECT * FROM ks.t WHERE v = 1", filtering)
+			expectInvalid(e, "SELECT * FROM ks.t WHERE c1 = 1", filtering)
+			expectInvalid(e, "SELECT * FROM ks.t WHERE p = 1 AND v = 1", filtering)
+		})
+
+		It("refuses slices on the partition key", func() {
+			expectInvalid(e, "SELECT * FROM ks.t WHERE p > 1", "Only EQ and IN relation are supported on the partition key (unless you use the token() function or allow filtering)")
+		})
+
+		It("refuses clustering restrictions out of order", func() {
+			expectInvalid(e, "SELECT * FROM ks.t WHERE p = 1 AND c2 = 1", `PRIMARY KEY column "c2" cannot be restricted as preceding column "c1" is not restricted`)
+			expectInvalid(e, "SELECT * FROM ks.t WHERE p = 1 AND c1 > 1 AND c2 = 1", `Clustering column "c2" cannot be restricted (preceding column "c1" is restricted by a non-EQ relation)`)
+		})
+
+		It("refuses conflicting restrictions", func() {
+			expectInvalid(e, "SELECT * FROM ks.t WHERE p = 1 AND p = 2", "p cannot be restricted by more than one relation if it includes an Equal")
+			expectInvalid(e, "SELECT * FROM ks.t WHERE p = 1 AND c1 > 1 AND c1 > 2", "More than one restriction was found for the start bound on c1")
+			expectInvalid(e, "SELECT * FROM ks.t WHERE p = 1 AND v IN (1, 2) ALLOW FILTERING", "IN predicates on non-primary-key columns (v) is not yet supported")
+		})
+
+		It("refuses invalid orderings", func() {
+			expectInvalid(e, "SELECT * FROM ks.t ORDER BY c1 DESC", "ORDER BY is only supported when the partition key is restricted by an EQ or an IN.")
+			expectInvalid(e, "SELECT * FROM ks.t WHERE p = 1 ORDER BY v DESC", "Order by is currently only supported on the clustered columns of the PRIMARY KEY, got v")
+			expectInvalid(e, "SELECT * FROM ks.t WHERE p = 1 ORDER BY c2 DESC", "Order by currently only supports the ordering of columns following their declared order in the PRIMARY KEY")
+			expectInvalid(e, "SELECT * FROM ks.t WHERE p = 1 ORDER BY c1 ASC, c2 DESC", "Unsupported order by relation")
+		})
+
+		It("refuses invalid limits and aliases", func() {
+			expectInvalid(e, "SELECT * FROM ks.t LIMIT 0", "LIMIT must be strictly positive")
+			expectInvalid(e, "SELECT * FROM ks.t PER PARTITION LIMIT -1", "PER PARTITION LIMIT must be strictly positive")
+			expectInvalid(e, "SELECT v AS x FROM ks.t WHERE x = 1 ALLOW FILTERING", "Aliases aren't allowed in the where clause ('x = 1')")
+		})
+	})
+})
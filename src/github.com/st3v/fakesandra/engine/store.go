@@ -0,0 +1,415 @@
+package engine
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+// noTimestamp marks deletions that have not been written.
+const noTimestamp = math.MinInt64
+
+// cell is the value of a single column in a row. A nil value is a
+// tombstone, which shadows older writes of the cell. Cells written with a
+// TTL expire at the given time in seconds and then act as tombstones.
+//
+// Non-frozen collections and user-defined types are stored as a cell
+// holding a cell per element or field. The timestamp of such a cell is that
+// of the latest tombstone of the whole value.
+type cell struct {
+	value     []byte
+	timestamp int64
+	ttl       int32
+	expires   int64
+	elements  map[string]*cell
+}
+
+// live returns true if c holds a value that has not expired at now.
+func (c *cell) live(now int64) bool {
+	return c.value != nil && (c.ttl == 0 || now < c.expires)
+}
+
+// supersedes returns true if c wins over o. Like Cassandra, the higher
+// timestamp wins. On a tie tombstones and expired cells win over live
+// values and greater values over smaller ones.
+func (c *cell) supersedes(o *cell, now int64) bool {
+	switch {
+	case c.timestamp != o.timestamp:
+		return c.timestamp > o.timestamp
+	case c.live(now) != o.live(now):
+		return !c.live(now)
+	}
+	return string(c.value) > string(o.value)
+}
+
+// row is a CQL row within a partition, identified by its clustering values.
+type row struct {
+	clustering [][]byte
+
+	// marker is the row marker written by INSERT, which keeps a row alive
+	// even if all its regular columns are null. It has an empty value.
+	marker *cell
+	cells  map[string]*cell
+}
+
+// rangeTombstone deletes the rows whose clustering starts with prefix and
+// whose next clustering value lies within the optional bounds.
+type rangeTombstone struct {
+	prefix       [][]byte
+	lower, upper *bound
+	timestamp    int64
+}
+
+func (rt *rangeTombstone) covers(t *Table, clustering [][]byte) bool {
+	for i, v := range rt.prefix {
+		if types.Compare(t.ClusteringKey[i].Type, clustering[i], v) != 0 {
+			return false
+		}
+	}
+
+	if rt.lower == nil && rt.upper == nil {
+		return true
+	}
+
+	next := &restriction{column: t.ClusteringKey[len(rt.prefix)], lower: rt.lower, upper: rt.upper}
+	return next.match(clustering[len(rt.prefix)])
+}
+
+// partition holds the rows sharing a partition key, sorted by clustering,
+// together with the deletions applied to it. Token is the token of the key.
+type partition struct {
+	key    [][]byte
+	token  int64
+	static map[string]*cell
+	rows   []*row
+
+	deletion int64
+	ranges   []*rangeTombstone
+}
+
+// store holds the data of a table. Partitions maps partition IDs to
+// partitions, ring holds the same partitions in token order. Tombstones are
+// kept until the table is truncated. Indexes holds the entries of the
+// secondary indexes of the table by index name.
+type store struct {
+	mu         sync.RWMutex
+	partitions map[string]*partition
+	ring       []*partition
+
+	// sequence numbers the list elements written to the table.
+	sequence int64
+
+	indexes map[string]postings
+}
+
+func newStore() *store {
+	return &store{partitions: map[string]*partition{}, indexes: map[string]postings{}}
+}
+
+func newPartition(key [][]byte) *partition {
+	return &partition{key: key, token: token(key), static: map[string]*cell{}, deletion: noTimestamp}
+}
+
+func partitionID(key [][]byte) string {
+	return string(types.JoinComponents(key))
+}
+
+// compareClustering compares clustering prefixes in the clustering order of
+// t. A prefix sorts before all clusterings it is a prefix of.
+func compareClustering(t *Table, a, b [][]byte) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		c := types.Compare(t.ClusteringKey[i].Type, a[i], b[i])
+		if t.ClusteringKey[i].Descending {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return len(a) - len(b)
+}
+
+// comparePartitions orders partitions by their token like Cassandra does.
+// Partitions whose tokens collide are ordered by their key.
+func comparePartitions(t *Table, ta int64, a [][]byte, tb int64, b [][]byte) int {
+	if ta != tb {
+		if ta < tb {
+			return -1
+		}
+		return 1
+	}
+
+	for i, c := range t.PartitionKey {
+		if cmp := types.Compare(c.Type, a[i], b[i]); cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+// search returns the index of the row with the given clustering or the
+// index it would have to be inserted at.
+func (p *partition) search(t *Table, clustering [][]byte) (int, bool) {
+	i := sort.Search(len(p.rows), func(i int) bool {
+		return compareClustering(t, p.rows[i].clustering, clustering) >= 0
+	})
+	return i, i < len(p.rows) && compareClustering(t, p.rows[i].clustering, clustering) == 0
+}
+
+func (p *partition) row(t *Table, clustering [][]byte) *row {
+	i, found := p.search(t, clustering)
+	if found {
+		return p.rows[i]
+	}
+
+	r := &row{clustering: clustering, cells: map[string]*cell{}}
+	p.rows = append(p.rows, nil)
+	copy(p.rows[i+1:], p.rows[i:])
+	p.rows[i] = r
+	return r
+}
+
+// rowDeletion returns the timestamp of the latest deletion covering the
+// row with the given clustering.
+func (p *partition) rowDeletion(t *Table, clustering [][]byte) int64 {
+	deletion := p.deletion
+	for _, rt := range p.ranges {
+		if rt.timestamp > deletion && rt.covers(t, clustering) {
+			deletion = rt.timestamp
+		}
+	}
+	return deletion
+}
+
+// live returns the static values and the rows of p that have neither been
+// deleted nor expired at now, without any shadowed cells. Collections and
+// user-defined types are returned as a single cell holding their live
+// elements. The result must not be modified.
+func (p *partition) live(t *Table, now int64) (map[string]*cell, []*row) {
+	static := liveCells(t, p.static, p.deletion, now)
+
+	rows := []*row{}
+	for _, r := range p.rows {
+		deletion := p.rowDeletion(t, r.clustering)
+
+		lr := &row{clustering: r.clustering, cells: liveCells(t, r.cells, deletion, now)}
+		if r.marker != nil && r.marker.timestamp > deletion && r.marker.live(now) {
+			lr.marker = r.marker
+		}
+
+		if lr.marker != nil || len(lr.cells) > 0 {
+			rows = append(rows, lr)
+		}
+	}
+
+	return static, rows
+}
+
+func liveCells(t *Table, cells map[string]*cell, deletion, now int64) map[string]*cell {
+	live := map[string]*cell{}
+	for name, c := range cells {
+		if c.elements != nil {
+			col, _ := t.Column(name)
+			if lc := c.liveValue(col.Type, deletion, now); lc != nil {
+				live[name] = lc
+			}
+			continue
+		}
+		if c.timestamp > deletion && c.live(now) {
+			live[name] = c
+		}
+	}
+	return live
+}
+
+// mutation describes a write to a single partition. Null values write
+// tombstones. Clustering is nil if no row is written, e.g. when only static
+// columns are set, and empty for tables without clustering columns. Values
+// written with a TTL expire ttl seconds after now. Counters holds the
+// amounts counter columns change by, collections the changes to the
+// elements of non-frozen collections and user-defined types.
+type mutation struct {
+	key         [][]byte
+	clustering  [][]byte
+	live        bool
+	cells       map[string][]byte
+	statics     map[string][]byte
+	counters    map[string]int64
+	collections map[string]*collectionMutation
+	timestamp   int64
+	ttl         int32
+	now         int64
+
+	// deletePartition deletes the whole partition, ranges delete rows.
+	deletePartition bool
+	ranges          []*rangeTombstone
+}
+
+func newMutation(key [][]byte, timestamp, now int64) *mutation {
+	return &mutation{
+		key:         key,
+		cells:       map[string][]byte{},
+		statics:     map[string][]byte{},
+		counters:    map[string]int64{},
+		collections: map[string]*collectionMutation{},
+		timestamp:   timestamp,
+		now:         now,
+	}
+}
+
+// cell returns the cell written by m for v.
+func (m *mutation) cell(v []byte) *cell {
+	c := &cell{value: v, timestamp: m.timestamp}
+	if v != nil && m.ttl > 0 {
+		c.ttl = m.ttl
+		c.expires = m.now + int64(m.ttl)
+	}
+	return c
+}
+
+// write applies m. The caller has to hold the write lock.
+func (s *store) write(t *Table, m *mutation) {
+	id := partitionID(m.key)
+	p, found := s.partitions[id]
+	if !found {
+		p = s.add(t, id, m.key)
+	}
+
+	if m.deletePartition && m.timestamp > p.deletion {
+		p.deletion = m.timestamp
+	}
+
+	for _, rt := range m.ranges {
+		rt.timestamp = m.timestamp
+		p.ranges = append(p.ranges, rt)
+	}
+
+	m.setCells(p.static, m.statics)
+
+	var r *row
+	if m.clustering != nil {
+		r = p.row(t, m.clustering)
+		if m.live {
+			if marker := m.cell([]byte{}); r.marker == nil || marker.supersedes(r.marker, m.now) {
+				r.marker = marker
+			}
+		}
+		m.setCells(r.cells, m.cells)
+	}
+
+	for name, delta := range m.counters {
+		if c, _ := t.Column(name); c.Kind == Static {
+			p.static[name] = m.increment(p.static[name], p.deletion, delta)
+		} else {
+			r.cells[name] = m.increment(r.cells[name], p.rowDeletion(t, m.clustering), delta)
+		}
+	}
+
+	for name, cm := range m.collections {
+		if c, _ := t.Column(name); c.Kind == Static {
+			p.static[name] = s.writeCollection(m, p.static[name], cm)
+		} else {
+			r.cells[name] = s.writeCollection(m, r.cells[name], cm)
+		}
+	}
+
+	s.index(t, p, r)
+}
+
+// increment returns counter cell c changed by delta. Counters are not
+// subject to last-write-wins, every increment adds up. A counter that has
+// been deleted starts over at zero.
+func (m *mutation) increment(c *cell, deletion, delta int64) *cell {
+	value, timestamp := int64(0), m.timestamp
+	if c != nil && c.timestamp > deletion && c.live(m.now) {
+		v, _ := types.Unmarshal(types.Native(types.Counter), c.value)
+		value = v.(int64)
+		if c.timestamp > timestamp {
+			timestamp = c.timestamp
+		}
+	}
+
+	b, _ := types.Marshal(types.Native(types.Counter), value+delta)
+	return &cell{value: b, timestamp: timestamp}
+}
+
+// setCells writes values unless the existing cells supersede them.
+func (m *mutation) setCells(cells map[string]*cell, values map[string][]byte) {
+	for name, v := range values {
+		c := m.cell(v)
+		if existing, found := cells[name]; !found || c.supersedes(existing, m.now) {
+			cells[name] = c
+		}
+	}
+}
+
+// partition returns the partition with the given key. The caller has to
+// hold the read lock.
+func (s *store) partition(key [][]byte) (*partition, bool) {
+	p, found := s.partitions[partitionID(key)]
+	return p, found
+}
+
+// compare orders p and o by their tokens and keys.
+func (p *partition) compare(t *Table, o *partition) int {
+	return comparePartitions(t, p.token, p.key, o.token, o.key)
+}
+
+// locate returns the index of p in the ring or the index it would have to
+// be inserted at.
+func (s *store) locate(t *Table, p *partition) (int, bool) {
+	i := sort.Search(len(s.ring), func(i int) bool {
+		return s.ring[i].compare(t, p) >= 0
+	})
+	return i, i < len(s.ring) && s.ring[i] == p
+}
+
+// add creates the partition with the given key and ID. The caller has to
+// hold the write lock.
+func (s *store) add(t *Table, id string, key [][]byte) *partition {
+	p := newPartition(key)
+	s.partitions[id] = p
+
+	i, _ := s.locate(t, p)
+	s.ring = append(s.ring, nil)
+	copy(s.ring[i+1:], s.ring[i:])
+	s.ring[i] = p
+	return p
+}
+
+// remove deletes the partition with the given ID. The caller has to hold
+// the write lock.
+func (s *store) remove(t *Table, id string) {
+	p, found := s.partitions[id]
+	if !found {
+		return
+	}
+	delete(s.partitions, id)
+
+	if i, found := s.locate(t, p); found {
+		s.ring = append(s.ring[:i], s.ring[i+1:]...)
+	}
+}
+
+// dropColumn removes the cells of a dropped column.
+func (s *store) dropColumn(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range s.partitions {
+		delete(p.static, name)
+		for _, r := range p.rows {
+			delete(r.cells, name)
+		}
+	}
+}
+
+func (s *store) truncate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.partitions = map[string]*partition{}
+	s.ring = nil
+	s.indexes = map[string]postings{}
+}
@@ -0,0 +1,255 @@
+package engine
+
+import (
+	"strconv"
+
+	"github.com/st3v/fakesandra/cql/parser"
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+// systemTable is a table of a system keyspace that the engine implements.
+// It is defined by a CREATE TABLE statement and its rows are generated from
+// the state of the engine whenever it is read. Rows map column names to
+// values as accepted by types.Marshal, missing and empty columns are null.
+// Strings are also accepted for numeric columns, e.g. for table options.
+type systemTable struct {
+	definition string
+	rows       func(e *Engine) []map[string]interface{}
+
+	// available returns whether the release of profile p has the table.
+	// Tables with a nil available exist in all releases.
+	available func(p Profile) bool
+}
+
+// since returns an available function for tables added in version.
+func since(version string) func(p Profile) bool {
+	return func(p Profile) bool { return p.atLeast(version) }
+}
+
+// until returns an available function for tables removed in version.
+func until(version string) func(p Profile) bool {
+	return func(p Profile) bool { return !p.atLeast(version) }
+}
+
+var systemTables = map[string]*systemTable{
+	"system.local": {
+		definition: `CREATE TABLE system.local (
+			key text PRIMARY KEY,
+			bootstrapped text,
+			broadcast_address inet,
+			cluster_name text,
+			cql_version text,
+			data_center text,
+			gossip_generation int,
+			host_id uuid,
+			listen_address inet,
+			native_protocol_version text,
+			partitioner text,
+			rack text,
+			release_version text,
+			rpc_address inet,
+			schema_version uuid,
+			thrift_version text,
+			tokens set<text>,
+			truncated_at map<uuid, blob>
+		)`,
+		rows: func(e *Engine) []map[string]interface{} {
+			c := e.Cluster()
+			local := e.node(c.Local)
+			return []map[string]interface{}{{
+				"key":                     "local",
+				"bootstrapped":            "COMPLETED",
+				"broadcast_address":       local.Address,
+				"cluster_name":            c.Name,
+				"cql_version":             e.Profile().CQLVersion,
+				"data_center":             local.DataCenter,
+				"host_id":                 local.HostID,
+				"listen_address":          local.Address,
+				"native_protocol_version": local.NativeProtocolVersion,
+				"partitioner":             Murmur3Partitioner{}.Name(),
+				"rack":                    local.Rack,
+				"release_version":         local.ReleaseVersion,
+				"rpc_address":             local.RPCAddress,
+				"schema_version":          e.nodeSchemaVersion(local),
+				"thrift_version":          "20.1.0",
+				"tokens":                  local.Tokens,
+			}}
+		},
+	},
+	"system.peers": {
+		definition: `CREATE TABLE system.peers (
+			peer inet PRIMARY KEY,
+			data_center text,
+			host_id uuid,
+			preferred_ip inet,
+			rack text,
+			release_version text,
+			rpc_address inet,
+			schema_version uuid,
+			tokens set<text>
+		)`,
+		rows: func(e *Engine) []map[string]interface{} {
+			rows := []map[string]interface{}{}
+			for _, n := range e.Cluster().Peers {
+				n = e.node(n)
+				rows = append(rows, map[string]interface{}{
+					"peer":            n.Address,
+					"data_center":     n.DataCenter,
+					"host_id":         n.HostID,
+					"rack":            n.Rack,
+					"release_version": n.ReleaseVersion,
+					"rpc_address":     n.RPCAddress,
+					"schema_version":  e.nodeSchemaVersion(n),
+					"tokens":          n.Tokens,
+				})
+			}
+			return rows
+		},
+	},
+	"system.peers_v2": {
+		definition: `CREATE TABLE system.peers_v2 (
+			peer inet,
+			peer_port int,
+			data_center text,
+			host_id uuid,
+			native_address inet,
+			native_port int,
+			preferred_ip inet,
+			preferred_port int,
+			rack text,
+			release_version text,
+			schema_version uuid,
+			tokens set<text>,
+			PRIMARY KEY (peer, peer_port)
+		)`,
+		rows: func(e *Engine) []map[string]interface{} {
+			rows := []map[string]interface{}{}
+			for _, n := range e.Cluster().Peers {
+				n = e.node(n)
+				rows = append(rows, map[string]interface{}{
+					"peer":            n.Address,
+					"peer_port":       int32(7000),
+					"data_center":     n.DataCenter,
+					"host_id":         n.HostID,
+					"native_address":  n.RPCAddress,
+					"native_port":     int32(9042),
+					"rack":            n.Rack,
+					"release_version": n.ReleaseVersion,
+					"schema_version":  e.nodeSchemaVersion(n),
+					"tokens":          n.Tokens,
+				})
+			}
+			return rows
+		},
+		available: since("4.0"),
+	},
+}
+
+// nodeSchemaVersion returns the schema version node n reports.
+func (e *Engine) nodeSchemaVersion(n Node) interface{} {
+	if n.SchemaVersion != "" {
+		return n.SchemaVersion
+	}
+	return e.schemaVersion()
+}
+
+// systemTable returns a system table filled with its current rows. Tables
+// the engine does not implement are left to the next query handler, tables
+// the release of the profile does not have are reported as such.
+func (e *Engine) systemTable(r *request, name parser.Name) (*Table, error) {
+	ksName, err := r.keyspaceName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	st, found := systemTables[ksName+"."+name.Name]
+	if !found {
+		return nil, errNotHandled
+	}
+
+	if p := e.Profile(); st.available != nil && !st.available(p) {
+		if ksName == "system_schema" {
+			return nil, invalid("Keyspace %s does not exist", ksName)
+		}
+		return nil, invalid("unconfigured table %s", name.Name)
+	}
+
+	stmt, err := parser.Parse(st.definition)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := buildTable(newKeyspace(ksName), stmt.(*parser.CreateTable))
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp, now := e.timestamp(), e.nowInSeconds()
+	for _, values := range st.rows(e) {
+		m, err := systemRow(t, values, timestamp, now)
+		if err != nil {
+			return nil, err
+		}
+		t.data.write(t, m)
+	}
+
+	return t, nil
+}
+
+// systemRow returns the mutation that writes a row of a system table.
+func systemRow(t *Table, values map[string]interface{}, timestamp, now int64) (*mutation, error) {
+	marshal := func(c *Column) (b []byte, err error) {
+		v, found := values[c.Name]
+		if !found || v == nil || v == "" {
+			return nil, nil
+		}
+		if s, ok := v.(string); ok {
+			if v, err = optionValue(c.Type, s); err != nil {
+				return nil, err
+			}
+		}
+		return types.Marshal(c.Type, v)
+	}
+
+	key := make([][]byte, len(t.PartitionKey))
+	for i, c := range t.PartitionKey {
+		v, err := marshal(c)
+		if err != nil {
+			return nil, err
+		}
+		key[i] = v
+	}
+
+	m := newMutation(key, timestamp, now)
+	m.live = true
+	m.clustering = make([][]byte, len(t.ClusteringKey))
+
+	for _, c := range t.Columns {
+		v, err := marshal(c)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case c.Kind == Clustering:
+			m.clustering[c.Position] = v
+		case !c.IsPrimaryKey() && v != nil:
+			m.set(c, v)
+		}
+	}
+
+	return m, nil
+}
+
+// optionValue converts a value given as string to the numeric type of the
+// column it is listed in.
+func optionValue(t types.Type, s string) (interface{}, error) {
+	switch t.ID {
+	case types.Int:
+		i, err := strconv.ParseInt(s, 10, 32)
+		return int32(i), err
+	case types.Double:
+		return strconv.ParseFloat(s, 64)
+	}
+	return s, nil
+}
@@ -0,0 +1,811 @@
+package engine
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+// The system_schema keyspace describes the schema catalog in the layout of
+// Cassandra 3.x, the schema_* tables of the system keyspace in the layout
+// of Cassandra 2.x. Drivers read them to build their metadata.
+func init() {
+	systemTables["system_schema.keyspaces"] = &systemTable{
+		definition: `CREATE TABLE system_schema.keyspaces (
+			keyspace_name text PRIMARY KEY,
+			durable_writes boolean,
+			replication frozen<map<text, text>>
+		)`,
+		rows: func(e *Engine) []map[string]interface{} {
+			rows := []map[string]interface{}{}
+			for _, ks := range e.schemaKeyspaces() {
+				rows = append(rows, map[string]interface{}{
+					"keyspace_name":  ks.Name,
+					"durable_writes": ks.DurableWrites,
+					"replication":    ks.Replication,
+				})
+			}
+			return rows
+		},
+		available: since("3.0"),
+	}
+
+	systemTables["system_schema.tables"] = &systemTable{
+		definition: `CREATE TABLE system_schema.tables (
+			keyspace_name text,
+			table_name text,
+			bloom_filter_fp_chance double,
+			caching frozen<map<text, text>>,
+			cdc boolean,
+			comment text,
+			compaction frozen<map<text, text>>,
+			compression frozen<map<text, text>>,
+			crc_check_chance double,
+			dclocal_read_repair_chance double,
+			default_time_to_live int,
+			extensions frozen<map<text, blob>>,
+			flags frozen<set<text>>,
+			gc_grace_seconds int,
+			id uuid,
+			max_index_interval int,
+			memtable_flush_period_in_ms int,
+			min_index_interval int,
+			read_repair_chance double,
+			speculative_retry text,
+			PRIMARY KEY (keyspace_name, table_name)
+		)`,
+		rows: func(e *Engine) []map[string]interface{} {
+			rows := []map[string]interface{}{}
+			for _, ks := range e.Keyspaces() {
+				for _, t := range ks.Tables() {
+					row := tableOptionRow(t.Options)
+					row["keyspace_name"] = ks.Name
+					row["table_name"] = t.Name
+					row["flags"] = tableFlags(t)
+					row["id"] = tableID(t)
+					rows = append(rows, row)
+				}
+			}
+			return rows
+		},
+		available: since("3.0"),
+	}
+
+	systemTables["system_schema.columns"] = &systemTable{
+		definition: `CREATE TABLE system_schema.columns (
+			keyspace_name text,
+			table_name text,
+			column_name text,
+			clustering_order text,
+			column_name_bytes blob,
+			kind text,
+			position int,
+			type text,
+			PRIMARY KEY (keyspace_name, table_name, column_name)
+		)`,
+		rows: func(e *Engine) []map[string]interface{} {
+			rows := []map[string]interface{}{}
+			for _, ks := range e.Keyspaces() {
+				for _, t := range ks.sortedTables() {
+					for _, c := range t.Columns {
+						rows = append(rows, map[string]interface{}{
+							"keyspace_name":     ks.Name,
+							"table_name":        t.Name,
+							"column_name":       c.Name,
+							"clustering_order":  clusteringOrderName(c),
+							"column_name_bytes": []byte(c.Name),
+							"kind":              columnKindName(c.Kind),
+							"position":          int32(c.Position),
+							"type":              cqlType(c.Type),
+						})
+					}
+				}
+			}
+			return rows
+		},
+		available: since("3.0"),
+	}
+
+	systemTables["system_schema.types"] = &systemTable{
+		definition: `CREATE TABLE system_schema.types (
+			keyspace_name text,
+			type_name text,
+			field_names frozen<list<text>>,
+			field_types frozen<list<text>>,
+			PRIMARY KEY (keyspace_name, type_name)
+		)`,
+		rows: func(e *Engine) []map[string]interface{} {
+			rows := []map[string]interface{}{}
+			for _, ks := range e.Keyspaces() {
+				for _, t := range ks.Types() {
+					rows = append(rows, map[string]interface{}{
+						"keyspace_name": ks.Name,
+						"type_name":     t.Name,
+						"field_names":   t.Fields,
+						"field_types":   cqlTypes(t.Elems),
+					})
+				}
+			}
+			return rows
+		},
+		available: since("3.0"),
+	}
+
+	systemTables["system_schema.indexes"] = &systemTable{
+		definition: `CREATE TABLE system_schema.indexes (
+			keyspace_name text,
+			table_name text,
+			index_name text,
+			kind text,
+			options frozen<map<text, text>>,
+			PRIMARY KEY (keyspace_name, table_name, index_name)
+		)`,
+		rows: func(e *Engine) []map[string]interface{} {
+			rows := []map[string]interface{}{}
+			for _, ks := range e.Keyspaces() {
+				for _, t := range ks.Tables() {
+					for _, idx := range t.Indexes {
+						options := copyMap(idx.Options)
+						options["target"] = idx.Target()
+						if idx.Class != "" {
+							options["class_name"] = idx.Class
+						}
+
+						rows = append(rows, map[string]interface{}{
+							"keyspace_name": ks.Name,
+							"table_name":    t.Name,
+							"index_name":    idx.Name,
+							"kind":          indexKind(t, idx),
+							"options":       options,
+						})
+					}
+				}
+			}
+			return rows
+		},
+		available: since("3.0"),
+	}
+
+	systemTables["system_schema.views"] = &systemTable{
+		definition: `CREATE TABLE system_schema.views (
+			keyspace_name text,
+			view_name text,
+			base_table_id uuid,
+			base_table_name text,
+			bloom_filter_fp_chance double,
+			caching frozen<map<text, text>>,
+			cdc boolean,
+			comment text,
+			compaction frozen<map<text, text>>,
+			compression frozen<map<text, text>>,
+			crc_check_chance double,
+			dclocal_read_repair_chance double,
+			default_time_to_live int,
+			extensions frozen<map<text, blob>>,
+			gc_grace_seconds int,
+			id uuid,
+			include_all_columns boolean,
+			max_index_interval int,
+			memtable_flush_period_in_ms int,
+			min_index_interval int,
+			read_repair_chance double,
+			speculative_retry text,
+			where_clause text,
+			PRIMARY KEY (keyspace_name, view_name)
+		)`,
+		rows: func(e *Engine) []map[string]interface{} {
+			rows := []map[string]interface{}{}
+			for _, ks := range e.Keyspaces() {
+				for _, v := range ks.Views() {
+					base, _ := ks.Table(v.View.Base)
+
+					row := tableOptionRow(v.Options)
+					row["keyspace_name"] = ks.Name
+					row["view_name"] = v.Name
+					row["base_table_id"] = tableID(base)
+					row["base_table_name"] = base.Name
+					row["id"] = tableID(v)
+					row["include_all_columns"] = v.View.IncludeAll
+					row["where_clause"] = v.View.WhereClause()
+					rows = append(rows, row)
+				}
+			}
+			return rows
+		},
+		available: since("3.0"),
+	}
+
+	systemTables["system_schema.functions"] = &systemTable{
+		definition: `CREATE TABLE system_schema.functions (
+			keyspace_name text,
+			function_name text,
+			argument_types frozen<list<text>>,
+			argument_names frozen<list<text>>,
+			body text,
+			called_on_null_input boolean,
+			language text,
+			return_type text,
+			PRIMARY KEY (keyspace_name, function_name, argument_types)
+		)`,
+		rows: func(e *Engine) []map[string]interface{} {
+			rows := []map[string]interface{}{}
+			for _, ks := range e.Keyspaces() {
+				for _, f := range ks.Functions() {
+					rows = append(rows, map[string]interface{}{
+						"keyspace_name":        ks.Name,
+						"function_name":        f.Name,
+						"argument_types":       cqlTypes(f.ArgTypes),
+						"argument_names":       f.ArgNames,
+						"body":                 f.Body,
+						"called_on_null_input": f.CalledOnNullInput,
+						"language":             f.Language,
+						"return_type":          cqlType(f.ReturnType),
+					})
+				}
+			}
+			return rows
+		},
+		available: since("3.0"),
+	}
+
+	systemTables["system_schema.aggregates"] = &systemTable{
+		definition: `CREATE TABLE system_schema.aggregates (
+			keyspace_name text,
+			aggregate_name text,
+			argument_types frozen<list<text>>,
+			final_func text,
+			initcond text,
+			return_type text,
+			state_func text,
+			state_type text,
+			PRIMARY KEY (keyspace_name, aggregate_name, argument_types)
+		)`,
+		rows: func(e *Engine) []map[string]interface{} {
+			rows := []map[string]interface{}{}
+			for _, ks := range e.Keyspaces() {
+				for _, a := range ks.Aggregates() {
+					row := map[string]interface{}{
+						"keyspace_name":  ks.Name,
+						"aggregate_name": a.Name,
+						"argument_types": cqlTypes(a.ArgTypes),
+						"final_func":     a.FinalFunc,
+						"return_type":    cqlType(a.ReturnType),
+						"state_func":     a.StateFunc,
+						"state_type":     cqlType(a.StateType),
+					}
+					if a.InitCond != nil {
+						row["initcond"] = cqlLiteral(a.StateType, a.InitCond)
+					}
+					rows = append(rows, row)
+				}
+			}
+			return rows
+		},
+		available: since("3.0"),
+	}
+
+	systemTables["system.schema_keyspaces"] = &systemTable{
+		definition: `CREATE TABLE system.schema_keyspaces (
+			keyspace_name text PRIMARY KEY,
+			durable_writes boolean,
+			strategy_class text,
+			strategy_options text
+		)`,
+		rows: func(e *Engine) []map[string]interface{} {
+			rows := []map[string]interface{}{}
+			for _, ks := range e.schemaKeyspaces() {
+				options := map[string]string{}
+				for k, v := range ks.Replication {
+					if k != "class" {
+						options[k] = v
+					}
+				}
+				rows = append(rows, map[string]interface{}{
+					"keyspace_name":    ks.Name,
+					"durable_writes":   ks.DurableWrites,
+					"strategy_class":   ks.Replication["class"],
+					"strategy_options": jsonString(options),
+				})
+			}
+			return rows
+		},
+		available: until("3.0"),
+	}
+
+	systemTables["system.schema_columnfamilies"] = &systemTable{
+		definition: `CREATE TABLE system.schema_columnfamilies (
+			keyspace_name text,
+			columnfamily_name text,
+			bloom_filter_fp_chance double,
+			caching text,
+			cf_id uuid,
+			column_aliases text,
+			comment text,
+			compaction_strategy_class text,
+			compaction_strategy_options text,
+			comparator text,
+			compression_parameters text,
+			default_time_to_live int,
+			default_validator text,
+			dropped_columns map<text, bigint>,
+			gc_grace_seconds int,
+			index_interval int,
+			is_dense boolean,
+			key_aliases text,
+			key_validator text,
+			local_read_repair_chance double,
+			max_compaction_threshold int,
+			max_index_interval int,
+			memtable_flush_period_in_ms int,
+			min_compaction_threshold int,
+			min_index_interval int,
+			read_repair_chance double,
+			speculative_retry text,
+			subcomparator text,
+			type text,
+			value_alias text,
+			PRIMARY KEY (keyspace_name, columnfamily_name)
+		)`,
+		rows: func(e *Engine) []map[string]interface{} {
+			rows := []map[string]interface{}{}
+			for _, ks := range e.Keyspaces() {
+				for _, t := range ks.Tables() {
+					rows = append(rows, legacyTableRow(t))
+				}
+			}
+			return rows
+		},
+		available: until("3.0"),
+	}
+
+	systemTables["system.schema_columns"] = &systemTable{
+		definition: `CREATE TABLE system.schema_columns (
+			keyspace_name text,
+			columnfamily_name text,
+			column_name text,
+			component_index int,
+			index_name text,
+			index_options text,
+			index_type text,
+			type text,
+			validator text,
+			PRIMARY KEY (keyspace_name, columnfamily_name, column_name)
+		)`,
+		rows: func(e *Engine) []map[string]interface{} {
+			rows := []map[string]interface{}{}
+			for _, ks := range e.Keyspaces() {
+				for _, t := range ks.Tables() {
+					for _, c := range t.Columns {
+						row := map[string]interface{}{
+							"keyspace_name":     ks.Name,
+							"columnfamily_name": t.Name,
+							"column_name":       c.Name,
+							"type":              legacyColumnKind(t, c),
+							"validator":         marshalClass(c.Type, c.Descending),
+						}
+						if c.Position >= 0 && (c.Kind == PartitionKey && len(t.PartitionKey) > 1 || c.Kind == Clustering) {
+							row["component_index"] = int32(c.Position)
+						}
+						if idx, found := t.indexOn(c); found {
+							row["index_name"] = idx.Name
+							row["index_type"] = indexKind(t, idx)
+							row["index_options"] = legacyIndexOptions(idx)
+						}
+						rows = append(rows, row)
+					}
+				}
+			}
+			return rows
+		},
+		available: until("3.0"),
+	}
+
+	systemTables["system.schema_usertypes"] = &systemTable{
+		definition: `CREATE TABLE system.schema_usertypes (
+			keyspace_name text,
+			type_name text,
+			field_names list<text>,
+			field_types list<text>,
+			PRIMARY KEY (keyspace_name, type_name)
+		)`,
+		rows: func(e *Engine) []map[string]interface{} {
+			rows := []map[string]interface{}{}
+			for _, ks := range e.Keyspaces() {
+				for _, t := range ks.Types() {
+					fieldTypes := make([]string, len(t.Elems))
+					for i, f := range t.Elems {
+						fieldTypes[i] = marshalClass(f, false)
+					}
+					rows = append(rows, map[string]interface{}{
+						"keyspace_name": ks.Name,
+						"type_name":     t.Name,
+						"field_names":   t.Fields,
+						"field_types":   fieldTypes,
+					})
+				}
+			}
+			return rows
+		},
+		available: until("3.0"),
+	}
+}
+
+// tableOptionRow returns the options of a table as listed in
+// system_schema.tables and system_schema.views.
+func tableOptionRow(o TableOptions) map[string]interface{} {
+	row := map[string]interface{}{
+		"caching":              o.Caching,
+		"cdc":                  false,
+		"comment":              o.Comment,
+		"compaction":           o.Compaction,
+		"compression":          o.Compression,
+		"default_time_to_live": int32(o.DefaultTimeToLive),
+		"extensions":           map[string][]byte{},
+		"gc_grace_seconds":     int32(o.GCGraceSeconds),
+	}
+	for name, v := range o.Other {
+		row[name] = v
+	}
+	return row
+}
+
+// tableID returns the ID of a table. Cassandra assigns random IDs, the
+// engine derives them from the name so that they do not change when the
+// table is altered.
+func tableID(t *Table) types.UUID {
+	return nameUUID([]byte(t.Keyspace + "." + t.Name))
+}
+
+// tableFlags returns the flags of a table as listed in
+// system_schema.tables.
+func tableFlags(t *Table) []string {
+	switch {
+	case !t.CompactStorage:
+		return []string{"compound"}
+	case len(t.ClusteringKey) > 0:
+		return []string{"dense"}
+	}
+	return []string{}
+}
+
+func columnKindName(k ColumnKind) string {
+	switch k {
+	case PartitionKey:
+		return "partition_key"
+	case Clustering:
+		return "clustering"
+	case Static:
+		return "static"
+	}
+	return "regular"
+}
+
+func clusteringOrderName(c *Column) string {
+	switch {
+	case c.Kind != Clustering:
+		return "none"
+	case c.Descending:
+		return "desc"
+	}
+	return "asc"
+}
+
+// cqlType returns a type as written in the schema tables, where tuples are
+// always frozen.
+func cqlType(t types.Type) string {
+	switch t.ID {
+	case types.Tuple:
+		return "frozen<tuple<" + strings.Join(cqlTypes(t.Elems), ", ") + ">>"
+	case types.List, types.Set:
+		return wrapFrozen(t, fmt.Sprintf("%s<%s>", t.ID, cqlType(t.Elems[0])))
+	case types.Map:
+		return wrapFrozen(t, fmt.Sprintf("map<%s, %s>", cqlType(t.Elems[0]), cqlType(t.Elems[1])))
+	}
+	return t.String()
+}
+
+func cqlTypes(ts []types.Type) []string {
+	names := make([]string, len(ts))
+	for i, t := range ts {
+		names[i] = cqlType(t)
+	}
+	return names
+}
+
+func wrapFrozen(t types.Type, s string) string {
+	if t.Frozen {
+		return "frozen<" + s + ">"
+	}
+	return s
+}
+
+// cqlLiteral returns a value as a CQL literal, e.g. to list the INITCOND
+// of an aggregate.
+func cqlLiteral(t types.Type, b []byte) string {
+	if b == nil {
+		return "null"
+	}
+
+	join := func(ts []types.Type, open, close string) string {
+		elems, err := types.SplitComponents(b, len(ts))
+		if err != nil {
+			return "null"
+		}
+		literals := make([]string, len(ts))
+		for i, e := range elems {
+			literals[i] = cqlLiteral(ts[i], e)
+			if t.ID == types.UDT {
+				literals[i] = t.Fields[i] + ": " + literals[i]
+			}
+		}
+		return open + strings.Join(literals, ", ") + close
+	}
+
+	switch t.ID {
+	case types.Tuple:
+		return join(t.Elems, "(", ")")
+	case types.UDT:
+		return join(t.Elems, "{", "}")
+	case types.List, types.Set, types.Map:
+		elems, err := types.SplitCollection(b)
+		if err != nil {
+			return "null"
+		}
+		literals := []string{}
+		for i := 0; i < len(elems); i++ {
+			if t.ID == types.Map {
+				literals = append(literals, cqlLiteral(t.Elems[0], elems[i])+": "+cqlLiteral(t.Elems[1], elems[i+1]))
+				i++
+				continue
+			}
+			literals = append(literals, cqlLiteral(t.Elems[0], elems[i]))
+		}
+		if t.ID == types.List {
+			return "[" + strings.Join(literals, ", ") + "]"
+		}
+		return "{" + strings.Join(literals, ", ") + "}"
+	}
+
+	s, err := formatValue(t, b)
+	if err != nil {
+		return "null"
+	}
+
+	switch t.ID {
+	case types.Ascii, types.Varchar, types.Inet, types.Timestamp, types.Date, types.Time:
+		return "'" + strings.Replace(s, "'", "''", -1) + "'"
+	}
+	return s
+}
+
+// legacyTableRow describes a table in the layout of
+// system.schema_columnfamilies.
+func legacyTableRow(t *Table) map[string]interface{} {
+	o := t.Options
+
+	compaction := map[string]string{}
+	for k, v := range o.Compaction {
+		if k != "class" && k != "min_threshold" && k != "max_threshold" {
+			compaction[k] = v
+		}
+	}
+
+	compression := map[string]string{}
+	for k, v := range o.Compression {
+		if k == "class" {
+			k = "sstable_compression"
+		}
+		compression[k] = v
+	}
+
+	keyValidators := make([]string, len(t.PartitionKey))
+	keyAliases := make([]string, len(t.PartitionKey))
+	for i, c := range t.PartitionKey {
+		keyValidators[i] = marshalClass(c.Type, false)
+		keyAliases[i] = c.Name
+	}
+	keyValidator := keyValidators[0]
+	if len(keyValidators) > 1 {
+		keyValidator = compositeClass(keyValidators)
+	}
+
+	comparators := []string{}
+	columnAliases := []string{}
+	for _, c := range t.ClusteringKey {
+		comparators = append(comparators, marshalClass(c.Type, c.Descending))
+		columnAliases = append(columnAliases, c.Name)
+	}
+	comparator := marshalPackage + "UTF8Type"
+	switch {
+	case !t.CompactStorage:
+		comparator = compositeClass(append(comparators, comparator))
+	case len(comparators) == 1:
+		comparator = comparators[0]
+	case len(comparators) > 1:
+		comparator = compositeClass(comparators)
+	}
+
+	row := map[string]interface{}{
+		"keyspace_name":               t.Keyspace,
+		"columnfamily_name":           t.Name,
+		"caching":                     jsonString(o.Caching),
+		"cf_id":                       tableID(t),
+		"column_aliases":              jsonString(columnAliases),
+		"comment":                     o.Comment,
+		"compaction_strategy_class":   o.Compaction["class"],
+		"compaction_strategy_options": jsonString(compaction),
+		"comparator":                  comparator,
+		"compression_parameters":      jsonString(compression),
+		"default_time_to_live":        int32(o.DefaultTimeToLive),
+		"default_validator":           marshalPackage + "BytesType",
+		"gc_grace_seconds":            int32(o.GCGraceSeconds),
+		"is_dense":                    t.CompactStorage && len(t.ClusteringKey) > 0,
+		"key_aliases":                 jsonString(keyAliases),
+		"key_validator":               keyValidator,
+		"local_read_repair_chance":    o.Other["dclocal_read_repair_chance"],
+		"max_compaction_threshold":    o.Compaction["max_threshold"],
+		"min_compaction_threshold":    o.Compaction["min_threshold"],
+		"type":                        "Standard",
+	}
+	for _, name := range []string{"bloom_filter_fp_chance", "max_index_interval", "memtable_flush_period_in_ms", "min_index_interval", "read_repair_chance", "speculative_retry"} {
+		row[name] = o.Other[name]
+	}
+	if t.IsCounter() {
+		row["default_validator"] = marshalPackage + "CounterColumnType"
+	}
+	return row
+}
+
+// indexKind returns the kind of an index as listed in
+// system_schema.indexes.
+func indexKind(t *Table, idx *Index) string {
+	switch {
+	case idx.Class != "":
+		return "CUSTOM"
+	case t.CompactStorage:
+		return "KEYS"
+	}
+	return "COMPOSITES"
+}
+
+// legacyIndexOptions returns the options of an index as listed in
+// system.schema_columns.
+func legacyIndexOptions(idx *Index) string {
+	options := copyMap(idx.Options)
+	switch idx.Kind {
+	case "keys":
+		options["index_keys"] = ""
+	case "values":
+		options["index_values"] = ""
+	case "entries":
+		options["index_keys_and_values"] = ""
+	}
+	if idx.Class != "" {
+		options["class_name"] = idx.Class
+	}
+	return jsonString(options)
+}
+
+// legacyColumnKind returns the kind of a column as listed in
+// system.schema_columns.
+func legacyColumnKind(t *Table, c *Column) string {
+	switch {
+	case c.Kind == PartitionKey:
+		return "partition_key"
+	case c.Kind == Clustering:
+		return "clustering_key"
+	case c.Kind == Static:
+		return "static"
+	case t.CompactStorage && len(t.ClusteringKey) > 0:
+		return "compact_value"
+	}
+	return "regular"
+}
+
+const marshalPackage = "org.apache.cassandra.db.marshal."
+
+// marshalClasses are the Java classes of the native types.
+var marshalClasses = map[types.ID]string{
+	types.Ascii:     "AsciiType",
+	types.Bigint:    "LongType",
+	types.Blob:      "BytesType",
+	types.Boolean:   "BooleanType",
+	types.Counter:   "CounterColumnType",
+	types.Date:      "SimpleDateType",
+	types.Decimal:   "DecimalType",
+	types.Double:    "DoubleType",
+	types.Duration:  "DurationType",
+	types.Float:     "FloatType",
+	types.Inet:      "InetAddressType",
+	types.Int:       "Int32Type",
+	types.Smallint:  "ShortType",
+	types.Time:      "TimeType",
+	types.Timestamp: "TimestampType",
+	types.Timeuuid:  "TimeUUIDType",
+	types.Tinyint:   "ByteType",
+	types.Uuid:      "UUIDType",
+	types.Varchar:   "UTF8Type",
+	types.Varint:    "IntegerType",
+}
+
+// marshalClass returns the Java class of a type as listed in the schema
+// tables of Cassandra 2.x, e.g. for validators.
+func marshalClass(t types.Type, reversed bool) string {
+	var class string
+
+	switch t.ID {
+	case types.Custom:
+		class = t.Class
+	case types.List:
+		class = marshalPackage + "ListType(" + marshalClass(t.Elems[0], false) + ")"
+	case types.Set:
+		class = marshalPackage + "SetType(" + marshalClass(t.Elems[0], false) + ")"
+	case types.Map:
+		class = marshalPackage + "MapType(" + marshalClass(t.Elems[0], false) + "," + marshalClass(t.Elems[1], false) + ")"
+	case types.Tuple:
+		elems := make([]string, len(t.Elems))
+		for i, e := range t.Elems {
+			elems[i] = marshalClass(e, false)
+		}
+		class = marshalPackage + "TupleType(" + strings.Join(elems, ",") + ")"
+	case types.UDT:
+		fields := make([]string, len(t.Elems))
+		for i, e := range t.Elems {
+			fields[i] = hex.EncodeToString([]byte(t.Fields[i])) + ":" + marshalClass(e, false)
+		}
+		class = marshalPackage + "UserType(" + t.Keyspace + "," + hex.EncodeToString([]byte(t.Name)) + "," + strings.Join(fields, ",") + ")"
+	default:
+		class = marshalPackage + marshalClasses[t.ID]
+	}
+
+	if t.Frozen && t.ID != types.Tuple {
+		class = marshalPackage + "FrozenType(" + class + ")"
+	}
+	if reversed {
+		class = marshalPackage + "ReversedType(" + class + ")"
+	}
+	return class
+}
+
+func compositeClass(classes []string) string {
+	return marshalPackage + "CompositeType(" + strings.Join(classes, ",") + ")"
+}
+
+// jsonString returns v encoded as JSON, the format of the options in the
+// schema tables of Cassandra 2.x.
+func jsonString(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// systemKeyspaces are the keyspaces Cassandra creates for itself, along with
+// the release that introduced them.
+var systemKeyspaces = []struct {
+	name        string
+	replication map[string]string
+	since       string
+}{
+	{"system", map[string]string{"class": "org.apache.cassandra.locator.LocalStrategy"}, "2.1"},
+	{"system_auth", map[string]string{"class": "org.apache.cassandra.locator.SimpleStrategy", "replication_factor": "1"}, "2.1"},
+	{"system_distributed", map[string]string{"class": "org.apache.cassandra.locator.SimpleStrategy", "replication_factor": "3"}, "2.2"},
+	{"system_schema", map[string]string{"class": "org.apache.cassandra.locator.LocalStrategy"}, "3.0"},
+	{"system_traces", map[string]string{"class": "org.apache.cassandra.locator.SimpleStrategy", "replication_factor": "2"}, "2.1"},
+}
+
+// schemaKeyspaces returns the keyspaces listed in the keyspaces schema
+// table, i.e. the system keyspaces of the profile's release followed by the
+// user keyspaces, each ordered by name.
+func (e *Engine) schemaKeyspaces() []*Keyspace {
+	keyspaces := []*Keyspace{}
+	for _, sk := range systemKeyspaces {
+		if e.Profile().atLeast(sk.since) {
+			ks := newKeyspace(sk.name)
+			ks.Replication = sk.replication
+			keyspaces = append(keyspaces, ks)
+		}
+	}
+	return append(keyspaces, e.Keyspaces()...)
+}
@@ -0,0 +1,221 @@
+package engine_test
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/cql/types"
+	"github.com/st3v/fakesandra/engine"
+)
+
+var _ = Describe("System tables", func() {
+	var e *engine.Engine
+
+	// records executes stmt and returns its rows keyed by column name.
+	records := func(stmt string) []map[string]interface{} {
+		res, err := e.Execute(stmt)
+		Expect(err).NotTo(HaveOccurred())
+
+		rows := res.(*result.Rows)
+		decoded := []map[string]interface{}{}
+		for _, data := range rows.Data {
+			row := map[string]interface{}{}
+			for i, b := range data {
+				var v interface{}
+				if b != nil {
+					v, err = types.Unmarshal(rows.Columns[i].Type, b)
+					Expect(err).NotTo(HaveOccurred())
+				}
+				row[rows.Columns[i].Name] = v
+			}
+			decoded = append(decoded, row)
+		}
+		return decoded
+	}
+
+	BeforeEach(func() {
+		e = engine.New()
+	})
+
+	It("describes the local node", func() {
+		local := records("SELECT * FROM system.local WHERE key = 'local'")
+		Expect(local).To(HaveLen(1))
+		Expect(local[0]).To(HaveKeyWithValue("cluster_name", "Test Cluster"))
+		Expect(local[0]).To(HaveKeyWithValue("data_center", "datacenter1"))
+		Expect(local[0]).To(HaveKeyWithValue("rack", "rack1"))
+		Expect(local[0]).To(HaveKeyWithValue("release_version", "3.11.4"))
+		Expect(local[0]).To(HaveKeyWithValue("partitioner", "org.apache.cassandra.dht.Murmur3Partitioner"))
+		Expect(local[0]).To(HaveKeyWithValue("tokens", []interface{}{"-9223372036854775808"}))
+		Expect(local[0]).To(HaveKeyWithValue("rpc_address", net.ParseIP("127.0.0.1").To4()))
+		Expect(local[0]).To(HaveKeyWithValue("native_protocol_version", "3"))
+		Expect(local[0]["host_id"]).NotTo(BeNil())
+		Expect(local[0]["schema_version"]).NotTo(BeNil())
+
+		Expect(records("SELECT * FROM system.peers")).To(BeEmpty())
+	})
+
+	It("lists the configured cluster", func() {
+		cluster := e.Cluster()
+		cluster.Name = "prod"
+		cluster.Local.DataCenter = "eu-west"
+		cluster.Local.Tokens = []string{"-100", "100"}
+		cluster.Peers = []engine.Node{{
+			Address:        "10.0.0.2",
+			RPCAddress:     "10.0.0.2",
+			DataCenter:     "eu-west",
+			Rack:           "rack2",
+			HostID:         "b1a2c3d4-0000-4000-8000-000000000002",
+			Tokens:         []string{"0"},
+			ReleaseVersion: "3.11.4",
+		}}
+		e.SetCluster(cluster)
+
+		Expect(records("SELECT cluster_name, data_center, tokens FROM system.local")).To(Equal([]map[string]interface{}{{
+			"cluster_name": "prod",
+			"data_center":  "eu-west",
+			"tokens":       []interface{}{"-100", "100"},
+		}}))
+
+		peers := records("SELECT peer, rack, host_id, tokens FROM system.peers")
+		Expect(peers).To(HaveLen(1))
+		Expect(peers[0]["peer"]).To(Equal(net.ParseIP("10.0.0.2").To4()))
+		Expect(peers[0]["rack"]).To(Equal("rack2"))
+		Expect(peers[0]["host_id"].(types.UUID).String()).To(Equal("b1a2c3d4-0000-4000-8000-000000000002"))
+		Expect(peers[0]["tokens"]).To(Equal([]interface{}{"0"}))
+	})
+
+	It("reports a schema version that changes with the schema", func() {
+		version := func() interface{} {
+			return records("SELECT schema_version FROM system.local")[0]["schema_version"]
+		}
+
+		cluster := e.Cluster()
+		cluster.Peers = []engine.Node{{Address: "10.0.0.2"}}
+		e.SetCluster(cluster)
+
+		before := version()
+		Expect(version()).To(Equal(before))
+
+		exec(e, "CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}")
+		after := version()
+		Expect(after).NotTo(Equal(before))
+		Expect(records("SELECT schema_version FROM system.peers")[0]["schema_version"]).To(Equal(after))
+
+		exec(e, "CREATE TABLE ks.t (p int PRIMARY KEY)")
+		Expect(version()).NotTo(Equal(after))
+	})
+
+	Describe("schema tables", func() {
+		BeforeEach(func() {
+			exec(e, "CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}")
+			exec(e, "CREATE TYPE ks.address (street text, zip int)")
+			exec(e, "CREATE TABLE ks.t (p int, q text, c timeuuid, v frozen<address>, PRIMARY KEY ((p, q), c)) WITH CLUSTERING ORDER BY (c DESC) AND comment = 'events'")
+			exec(e, "CREATE FUNCTION ks.st (s tuple<int, bigint>, v int) CALLED ON NULL INPUT RETURNS tuple<int, bigint> LANGUAGE java AS ''")
+			exec(e, "CREATE AGGREGATE ks.a (int) SFUNC st STYPE tuple<int, bigint> INITCOND (0, 0)")
+		})
+
+		It("lists the schema in the layout of Cassandra 3.x", func() {
+			Expect(records("SELECT keyspace_name, replication FROM system_schema.keyspaces WHERE keyspace_name = 'ks'")).To(Equal([]map[string]interface{}{{
+				"keyspace_name": "ks",
+				"replication": []types.Pair{
+					{Key: "class", Value: "org.apache.cassandra.locator.SimpleStrategy"},
+					{Key: "replication_factor", Value: "1"},
+				},
+			}}))
+
+			Expect(records("SELECT table_name, comment, flags, gc_grace_seconds FROM system_schema.tables WHERE keyspace_name = 'ks'")).To(Equal([]map[string]interface{}{{
+				"table_name":       "t",
+				"comment":          "events",
+				"flags":            []interface{}{"compound"},
+				"gc_grace_seconds": int32(864000),
+			}}))
+
+			Expect(records("SELECT column_name, kind, position, clustering_order, type FROM system_schema.columns WHERE keyspace_name = 'ks' AND table_name = 't'")).To(Equal([]map[string]interface{}{
+				{"column_name": "c", "kind": "clustering", "position": int32(0), "clustering_order": "desc", "type": "timeuuid"},
+				{"column_name": "p", "kind": "partition_key", "position": int32(0), "clustering_order": "none", "type": "int"},
+				{"column_name": "q", "kind": "partition_key", "position": int32(1), "clustering_order": "none", "type": "text"},
+				{"column_name": "v", "kind": "regular", "position": int32(-1), "clustering_order": "none", "type": "frozen<address>"},
+			}))
+
+			Expect(records("SELECT type_name, field_names, field_types FROM system_schema.types")).To(Equal([]map[string]interface{}{{
+				"type_name":   "address",
+				"field_names": []interface{}{"street", "zip"},
+				"field_types": []interface{}{"text", "int"},
+			}}))
+
+			Expect(records("SELECT function_name, argument_types, return_type FROM system_schema.functions")).To(Equal([]map[string]interface{}{{
+				"function_name":  "st",
+				"argument_types": []interface{}{"frozen<tuple<int, bigint>>", "int"},
+				"return_type":    "frozen<tuple<int, bigint>>",
+			}}))
+
+			Expect(records("SELECT aggregate_name, state_func, initcond FROM system_schema.aggregates")).To(Equal([]map[string]interface{}{{
+				"aggregate_name": "a",
+				"state_func":     "st",
+				"initcond":       "(0, 0)",
+			}}))
+		})
+
+		It("lists the system keyspaces", func() {
+			local := []types.Pair{{Key: "class", Value: "org.apache.cassandra.locator.LocalStrategy"}}
+			Expect(records("SELECT keyspace_name, replication FROM system_schema.keyspaces")).To(ConsistOf(
+				map[string]interface{}{"keyspace_name": "system", "replication": local},
+				map[string]interface{}{"keyspace_name": "system_schema", "replication": local},
+				map[string]interface{}{"keyspace_name": "system_auth", "replication": []types.Pair{
+					{Key: "class", Value: "org.apache.cassandra.locator.SimpleStrategy"},
+					{Key: "replication_factor", Value: "1"},
+				}},
+				map[string]interface{}{"keyspace_name": "system_distributed", "replication": []types.Pair{
+					{Key: "class", Value: "org.apache.cassandra.locator.SimpleStrategy"},
+					{Key: "replication_factor", Value: "3"},
+				}},
+				map[string]interface{}{"keyspace_name": "system_traces", "replication": []types.Pair{
+					{Key: "class", Value: "org.apache.cassandra.locator.SimpleStrategy"},
+					{Key: "replication_factor", Value: "2"},
+				}},
+				map[string]interface{}{"keyspace_name": "ks", "replication": []types.Pair{
+					{Key: "class", Value: "org.apache.cassandra.locator.SimpleStrategy"},
+					{Key: "replication_factor", Value: "1"},
+				}},
+			))
+
+			profile, err := engine.LookupProfile("2.1")
+			Expect(err).NotTo(HaveOccurred())
+			e.SetProfile(profile)
+
+			Expect(records("SELECT keyspace_name, strategy_class FROM system.schema_keyspaces")).To(ConsistOf(
+				map[string]interface{}{"keyspace_name": "system", "strategy_class": "org.apache.cassandra.locator.LocalStrategy"},
+				map[string]interface{}{"keyspace_name": "system_auth", "strategy_class": "org.apache.cassandra.locator.SimpleStrategy"},
+				map[string]interface{}{"keyspace_name": "system_traces", "strategy_class": "org.apache.cassandra.locator.SimpleStrategy"},
+				map[string]interface{}{"keyspace_name": "ks", "strategy_class": "org.apache.cassandra.locator.SimpleStrategy"},
+			))
+		})
+
+		It("lists the schema in the layout of Cassandra 2.x", func() {
+			profile, err := engine.LookupProfile("2.1")
+			Expect(err).NotTo(HaveOccurred())
+			e.SetProfile(profile)
+
+			Expect(records("SELECT strategy_class, strategy_options FROM system.schema_keyspaces WHERE keyspace_name = 'ks'")).To(Equal([]map[string]interface{}{{
+				"strategy_class":   "org.apache.cassandra.locator.SimpleStrategy",
+				"strategy_options": `{"replication_factor":"1"}`,
+			}}))
+
+			Expect(records("SELECT key_validator, key_aliases, column_aliases, comparator FROM system.schema_columnfamilies WHERE keyspace_name = 'ks'")).To(Equal([]map[string]interface{}{{
+				"key_validator":  "org.apache.cassandra.db.marshal.CompositeType(org.apache.cassandra.db.marshal.Int32Type,org.apache.cassandra.db.marshal.UTF8Type)",
+				"key_aliases":    `["p","q"]`,
+				"column_aliases": `["c"]`,
+				"comparator":     "org.apache.cassandra.db.marshal.CompositeType(org.apache.cassandra.db.marshal.ReversedType(org.apache.cassandra.db.marshal.TimeUUIDType),org.apache.cassandra.db.marshal.UTF8Type)",
+			}}))
+
+			Expect(records("SELECT column_name, type, validator FROM system.schema_columns WHERE keyspace_name = 'ks' AND columnfamily_name = 't' AND column_name = 'v'")).To(Equal([]map[string]interface{}{{
+				"column_name": "v",
+				"type":        "regular",
+				"validator":   "org.apache.cassandra.db.marshal.FrozenType(org.apache.cassandra.db.marshal.UserType(ks,61646472657373,737472656574:org.apache.cassandra.db.marshal.UTF8Type,7a6970:org.apache.cassandra.db.marshal.Int32Type))",
+			}}))
+		})
+	})
+})
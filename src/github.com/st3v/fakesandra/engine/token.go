@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+// Murmur3Partitioner is Cassandra's default partitioner, the only one the
+// engine implements. Partitions are stored in the order of their tokens.
+type Murmur3Partitioner struct{}
+
+// Name returns the class name of the partitioner as listed in system.local.
+func (Murmur3Partitioner) Name() string {
+	return "org.apache.cassandra.dht.Murmur3Partitioner"
+}
+
+// Token returns the token of a partition key, which holds the serialized
+// values of the partition key columns.
+func (Murmur3Partitioner) Token(key [][]byte) int64 {
+	return token(key)
+}
+
+// token returns the token of a partition key as computed by Cassandra's
+// Murmur3Partitioner.
+func token(key [][]byte) int64 {
+	t := murmur3(partitionKeyBytes(key))
+	if t == math.MinInt64 {
+		return math.MaxInt64
+	}
+	return t
+}
+
+// partitionKeyBytes serializes a partition key the way Cassandra does
+// before hashing it. Keys with multiple components are encoded like the
+// composite type: each component is prefixed by its length and followed by
+// an end-of-component byte.
+func partitionKeyBytes(key [][]byte) []byte {
+	if len(key) == 1 {
+		return key[0]
+	}
+
+	b := []byte{}
+	for _, c := range key {
+		b = append(b, byte(len(c)>>8), byte(len(c)))
+		b = append(b, c...)
+		b = append(b, 0)
+	}
+	return b
+}
+
+// murmur3 returns the first half of the 128 bit x64 variant of
+// MurmurHash3 with seed 0. Like Cassandra, which is not faithful to the
+// reference implementation here, it sign-extends the trailing bytes.
+func murmur3(data []byte) int64 {
+	const (
+		c1 = 0x87c37b91114253d5
+		c2 = 0x4cf5ad432745937f
+	)
+
+	var h1, h2 uint64
+
+	nblocks := len(data) / 16
+	for i := 0; i < nblocks; i++ {
+		k1 := binary.LittleEndian.Uint64(data[i*16:])
+		k2 := binary.LittleEndian.Uint64(data[i*16+8:])
+
+		k1 *= c1
+		k1 = bits.RotateLeft64(k1, 31)
+		k1 *= c2
+		h1 ^= k1
+
+		h1 = bits.RotateLeft64(h1, 27)
+		h1 += h2
+		h1 = h1*5 + 0x52dce729
+
+		k2 *= c2
+		k2 = bits.RotateLeft64(k2, 33)
+		k2 *= c1
+		h2 ^= k2
+
+		h2 = bits.RotateLeft64(h2, 31)
+		h2 += h1
+		h2 = h2*5 + 0x38495ab5
+	}
+
+	tail := data[nblocks*16:]
+	signed := func(i int) uint64 {
+		return uint64(int64(int8(tail[i])))
+	}
+
+	var k1, k2 uint64
+	switch len(tail) {
+	case 15:
+		k2 ^= signed(14) << 48
+		fallthrough
+	case 14:
+		k2 ^= signed(13) << 40
+		fallthrough
+	case 13:
+		k2 ^= signed(12) << 32
+		fallthrough
+	case 12:
+		k2 ^= signed(11) << 24
+		fallthrough
+	case 11:
+		k2 ^= signed(10) << 16
+		fallthrough
+	case 10:
+		k2 ^= signed(9) << 8
+		fallthrough
+	case 9:
+		k2 ^= signed(8)
+		k2 *= c2
+		k2 = bits.RotateLeft64(k2, 33)
+		k2 *= c1
+		h2 ^= k2
+		fallthrough
+	case 8:
+		k1 ^= signed(7) << 56
+		fallthrough
+	case 7:
+		k1 ^= signed(6) << 48
+		fallthrough
+	case 6:
+		k1 ^= signed(5) << 40
+		fallthrough
+	case 5:
+		k1 ^= signed(4) << 32
+		fallthrough
+	case 4:
+		k1 ^= signed(3) << 24
+		fallthrough
+	case 3:
+		k1 ^= signed(2) << 16
+		fallthrough
+	case 2:
+		k1 ^= signed(1) << 8
+		fallthrough
+	case 1:
+		k1 ^= signed(0)
+		k1 *= c1
+		k1 = bits.RotateLeft64(k1, 31)
+		k1 *= c2
+		h1 ^= k1
+	}
+
+	h1 ^= uint64(len(data))
+	h2 ^= uint64(len(data))
+
+	h1 += h2
+	h2 += h1
+
+	h1 = fmix64(h1)
+	h2 = fmix64(h2)
+
+	h1 += h2
+	return int64(h1)
+}
+
+func fmix64(k uint64) uint64 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+	return k
+}
+
+// tokenFunction returns the token function of a table, which takes the
+// partition key columns as arguments.
+func tokenFunction(t *Table) *function {
+	f := &function{name: "token", returns: bigintType, execute: func(e *Engine, args [][]byte) ([]byte, error) {
+		return types.Marshal(bigintType, token(args))
+	}}
+	for _, c := range t.PartitionKey {
+		f.args = append(f.args, c.Type)
+	}
+	return f
+}
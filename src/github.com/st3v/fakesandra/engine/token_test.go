@@ -0,0 +1,122 @@
+package engine_test
+
+import (
+	"math"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/cql/types"
+	"github.com/st3v/fakesandra/engine"
+)
+
+var _ = Describe("Murmur3Partitioner", func() {
+	var (
+		e           *engine.Engine
+		partitioner engine.Murmur3Partitioner
+	)
+
+	marshal := func(id types.ID, v interface{}) []byte {
+		b, err := types.Marshal(types.Native(id), v)
+		Expect(err).NotTo(HaveOccurred())
+		return b
+	}
+
+	// boundColumn executes stmt with the given bound values and returns the
+	// values of its first column.
+	boundColumn := func(stmt string, bound ...[]byte) []interface{} {
+		res, err := e.ExecuteQuery(query{statement: stmt, values: bound}, proto.NewSession())
+		Expect(err).NotTo(HaveOccurred())
+
+		rows := res.(*result.Rows)
+		values := []interface{}{}
+		for _, data := range rows.Data {
+			v, err := types.Unmarshal(rows.Columns[0].Type, data[0])
+			Expect(err).NotTo(HaveOccurred())
+			values = append(values, v)
+		}
+		return values
+	}
+
+	BeforeEach(func() {
+		e = engine.New()
+		exec(e, "CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}")
+		exec(e, "CREATE TABLE ks.t (p int, c int, PRIMARY KEY (p, c))")
+		for _, p := range []string{"1", "2", "3", "4", "5", "6"} {
+			exec(e, "INSERT INTO ks.t (p, c) VALUES ("+p+", 0)")
+		}
+	})
+
+	It("computes the tokens of Cassandra", func() {
+		Expect(partitioner.Name()).To(Equal("org.apache.cassandra.dht.Murmur3Partitioner"))
+		Expect(partitioner.Token([][]byte{marshal(types.Int, int32(5))})).To(Equal(int64(-7509452495886106294)))
+		Expect(partitioner.Token([][]byte{marshal(types.Varchar, "a"), marshal(types.Int, int32(1))})).To(Equal(int64(8247712171917364652)))
+	})
+
+	It("stores partitions in token order", func() {
+		Expect(boundColumn("SELECT p FROM ks.t")).To(Equal([]interface{}{
+			int32(5), int32(1), int32(2), int32(4), int32(6), int32(3),
+		}))
+		Expect(boundColumn("SELECT token(p) FROM ks.t WHERE p = 3")).To(Equal([]interface{}{int64(9010454139840013625)}))
+	})
+
+	It("keeps token order as partitions are added and removed", func() {
+		exec(e, "CREATE MATERIALIZED VIEW ks.by_c AS SELECT * FROM ks.t WHERE c IS NOT NULL AND p IS NOT NULL PRIMARY KEY (c, p)")
+		for _, c := range []string{"1", "2", "3", "4", "5", "6"} {
+			exec(e, "INSERT INTO ks.t (p, c) VALUES (1, "+c+")")
+		}
+		exec(e, "DELETE FROM ks.t WHERE p = 1 AND c = 4")
+		exec(e, "DELETE FROM ks.t WHERE p = 1 AND c = 6")
+		Expect(boundColumn("SELECT DISTINCT c FROM ks.by_c")).To(Equal([]interface{}{
+			int32(5), int32(1), int32(0), int32(2), int32(3),
+		}))
+
+		exec(e, "TRUNCATE ks.t")
+		exec(e, "INSERT INTO ks.t (p, c) VALUES (3, 0)")
+		exec(e, "INSERT INTO ks.t (p, c) VALUES (5, 0)")
+		Expect(boundColumn("SELECT p FROM ks.t")).To(Equal([]interface{}{int32(5), int32(3)}))
+	})
+
+	It("restricts partitions by token range", func() {
+		Expect(boundColumn("SELECT p FROM ks.t WHERE token(p) > ? AND token(p) <= ?", marshal(types.Bigint, int64(-4069959284402364209)), marshal(types.Bigint, int64(2705480034054113608)))).To(Equal([]interface{}{
+			int32(2), int32(4), int32(6),
+		}))
+		Expect(boundColumn("SELECT p FROM ks.t WHERE token(p) >= ?", marshal(types.Bigint, int64(math.MinInt64)))).To(HaveLen(6))
+		Expect(boundColumn("SELECT p FROM ks.t WHERE token(p) = -3248873570005575792")).To(Equal([]interface{}{int32(2)}))
+		Expect(boundColumn("SELECT p FROM ks.t WHERE token(p) > 0 AND c = 0")).To(Equal([]interface{}{int32(6), int32(3)}))
+	})
+
+	It("restricts partitions by the tokens of values", func() {
+		Expect(boundColumn("SELECT p FROM ks.t WHERE token(p) > token(1)")).To(Equal([]interface{}{
+			int32(2), int32(4), int32(6), int32(3),
+		}))
+		Expect(boundColumn("SELECT p FROM ks.t WHERE token(p) > token(?) AND token(p) <= token(6)", marshal(types.Int, int32(2)))).To(Equal([]interface{}{
+			int32(4), int32(6),
+		}))
+		Expect(boundColumn("SELECT p FROM ks.t WHERE token(p) = token(4)")).To(Equal([]interface{}{int32(4)}))
+
+		exec(e, "CREATE TABLE ks.composite (a int, b text, PRIMARY KEY ((a, b)))")
+		exec(e, "INSERT INTO ks.composite (a, b) VALUES (1, 'x')")
+		Expect(boundColumn("SELECT a FROM ks.composite WHERE token(a, b) >= token(1, 'x')")).To(Equal([]interface{}{int32(1)}))
+		Expect(boundColumn("SELECT a FROM ks.composite WHERE token(a, b) > token(1, 'x')")).To(BeEmpty())
+
+		expectInvalid(e, "SELECT * FROM ks.composite WHERE token(a, b) > token(1)", "Invalid number of arguments in call to function token: 2 required but 1 provided")
+		expectInvalid(e, "SELECT * FROM ks.t WHERE token(p) > token('a')", `Invalid STRING constant (a) for "p" of type int`)
+		expectInvalid(e, "SELECT * FROM ks.t WHERE token(p) > token(null)", "Invalid null value in condition for column partition key token")
+	})
+
+	It("validates token relations", func() {
+		exec(e, "CREATE TABLE ks.composite (a int, b int, PRIMARY KEY ((a, b)))")
+
+		expectInvalid(e, "SELECT * FROM ks.composite WHERE token(b, a) > 0", "The token function arguments must be in the partition key order: a, b")
+		expectInvalid(e, "SELECT * FROM ks.composite WHERE token(a) > 0", "The token() function must be applied to all partition key components or none of them")
+		expectInvalid(e, "SELECT * FROM ks.t WHERE token(p) > 0 AND p = 1", "Columns \"p\" cannot be restricted by both a normal relation and a token relation")
+		expectInvalid(e, "SELECT * FROM ks.t WHERE token(p) > 0 AND token(p) > 1", "More than one restriction was found for the start bound on token(p)")
+	})
+
+	It("lists the partitioner in system.local", func() {
+		Expect(boundColumn("SELECT partitioner FROM system.local WHERE key = 'local'")).To(Equal([]interface{}{partitioner.Name()}))
+	})
+})
@@ -0,0 +1,85 @@
+package engine_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/cql/types"
+	"github.com/st3v/fakesandra/engine"
+)
+
+var _ = Describe("TTL", func() {
+	var e *engine.Engine
+
+	BeforeEach(func() {
+		e = engine.New()
+		e.Clock().Set(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+
+		exec(e, "CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}")
+		exec(e, "CREATE TABLE ks.t (p text, c text, v text, w text, PRIMARY KEY (p, c))")
+	})
+
+	It("expires cells and rows written with a TTL", func() {
+		exec(e, "INSERT INTO ks.t (p, c, v) VALUES ('a', 'x', 'v') USING TTL 60")
+		exec(e, "UPDATE ks.t USING TTL 120 SET w = 'w' WHERE p = 'a' AND c = 'x'")
+		Expect(values(e, "SELECT v, w FROM ks.t")).To(Equal([][]interface{}{{"v", "w"}}))
+
+		e.Clock().Advance(time.Minute)
+		Expect(values(e, "SELECT c, v, w FROM ks.t")).To(Equal([][]interface{}{{"x", nil, "w"}}))
+
+		e.Clock().Advance(time.Minute)
+		Expect(values(e, "SELECT * FROM ks.t")).To(BeEmpty())
+	})
+
+	It("keeps rows whose marker has not expired", func() {
+		exec(e, "INSERT INTO ks.t (p, c) VALUES ('a', 'x')")
+		exec(e, "UPDATE ks.t USING TTL 10 SET v = 'v' WHERE p = 'a' AND c = 'x'")
+
+		e.Clock().Advance(time.Hour)
+		Expect(values(e, "SELECT c, v FROM ks.t")).To(Equal([][]interface{}{{"x", nil}}))
+	})
+
+	It("lets an expired cell win over a live cell with the same timestamp", func() {
+		exec(e, "INSERT INTO ks.t (p, c, v) VALUES ('a', 'x', 'v') USING TIMESTAMP 1 AND TTL 10")
+		e.Clock().Advance(time.Minute)
+		exec(e, "INSERT INTO ks.t (p, c, v) VALUES ('a', 'x', 'z') USING TIMESTAMP 1")
+		Expect(values(e, "SELECT v FROM ks.t")).To(BeEmpty())
+	})
+
+	It("applies the default_time_to_live of the table", func() {
+		exec(e, "CREATE TABLE ks.d (p text PRIMARY KEY, v text) WITH default_time_to_live = 30")
+		exec(e, "INSERT INTO ks.d (p, v) VALUES ('a', 'v')")
+		exec(e, "INSERT INTO ks.d (p, v) VALUES ('b', 'v') USING TTL 0")
+		Expect(values(e, "SELECT p, ttl(v) FROM ks.d")).To(ConsistOf([]interface{}{"a", int32(30)}, []interface{}{"b", nil}))
+
+		e.Clock().Advance(30 * time.Second)
+		Expect(values(e, "SELECT p FROM ks.d")).To(Equal([][]interface{}{{"b"}}))
+	})
+
+	It("selects ttl() and writetime()", func() {
+		exec(e, "INSERT INTO ks.t (p, c, v, w) VALUES ('a', 'x', 'v', 'w') USING TTL 100 AND TIMESTAMP 42")
+		e.Clock().Advance(40 * time.Second)
+
+		rs := rows(e, "SELECT ttl(v), writetime(v) AS wt, ttl(w) FROM ks.t")
+		Expect(rs.Columns[0].Name).To(Equal("ttl(v)"))
+		Expect(rs.Columns[0].Type).To(Equal(types.Native(types.Int)))
+		Expect(rs.Columns[1].Name).To(Equal("wt"))
+		Expect(rs.Columns[1].Type).To(Equal(types.Native(types.Bigint)))
+		Expect(values(e, "SELECT ttl(v), writetime(v) FROM ks.t")).To(Equal([][]interface{}{{int32(60), int64(42)}}))
+	})
+
+	It("rejects invalid TTLs", func() {
+		expectInvalid(e, "INSERT INTO ks.t (p, c) VALUES ('a', 'x') USING TTL -1", "A TTL must be greater or equal to 0, but was -1")
+		expectInvalid(e, "INSERT INTO ks.t (p, c) VALUES ('a', 'x') USING TTL 630720001", "ttl is too large. requested (630720001) maximum (630720000)")
+		expectInvalid(e, "DELETE FROM ks.t USING TTL 1 WHERE p = 'a'", "TTL attribute is not allowed for deletes")
+	})
+
+	It("rejects ttl() and writetime() on primary key columns and collections", func() {
+		exec(e, "ALTER TABLE ks.t ADD l list<int>")
+		expectInvalid(e, "SELECT ttl(c) FROM ks.t", "Cannot use selection function ttl on PRIMARY KEY part c")
+		expectInvalid(e, "SELECT writetime(p) FROM ks.t", "Cannot use selection function writeTime on PRIMARY KEY part p")
+		expectInvalid(e, "SELECT writetime(l) FROM ks.t", "Cannot use selection function writeTime on collections")
+	})
+})
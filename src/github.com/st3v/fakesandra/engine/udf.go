@@ -0,0 +1,703 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/st3v/fakesandra/cql/parser"
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+// Function is a user-defined function of the schema catalog. Its body is
+// kept as written but never run. Calls execute the Go implementation
+// registered with RegisterFunction instead.
+type Function struct {
+	Keyspace          string
+	Name              string
+	ArgNames          []string
+	ArgTypes          []types.Type
+	ReturnType        types.Type
+	CalledOnNullInput bool
+	Language          string
+	Body              string
+}
+
+// String returns the signature of f, e.g. ks.f : (int) -> text.
+func (f *Function) String() string {
+	return udf(f).signature()
+}
+
+// Aggregate is a user-defined aggregate of the schema catalog. It folds the
+// rows of a group into a state of type StateType, starting with InitCond,
+// by calling StateFunc and turns the final state into the result by calling
+// FinalFunc, if any. Both are user-defined functions of the keyspace.
+type Aggregate struct {
+	Keyspace   string
+	Name       string
+	ArgTypes   []types.Type
+	StateFunc  string
+	StateType  types.Type
+	FinalFunc  string
+	InitCond   []byte
+	ReturnType types.Type
+}
+
+// String returns the signature of a, e.g. ks.a : (int) -> bigint.
+func (a *Aggregate) String() string {
+	f := &function{keyspace: a.Keyspace, name: a.Name, args: a.ArgTypes, returns: a.ReturnType}
+	return f.signature()
+}
+
+// Functions returns the user-defined functions of the keyspace sorted by
+// name.
+func (ks *Keyspace) Functions() []*Function {
+	functions := []*Function{}
+	for _, overloads := range ks.functions {
+		functions = append(functions, overloads...)
+	}
+	sort.SliceStable(functions, func(i, j int) bool {
+		return functions[i].Name < functions[j].Name
+	})
+	return functions
+}
+
+// Aggregates returns the user-defined aggregates of the keyspace sorted by
+// name.
+func (ks *Keyspace) Aggregates() []*Aggregate {
+	aggregates := []*Aggregate{}
+	for _, overloads := range ks.aggregates {
+		aggregates = append(aggregates, overloads...)
+	}
+	sort.SliceStable(aggregates, func(i, j int) bool {
+		return aggregates[i].Name < aggregates[j].Name
+	})
+	return aggregates
+}
+
+// function returns the user-defined function with the given name and
+// argument types.
+func (ks *Keyspace) function(name string, args []types.Type) (*Function, bool) {
+	for _, f := range ks.functions[name] {
+		if sameTypes(f.ArgTypes, args) {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// aggregate returns the user-defined aggregate with the given name and
+// argument types.
+func (ks *Keyspace) aggregate(name string, args []types.Type) (*Aggregate, bool) {
+	for _, a := range ks.aggregates[name] {
+		if sameTypes(a.ArgTypes, args) {
+			return a, true
+		}
+	}
+	return nil, false
+}
+
+func sameTypes(a, b []types.Type) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Freeze().Equal(b[i].Freeze()) {
+			return false
+		}
+	}
+	return true
+}
+
+// userFunctions returns the user-defined functions and aggregates with the
+// given name as overloads to resolve calls with.
+func (ks *Keyspace) userFunctions(name string) []*function {
+	overloads := []*function{}
+	for _, f := range ks.functions[name] {
+		overloads = append(overloads, udf(f))
+	}
+	for _, a := range ks.aggregates[name] {
+		overloads = append(overloads, ks.uda(a))
+	}
+	return overloads
+}
+
+// udf returns the function executing the user-defined function f.
+func udf(f *Function) *function {
+	return &function{
+		keyspace:          f.Keyspace,
+		name:              f.Name,
+		args:              f.ArgTypes,
+		returns:           f.ReturnType,
+		calledOnNullInput: f.CalledOnNullInput,
+		execute: func(e *Engine, args [][]byte) ([]byte, error) {
+			return e.callFunction(f, args)
+		},
+	}
+}
+
+// uda returns the function executing the user-defined aggregate a.
+func (ks *Keyspace) uda(a *Aggregate) *function {
+	state, _ := ks.function(a.StateFunc, append([]types.Type{a.StateType}, a.ArgTypes...))
+	final, _ := ks.function(a.FinalFunc, []types.Type{a.StateType})
+
+	return &function{
+		keyspace: a.Keyspace,
+		name:     a.Name,
+		args:     a.ArgTypes,
+		returns:  a.ReturnType,
+		aggregate: func() accumulator {
+			acc := &udaAccumulator{state: udf(state), value: a.InitCond}
+			if final != nil {
+				acc.final = udf(final)
+			}
+			return acc
+		},
+	}
+}
+
+// udaAccumulator computes a user-defined aggregate.
+type udaAccumulator struct {
+	state *function
+	final *function
+	value []byte
+}
+
+func (a *udaAccumulator) add(e *Engine, args [][]byte) error {
+	v, err := a.state.call(e, append([][]byte{a.value}, args...))
+	if err != nil {
+		return err
+	}
+	a.value = v
+	return nil
+}
+
+func (a *udaAccumulator) result(e *Engine) ([]byte, error) {
+	if a.final == nil {
+		return a.value, nil
+	}
+	return a.final.call(e, [][]byte{a.value})
+}
+
+// Implementation is the Go code of a user-defined function. It is called
+// with the arguments decoded as by types.Unmarshal, null arguments being
+// nil, and returns a value types.Marshal can encode as the return type of
+// the function or nil for null. Errors are reported to the client as
+// function failures.
+type Implementation func(args ...interface{}) (interface{}, error)
+
+// implementation is a registered Implementation along with the argument
+// types it was registered for.
+type implementation struct {
+	args []parser.Type
+	fn   Implementation
+}
+
+// RegisterFunction defines the user-defined function keyspace.name with the
+// given CQL argument and return types, e.g. int or list<text>, and registers
+// fn as its Go implementation. The function is defined as if created by
+// CREATE FUNCTION ... CALLED ON NULL INPUT, so no DDL is needed, but the
+// keyspace must exist. If the function has been created with CREATE
+// FUNCTION before, its definition is kept and only fn is registered.
+// Functions without an implementation fail when they are called.
+//
+// There is no equivalent for aggregates, as they are not implemented in Go
+// themselves. Define them with CREATE AGGREGATE on top of registered state
+// and final functions.
+func (e *Engine) RegisterFunction(keyspace, name string, argTypes []string, returnType string, fn Implementation) error {
+	stmt := &parser.CreateFunction{
+		Function:          parser.Name{Keyspace: keyspace, Name: name},
+		IfNotExists:       true,
+		CalledOnNullInput: true,
+		Language:          "java",
+	}
+
+	args := make([]parser.Type, len(argTypes))
+	for i, a := range argTypes {
+		t, err := parser.ParseType(a)
+		if err != nil {
+			return fmt.Errorf("invalid type %q of argument %d: %s", a, i, err)
+		}
+		args[i] = t
+		stmt.Args = append(stmt.Args, parser.ColumnDef{Name: fmt.Sprintf("arg%d", i), Type: t})
+	}
+
+	var err error
+	if stmt.Returns, err = parser.ParseType(returnType); err != nil {
+		return fmt.Errorf("invalid return type %q: %s", returnType, err)
+	}
+
+	if _, err := e.createFunction(e.newRequest(proto.NewSession(), nil), stmt); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.checkReturnType(stmt); err != nil {
+		return err
+	}
+
+	key := keyspace + "." + name
+	impl := &implementation{args: args, fn: fn}
+	for i, other := range e.implementations[key] {
+		if typeNames(other.args) == typeNames(args) {
+			e.implementations[key][i] = impl
+			return nil
+		}
+	}
+	e.implementations[key] = append(e.implementations[key], impl)
+	return nil
+}
+
+// checkReturnType verifies that the function defined in the schema for the
+// signature of s returns the type s does. It fails for functions created
+// with CREATE FUNCTION that do not match a registered implementation.
+func (e *Engine) checkReturnType(s *parser.CreateFunction) error {
+	ks, found := e.keyspaces[s.Function.Keyspace]
+	if !found {
+		return invalid("Keyspace %s does not exist", s.Function.Keyspace)
+	}
+
+	args := make([]parser.Type, len(s.Args))
+	for i, a := range s.Args {
+		args[i] = a.Type
+	}
+	argTypes, err := functionTypes(ks, args)
+	if err != nil {
+		return err
+	}
+	returns, err := functionType(ks, s.Returns, "return type")
+	if err != nil {
+		return err
+	}
+
+	f, found := ks.function(s.Function.Name, argTypes)
+	if !found {
+		return invalid("Function %s does not exist", callSignature(ks.Name, s.Function.Name, argTypes))
+	}
+	if !f.ReturnType.Equal(returns) {
+		return invalid("Function %s already exists with return type %s", f, f.ReturnType)
+	}
+	return nil
+}
+
+func typeNames(ts []parser.Type) string {
+	names := make([]string, len(ts))
+	for i, t := range ts {
+		names[i] = t.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+// implementation returns the Go implementation registered for f.
+func (e *Engine) implementation(f *Function) (Implementation, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	ks, found := e.keyspaces[f.Keyspace]
+	if !found {
+		return nil, false
+	}
+
+next:
+	for _, impl := range e.implementations[f.Keyspace+"."+f.Name] {
+		args := make([]types.Type, len(impl.args))
+		for i, a := range impl.args {
+			t, err := resolveType(ks, a)
+			if err != nil {
+				continue next
+			}
+			args[i] = t
+		}
+		if sameTypes(args, f.ArgTypes) {
+			return impl.fn, true
+		}
+	}
+	return nil, false
+}
+
+// callFunction executes the user-defined function f.
+func (e *Engine) callFunction(f *Function, args [][]byte) (result []byte, err error) {
+	argTypes := make([]string, len(f.ArgTypes))
+	for i, t := range f.ArgTypes {
+		argTypes[i] = t.String()
+	}
+
+	fail := func(cause interface{}) error {
+		return &proto.FunctionFailureError{
+			Keyspace: f.Keyspace,
+			Function: f.Name,
+			ArgTypes: argTypes,
+			Message:  fmt.Sprintf("execution of '%s.%s[%s]' failed: %s", f.Keyspace, f.Name, strings.Join(argTypes, ", "), cause),
+		}
+	}
+
+	impl, found := e.implementation(f)
+	if !found {
+		return nil, fail("no Go implementation registered")
+	}
+
+	values := make([]interface{}, len(args))
+	for i, a := range args {
+		if a == nil {
+			continue
+		}
+		if values[i], err = types.Unmarshal(f.ArgTypes[i], a); err != nil {
+			return nil, fail(err)
+		}
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			result, err = nil, fail(p)
+		}
+	}()
+
+	v, err := impl(values...)
+	if err != nil {
+		return nil, fail(err)
+	}
+	if v == nil {
+		return nil, nil
+	}
+
+	if result, err = types.Marshal(f.ReturnType, v); err != nil {
+		return nil, fail(err)
+	}
+	return result, nil
+}
+
+// functionType resolves the type of an argument or the return type of a
+// user-defined function or aggregate. Like in Cassandra, they are frozen
+// implicitly and must not be frozen explicitly.
+func functionType(ks *Keyspace, t parser.Type, what string) (types.Type, error) {
+	if t.Name == "frozen" && !t.Custom {
+		return types.Type{}, invalid("The function %s should not be frozen; remove the frozen<> modifier", what)
+	}
+
+	typ, err := resolveType(ks, t)
+	if err != nil {
+		return types.Type{}, err
+	}
+	return typ.Freeze(), nil
+}
+
+func functionTypes(ks *Keyspace, ts []parser.Type) ([]types.Type, error) {
+	args := make([]types.Type, len(ts))
+	for i, t := range ts {
+		var err error
+		if args[i], err = functionType(ks, t, "arguments"); err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+// createFunction executes CREATE FUNCTION.
+func (e *Engine) createFunction(r *request, s *parser.CreateFunction) (result.Result, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ks, err := e.modifiableKeyspace(r, s.Function)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.OrReplace && s.IfNotExists {
+		return nil, invalid("Cannot use both 'OR REPLACE' and 'IF NOT EXISTS' directives")
+	}
+
+	f := &Function{
+		Keyspace:          ks.Name,
+		Name:              s.Function.Name,
+		CalledOnNullInput: s.CalledOnNullInput,
+		Language:          s.Language,
+		Body:              s.Body,
+	}
+
+	seen := map[string]bool{}
+	for _, a := range s.Args {
+		if seen[a.Name] {
+			names := []string{}
+			for _, a := range s.Args {
+				names = append(names, a.Name)
+			}
+			return nil, invalid("duplicate argument names for given function %s.%s with argument names %s", ks.Name, f.Name, strings.Join(names, ", "))
+		}
+		seen[a.Name] = true
+
+		t, err := functionType(ks, a.Type, "arguments")
+		if err != nil {
+			return nil, err
+		}
+		f.ArgNames = append(f.ArgNames, a.Name)
+		f.ArgTypes = append(f.ArgTypes, t)
+	}
+
+	if f.ReturnType, err = functionType(ks, s.Returns, "return type"); err != nil {
+		return nil, err
+	}
+
+	change := result.Created
+	overloads := append([]*Function{}, ks.functions[f.Name]...)
+	if old, found := ks.function(f.Name, f.ArgTypes); found {
+		switch {
+		case s.IfNotExists:
+			return result.Void{}, nil
+		case !s.OrReplace:
+			return nil, invalid("Function %s already exists", old)
+		case !old.ReturnType.Equal(f.ReturnType):
+			return nil, invalid("Cannot replace function %s, the new return type %s is not compatible with the return type %s of existing function", old, f.ReturnType, old.ReturnType)
+		}
+
+		for i, o := range overloads {
+			if o == old {
+				overloads = append(overloads[:i], overloads[i+1:]...)
+				break
+			}
+		}
+		change = result.Updated
+	}
+
+	ks = ks.clone()
+	ks.functions[f.Name] = append(overloads, f)
+	e.keyspaces[ks.Name] = ks
+
+	return functionChange(change, result.TargetFunction, ks.Name, f.Name, f.ArgTypes), nil
+}
+
+// dropFunction executes DROP FUNCTION. Functions used by aggregates cannot
+// be dropped.
+func (e *Engine) dropFunction(r *request, s *parser.DropFunction) (result.Result, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ks, err := e.modifiableKeyspace(r, s.Function)
+	if err != nil {
+		return nil, err
+	}
+
+	name := ks.Name + "." + s.Function.Name
+	matching := ks.functions[s.Function.Name]
+	if s.ArgTypes != nil {
+		args, err := functionTypes(ks, s.ArgTypes)
+		if err != nil {
+			return nil, err
+		}
+
+		matching = nil
+		if f, found := ks.function(s.Function.Name, args); found {
+			matching = []*Function{f}
+		}
+	}
+
+	switch {
+	case len(matching) == 0 && s.IfExists:
+		return result.Void{}, nil
+	case len(matching) == 0 && s.ArgTypes == nil:
+		return nil, invalid("Cannot drop non existing function '%s'", name)
+	case len(matching) == 0:
+		return nil, invalid("Cannot drop non existing function '%s' matching argument types [%s]", name, typeNames(s.ArgTypes))
+	case len(matching) > 1:
+		return nil, invalid("'DROP FUNCTION %s' matches multiple function definitions; specify the argument types by issuing a statement like 'DROP FUNCTION %s (type, type, ...)'. Hint: use cqlsh 'DESCRIBE FUNCTION %s' command to find all overloads", name, name, name)
+	}
+
+	f := matching[0]
+	for _, a := range ks.Aggregates() {
+		state, _ := ks.function(a.StateFunc, append([]types.Type{a.StateType}, a.ArgTypes...))
+		final, _ := ks.function(a.FinalFunc, []types.Type{a.StateType})
+		if state == f || final == f {
+			return nil, invalid("Function %s still referenced by %s", f, a)
+		}
+	}
+
+	ks = ks.clone()
+	overloads := ks.functions[f.Name]
+	for i, o := range overloads {
+		if o == f {
+			ks.functions[f.Name] = append(overloads[:i], overloads[i+1:]...)
+			break
+		}
+	}
+	if len(ks.functions[f.Name]) == 0 {
+		delete(ks.functions, f.Name)
+	}
+	e.keyspaces[ks.Name] = ks
+
+	return functionChange(result.Dropped, result.TargetFunction, ks.Name, f.Name, f.ArgTypes), nil
+}
+
+// createAggregate executes CREATE AGGREGATE.
+func (e *Engine) createAggregate(r *request, s *parser.CreateAggregate) (result.Result, error) {
+	// The initial state is bound before the schema is locked as binding
+	// may call functions.
+	initCond, err := e.initCond(r, s)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ks, err := e.modifiableKeyspace(r, s.Aggregate)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.OrReplace && s.IfNotExists {
+		return nil, invalid("Cannot use both 'OR REPLACE' and 'IF NOT EXISTS' directives")
+	}
+
+	a := &Aggregate{Keyspace: ks.Name, Name: s.Aggregate.Name, StateFunc: s.StateFunc, FinalFunc: s.FinalFunc, InitCond: initCond}
+	if a.ArgTypes, err = functionTypes(ks, s.ArgTypes); err != nil {
+		return nil, err
+	}
+	if a.StateType, err = functionType(ks, s.StateType, "state type"); err != nil {
+		return nil, err
+	}
+
+	stateArgs := append([]types.Type{a.StateType}, a.ArgTypes...)
+	state, found := ks.function(a.StateFunc, stateArgs)
+	if !found {
+		return nil, invalid("State function %s does not exist", callSignature(ks.Name, a.StateFunc, stateArgs))
+	}
+	if !state.ReturnType.Equal(a.StateType) {
+		return nil, invalid("State function %s return type must be the same as the first argument type - check STYPE, argument and return types", state)
+	}
+
+	a.ReturnType = a.StateType
+	if a.FinalFunc != "" {
+		final, found := ks.function(a.FinalFunc, []types.Type{a.StateType})
+		if !found {
+			return nil, invalid("Final function %s does not exist", callSignature(ks.Name, a.FinalFunc, []types.Type{a.StateType}))
+		}
+		a.ReturnType = final.ReturnType
+	}
+
+	change := result.Created
+	overloads := append([]*Aggregate{}, ks.aggregates[a.Name]...)
+	if old, found := ks.aggregate(a.Name, a.ArgTypes); found {
+		switch {
+		case s.IfNotExists:
+			return result.Void{}, nil
+		case !s.OrReplace:
+			return nil, invalid("Aggregate %s already exists", old)
+		case !old.ReturnType.Equal(a.ReturnType):
+			return nil, invalid("Cannot replace aggregate %s, the new return type %s is not compatible with the return type %s of existing function", old, a.ReturnType, old.ReturnType)
+		}
+
+		for i, o := range overloads {
+			if o == old {
+				overloads = append(overloads[:i], overloads[i+1:]...)
+				break
+			}
+		}
+		change = result.Updated
+	}
+
+	ks = ks.clone()
+	ks.aggregates[a.Name] = append(overloads, a)
+	e.keyspaces[ks.Name] = ks
+
+	return functionChange(change, result.TargetAggregate, ks.Name, a.Name, a.ArgTypes), nil
+}
+
+// initCond binds the INITCOND of an aggregate as a value of its state
+// type. It is null if there is none.
+func (e *Engine) initCond(r *request, s *parser.CreateAggregate) ([]byte, error) {
+	if s.InitCond == nil {
+		return nil, nil
+	}
+
+	e.mu.RLock()
+	ks, err := e.modifiableKeyspace(r, s.Aggregate)
+	e.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	stateType, err := functionType(ks, s.StateType, "state type")
+	if err != nil {
+		return nil, err
+	}
+	return r.bindAs(s.InitCond, "INITCOND", stateType)
+}
+
+// dropAggregate executes DROP AGGREGATE.
+func (e *Engine) dropAggregate(r *request, s *parser.DropAggregate) (result.Result, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ks, err := e.modifiableKeyspace(r, s.Aggregate)
+	if err != nil {
+		return nil, err
+	}
+
+	name := ks.Name + "." + s.Aggregate.Name
+	matching := ks.aggregates[s.Aggregate.Name]
+	if s.ArgTypes != nil {
+		args, err := functionTypes(ks, s.ArgTypes)
+		if err != nil {
+			return nil, err
+		}
+
+		matching = nil
+		if a, found := ks.aggregate(s.Aggregate.Name, args); found {
+			matching = []*Aggregate{a}
+		}
+	}
+
+	switch {
+	case len(matching) == 0 && s.IfExists:
+		return result.Void{}, nil
+	case len(matching) == 0 && s.ArgTypes == nil:
+		return nil, invalid("Cannot drop non existing aggregate '%s'", name)
+	case len(matching) == 0:
+		return nil, invalid("Cannot drop non existing aggregate '%s' matching argument types [%s]", name, typeNames(s.ArgTypes))
+	case len(matching) > 1:
+		return nil, invalid("'DROP AGGREGATE %s' matches multiple function definitions; specify the argument types by issuing a statement like 'DROP AGGREGATE %s (type, type, ...)'. Hint: use cqlsh 'DESCRIBE AGGREGATE %s' command to find all overloads", name, name, name)
+	}
+
+	a := matching[0]
+	ks = ks.clone()
+	overloads := ks.aggregates[a.Name]
+	for i, o := range overloads {
+		if o == a {
+			ks.aggregates[a.Name] = append(overloads[:i], overloads[i+1:]...)
+			break
+		}
+	}
+	if len(ks.aggregates[a.Name]) == 0 {
+		delete(ks.aggregates, a.Name)
+	}
+	e.keyspaces[ks.Name] = ks
+
+	return functionChange(result.Dropped, result.TargetAggregate, ks.Name, a.Name, a.ArgTypes), nil
+}
+
+// callSignature formats a function call by argument types, e.g.
+// ks.f(int, text).
+func callSignature(keyspace, name string, args []types.Type) string {
+	names := make([]string, len(args))
+	for i, a := range args {
+		names[i] = a.String()
+	}
+	return keyspace + "." + name + "(" + strings.Join(names, ", ") + ")"
+}
+
+func functionChange(change, target, keyspace, name string, args []types.Type) result.SchemaChange {
+	names := make([]string, len(args))
+	for i, a := range args {
+		names[i] = a.String()
+	}
+	return result.SchemaChange{
+		Change:   change,
+		Target:   target,
+		Keyspace: keyspace,
+		Name:     name,
+		Args:     names,
+	}
+}
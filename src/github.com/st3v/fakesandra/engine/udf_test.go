@@ -0,0 +1,121 @@
+package engine_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/engine"
+)
+
+var _ = Describe("User-defined functions", func() {
+	var e *engine.Engine
+
+	BeforeEach(func() {
+		e = engine.New()
+		exec(e, "CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}")
+		exec(e, "CREATE TABLE ks.t (p int, c int, v int, PRIMARY KEY (p, c))")
+		exec(e, "INSERT INTO ks.t (p, c, v) VALUES (1, 1, 3)")
+		exec(e, "INSERT INTO ks.t (p, c, v) VALUES (1, 2, 4)")
+		exec(e, "INSERT INTO ks.t (p, c) VALUES (1, 3)")
+
+		exec(e, "CREATE FUNCTION ks.double (x int) RETURNS NULL ON NULL INPUT RETURNS int LANGUAGE java AS 'return x * 2;'")
+		Expect(e.RegisterFunction("ks", "double", []string{"int"}, "int", func(args ...interface{}) (interface{}, error) {
+			return args[0].(int32) * 2, nil
+		})).To(Succeed())
+	})
+
+	It("calls the Go implementation", func() {
+		res, err := e.Execute("SELECT ks.double(v) FROM ks.t WHERE p = 1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.(*result.Rows).Columns[0].Name).To(Equal("ks.double(v)"))
+
+		Expect(column(e, "SELECT ks.double(v) FROM ks.t WHERE p = 1")).To(Equal([]interface{}{int32(6), int32(8), nil}))
+
+		exec(e, "INSERT INTO ks.t (p, c, v) VALUES (2, 1, ks.double(21))")
+		Expect(column(e, "SELECT v FROM ks.t WHERE p = 2")).To(Equal([]interface{}{int32(42)}))
+	})
+
+	It("defines registered functions in the schema", func() {
+		Expect(e.RegisterFunction("ks", "orzero", []string{"int"}, "int", func(args ...interface{}) (interface{}, error) {
+			if args[0] == nil {
+				return int32(0), nil
+			}
+			return args[0], nil
+		})).To(Succeed())
+
+		Expect(column(e, "SELECT ks.orzero(v) FROM ks.t WHERE p = 1")).To(Equal([]interface{}{int32(3), int32(4), int32(0)}))
+		Expect(values(e, "SELECT argument_names, argument_types, return_type, called_on_null_input FROM system_schema.functions WHERE keyspace_name = 'ks' AND function_name = 'orzero'")).To(Equal([][]interface{}{
+			{[]interface{}{"arg0"}, []interface{}{"int"}, "int", true},
+		}))
+		expectInvalid(e, "CREATE FUNCTION ks.orzero (x int) CALLED ON NULL INPUT RETURNS int LANGUAGE java AS ''", "Function ks.orzero : (int) -> int already exists")
+
+		Expect(e.RegisterFunction("ks", "orzero", []string{"int"}, "int", func(args ...interface{}) (interface{}, error) {
+			return int32(-1), nil
+		})).To(Succeed())
+		Expect(column(e, "SELECT ks.orzero(v) FROM ks.t WHERE p = 1")).To(Equal([]interface{}{int32(-1), int32(-1), int32(-1)}))
+	})
+
+	It("rejects registrations that do not match the schema", func() {
+		noop := func(args ...interface{}) (interface{}, error) { return nil, nil }
+
+		Expect(e.RegisterFunction("ks", "double", []string{"int"}, "text", noop)).To(MatchError("Function ks.double : (int) -> int already exists with return type int"))
+		Expect(e.RegisterFunction("nope", "f", []string{"int"}, "int", noop)).To(MatchError("Keyspace nope does not exist"))
+		Expect(e.RegisterFunction("ks", "f", []string{"lst<int>"}, "int", noop)).To(HaveOccurred())
+		Expect(e.RegisterFunction("ks", "f", []string{"frozen<list<int>>"}, "int", noop)).To(MatchError("The function arguments should not be frozen; remove the frozen<> modifier"))
+	})
+
+	It("reports errors as function failures", func() {
+		Expect(e.RegisterFunction("ks", "fail", []string{"int"}, "int", func(args ...interface{}) (interface{}, error) {
+			return nil, errors.New("boom")
+		})).To(Succeed())
+		exec(e, "CREATE FUNCTION ks.missing (x int) RETURNS NULL ON NULL INPUT RETURNS int LANGUAGE java AS 'return x;'")
+
+		_, err := e.Execute("SELECT ks.fail(v) FROM ks.t WHERE p = 1")
+		Expect(err).To(Equal(&proto.FunctionFailureError{
+			Keyspace: "ks",
+			Function: "fail",
+			ArgTypes: []string{"int"},
+			Message:  "execution of 'ks.fail[int]' failed: boom",
+		}))
+
+		_, err = e.Execute("SELECT ks.missing(v) FROM ks.t WHERE p = 1")
+		Expect(err).To(BeAssignableToTypeOf(&proto.FunctionFailureError{}))
+	})
+
+	It("folds rows with user-defined aggregates", func() {
+		Expect(e.RegisterFunction("ks", "sumstate", []string{"tuple<int, bigint>", "int"}, "tuple<int, bigint>", func(args ...interface{}) (interface{}, error) {
+			state := args[0].([]interface{})
+			if args[1] == nil {
+				return state, nil
+			}
+			return []interface{}{state[0].(int32) + 1, state[1].(int64) + int64(args[1].(int32))}, nil
+		})).To(Succeed())
+		Expect(e.RegisterFunction("ks", "average", []string{"tuple<int, bigint>"}, "double", func(args ...interface{}) (interface{}, error) {
+			state := args[0].([]interface{})
+			return float64(state[1].(int64)) / float64(state[0].(int32)), nil
+		})).To(Succeed())
+
+		exec(e, "CREATE AGGREGATE ks.mean (int) SFUNC sumstate STYPE tuple<int, bigint> FINALFUNC average INITCOND (0, 0)")
+
+		Expect(column(e, "SELECT ks.mean(v) FROM ks.t WHERE p = 1")).To(Equal([]interface{}{3.5}))
+		Expect(column(e, "SELECT ks.mean(ks.double(v)) FROM ks.t WHERE p = 1")).To(Equal([]interface{}{7.0}))
+
+		expectInvalid(e, "DROP FUNCTION ks.average", "Function ks.average : (tuple<int, bigint>) -> double still referenced by ks.mean : (int) -> double")
+	})
+
+	It("validates function and aggregate definitions", func() {
+		expectInvalid(e, "CREATE FUNCTION ks.double (y int) RETURNS NULL ON NULL INPUT RETURNS int LANGUAGE java AS ''", "Function ks.double : (int) -> int already exists")
+		expectInvalid(e, "CREATE OR REPLACE FUNCTION ks.double (y int) RETURNS NULL ON NULL INPUT RETURNS text LANGUAGE java AS ''", "Cannot replace function ks.double : (int) -> int, the new return type text is not compatible with the return type int of existing function")
+		expectInvalid(e, "CREATE FUNCTION ks.f (x frozen<list<int>>) RETURNS NULL ON NULL INPUT RETURNS int LANGUAGE java AS ''", "The function arguments should not be frozen; remove the frozen<> modifier")
+		expectInvalid(e, "CREATE AGGREGATE ks.a (int) SFUNC nope STYPE int", "State function ks.nope(int, int) does not exist")
+		expectInvalid(e, "DROP FUNCTION ks.nope", "Cannot drop non existing function 'ks.nope'")
+
+		exec(e, "CREATE FUNCTION IF NOT EXISTS ks.double (y int) RETURNS NULL ON NULL INPUT RETURNS int LANGUAGE java AS ''")
+		exec(e, "DROP FUNCTION ks.double (int)")
+		expectInvalid(e, "SELECT ks.double(v) FROM ks.t", "Unknown function ks.double called")
+	})
+})
@@ -0,0 +1,105 @@
+package engine_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/cql/types"
+	"github.com/st3v/fakesandra/engine"
+)
+
+var _ = Describe("User-defined types and tuples", func() {
+	var e *engine.Engine
+
+	// typedValue executes stmt and returns the first column of its first row
+	// and the type of that column.
+	typedValue := func(stmt string) (interface{}, types.Type) {
+		res, err := e.Execute(stmt)
+		Expect(err).NotTo(HaveOccurred())
+
+		rows := res.(*result.Rows)
+		Expect(rows.Data).To(HaveLen(1))
+
+		typ := rows.Columns[0].Type
+		if rows.Data[0][0] == nil {
+			return nil, typ
+		}
+		v, err := types.Unmarshal(typ, rows.Data[0][0])
+		Expect(err).NotTo(HaveOccurred())
+		return v, typ
+	}
+
+	BeforeEach(func() {
+		e = engine.New()
+		exec(e, "CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}")
+		exec(e, "CREATE TYPE ks.money (amount decimal, currency text)")
+		exec(e, "CREATE TYPE ks.address (street text, zip int, price frozen<money>)")
+		exec(e, "CREATE TABLE ks.t (p int PRIMARY KEY, home address, work frozen<address>, pos tuple<int, text, frozen<list<int>>>)")
+	})
+
+	It("round-trips nested and frozen values", func() {
+		exec(e, "INSERT INTO ks.t (p, work, pos) VALUES (1, {street: 'Main', price: {amount: 1.5, currency: 'EUR'}}, (1, 'a', [2, 3]))")
+
+		work, typ := typedValue("SELECT work FROM ks.t WHERE p = 1")
+		Expect(typ.Keyspace).To(Equal("ks"))
+		Expect(typ.Name).To(Equal("address"))
+		Expect(typ.Fields).To(Equal([]string{"street", "zip", "price"}))
+		Expect(work).To(HaveKeyWithValue("street", "Main"))
+		Expect(work).To(HaveKeyWithValue("zip", BeNil()))
+		Expect(work.(map[string]interface{})["price"]).To(HaveKeyWithValue("currency", "EUR"))
+
+		pos, typ := typedValue("SELECT pos FROM ks.t WHERE p = 1")
+		Expect(typ.ID).To(Equal(types.Tuple))
+		Expect(pos).To(Equal([]interface{}{int32(1), "a", []interface{}{int32(2), int32(3)}}))
+	})
+
+	It("selects fields", func() {
+		exec(e, "INSERT INTO ks.t (p, work) VALUES (1, {street: 'Main', zip: 12345})")
+
+		zip, typ := typedValue("SELECT work.zip FROM ks.t WHERE p = 1")
+		Expect(zip).To(Equal(int32(12345)))
+		Expect(typ).To(Equal(types.Native(types.Int)))
+
+		res, err := e.Execute("SELECT work.street FROM ks.t WHERE p = 1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.(*result.Rows).Columns[0].Name).To(Equal("work.street"))
+
+		expectInvalid(e, "SELECT work.nope FROM ks.t", "work of type frozen<address> has no field nope")
+		expectInvalid(e, "SELECT p.x FROM ks.t", "Invalid field selection: p of type int is not a user type")
+	})
+
+	It("updates and deletes fields of non-frozen values individually", func() {
+		exec(e, "INSERT INTO ks.t (p, home) VALUES (1, {street: 'Main', zip: 12345})")
+		exec(e, "UPDATE ks.t SET home.zip = 54321 WHERE p = 1")
+		exec(e, "UPDATE ks.t SET home.price = {amount: 2, currency: 'USD'} WHERE p = 1")
+		exec(e, "DELETE home.street FROM ks.t WHERE p = 1")
+
+		home, _ := typedValue("SELECT home FROM ks.t WHERE p = 1")
+		Expect(home).To(HaveKeyWithValue("street", BeNil()))
+		Expect(home).To(HaveKeyWithValue("zip", int32(54321)))
+
+		exec(e, "UPDATE ks.t SET home = {street: 'Elm'} WHERE p = 1")
+		home, _ = typedValue("SELECT home FROM ks.t WHERE p = 1")
+		Expect(home).To(Equal(map[string]interface{}{"street": "Elm", "zip": nil, "price": nil}))
+	})
+
+	It("reads values written before fields were added", func() {
+		exec(e, "INSERT INTO ks.t (p, home, work) VALUES (1, {street: 'Main'}, {street: 'Main'})")
+		exec(e, "ALTER TYPE ks.address ADD city text")
+		exec(e, "UPDATE ks.t SET home.city = 'Berlin' WHERE p = 1")
+
+		home, _ := typedValue("SELECT home FROM ks.t WHERE p = 1")
+		Expect(home).To(HaveKeyWithValue("city", "Berlin"))
+
+		city, _ := typedValue("SELECT work.city FROM ks.t WHERE p = 1")
+		Expect(city).To(BeNil())
+	})
+
+	It("rejects field operations on frozen and non-UDT columns", func() {
+		expectInvalid(e, "UPDATE ks.t SET work.zip = 1 WHERE p = 1", "Invalid operation (work.zip = 1) for frozen UDT column work")
+		expectInvalid(e, "UPDATE ks.t SET pos.x = 1 WHERE p = 1", "Invalid operation (pos.x = 1) for non-UDT column pos")
+		expectInvalid(e, "UPDATE ks.t SET home.nope = 1 WHERE p = 1", "UDT column home does not have a field named nope")
+		expectInvalid(e, "DELETE work.zip FROM ks.t WHERE p = 1", "Frozen UDT column work does not support field deletions")
+	})
+})
@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"crypto/md5"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+// uuidGenerator generates the UUIDs returned by now() and uuid(). Like
+// Cassandra, it uses a fixed clock sequence and node for timeuuids and
+// never repeats a timestamp, which keeps timeuuids unique and ordered even
+// if the clock stands still. Everything is derived from a seed, so that
+// the same seed and clock yield the same UUIDs.
+type uuidGenerator struct {
+	mu       sync.Mutex
+	rand     *rand.Rand
+	clockSeq uint16
+	node     [6]byte
+
+	// last is the timestamp of the latest timeuuid in 100ns intervals.
+	last int64
+}
+
+func newUUIDGenerator(seed int64) *uuidGenerator {
+	g := &uuidGenerator{rand: rand.New(rand.NewSource(seed))}
+	g.clockSeq = uint16(g.rand.Intn(1 << 14))
+	g.rand.Read(g.node[:])
+	// The multicast bit marks nodes that are not MAC addresses.
+	g.node[0] |= 0x01
+	return g
+}
+
+// timeUUID returns a version 1 UUID for now, or for the timestamp
+// following the one of the previous timeuuid if now is not later.
+func (g *uuidGenerator) timeUUID(now time.Time) types.UUID {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ts := now.UnixNano() / 100
+	if ts <= g.last {
+		ts = g.last + 1
+	}
+	g.last = ts
+
+	return types.TimeUUID(time.Unix(0, ts*100), g.clockSeq, g.node)
+}
+
+// randomUUID returns a version 4 UUID.
+func (g *uuidGenerator) randomUUID() types.UUID {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var u types.UUID
+	g.rand.Read(u[:])
+	u[6] = u[6]&0x0F | 0x40
+	u[8] = u[8]&0x3F | 0x80
+	return u
+}
+
+// nameUUID returns the version 3 UUID for name, like Java's
+// UUID.nameUUIDFromBytes which Cassandra uses for schema versions.
+func nameUUID(name []byte) types.UUID {
+	u := types.UUID(md5.Sum(name))
+	u[6] = u[6]&0x0F | 0x30
+	u[8] = u[8]&0x3F | 0x80
+	return u
+}
@@ -0,0 +1,315 @@
+package engine
+
+import (
+	"encoding/json"
+
+	"github.com/st3v/fakesandra/cql/parser"
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+// request is the context a statement is executed in. Statements of a
+// batch share the batch and its timestamp.
+type request struct {
+	engine  *Engine
+	session *proto.Session
+	query   proto.Query
+	values  [][]byte
+	named   map[string][]byte
+
+	batch          *parser.Batch
+	batchTimestamp int64
+
+	// variables collects the bind variables of a statement that is
+	// prepared rather than executed, by the index of their markers. The
+	// markers are null while the statement is prepared.
+	variables map[int]result.Column
+
+	// preparing is the table the variables being collected belong to.
+	preparing *Table
+}
+
+func (e *Engine) newRequest(session *proto.Session, qry proto.Query) *request {
+	r := &request{engine: e, session: session, query: qry}
+
+	if qry != nil {
+		if named, ok := qry.NamedValues(); ok {
+			r.named = named
+		} else if values, ok := qry.Values(); ok {
+			r.values = values
+		}
+	}
+
+	return r
+}
+
+// marker returns the value bound to m.
+func (r *request) marker(m *parser.BindMarker) ([]byte, error) {
+	if r.variables != nil {
+		return nil, nil
+	}
+
+	if r.named != nil && m.Name != "" {
+		v, found := r.named[m.Name]
+		if !found {
+			return nil, invalid("Missing value for bind marker :%s", m.Name)
+		}
+		return v, nil
+	}
+
+	if r.named != nil || m.Index >= len(r.values) {
+		return nil, invalid("There were fewer bound variables than markers(?) in CQL, missing value for marker %d", m.Index)
+	}
+
+	return r.values[m.Index], nil
+}
+
+// declare records the receiver of m as a bind variable of the statement
+// being prepared, if any. Like in Cassandra, named markers are described by
+// their names.
+func (r *request) declare(m *parser.BindMarker, name string, t types.Type) {
+	if r.variables == nil {
+		return
+	}
+
+	v := result.Column{Name: name, Type: t}
+	if m.Name != "" {
+		v.Name = m.Name
+	}
+	if r.preparing != nil {
+		v.Keyspace, v.Table = r.preparing.Keyspace, r.preparing.Name
+	}
+	r.variables[m.Index] = v
+}
+
+// bind evaluates term as a value of column c.
+func (r *request) bind(term parser.Term, c *Column) ([]byte, error) {
+	return r.bindAs(term, c.Name, c.Type)
+}
+
+// bindAs evaluates term as a value of type t for the receiver with the
+// given name, which is only used in error messages.
+func (r *request) bindAs(term parser.Term, name string, t types.Type) ([]byte, error) {
+	switch x := term.(type) {
+	case *parser.BindMarker:
+		r.declare(x, name, t)
+		b, err := r.marker(x)
+		if err != nil {
+			return nil, err
+		}
+		if b != nil {
+			if _, err := types.Unmarshal(t, b); err != nil {
+				return nil, invalid("Exception while binding column %s: %s", name, err)
+			}
+		}
+		return b, nil
+	case *parser.TypeHint:
+		return r.bindAs(x.Expr, name, t)
+	case *parser.FunctionCall:
+		b, f, err := r.call(x)
+		if err != nil {
+			return nil, err
+		}
+		if !assignableType(t, f.returns) {
+			return nil, invalid("Type error: cannot assign result of function %s (type %s) to %s (type %s)", f.qualifiedName(), f.returns, name, t)
+		}
+		return b, nil
+	}
+
+	v, err := r.value(term, name, t)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := types.Marshal(t, v)
+	if err != nil {
+		return nil, invalid("%s", err)
+	}
+	return b, nil
+}
+
+// value evaluates term into a Go value that can be marshalled as type t.
+func (r *request) value(term parser.Term, name string, t types.Type) (interface{}, error) {
+	switch x := term.(type) {
+	case *parser.Literal:
+		return literalValue(x, name, t)
+	case *parser.BindMarker:
+		r.declare(x, name, t)
+		b, err := r.marker(x)
+		if err != nil || b == nil {
+			return nil, err
+		}
+		v, err := types.Unmarshal(t, b)
+		if err != nil {
+			return nil, invalid("Exception while binding column %s: %s", name, err)
+		}
+		return v, nil
+	case *parser.TypeHint:
+		return r.value(x.Expr, name, t)
+	case *parser.FunctionCall:
+		b, err := r.bindAs(x, name, t)
+		if err != nil || b == nil {
+			return nil, err
+		}
+		return types.Unmarshal(t, b)
+	case *parser.List:
+		if t.ID != types.List {
+			return nil, invalid("Invalid list literal for %s of type %s", name, t)
+		}
+		return r.elems(x.Elems, name, t.Elems[0])
+	case *parser.Set:
+		if t.ID != types.Set {
+			return nil, invalid("Invalid set literal for %s of type %s", name, t)
+		}
+		return r.elems(x.Elems, name, t.Elems[0])
+	case *parser.Map:
+		switch {
+		case len(x.Entries) == 0 && t.ID == types.Set:
+			return []interface{}{}, nil
+		case t.ID != types.Map:
+			return nil, invalid("Invalid map literal for %s of type %s", name, t)
+		}
+		pairs := make([]types.Pair, len(x.Entries))
+		for i, e := range x.Entries {
+			k, err := r.value(e.Key, name, t.Elems[0])
+			if err != nil {
+				return nil, err
+			}
+			v, err := r.value(e.Value, name, t.Elems[1])
+			if err != nil {
+				return nil, err
+			}
+			pairs[i] = types.Pair{Key: k, Value: v}
+		}
+		return pairs, nil
+	case *parser.Tuple:
+		if t.ID != types.Tuple {
+			return nil, invalid("Invalid tuple type literal for %s of type %s", name, t)
+		}
+		if len(x.Elems) > len(t.Elems) {
+			return nil, invalid("Invalid tuple literal for %s: too many elements. Type %s expects %d but got %d", name, t, len(t.Elems), len(x.Elems))
+		}
+		elems := make([]interface{}, len(x.Elems))
+		for i, e := range x.Elems {
+			var err error
+			if elems[i], err = r.value(e, name, t.Elems[i]); err != nil {
+				return nil, err
+			}
+		}
+		return elems, nil
+	case *parser.UserType:
+		if t.ID != types.UDT {
+			return nil, invalid("Invalid user type literal for %s of type %s", name, t)
+		}
+		fields := map[string]interface{}{}
+		for _, f := range x.Fields {
+			i := fieldIndex(t, f.Name)
+			if i < 0 {
+				return nil, invalid("Unknown field '%s' in value of user defined type %s", f.Name, t.Name)
+			}
+			v, err := r.value(f.Value, name, t.Elems[i])
+			if err != nil {
+				return nil, err
+			}
+			fields[f.Name] = v
+		}
+		return fields, nil
+	}
+
+	return nil, invalid("Invalid value %s for %s of type %s", term, name, t)
+}
+
+func (r *request) elems(terms []parser.Term, name string, t types.Type) ([]interface{}, error) {
+	values := make([]interface{}, len(terms))
+	for i, term := range terms {
+		v, err := r.value(term, name, t)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			return nil, invalid("null is not supported inside collections")
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func fieldIndex(t types.Type, name string) int {
+	for i, f := range t.Fields {
+		if f == name {
+			return i
+		}
+	}
+	return -1
+}
+
+var literalKindNames = map[parser.LiteralKind]string{
+	parser.StringLiteral:   "STRING",
+	parser.IntegerLiteral:  "INTEGER",
+	parser.FloatLiteral:    "FLOAT",
+	parser.BooleanLiteral:  "BOOLEAN",
+	parser.UUIDLiteral:     "UUID",
+	parser.BlobLiteral:     "HEX",
+	parser.DurationLiteral: "DURATION",
+}
+
+// literalTypes lists the types each kind of constant can be assigned to.
+var literalTypes = map[parser.LiteralKind][]types.ID{
+	parser.StringLiteral:   {types.Ascii, types.Varchar, types.Timestamp, types.Date, types.Time, types.Inet},
+	parser.IntegerLiteral:  {types.Bigint, types.Counter, types.Decimal, types.Double, types.Float, types.Int, types.Smallint, types.Tinyint, types.Varint, types.Timestamp, types.Date, types.Time},
+	parser.FloatLiteral:    {types.Decimal, types.Double, types.Float},
+	parser.BooleanLiteral:  {types.Boolean},
+	parser.UUIDLiteral:     {types.Uuid, types.Timeuuid},
+	parser.BlobLiteral:     {types.Blob},
+	parser.DurationLiteral: {types.Duration},
+}
+
+// literalValue converts a constant into a Go value that can be marshalled
+// as type t, if Cassandra accepts the constant for t.
+func literalValue(l *parser.Literal, name string, t types.Type) (interface{}, error) {
+	if l.Kind == parser.NullLiteral {
+		return nil, nil
+	}
+
+	compatible := t.ID == types.Custom && l.Kind == parser.BlobLiteral
+	for _, id := range literalTypes[l.Kind] {
+		compatible = compatible || id == t.ID
+	}
+
+	if !compatible {
+		return nil, invalid(`Invalid %s constant (%s) for "%s" of type %s`, literalKindNames[l.Kind], l.Value, name, t)
+	}
+
+	switch l.Kind {
+	case parser.IntegerLiteral, parser.FloatLiteral:
+		return json.Number(l.Value), nil
+	case parser.BooleanLiteral:
+		return l.Value == "true", nil
+	case parser.DurationLiteral:
+		d, err := types.ParseDuration(l.Value)
+		if err != nil {
+			return nil, invalid("%s", err)
+		}
+		return d, nil
+	}
+
+	return l.Value, nil
+}
+
+// bindInt evaluates term as an int, e.g. for LIMIT.
+func (r *request) bindInt(term parser.Term, name string) (int32, error) {
+	b, err := r.bindAs(term, name, types.Native(types.Int))
+	if err != nil {
+		return 0, err
+	}
+	if b == nil {
+		return 0, invalid("Invalid null value of %s", name)
+	}
+
+	v, err := types.Unmarshal(types.Native(types.Int), b)
+	if err != nil {
+		return 0, invalid("%s", err)
+	}
+	return v.(int32), nil
+}
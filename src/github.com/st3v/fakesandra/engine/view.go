@@ -0,0 +1,621 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/st3v/fakesandra/cql/parser"
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+// View describes how a materialized view is derived from its base table.
+// Views are tables with View set. Their rows are never written directly,
+// the engine derives them from the base table whenever it changes.
+type View struct {
+	Base string
+
+	// IncludeAll is set for views selecting all columns of the base table,
+	// which then also include columns added to the base table later on.
+	IncludeAll bool
+
+	// Where is the WHERE clause of the view. It is split into the columns
+	// restricted by IS NOT NULL and the restrictions on the base table the
+	// other relations make up.
+	Where   []parser.Relation
+	notNull []string
+	filter  *restrictions
+}
+
+// WhereClause returns the WHERE clause of the view as listed in
+// system_schema.views.
+func (v *View) WhereClause() string {
+	clauses := make([]string, len(v.Where))
+	for i, rel := range v.Where {
+		if rel.Op == parser.IsNot {
+			clauses[i] = fmt.Sprintf("%s IS NOT NULL", rel.Left)
+			continue
+		}
+		clauses[i] = rel.String()
+	}
+	return strings.Join(clauses, " AND ")
+}
+
+// Views returns all materialized views of the keyspace sorted by name.
+func (ks *Keyspace) Views() []*Table {
+	views := []*Table{}
+	for _, t := range ks.sortedTables() {
+		if t.View != nil {
+			views = append(views, t)
+		}
+	}
+	return views
+}
+
+// views returns the materialized views of the table base sorted by name.
+func (ks *Keyspace) views(base string) []*Table {
+	views := []*Table{}
+	for _, v := range ks.Views() {
+		if v.View.Base == base {
+			views = append(views, v)
+		}
+	}
+	return views
+}
+
+// views returns the materialized views of t.
+func (e *Engine) views(t *Table) []*Table {
+	ks, found := e.Keyspace(t.Keyspace)
+	if !found {
+		return nil
+	}
+	return ks.views(t.Name)
+}
+
+// apply applies m to the data of t and updates the materialized views of
+// t. The views are looked up before the data is locked, schema changes
+// lock the data while holding the schema lock.
+func (e *Engine) apply(t *Table, m *mutation) {
+	views := e.views(t)
+
+	t.data.mu.Lock()
+	defer t.data.mu.Unlock()
+	t.data.update(t, views, m)
+}
+
+// update applies m and derives the rows the views of t hold for the
+// written partition anew. The caller has to hold the write lock.
+func (s *store) update(t *Table, views []*Table, m *mutation) {
+	if len(views) == 0 {
+		s.write(t, m)
+		return
+	}
+
+	staticBefore, before := s.liveRows(t, m.key, m.now)
+	s.write(t, m)
+	staticAfter, after := s.liveRows(t, m.key, m.now)
+
+	for _, v := range views {
+		removed := v.derive(t, m.key, staticBefore, before)
+		added := v.derive(t, m.key, staticAfter, after)
+
+		v.data.mu.Lock()
+		v.data.replace(v, removed, added)
+		v.data.mu.Unlock()
+	}
+}
+
+// liveRows returns the live static values and rows of the partition with
+// the given key. The caller has to hold the read lock.
+func (s *store) liveRows(t *Table, key [][]byte, now int64) (map[string]*cell, []*row) {
+	if p, found := s.partition(key); found {
+		return p.live(t, now)
+	}
+	return nil, nil
+}
+
+// viewRow is a row of a materialized view together with its partition key.
+type viewRow struct {
+	key [][]byte
+	row *row
+}
+
+// derive returns the rows of view v that stem from the live static values
+// and rows of the partition of base with the given key.
+func (v *Table) derive(base *Table, key [][]byte, static map[string]*cell, rows []*row) []viewRow {
+	view := v.View
+	if !view.filter.matchPartition(key, static) {
+		return nil
+	}
+
+	derived := []viewRow{}
+	for _, rw := range rows {
+		if !view.filter.matchRow(rw) {
+			continue
+		}
+
+		value := func(name string) []byte {
+			c, _ := base.Column(name)
+			switch c.Kind {
+			case PartitionKey:
+				return key[c.Position]
+			case Clustering:
+				return rw.clustering[c.Position]
+			}
+			return cellValue(rw.cells[name])
+		}
+
+		live := true
+		for _, name := range view.notNull {
+			live = live && value(name) != nil
+		}
+		if !live {
+			continue
+		}
+
+		vr := viewRow{
+			key: make([][]byte, len(v.PartitionKey)),
+			row: &row{clustering: make([][]byte, len(v.ClusteringKey)), cells: map[string]*cell{}, marker: rw.marker},
+		}
+		for _, c := range v.Columns {
+			switch c.Kind {
+			case PartitionKey:
+				vr.key[c.Position] = value(c.Name)
+			case Clustering:
+				vr.row.clustering[c.Position] = value(c.Name)
+			default:
+				if lc, found := rw.cells[c.Name]; found {
+					vr.row.cells[c.Name] = lc
+				}
+			}
+
+			// A regular column of the base table in the primary key of the
+			// view determines whether the view row is alive.
+			if bc, _ := base.Column(c.Name); c.IsPrimaryKey() && !bc.IsPrimaryKey() {
+				lc := rw.cells[c.Name]
+				vr.row.marker = &cell{value: []byte{}, timestamp: lc.timestamp, ttl: lc.ttl, expires: lc.expires}
+			}
+		}
+
+		if vr.row.marker == nil {
+			vr.row.marker = cellLiveness(rw.cells)
+		}
+
+		derived = append(derived, vr)
+	}
+	return derived
+}
+
+// cellLiveness returns a row marker that keeps a view row alive as long as
+// any of the given cells of its base row is.
+func cellLiveness(cells map[string]*cell) *cell {
+	marker := &cell{value: []byte{}, timestamp: noTimestamp}
+	expiring := true
+	for _, c := range cells {
+		if c.timestamp > marker.timestamp {
+			marker.timestamp = c.timestamp
+		}
+		if c.ttl == 0 {
+			expiring = false
+		} else if c.expires > marker.expires {
+			marker.ttl, marker.expires = c.ttl, c.expires
+		}
+	}
+
+	if !expiring {
+		marker.ttl, marker.expires = 0, 0
+	}
+	return marker
+}
+
+// replace removes the removed rows from the data of view v and writes the
+// added ones. The caller has to hold the write lock.
+func (s *store) replace(v *Table, removed, added []viewRow) {
+	for _, vr := range removed {
+		id := partitionID(vr.key)
+		p, found := s.partitions[id]
+		if !found {
+			continue
+		}
+
+		if i, found := p.search(v, vr.row.clustering); found {
+			p.rows = append(p.rows[:i], p.rows[i+1:]...)
+		}
+		if len(p.rows) == 0 {
+			s.remove(v, id)
+		}
+	}
+
+	for _, vr := range added {
+		id := partitionID(vr.key)
+		p, found := s.partitions[id]
+		if !found {
+			p = s.add(v, id, vr.key)
+		}
+
+		r := p.row(v, vr.row.clustering)
+		r.marker, r.cells = vr.row.marker, vr.row.cells
+	}
+}
+
+// populate derives the rows of view v from the current data of its base
+// table.
+func (v *Table) populate(base *Table, now int64) {
+	base.data.mu.RLock()
+	defer base.data.mu.RUnlock()
+
+	v.data.mu.Lock()
+	defer v.data.mu.Unlock()
+
+	for _, p := range base.data.partitions {
+		static, rows := p.live(base, now)
+		v.data.replace(v, nil, v.derive(base, p.key, static, rows))
+	}
+}
+
+// createView executes CREATE MATERIALIZED VIEW.
+func (e *Engine) createView(r *request, s *parser.CreateView) (result.Result, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ks, err := e.modifiableKeyspace(r, s.View)
+	if err != nil {
+		return nil, err
+	}
+
+	baseKeyspace, err := r.keyspaceName(s.Base)
+	if err != nil {
+		return nil, err
+	}
+	if baseKeyspace != ks.Name {
+		return nil, invalid("Cannot create a materialized view on a table in a separate keyspace")
+	}
+
+	base, found := ks.tables[s.Base.Name]
+	if !found {
+		return nil, invalid("unconfigured table %s", s.Base.Name)
+	}
+
+	v, err := r.buildView(ks, base, s)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, found := ks.tables[v.Name]; found {
+		if s.IfNotExists {
+			return result.Void{}, nil
+		}
+		return nil, &proto.AlreadyExistsError{Keyspace: ks.Name, Table: v.Name}
+	}
+
+	ks = ks.clone()
+	ks.tables[v.Name] = v
+	e.keyspaces[ks.Name] = ks
+
+	v.populate(base, e.nowInSeconds())
+
+	return tableChange(result.Created, v), nil
+}
+
+// buildView validates the definition of a materialized view of base and
+// builds its columns. The primary key of the view has to include all
+// primary key columns of the base table and at most one other column.
+func (r *request) buildView(ks *Keyspace, base *Table, s *parser.CreateView) (*Table, error) {
+	switch {
+	case base.View != nil:
+		return nil, invalid("Materialized views cannot be created against other materialized views")
+	case base.IsCounter():
+		return nil, invalid("Materialized views are not supported on counter tables")
+	}
+
+	view := &View{Base: base.Name, IncludeAll: len(s.Selectors) == 0, Where: s.Where}
+
+	selected := []*Column{}
+	if view.IncludeAll {
+		for _, c := range base.Columns {
+			if c.Kind == Static {
+				return nil, invalid("Unable to include static column '%s' which would be included by Materialized View SELECT * statement", c.Name)
+			}
+		}
+		selected = base.Columns
+	}
+
+	for _, sel := range s.Selectors {
+		col, ok := sel.Expr.(*parser.Column)
+		switch {
+		case sel.Alias != "":
+			return nil, invalid("Cannot use alias when defining a materialized view")
+		case !ok:
+			return nil, invalid("Can only select columns by name when defining a materialized view")
+		}
+
+		c, found := base.Column(col.Name)
+		switch {
+		case !found:
+			return nil, invalid("Unknown column name detected in CREATE MATERIALIZED VIEW statement : %s", col.Name)
+		case c.Kind == Static:
+			return nil, invalid("Cannot include static column '%s' in materialized view '%s'", c.Name, s.View.Name)
+		}
+		selected = append(selected, c)
+	}
+
+	for _, rel := range s.Where {
+		if hasMarker(rel.Left) || hasMarker(rel.Right) {
+			return nil, invalid("Cannot use query parameters in CREATE MATERIALIZED VIEW statements")
+		}
+	}
+
+	if err := r.filterView(view, base); err != nil {
+		return nil, err
+	}
+
+	notNull := map[string]bool{}
+	for _, name := range view.notNull {
+		notNull[name] = true
+	}
+
+	columns := []*Column{}
+	keys := map[string]bool{}
+	regular := []string{}
+
+	addKey := func(name string, kind ColumnKind, position int) error {
+		c, found := base.Column(name)
+		switch {
+		case !found:
+			return invalid("Unknown column name detected in CREATE MATERIALIZED VIEW statement : %s", name)
+		case keys[name]:
+			return invalid("Duplicate entry found in PRIMARY KEY: %s", name)
+		case c.Kind == Static:
+			return invalid("Cannot use Static column '%s' in PRIMARY KEY of materialized view", name)
+		case c.Type.IsMultiCell():
+			return invalid("Cannot use MultiCell column '%s' in PRIMARY KEY of materialized view", name)
+		case c.Type.ID == types.Duration:
+			return invalid("Cannot use Duration column '%s' in PRIMARY KEY of materialized view", name)
+		case !notNull[name]:
+			return invalid("Primary key column '%s' is required to be filtered by 'IS NOT NULL'", name)
+		}
+
+		if !c.IsPrimaryKey() {
+			regular = append(regular, name)
+		}
+		keys[name] = true
+		columns = append(columns, &Column{Name: name, Type: c.Type, Kind: kind, Position: position})
+		return nil
+	}
+
+	for i, name := range s.PartitionKey {
+		if err := addKey(name, PartitionKey, i); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, name := range s.ClusteringKey {
+		if err := addKey(name, Clustering, i); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(regular) > 1 {
+		return nil, invalid("Cannot include more than one non-primary key column in materialized view primary key (got %s)", strings.Join(regular, ", "))
+	}
+
+	missing := []string{}
+	for _, c := range base.Columns {
+		if c.IsPrimaryKey() && !keys[c.Name] {
+			missing = append(missing, c.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, invalid("Cannot create Materialized View %s without primary key columns from base %s (%s)", s.View.Name, base.Name, strings.Join(missing, ","))
+	}
+
+	for _, c := range selected {
+		if !keys[c.Name] {
+			keys[c.Name] = true
+			columns = append(columns, &Column{Name: c.Name, Type: c.Type, Kind: Regular, Position: -1})
+		}
+	}
+
+	if err := clusteringOrder(columns, &parser.CreateTable{ClusteringKey: s.ClusteringKey, ClusteringOrder: s.ClusteringOrder}); err != nil {
+		return nil, err
+	}
+
+	v := newTable(ks.Name, s.View.Name, columns)
+	v.View = view
+	if err := v.Options.set(s.Options); err != nil {
+		return nil, err
+	}
+
+	if v.Options.DefaultTimeToLive > 0 {
+		return nil, invalid("Cannot set default_time_to_live for a materialized view. Data in a materialized view always expire at the same time than the corresponding data in the parent table.")
+	}
+
+	return v, nil
+}
+
+// filterView splits the WHERE clause of view into the columns restricted
+// by IS NOT NULL and the restrictions on the rows of base.
+func (r *request) filterView(view *View, base *Table) error {
+	view.notNull = nil
+
+	where := []parser.Relation{}
+	for _, rel := range view.Where {
+		if rel.Op != parser.IsNot {
+			where = append(where, rel)
+			continue
+		}
+
+		col, ok := rel.Left.(*parser.Column)
+		if !ok {
+			return invalid("Unsupported restriction: %s", rel)
+		}
+		if _, found := base.Column(col.Name); !found {
+			return invalid("Undefined column name %s", col.Name)
+		}
+		view.notNull = append(view.notNull, col.Name)
+	}
+
+	filter, err := r.restrict(base, &parser.Select{Where: where, AllowFiltering: true}, nil)
+	if err != nil {
+		return err
+	}
+	view.filter = filter
+	return nil
+}
+
+// hasMarker returns true if t contains a bind marker.
+func hasMarker(t parser.Term) bool {
+	var terms []parser.Term
+	switch x := t.(type) {
+	case *parser.BindMarker:
+		return true
+	case *parser.Index:
+		terms = []parser.Term{x.Expr, x.Key}
+	case *parser.Tuple:
+		terms = x.Elems
+	case *parser.List:
+		terms = x.Elems
+	case *parser.Set:
+		terms = x.Elems
+	case *parser.Map:
+		for _, e := range x.Entries {
+			terms = append(terms, e.Key, e.Value)
+		}
+	case *parser.UserType:
+		for _, f := range x.Fields {
+			terms = append(terms, f.Value)
+		}
+	case *parser.FunctionCall:
+		terms = x.Args
+	case *parser.Cast:
+		terms = []parser.Term{x.Expr}
+	case *parser.TypeHint:
+		terms = []parser.Term{x.Expr}
+	}
+
+	for _, term := range terms {
+		if hasMarker(term) {
+			return true
+		}
+	}
+	return false
+}
+
+// followBase returns a copy of view v adapted to the changes ALTER TABLE s
+// made to its base table. Views selecting all columns get the added
+// columns, renamed primary key columns are renamed in the view as well.
+func (r *request) followBase(v *Table, base *Table, s *parser.AlterTable) (*Table, error) {
+	v = v.clone()
+	view := *v.View
+	v.View = &view
+
+	for _, d := range s.Add {
+		if c, _ := base.Column(d.Name); view.IncludeAll && c.Kind == Regular {
+			v.setColumns(append(v.Columns, &Column{Name: c.Name, Type: c.Type, Kind: Regular, Position: -1}))
+		}
+	}
+
+	for _, rn := range s.Rename {
+		if c, found := v.Column(rn.From); found {
+			c.Name = rn.To
+			v.setColumns(v.Columns)
+		}
+
+		where := make([]parser.Relation, len(view.Where))
+		for i, rel := range view.Where {
+			where[i] = parser.Relation{Left: renameColumn(rel.Left, rn), Op: rel.Op, Right: rel.Right}
+		}
+		view.Where = where
+	}
+
+	if err := r.filterView(&view, base); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// renameColumn returns the left-hand side of a relation with references to
+// a renamed column replaced.
+func renameColumn(t parser.Term, rn parser.Rename) parser.Term {
+	switch x := t.(type) {
+	case *parser.Column:
+		if x.Name == rn.From {
+			return &parser.Column{Name: rn.To}
+		}
+	case *parser.Tuple:
+		elems := make([]parser.Term, len(x.Elems))
+		for i, e := range x.Elems {
+			elems[i] = renameColumn(e, rn)
+		}
+		return &parser.Tuple{Elems: elems}
+	case *parser.FunctionCall:
+		args := make([]parser.Term, len(x.Args))
+		for i, a := range x.Args {
+			args[i] = renameColumn(a, rn)
+		}
+		return &parser.FunctionCall{Keyspace: x.Keyspace, Name: x.Name, Args: args}
+	}
+	return t
+}
+
+// alterView executes ALTER MATERIALIZED VIEW.
+func (e *Engine) alterView(r *request, s *parser.AlterView) (result.Result, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ks, err := e.modifiableKeyspace(r, s.View)
+	if err != nil {
+		return nil, err
+	}
+
+	v, found := ks.tables[s.View.Name]
+	switch {
+	case !found:
+		return nil, invalid("unconfigured table %s", s.View.Name)
+	case v.View == nil:
+		return nil, invalid("Cannot use ALTER MATERIALIZED VIEW on Table")
+	}
+
+	v = v.clone()
+	if err := v.Options.set(s.Options); err != nil {
+		return nil, err
+	}
+
+	if v.Options.DefaultTimeToLive > 0 {
+		return nil, invalid("Cannot set or alter default_time_to_live for a materialized view. Data in a materialized view always expire at the same time than the corresponding data in the parent table.")
+	}
+
+	ks = ks.clone()
+	ks.tables[v.Name] = v
+	e.keyspaces[ks.Name] = ks
+
+	return tableChange(result.Updated, v), nil
+}
+
+// dropView executes DROP MATERIALIZED VIEW.
+func (e *Engine) dropView(r *request, s *parser.DropView) (result.Result, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ks, err := e.modifiableKeyspace(r, s.View)
+	if err != nil {
+		return nil, err
+	}
+
+	v, found := ks.tables[s.View.Name]
+	switch {
+	case !found && s.IfExists:
+		return result.Void{}, nil
+	case !found:
+		return nil, configError("Cannot drop non existing materialized view '%s' in keyspace '%s'.", s.View.Name, ks.Name)
+	case v.View == nil:
+		return nil, invalid("Cannot use DROP MATERIALIZED VIEW on Table")
+	}
+
+	ks = ks.clone()
+	delete(ks.tables, v.Name)
+	e.keyspaces[ks.Name] = ks
+
+	return tableChange(result.Dropped, v), nil
+}
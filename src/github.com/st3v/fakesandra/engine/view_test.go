@@ -0,0 +1,152 @@
+package engine_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/engine"
+)
+
+var _ = Describe("Materialized views", func() {
+	var e *engine.Engine
+
+	row := func(values ...interface{}) []interface{} {
+		return values
+	}
+
+	BeforeEach(func() {
+		e = engine.New()
+		exec(e, "CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}")
+		exec(e, "CREATE TABLE ks.users (id int, c int, name text, city text, age int, PRIMARY KEY (id, c))")
+		exec(e, "INSERT INTO ks.users (id, c, name, city, age) VALUES (1, 0, 'Alice', 'Berlin', 30)")
+		exec(e, "INSERT INTO ks.users (id, c, name, city, age) VALUES (2, 0, 'Bob', 'Paris', 40)")
+	})
+
+	It("derives the view from existing and new rows of the base table", func() {
+		exec(e, "CREATE MATERIALIZED VIEW ks.by_city AS SELECT * FROM ks.users WHERE city IS NOT NULL AND id IS NOT NULL AND c IS NOT NULL PRIMARY KEY (city, id, c)")
+		Expect(values(e, "SELECT id, name FROM ks.by_city WHERE city = 'Berlin'")).To(Equal([][]interface{}{row(int32(1), "Alice")}))
+
+		exec(e, "INSERT INTO ks.users (id, c, name, city) VALUES (3, 0, 'Carol', 'Berlin')")
+		exec(e, "UPDATE ks.users SET city = 'Rome' WHERE id = 1 AND c = 0")
+		exec(e, "UPDATE ks.users SET age = 41 WHERE id = 2 AND c = 0")
+		Expect(values(e, "SELECT id FROM ks.by_city WHERE city = 'Berlin'")).To(Equal([][]interface{}{row(int32(3))}))
+		Expect(values(e, "SELECT id, name FROM ks.by_city WHERE city = 'Rome'")).To(Equal([][]interface{}{row(int32(1), "Alice")}))
+		Expect(values(e, "SELECT age FROM ks.by_city WHERE city = 'Paris' AND id = 2")).To(Equal([][]interface{}{row(int32(41))}))
+
+		exec(e, "DELETE city FROM ks.users WHERE id = 3 AND c = 0")
+		exec(e, "DELETE FROM ks.users WHERE id = 2")
+		Expect(values(e, "SELECT city, id FROM ks.by_city")).To(Equal([][]interface{}{row("Rome", int32(1))}))
+
+		exec(e, "BEGIN BATCH INSERT INTO ks.users (id, c, city) VALUES (4, 0, 'Oslo'); INSERT INTO ks.users (id, c, city) VALUES (4, 1, 'Oslo'); APPLY BATCH")
+		exec(e, "UPDATE ks.users SET city = 'Lima' WHERE id = 4 AND c = 1 IF EXISTS")
+		Expect(values(e, "SELECT c FROM ks.by_city WHERE city = 'Oslo'")).To(Equal([][]interface{}{row(int32(0))}))
+		Expect(values(e, "SELECT c FROM ks.by_city WHERE city = 'Lima'")).To(Equal([][]interface{}{row(int32(1))}))
+
+		exec(e, "TRUNCATE ks.users")
+		Expect(values(e, "SELECT * FROM ks.by_city")).To(BeEmpty())
+	})
+
+	It("selects columns and filters rows", func() {
+		exec(e, "CREATE MATERIALIZED VIEW ks.adults AS SELECT name FROM ks.users WHERE age IS NOT NULL AND id IS NOT NULL AND c IS NOT NULL AND age >= 35 PRIMARY KEY (age, id, c) WITH CLUSTERING ORDER BY (id DESC)")
+		exec(e, "INSERT INTO ks.users (id, c, name, age) VALUES (3, 0, 'Carol', 40)")
+		exec(e, "INSERT INTO ks.users (id, c, name, age) VALUES (4, 0, 'Dave', 20)")
+
+		Expect(values(e, "SELECT * FROM ks.adults")).To(Equal([][]interface{}{
+			row(int32(40), int32(3), int32(0), "Carol"),
+			row(int32(40), int32(2), int32(0), "Bob"),
+		}))
+
+		exec(e, "UPDATE ks.users SET age = 20 WHERE id = 3 AND c = 0")
+		Expect(values(e, "SELECT name FROM ks.adults WHERE age = 40")).To(Equal([][]interface{}{row("Bob")}))
+		expectInvalid(e, "SELECT city FROM ks.adults", "Undefined column name city")
+	})
+
+	It("expires view rows with the base row", func() {
+		exec(e, "CREATE MATERIALIZED VIEW ks.by_name AS SELECT * FROM ks.users WHERE name IS NOT NULL AND id IS NOT NULL AND c IS NOT NULL PRIMARY KEY (name, id, c)")
+		exec(e, "INSERT INTO ks.users (id, c, name) VALUES (3, 0, 'Carol') USING TTL 10")
+		Expect(values(e, "SELECT id FROM ks.by_name WHERE name = 'Carol'")).To(HaveLen(1))
+
+		e.Clock().Advance(11 * time.Second)
+		Expect(values(e, "SELECT id FROM ks.by_name WHERE name = 'Carol'")).To(BeEmpty())
+		Expect(values(e, "SELECT id FROM ks.by_name WHERE name = 'Alice'")).To(HaveLen(1))
+	})
+
+	It("enforces the restrictions on the primary key of the view", func() {
+		exec(e, "CREATE TABLE ks.s (p int, c int, s int STATIC, v int, l list<int>, PRIMARY KEY (p, c))")
+
+		expectInvalid(e, "CREATE MATERIALIZED VIEW ks.v AS SELECT * FROM ks.users WHERE city IS NOT NULL AND id IS NOT NULL PRIMARY KEY (city, id)", "Cannot create Materialized View v without primary key columns from base users (c)")
+		expectInvalid(e, "CREATE MATERIALIZED VIEW ks.v AS SELECT * FROM ks.users WHERE city IS NOT NULL AND name IS NOT NULL AND id IS NOT NULL AND c IS NOT NULL PRIMARY KEY (city, name, id, c)", "Cannot include more than one non-primary key column in materialized view primary key (got city, name)")
+		expectInvalid(e, "CREATE MATERIALIZED VIEW ks.v AS SELECT * FROM ks.users WHERE id IS NOT NULL AND c IS NOT NULL PRIMARY KEY (city, id, c)", "Primary key column 'city' is required to be filtered by 'IS NOT NULL'")
+		expectInvalid(e, "CREATE MATERIALIZED VIEW ks.v AS SELECT * FROM ks.users WHERE id IS NOT NULL AND c IS NOT NULL PRIMARY KEY (nope, id, c)", "Unknown column name detected in CREATE MATERIALIZED VIEW statement : nope")
+		expectInvalid(e, "CREATE MATERIALIZED VIEW ks.v AS SELECT * FROM ks.users WHERE id IS NOT NULL AND c IS NOT NULL PRIMARY KEY (id, c, id)", "Duplicate entry found in PRIMARY KEY: id")
+		expectInvalid(e, "CREATE MATERIALIZED VIEW ks.v AS SELECT * FROM ks.users WHERE id IS NOT NULL AND c = ? PRIMARY KEY (id, c)", "Cannot use query parameters in CREATE MATERIALIZED VIEW statements")
+		expectInvalid(e, "CREATE MATERIALIZED VIEW ks.v AS SELECT v, l FROM ks.s WHERE l IS NOT NULL AND p IS NOT NULL AND c IS NOT NULL PRIMARY KEY (l, p, c)", "Cannot use MultiCell column 'l' in PRIMARY KEY of materialized view")
+		expectInvalid(e, "CREATE MATERIALIZED VIEW ks.v AS SELECT * FROM ks.s WHERE p IS NOT NULL AND c IS NOT NULL PRIMARY KEY (c, p)", "Unable to include static column 's' which would be included by Materialized View SELECT * statement")
+		expectInvalid(e, "CREATE MATERIALIZED VIEW ks.v AS SELECT s FROM ks.s WHERE p IS NOT NULL AND c IS NOT NULL PRIMARY KEY (c, p)", "Cannot include static column 's' in materialized view 'v'")
+		expectInvalid(e, "CREATE MATERIALIZED VIEW ks.v AS SELECT * FROM ks.users WHERE id IS NOT NULL AND c IS NOT NULL PRIMARY KEY (c, id) WITH default_time_to_live = 10", "Cannot set default_time_to_live for a materialized view. Data in a materialized view always expire at the same time than the corresponding data in the parent table.")
+
+		exec(e, "CREATE MATERIALIZED VIEW ks.v AS SELECT * FROM ks.users WHERE id IS NOT NULL AND c IS NOT NULL PRIMARY KEY (c, id)")
+		exec(e, "CREATE MATERIALIZED VIEW IF NOT EXISTS ks.v AS SELECT * FROM ks.users WHERE id IS NOT NULL AND c IS NOT NULL PRIMARY KEY (c, id)")
+		_, err := e.Execute("CREATE MATERIALIZED VIEW ks.v AS SELECT * FROM ks.users WHERE id IS NOT NULL AND c IS NOT NULL PRIMARY KEY (c, id)")
+		Expect(err).To(Equal(&proto.AlreadyExistsError{Keyspace: "ks", Table: "v"}))
+		expectInvalid(e, "CREATE MATERIALIZED VIEW ks.w AS SELECT * FROM ks.v WHERE id IS NOT NULL AND c IS NOT NULL PRIMARY KEY (id, c)", "Materialized views cannot be created against other materialized views")
+	})
+
+	It("protects views and their base tables", func() {
+		exec(e, "CREATE MATERIALIZED VIEW ks.by_city AS SELECT * FROM ks.users WHERE city IS NOT NULL AND id IS NOT NULL AND c IS NOT NULL PRIMARY KEY (city, id, c)")
+
+		expectInvalid(e, "INSERT INTO ks.by_city (city, id, c) VALUES ('Rome', 5, 0)", "Cannot directly modify a materialized view")
+		expectInvalid(e, "DELETE FROM ks.by_city WHERE city = 'Rome'", "Cannot directly modify a materialized view")
+		expectInvalid(e, "TRUNCATE ks.by_city", "Cannot TRUNCATE materialized view directly; must truncate base table instead")
+		expectInvalid(e, "ALTER TABLE ks.by_city WITH comment = 'x'", "Cannot use ALTER TABLE on Materialized View")
+		expectInvalid(e, "DROP TABLE ks.by_city", "Cannot use DROP TABLE on Materialized View")
+		expectInvalid(e, "CREATE INDEX ON ks.by_city (name)", "Secondary indexes are not supported on materialized views")
+		expectInvalid(e, "ALTER TABLE ks.users DROP age", "Cannot drop column age on base table users with materialized views.")
+		expectInvalid(e, "DROP TABLE ks.users", "Cannot drop table when materialized views still depend on it (ks.{by_city})")
+		expectInvalid(e, "DROP MATERIALIZED VIEW ks.users", "Cannot use DROP MATERIALIZED VIEW on Table")
+		expectInvalid(e, "ALTER MATERIALIZED VIEW ks.by_city WITH default_time_to_live = 1", "Cannot set or alter default_time_to_live for a materialized view. Data in a materialized view always expire at the same time than the corresponding data in the parent table.")
+
+		exec(e, "ALTER MATERIALIZED VIEW ks.by_city WITH comment = 'by city'")
+		exec(e, "DROP MATERIALIZED VIEW ks.by_city")
+		expectError(e, "DROP MATERIALIZED VIEW ks.by_city", proto.ErrConfig, "Cannot drop non existing materialized view 'by_city' in keyspace 'ks'.")
+		exec(e, "DROP MATERIALIZED VIEW IF EXISTS ks.by_city")
+		exec(e, "DROP TABLE ks.users")
+	})
+
+	It("follows changes to the columns of the base table", func() {
+		exec(e, "CREATE MATERIALIZED VIEW ks.by_city AS SELECT * FROM ks.users WHERE city IS NOT NULL AND id IS NOT NULL AND c IS NOT NULL AND c = 0 PRIMARY KEY (city, id, c)")
+
+		exec(e, "ALTER TABLE ks.users ADD email text")
+		exec(e, "ALTER TABLE ks.users RENAME c TO n")
+		exec(e, "INSERT INTO ks.users (id, n, city, email) VALUES (3, 0, 'Oslo', 'carol@example.com')")
+		exec(e, "INSERT INTO ks.users (id, n, city, email) VALUES (3, 1, 'Oslo', 'carol@example.org')")
+
+		Expect(values(e, "SELECT n, email FROM ks.by_city WHERE city = 'Oslo'")).To(Equal([][]interface{}{row(int32(0), "carol@example.com")}))
+		Expect(values(e, "SELECT where_clause FROM system_schema.views")).To(Equal([][]interface{}{row("city IS NOT NULL AND id IS NOT NULL AND n IS NOT NULL AND n = 0")}))
+	})
+
+	It("lists views in the schema tables", func() {
+		exec(e, "CREATE MATERIALIZED VIEW ks.by_city AS SELECT name FROM ks.users WHERE city IS NOT NULL AND id IS NOT NULL AND c IS NOT NULL PRIMARY KEY (city, id, c)")
+
+		Expect(values(e, "SELECT view_name, base_table_name, include_all_columns, where_clause FROM system_schema.views WHERE keyspace_name = 'ks'")).To(Equal([][]interface{}{
+			row("by_city", "users", false, "city IS NOT NULL AND id IS NOT NULL AND c IS NOT NULL"),
+		}))
+		Expect(values(e, "SELECT table_name FROM system_schema.tables WHERE keyspace_name = 'ks'")).To(Equal([][]interface{}{row("users")}))
+		Expect(values(e, "SELECT column_name, kind FROM system_schema.columns WHERE keyspace_name = 'ks' AND table_name = 'by_city'")).To(ConsistOf(
+			row("city", "partition_key"),
+			row("id", "clustering"),
+			row("c", "clustering"),
+			row("name", "regular"),
+		))
+
+		ks, _ := e.Keyspace("ks")
+		Expect(ks.Views()).To(HaveLen(1))
+		Expect(ks.Tables()).To(HaveLen(1))
+
+		e.SetProfile(engine.Profile{Version: "2.1", ReleaseVersion: "2.1.22"})
+		expectError(e, "DROP MATERIALIZED VIEW ks.by_city", proto.ErrSyntax, "no viable alternative at input 'MATERIALIZED'")
+	})
+})
@@ -0,0 +1,721 @@
+package engine
+
+import (
+	"strings"
+
+	"github.com/st3v/fakesandra/cql/parser"
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+// modification holds the mutations of an INSERT, UPDATE or DELETE
+// statement and the conditions they are subject to, if any.
+type modification struct {
+	table      *Table
+	mutations  []*mutation
+	conditions *conditions
+}
+
+// modify executes an INSERT, UPDATE or DELETE statement.
+func (e *Engine) modify(r *request, stmt parser.Statement) (result.Result, error) {
+	mod, err := e.modification(r, stmt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.checkConsistency(mod.conditions != nil); err != nil {
+		return nil, err
+	}
+
+	if mod.conditions != nil {
+		return e.cas(mod.table, mod.mutations, []*conditions{mod.conditions}, false), nil
+	}
+
+	for _, m := range mod.mutations {
+		e.apply(mod.table, m)
+	}
+	return result.Void{}, nil
+}
+
+// modification evaluates an INSERT, UPDATE or DELETE statement without
+// applying it.
+func (e *Engine) modification(r *request, stmt parser.Statement) (*modification, error) {
+	switch s := stmt.(type) {
+	case *parser.Insert:
+		return e.insert(r, s)
+	case *parser.Update:
+		return e.update(r, s)
+	case *parser.Delete:
+		return e.delete(r, s)
+	}
+	return nil, errNotHandled
+}
+
+// insert evaluates INSERT.
+func (e *Engine) insert(r *request, s *parser.Insert) (*modification, error) {
+	t, err := e.writableTable(r, s.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.JSON != nil {
+		return nil, invalid("INSERT JSON is not supported")
+	}
+
+	if t.IsCounter() {
+		return nil, invalid("INSERT statements are not allowed on counter tables, use UPDATE instead")
+	}
+
+	if len(s.Columns) != len(s.Values) {
+		return nil, invalid("Unmatched column names/values")
+	}
+
+	values := map[string][]byte{}
+	for i, name := range s.Columns {
+		c, found := t.Column(name)
+		if !found {
+			return nil, invalid("Undefined column name %s", name)
+		}
+		if _, found := values[name]; found {
+			return nil, invalid("Multiple definitions found for column %s", name)
+		}
+
+		if values[name], err = r.bind(s.Values[i], c); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := primaryKeyValues(t.PartitionKey, values, "Some partition key parts are missing: %s", "Invalid null value for partition key part %s")
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp, err := e.writeTimestamp(r, t, s.Using, s.IfNotExists)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl, err := r.writeTTL(t, s.Using)
+	if err != nil {
+		return nil, err
+	}
+
+	m := newMutation(key, timestamp, e.nowInSeconds())
+	m.ttl = ttl
+
+	clustering, err := primaryKeyValues(t.ClusteringKey, values, "Some clustering keys are missing: %s", "Invalid null value for clustering key part %s")
+	if err != nil && !onlyStatic(t, s.Columns) {
+		return nil, err
+	}
+	if err == nil {
+		m.clustering = clustering
+		m.live = true
+	}
+
+	for name, v := range values {
+		if c, _ := t.Column(name); !c.IsPrimaryKey() {
+			m.set(c, v)
+		}
+	}
+
+	mod := &modification{table: t, mutations: []*mutation{m}}
+	if s.IfNotExists {
+		mod.conditions = &conditions{notExists: true, clustering: m.clustering}
+	}
+	return mod, nil
+}
+
+// writableTable returns the table a write statement on name refers to.
+// Materialized views are only written by the engine.
+func (e *Engine) writableTable(r *request, name parser.Name) (*Table, error) {
+	t, err := e.table(r, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.View != nil {
+		return nil, invalid("Cannot directly modify a materialized view")
+	}
+	return t, nil
+}
+
+// writeTimestamp returns the timestamp of a write in microseconds. It is
+// taken from USING TIMESTAMP, the enclosing batch, the default timestamp of
+// the query or the clock of the engine, in that order. Conditional writes
+// and counter updates cannot have a custom timestamp.
+func (e *Engine) writeTimestamp(r *request, t *Table, using parser.Using, conditional bool) (int64, error) {
+	if using.Timestamp != nil {
+		switch {
+		case conditional && r.batch != nil:
+			return 0, invalid("Cannot provide custom timestamp for conditional BATCH")
+		case conditional:
+			return 0, invalid("Cannot provide custom timestamp for conditional updates")
+		case t.IsCounter():
+			return 0, invalid("Cannot provide custom timestamp for counter updates")
+		case r.batch != nil && r.batch.Using.Timestamp != nil:
+			return 0, invalid("Timestamp must be set either on BATCH or individual statements")
+		}
+		return r.bindTimestamp(using.Timestamp)
+	}
+
+	if r.batch != nil {
+		return r.batchTimestamp, nil
+	}
+
+	return e.defaultTimestamp(r), nil
+}
+
+// bindTimestamp evaluates the term of USING TIMESTAMP.
+func (r *request) bindTimestamp(term parser.Term) (int64, error) {
+	b, err := r.bindAs(term, "[timestamp]", types.Native(types.Bigint))
+	if err != nil {
+		return 0, err
+	}
+	if b == nil {
+		return 0, invalid("Invalid null value of timestamp")
+	}
+
+	v, err := types.Unmarshal(types.Native(types.Bigint), b)
+	if err != nil {
+		return 0, invalid("%s", err)
+	}
+	return v.(int64), nil
+}
+
+// defaultTimestamp returns the default timestamp of the query or, if it
+// has none, the current time of the engine clock.
+func (e *Engine) defaultTimestamp(r *request) int64 {
+	if r.query != nil {
+		if ts, set := r.query.DefaultTimestamp(); set {
+			return ts.UnixNano() / 1000
+		}
+	}
+
+	return e.timestamp()
+}
+
+// writeTTL returns the TTL of a write in seconds, taken from USING TTL or
+// the default_time_to_live of the table. Zero means the values do not
+// expire.
+func (r *request) writeTTL(t *Table, using parser.Using) (int32, error) {
+	if using.TTL != nil && t.IsCounter() {
+		return 0, invalid("Cannot provide custom TTL for counter updates")
+	}
+
+	if using.TTL == nil {
+		return int32(t.Options.DefaultTimeToLive), nil
+	}
+
+	b, err := r.bindAs(using.TTL, "[ttl]", types.Native(types.Int))
+	if err != nil {
+		return 0, err
+	}
+	if b == nil {
+		return 0, invalid("Invalid null value of TTL")
+	}
+
+	v, err := types.Unmarshal(types.Native(types.Int), b)
+	if err != nil {
+		return 0, invalid("%s", err)
+	}
+
+	ttl := v.(int32)
+	switch {
+	case ttl < 0:
+		return 0, invalid("A TTL must be greater or equal to 0, but was %d", ttl)
+	case ttl > maxTTL:
+		return 0, invalid("ttl is too large. requested (%d) maximum (%d)", ttl, maxTTL)
+	}
+	return ttl, nil
+}
+
+// primaryKeyValues returns the values of the given key columns. The error
+// formats take the list of missing columns and the column set to null.
+func primaryKeyValues(columns []*Column, values map[string][]byte, missingFmt, nullFmt string) ([][]byte, error) {
+	key := make([][]byte, len(columns))
+
+	missing := []string{}
+	for i, c := range columns {
+		v, found := values[c.Name]
+		if !found {
+			missing = append(missing, c.Name)
+			continue
+		}
+		if v == nil {
+			return nil, invalid(nullFmt, c.Name)
+		}
+		key[i] = v
+	}
+
+	if len(missing) > 0 {
+		return nil, invalid(missingFmt, strings.Join(missing, ", "))
+	}
+
+	return key, nil
+}
+
+// onlyStatic returns true if names contains static columns and no other
+// columns apart from the partition key.
+func onlyStatic(t *Table, names []string) bool {
+	static := false
+	for _, name := range names {
+		c, _ := t.Column(name)
+		switch c.Kind {
+		case Static:
+			static = true
+		case Clustering, Regular:
+			return false
+		}
+	}
+	return static
+}
+
+// update evaluates UPDATE.
+func (e *Engine) update(r *request, s *parser.Update) (*modification, error) {
+	t, err := e.writableTable(r, s.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	cs, err := r.conditions(t, s.IfExists, s.If)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string][]byte{}
+	counters := map[string]int64{}
+	ops := []*collectionOp{}
+	names := []string{}
+	for _, a := range s.Assignments {
+		var target *parser.Column
+		switch x := a.Target.(type) {
+		case *parser.Column:
+			target = x
+		case *parser.Index:
+			target, _ = x.Expr.(*parser.Column)
+		case *parser.Field:
+			target, _ = x.Expr.(*parser.Column)
+		}
+		if target == nil {
+			return nil, invalid("Invalid operation %s for non collection column", a.Target)
+		}
+
+		c, found := t.Column(target.Name)
+		if !found {
+			return nil, invalid("Undefined column name %s", target.Name)
+		}
+		if c.IsPrimaryKey() {
+			return nil, invalid("PRIMARY KEY part %s found in SET part", c.Name)
+		}
+		if _, found := values[c.Name]; found {
+			return nil, invalid("Multiple definitions found for column %s", c.Name)
+		}
+		if _, found := counters[c.Name]; found {
+			return nil, invalid("Multiple definitions found for column %s", c.Name)
+		}
+		names = append(names, c.Name)
+
+		var op *collectionOp
+		switch x := a.Target.(type) {
+		case *parser.Index:
+			op, err = r.elementAssignment(c, x, a.Value)
+		case *parser.Field:
+			op, err = r.fieldAssignment(c, x, a.Value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if op != nil {
+			ops = append(ops, op)
+			continue
+		}
+
+		operation, isOperation := a.Value.(*parser.Operation)
+		switch {
+		case c.Type.ID == types.Counter && !isOperation:
+			return nil, invalid("Cannot set the value of counter column %s (counters can only be incremented/decremented, not set)", c.Name)
+		case c.Type.ID == types.Counter:
+			if counters[c.Name], err = r.increment(c, operation); err != nil {
+				return nil, err
+			}
+		case isOperation && c.Type.IsCollection():
+			if op, err = r.collectionAssignment(c, operation); err != nil {
+				return nil, err
+			}
+			ops = append(ops, op)
+		case isOperation:
+			return nil, invalid("Invalid operation (%s = %s) for non counter column %s", c.Name, a.Value, c.Name)
+		default:
+			if values[c.Name], err = r.bind(a.Value, c); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	targets, err := r.writeTargets(t, s.Where, "UPDATE")
+	if err != nil {
+		return nil, err
+	}
+
+	static := onlyStatic(t, names)
+	switch {
+	case static && targets.restrictsClustering():
+		return nil, invalid("Invalid restrictions on clustering columns since the UPDATE statement modifies only static columns")
+	case !static && targets.clusterings == nil:
+		return nil, invalid("Some clustering keys are missing: %s", strings.Join(targets.missing, ", "))
+	}
+
+	if static && cs != nil && cs.regular() {
+		return nil, invalid("UPDATE statements must restrict all PRIMARY KEY columns with equality relations in order to use IF conditions")
+	}
+
+	if err := targets.checkConditional(cs, "updates"); err != nil {
+		return nil, err
+	}
+
+	timestamp, err := e.writeTimestamp(r, t, s.Using, cs != nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl, err := r.writeTTL(t, s.Using)
+	if err != nil {
+		return nil, err
+	}
+
+	clusterings := targets.clusterings
+	if static {
+		clusterings = [][][]byte{nil}
+	}
+
+	if cs != nil {
+		cs.clustering = clusterings[0]
+	}
+
+	now := e.nowInSeconds()
+	muts := []*mutation{}
+	for _, key := range targets.keys {
+		for _, clustering := range clusterings {
+			m := newMutation(key, timestamp, now)
+			m.ttl = ttl
+			m.clustering = clustering
+			for name, v := range values {
+				c, _ := t.Column(name)
+				m.set(c, v)
+			}
+			for name, delta := range counters {
+				m.counters[name] = delta
+			}
+			for _, op := range ops {
+				if err := op.apply(t, m); err != nil {
+					return nil, err
+				}
+			}
+			muts = append(muts, m)
+		}
+	}
+
+	return &modification{table: t, mutations: muts, conditions: cs}, nil
+}
+
+// increment evaluates the operation c = c + n or c = c - n on a counter
+// column and returns the amount the counter changes by.
+func (r *request) increment(c *Column, op *parser.Operation) (int64, error) {
+	if left, ok := op.Left.(*parser.Column); !ok || left.Name != c.Name {
+		return 0, invalid("Only expressions of the form X = X %s<value> are supported.", op.Op)
+	}
+
+	b, err := r.bindAs(op.Right, c.Name, types.Native(types.Bigint))
+	if err != nil {
+		return 0, err
+	}
+	if b == nil {
+		return 0, invalid("Invalid null value for counter increment")
+	}
+
+	v, err := types.Unmarshal(types.Native(types.Bigint), b)
+	if err != nil {
+		return 0, invalid("%s", err)
+	}
+
+	if op.Op == "-" {
+		return -v.(int64), nil
+	}
+	return v.(int64), nil
+}
+
+// delete evaluates DELETE. Without columns it deletes partitions, rows or
+// ranges of rows depending on the restrictions of the clustering columns.
+func (e *Engine) delete(r *request, s *parser.Delete) (*modification, error) {
+	t, err := e.writableTable(r, s.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	cs, err := r.conditions(t, s.IfExists, s.If)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Using.TTL != nil {
+		return nil, invalid("TTL attribute is not allowed for deletes")
+	}
+
+	names := []string{}
+	deleted := []string{}
+	ops := []*collectionOp{}
+	for _, term := range s.Columns {
+		var col *parser.Column
+		switch x := term.(type) {
+		case *parser.Column:
+			col = x
+		case *parser.Index:
+			col, _ = x.Expr.(*parser.Column)
+		case *parser.Field:
+			col, _ = x.Expr.(*parser.Column)
+		}
+		if col == nil {
+			return nil, invalid("Invalid deletion operation %s", term)
+		}
+
+		c, found := t.Column(col.Name)
+		if !found {
+			return nil, invalid("Undefined column name %s", col.Name)
+		}
+		if c.IsPrimaryKey() {
+			return nil, invalid("Invalid identifier %s for deletion (should not be a PRIMARY KEY part)", c.Name)
+		}
+		names = append(names, c.Name)
+
+		var op *collectionOp
+		switch x := term.(type) {
+		case *parser.Index:
+			op, err = r.elementDeletion(c, x)
+		case *parser.Field:
+			op, err = r.fieldDeletion(c, x)
+		default:
+			deleted = append(deleted, c.Name)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+
+	targets, err := r.writeTargets(t, s.Where, "DELETE")
+	if err != nil {
+		return nil, err
+	}
+
+	static := onlyStatic(t, names)
+	switch {
+	case len(names) == 0:
+	case static && targets.restrictsClustering():
+		return nil, invalid("Invalid restrictions on clustering columns since the DELETE statement modifies only static columns")
+	case !static && targets.clusterings == nil && !targets.restrictsClustering():
+		return nil, invalid("Some clustering keys are missing: %s", strings.Join(targets.missing, ", "))
+	case !static && targets.clusterings == nil:
+		return nil, invalid("Range deletions are not supported for specific columns")
+	}
+
+	if cs != nil && targets.clusterings == nil && cs.regular() {
+		return nil, invalid("DELETE statements must restrict all PRIMARY KEY columns with equality relations in order to use IF conditions")
+	}
+
+	if err := targets.checkConditional(cs, "deletions"); err != nil {
+		return nil, err
+	}
+
+	timestamp, err := e.writeTimestamp(r, t, s.Using, cs != nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if cs != nil && targets.clusterings != nil {
+		cs.clustering = targets.clusterings[0]
+	}
+
+	now := e.nowInSeconds()
+	muts := []*mutation{}
+	for _, key := range targets.keys {
+		m := newMutation(key, timestamp, now)
+
+		switch {
+		case len(names) > 0:
+			for _, name := range deleted {
+				if c, _ := t.Column(name); c.Kind == Static {
+					m.set(c, nil)
+				}
+			}
+			for _, op := range ops {
+				if op.column.Kind != Static {
+					continue
+				}
+				if err := op.apply(t, m); err != nil {
+					return nil, err
+				}
+			}
+			if static {
+				break
+			}
+			for _, clustering := range targets.clusterings {
+				cm := newMutation(key, timestamp, now)
+				cm.clustering = clustering
+				for _, name := range deleted {
+					if c, _ := t.Column(name); c.Kind == Regular {
+						cm.set(c, nil)
+					}
+				}
+				for _, op := range ops {
+					if op.column.Kind != Regular {
+						continue
+					}
+					if err := op.apply(t, cm); err != nil {
+						return nil, err
+					}
+				}
+				muts = append(muts, cm)
+			}
+		case !targets.restrictsClustering():
+			m.deletePartition = true
+		default:
+			for _, prefix := range targets.prefixes {
+				rt := &rangeTombstone{prefix: prefix}
+				if targets.slice != nil {
+					rt.lower, rt.upper = targets.slice.lower, targets.slice.upper
+				}
+				m.ranges = append(m.ranges, rt)
+			}
+		}
+
+		muts = append(muts, m)
+	}
+
+	return &modification{table: t, mutations: muts, conditions: cs}, nil
+}
+
+// writeTargets are the rows selected by the WHERE clause of a write.
+type writeTargets struct {
+	keys [][][]byte
+
+	// prefixes holds the clustering prefixes restricted by EQ or IN,
+	// optionally followed by a slice on the next clustering column.
+	prefixes [][][]byte
+	slice    *restriction
+
+	// clusterings is set if the clustering is fully restricted by EQ or IN,
+	// otherwise missing lists the unrestricted clustering columns.
+	clusterings [][][]byte
+	missing     []string
+}
+
+func (wt *writeTargets) restrictsClustering() bool {
+	return len(wt.prefixes[0]) > 0 || wt.slice != nil
+}
+
+// checkConditional rejects conditional writes to multiple rows, which
+// Cassandra does not support.
+func (wt *writeTargets) checkConditional(cs *conditions, kind string) error {
+	switch {
+	case cs == nil:
+		return nil
+	case len(wt.keys) > 1:
+		return invalid("IN on the partition key is not supported with conditional %s", kind)
+	case len(wt.clusterings) > 1:
+		return invalid("IN on the clustering key columns is not supported with conditional %s", kind)
+	}
+	return nil
+}
+
+// writeTargets evaluates the WHERE clause of an UPDATE or DELETE statement.
+// The partition key has to be fully restricted by EQ or IN. Slices on the
+// clustering columns are only supported by DELETE.
+func (r *request) writeTargets(t *Table, where []parser.Relation, statement string) (*writeTargets, error) {
+	rs := &restrictions{table: t, columns: map[string]*restriction{}}
+	nonKey := []string{}
+
+	for _, rel := range where {
+		switch left := rel.Left.(type) {
+		case *parser.Column:
+			c, found := t.Column(left.Name)
+			if !found {
+				return nil, invalid("Undefined column name %s", left.Name)
+			}
+			if !c.IsPrimaryKey() {
+				nonKey = append(nonKey, c.Name)
+				continue
+			}
+			if err := r.restrictColumn(rs, c, rel); err != nil {
+				return nil, err
+			}
+		case *parser.Tuple:
+			return nil, invalid("Multi-column relations cannot be used in WHERE clauses for UPDATE and DELETE statements: %s", rel)
+		default:
+			return nil, invalid("Unsupported restriction: %s", rel)
+		}
+	}
+
+	if len(nonKey) > 0 {
+		return nil, invalid("Non PRIMARY KEY columns found in where clause: %s ", strings.Join(nonKey, ", "))
+	}
+
+	wt := &writeTargets{keys: [][][]byte{{}}, prefixes: [][][]byte{{}}}
+
+	missing := []string{}
+	for _, c := range t.PartitionKey {
+		res, found := rs.columns[c.Name]
+		switch {
+		case !found:
+			missing = append(missing, c.Name)
+		case !res.eq:
+			return nil, invalid("Only EQ and IN relation are supported on the partition key (unless you use the token() function)")
+		default:
+			wt.keys = product(wt.keys, res.values)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, invalid("Some partition key parts are missing: %s", strings.Join(missing, ", "))
+	}
+
+	var gap *Column
+	for _, c := range t.ClusteringKey {
+		res, found := rs.columns[c.Name]
+		switch {
+		case !found:
+			if gap == nil {
+				gap = c
+			}
+			wt.missing = append(wt.missing, c.Name)
+		case gap != nil:
+			return nil, invalid("PRIMARY KEY column \"%s\" cannot be restricted as preceding column \"%s\" is not restricted", c.Name, gap.Name)
+		case wt.slice != nil:
+			return nil, invalid("Clustering column \"%s\" cannot be restricted (preceding column \"%s\" is restricted by a non-EQ relation)", c.Name, wt.slice.column.Name)
+		case !res.eq:
+			if statement != "DELETE" {
+				return nil, invalid("Slice restrictions are not supported on the clustering columns in %s statements", statement)
+			}
+			wt.slice = res
+		default:
+			wt.prefixes = product(wt.prefixes, res.values)
+		}
+	}
+
+	if gap == nil && wt.slice == nil {
+		wt.clusterings = wt.prefixes
+	}
+
+	return wt, nil
+}
+
+// product returns the cartesian product of the given prefixes and values,
+// e.g. of the partition keys restricted by IN.
+func product(prefixes [][][]byte, values [][]byte) [][][]byte {
+	result := [][][]byte{}
+	for _, prefix := range prefixes {
+		for _, v := range values {
+			result = append(result, append(append([][]byte{}, prefix...), v))
+		}
+	}
+	return result
+}
@@ -0,0 +1,166 @@
+package engine_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/types"
+	"github.com/st3v/fakesandra/engine"
+)
+
+var _ = Describe("Writes", func() {
+	var e *engine.Engine
+
+	BeforeEach(func() {
+		e = engine.New()
+		exec(e, "CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}")
+		exec(e, "CREATE TABLE ks.t (p text, c text, s text STATIC, v text, PRIMARY KEY (p, c))")
+	})
+
+	Describe("timestamps", func() {
+		It("keeps the write with the highest timestamp", func() {
+			exec(e, "INSERT INTO ks.t (p, c, v) VALUES ('a', 'x', 'new') USING TIMESTAMP 20")
+			exec(e, "INSERT INTO ks.t (p, c, v) VALUES ('a', 'x', 'old') USING TIMESTAMP 10")
+			Expect(values(e, "SELECT v FROM ks.t")).To(Equal([][]interface{}{{"new"}}))
+
+			exec(e, "UPDATE ks.t USING TIMESTAMP 30 SET v = 'newer' WHERE p = 'a' AND c = 'x'")
+			Expect(values(e, "SELECT v FROM ks.t")).To(Equal([][]interface{}{{"newer"}}))
+		})
+
+		It("resolves ties by value", func() {
+			exec(e, "INSERT INTO ks.t (p, c, v) VALUES ('a', 'x', 'b') USING TIMESTAMP 10")
+			exec(e, "INSERT INTO ks.t (p, c, v) VALUES ('a', 'x', 'a') USING TIMESTAMP 10")
+			Expect(values(e, "SELECT v FROM ks.t")).To(Equal([][]interface{}{{"b"}}))
+		})
+
+		It("uses the default timestamp of the query", func() {
+			_, err := e.ExecuteQuery(query{
+				statement: "INSERT INTO ks.t (p, c, v) VALUES ('a', 'x', 'client')",
+				timestamp: time.Unix(0, 50000),
+			}, proto.NewSession())
+			Expect(err).NotTo(HaveOccurred())
+
+			exec(e, "INSERT INTO ks.t (p, c, v) VALUES ('a', 'x', 'older') USING TIMESTAMP 49")
+			Expect(values(e, "SELECT v FROM ks.t")).To(Equal([][]interface{}{{"client"}}))
+
+			exec(e, "INSERT INTO ks.t (p, c, v) VALUES ('a', 'x', 'newer') USING TIMESTAMP 51")
+			Expect(values(e, "SELECT v FROM ks.t")).To(Equal([][]interface{}{{"newer"}}))
+		})
+
+		It("binds USING TIMESTAMP", func() {
+			ts, _ := types.Marshal(types.Native(types.Bigint), 100)
+			_, err := e.ExecuteQuery(query{
+				statement: "INSERT INTO ks.t (p, c, v) VALUES ('a', 'x', 'bound') USING TIMESTAMP ?",
+				values:    [][]byte{ts},
+			}, proto.NewSession())
+			Expect(err).NotTo(HaveOccurred())
+
+			exec(e, "INSERT INTO ks.t (p, c, v) VALUES ('a', 'x', 'older') USING TIMESTAMP 99")
+			Expect(values(e, "SELECT v FROM ks.t")).To(Equal([][]interface{}{{"bound"}}))
+		})
+
+		Context("when the clock stands still", func() {
+			BeforeEach(func() {
+				e.Clock().Set(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+			})
+
+			It("orders consecutive updates", func() {
+				exec(e, "INSERT INTO ks.t (p, c, v) VALUES ('a', 'x', 'b')")
+				exec(e, "UPDATE ks.t SET v = 'a' WHERE p = 'a' AND c = 'x'")
+				Expect(values(e, "SELECT v FROM ks.t")).To(Equal([][]interface{}{{"a"}}))
+
+				Expect(values(e, "SELECT WRITETIME(v) FROM ks.t")).To(Equal([][]interface{}{{int64(1577836800000001)}}))
+			})
+
+			It("inserts rows again after deleting them", func() {
+				exec(e, "INSERT INTO ks.t (p, c, v) VALUES ('a', 'x', 'first')")
+				exec(e, "DELETE FROM ks.t WHERE p = 'a' AND c = 'x'")
+				exec(e, "INSERT INTO ks.t (p, c, v) VALUES ('a', 'x', 'second')")
+				Expect(values(e, "SELECT v FROM ks.t")).To(Equal([][]interface{}{{"second"}}))
+			})
+
+			It("applies lightweight transactions after earlier writes", func() {
+				exec(e, "INSERT INTO ks.t (p, c, v) VALUES ('a', 'x', 'b')")
+				Expect(values(e, "UPDATE ks.t SET v = 'a' WHERE p = 'a' AND c = 'x' IF v = 'b'")).To(Equal([][]interface{}{{true}}))
+				Expect(values(e, "SELECT v FROM ks.t")).To(Equal([][]interface{}{{"a"}}))
+			})
+		})
+	})
+
+	Describe("DELETE", func() {
+		BeforeEach(func() {
+			for _, c := range []string{"w", "x", "y", "z"} {
+				exec(e, "INSERT INTO ks.t (p, c, s, v) VALUES ('a', '"+c+"', 's', '"+c+"') USING TIMESTAMP 10")
+			}
+			exec(e, "INSERT INTO ks.t (p, c, v) VALUES ('b', 'x', 'bx') USING TIMESTAMP 10")
+		})
+
+		It("deletes cells", func() {
+			exec(e, "DELETE v FROM ks.t USING TIMESTAMP 20 WHERE p = 'a' AND c = 'x'")
+			Expect(values(e, "SELECT c, v FROM ks.t WHERE p = 'a' AND c = 'x'")).To(Equal([][]interface{}{{"x", nil}}))
+		})
+
+		It("deletes static cells", func() {
+			exec(e, "DELETE s FROM ks.t USING TIMESTAMP 20 WHERE p = 'a'")
+			Expect(values(e, "SELECT s FROM ks.t WHERE p = 'a' LIMIT 1")).To(Equal([][]interface{}{{nil}}))
+		})
+
+		It("deletes rows", func() {
+			exec(e, "DELETE FROM ks.t USING TIMESTAMP 20 WHERE p = 'a' AND c IN ('x', 'z')")
+			Expect(values(e, "SELECT c FROM ks.t WHERE p = 'a'")).To(Equal([][]interface{}{{"w"}, {"y"}}))
+		})
+
+		It("deletes ranges of rows", func() {
+			exec(e, "DELETE FROM ks.t USING TIMESTAMP 20 WHERE p = 'a' AND c > 'w' AND c <= 'y'")
+			Expect(values(e, "SELECT c FROM ks.t WHERE p = 'a'")).To(Equal([][]interface{}{{"w"}, {"z"}}))
+		})
+
+		It("deletes partitions", func() {
+			exec(e, "DELETE FROM ks.t USING TIMESTAMP 20 WHERE p = 'a'")
+			Expect(values(e, "SELECT p, c FROM ks.t")).To(Equal([][]interface{}{{"b", "x"}}))
+		})
+
+		It("shadows only older writes", func() {
+			exec(e, "DELETE FROM ks.t USING TIMESTAMP 20 WHERE p = 'a'")
+			exec(e, "INSERT INTO ks.t (p, c, v) VALUES ('a', 'x', 'old') USING TIMESTAMP 15")
+			Expect(values(e, "SELECT c FROM ks.t WHERE p = 'a'")).To(BeEmpty())
+
+			exec(e, "UPDATE ks.t USING TIMESTAMP 25 SET v = 'new' WHERE p = 'a' AND c = 'x'")
+			Expect(values(e, "SELECT c, s, v FROM ks.t WHERE p = 'a'")).To(Equal([][]interface{}{{"x", nil, "new"}}))
+		})
+
+		It("keeps rows alive that were inserted", func() {
+			exec(e, "DELETE v FROM ks.t USING TIMESTAMP 20 WHERE p = 'b' AND c = 'x'")
+			Expect(values(e, "SELECT c, v FROM ks.t WHERE p = 'b'")).To(Equal([][]interface{}{{"x", nil}}))
+
+			exec(e, "UPDATE ks.t USING TIMESTAMP 30 SET v = 'u' WHERE p = 'c' AND c = 'x'")
+			exec(e, "DELETE v FROM ks.t USING TIMESTAMP 40 WHERE p = 'c' AND c = 'x'")
+			Expect(values(e, "SELECT c FROM ks.t WHERE p = 'c'")).To(BeEmpty())
+		})
+
+		It("refuses invalid deletions", func() {
+			expectInvalid(e, "DELETE FROM ks.t WHERE c = 'x'", "Some partition key parts are missing: p")
+			expectInvalid(e, "DELETE FROM ks.t WHERE p = 'a' AND v = 'x'", "Non PRIMARY KEY columns found in where clause: v ")
+			expectInvalid(e, "DELETE c FROM ks.t WHERE p = 'a' AND c = 'x'", "Invalid identifier c for deletion (should not be a PRIMARY KEY part)")
+			expectInvalid(e, "DELETE v FROM ks.t WHERE p = 'a' AND c > 'x'", "Range deletions are not supported for specific columns")
+			expectInvalid(e, "DELETE v FROM ks.t WHERE p = 'a'", "Some clustering keys are missing: c")
+		})
+	})
+
+	It("updates multiple rows with IN", func() {
+		exec(e, "UPDATE ks.t SET v = 'u' WHERE p IN ('a', 'b') AND c IN ('x', 'y')")
+		Expect(values(e, "SELECT p, c, v FROM ks.t")).To(Equal([][]interface{}{
+			{"a", "x", "u"},
+			{"a", "y", "u"},
+			{"b", "x", "u"},
+			{"b", "y", "u"},
+		}))
+	})
+
+	It("refuses slices in UPDATE", func() {
+		expectInvalid(e, "UPDATE ks.t SET v = 'u' WHERE p = 'a' AND c > 'x'", "Slice restrictions are not supported on the clustering columns in UPDATE statements")
+	})
+})
@@ -0,0 +1,13 @@
+package fakesandra_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestFakesandra(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Fakesandra")
+}
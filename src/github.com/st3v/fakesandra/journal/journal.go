@@ -0,0 +1,111 @@
+package journal
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/st3v/fakesandra/cql/proto"
+)
+
+// Entry is a single query recorded by a Journal.
+type Entry struct {
+	Statement   string
+	Consistency proto.Consistency
+	Values      [][]byte
+	ReceivedAt  time.Time
+}
+
+func (e Entry) String() string {
+	return fmt.Sprintf(`"%s" [Consistency: %s]`, e.Statement, e.Consistency)
+}
+
+func newEntry(qry proto.Query) Entry {
+	values, _ := qry.Values()
+	return Entry{
+		Statement:   qry.Statement(),
+		Consistency: qry.Consistency(),
+		Values:      values,
+		ReceivedAt:  time.Now(),
+	}
+}
+
+// Journal records the queries received by a server. It keeps track of all
+// queries as well as the ones that were not handled by anything but the
+// fallback handler of a query chain.
+type Journal struct {
+	mu        sync.RWMutex
+	entries   []Entry
+	unmatched []Entry
+}
+
+func New() *Journal {
+	return &Journal{}
+}
+
+// ServeQuery records the query. It never writes a response and can therefore
+// be prepended to any query handler chain.
+func (j *Journal) ServeQuery(qry proto.Query, req proto.Frame, rw proto.ResponseWriter) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries = append(j.entries, newEntry(qry))
+}
+
+// UnmatchedRecorder returns a query handler that records queries as
+// unmatched. It has to be the last handler in front of the fallback.
+func (j *Journal) UnmatchedRecorder() proto.QueryHandler {
+	return proto.QueryHandlerFunc(
+		func(qry proto.Query, req proto.Frame, rw proto.ResponseWriter) {
+			j.mu.Lock()
+			defer j.mu.Unlock()
+			j.unmatched = append(j.unmatched, newEntry(qry))
+		},
+	)
+}
+
+// Entries returns all recorded queries in the order they were received.
+func (j *Journal) Entries() []Entry {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return append([]Entry{}, j.entries...)
+}
+
+// Unmatched returns the recorded queries that were handled by nothing but
+// the fallback handler.
+func (j *Journal) Unmatched() []Entry {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return append([]Entry{}, j.unmatched...)
+}
+
+// TestingT is satisfied by *testing.T and GinkgoT().
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+// Verify reports an error to t that lists every unmatched query. Use it as a
+// cleanup hook to fail tests that sent unexpected queries, e.g.
+//
+//	t.Cleanup(func() { fakesandra.DefaultJournal.Verify(t) })
+func (j *Journal) Verify(t TestingT) {
+	unmatched := j.Unmatched()
+	if len(unmatched) == 0 {
+		return
+	}
+
+	stmts := make([]string, len(unmatched))
+	for i, e := range unmatched {
+		stmts[i] = "\t" + e.String()
+	}
+
+	t.Errorf("Received %d unexpected queries:\n%s", len(unmatched), strings.Join(stmts, "\n"))
+}
+
+// Reset discards all recorded queries.
+func (j *Journal) Reset() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries = nil
+	j.unmatched = nil
+}
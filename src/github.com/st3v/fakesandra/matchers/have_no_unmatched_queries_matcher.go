@@ -0,0 +1,33 @@
+package matchers
+
+import (
+	"fmt"
+
+	"github.com/st3v/fakesandra/journal"
+)
+
+type HaveNoUnmatchedQueriesMatcher struct {
+	unmatched []journal.Entry
+}
+
+func (matcher *HaveNoUnmatchedQueriesMatcher) Match(actual interface{}) (bool, error) {
+	j, err := toJournal(actual, "HaveNoUnmatchedQueries")
+	if err != nil {
+		return false, err
+	}
+
+	matcher.unmatched = j.Unmatched()
+	return len(matcher.unmatched) == 0, nil
+}
+
+func (matcher *HaveNoUnmatchedQueriesMatcher) FailureMessage(actual interface{}) string {
+	return fmt.Sprintf(
+		"Expected no unmatched queries, but %d queries were only handled by the fallback:\n%s",
+		len(matcher.unmatched),
+		listEntries("Unmatched queries:", matcher.unmatched),
+	)
+}
+
+func (matcher *HaveNoUnmatchedQueriesMatcher) NegatedFailureMessage(actual interface{}) string {
+	return "Expected unmatched queries, but every query was handled."
+}
@@ -0,0 +1,79 @@
+package matchers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/st3v/fakesandra/journal"
+)
+
+type HaveReceivedQueriesInOrderMatcher struct {
+	Patterns []string
+
+	// index of the first pattern that could not be matched and the entries
+	// received after the last match, i.e. those it was matched against
+	missing   int
+	remaining []journal.Entry
+}
+
+func (matcher *HaveReceivedQueriesInOrderMatcher) Match(actual interface{}) (bool, error) {
+	j, err := toJournal(actual, "HaveReceivedQueriesInOrder")
+	if err != nil {
+		return false, err
+	}
+
+	res := make([]*regexp.Regexp, len(matcher.Patterns))
+	for i, p := range matcher.Patterns {
+		if res[i], err = compile(p); err != nil {
+			return false, err
+		}
+	}
+
+	entries := j.Entries()
+	next := 0
+	for i, re := range res {
+		start, found := next, false
+		for next < len(entries) && !found {
+			found = re.MatchString(entries[next].Statement)
+			next++
+		}
+
+		if !found {
+			matcher.missing = i
+			matcher.remaining = entries[start:]
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (matcher *HaveReceivedQueriesInOrderMatcher) patterns() string {
+	quoted := make([]string, len(matcher.Patterns))
+	for i, p := range matcher.Patterns {
+		quoted[i] = fmt.Sprintf("\t%q", p)
+	}
+	return strings.Join(quoted, "\n")
+}
+
+func (matcher *HaveReceivedQueriesInOrderMatcher) FailureMessage(actual interface{}) string {
+	pattern := matcher.Patterns[matcher.missing]
+	closestEntries := "No queries have been received after the preceding ones."
+	if len(matcher.remaining) > 0 {
+		closestEntries = listEntries("Closest queries received after the preceding ones:", closest(pattern, matcher.remaining))
+	}
+	return fmt.Sprintf(
+		"Expected to have received queries matching, in order\n%s\nNo query matching\n\t%q\nwas received after the preceding ones.\n%s",
+		matcher.patterns(),
+		pattern,
+		closestEntries,
+	)
+}
+
+func (matcher *HaveReceivedQueriesInOrderMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf(
+		"Expected not to have received queries matching, in order\n%s",
+		matcher.patterns(),
+	)
+}
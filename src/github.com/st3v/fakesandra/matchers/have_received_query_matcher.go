@@ -0,0 +1,63 @@
+package matchers
+
+import (
+	"fmt"
+
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/journal"
+)
+
+type HaveReceivedQueryMatcher struct {
+	Pattern     string
+	Consistency *proto.Consistency
+
+	entries []journal.Entry
+}
+
+func (matcher *HaveReceivedQueryMatcher) Match(actual interface{}) (bool, error) {
+	j, err := toJournal(actual, "HaveReceivedQuery")
+	if err != nil {
+		return false, err
+	}
+
+	re, err := compile(matcher.Pattern)
+	if err != nil {
+		return false, err
+	}
+
+	matcher.entries = j.Entries()
+	for _, e := range matcher.entries {
+		if re.MatchString(e.Statement) && matcher.consistencyMatches(e) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (matcher *HaveReceivedQueryMatcher) consistencyMatches(e journal.Entry) bool {
+	return matcher.Consistency == nil || *matcher.Consistency == e.Consistency
+}
+
+func (matcher *HaveReceivedQueryMatcher) expectation() string {
+	if matcher.Consistency == nil {
+		return fmt.Sprintf("a query matching\n\t%q", matcher.Pattern)
+	}
+	return fmt.Sprintf("a query matching\n\t%q\nwith consistency %s", matcher.Pattern, *matcher.Consistency)
+}
+
+func (matcher *HaveReceivedQueryMatcher) FailureMessage(actual interface{}) string {
+	return fmt.Sprintf(
+		"Expected to have received %s\n%s",
+		matcher.expectation(),
+		listEntries("Closest received queries:", closest(matcher.Pattern, matcher.entries)),
+	)
+}
+
+func (matcher *HaveReceivedQueryMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf(
+		"Expected not to have received %s\n%s",
+		matcher.expectation(),
+		listEntries("Closest received queries:", closest(matcher.Pattern, matcher.entries)),
+	)
+}
@@ -0,0 +1,29 @@
+package matchers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// Resetter is implemented by *journal.Journal.
+type Resetter interface {
+	Reset()
+}
+
+// ResetBeforeEach registers a BeforeEach block that resets j, so assertions
+// in each spec only see the queries sent by that spec. It has to be called
+// from within a container such as Describe or Context.
+func ResetBeforeEach(j Resetter) {
+	BeforeEach(func() {
+		j.Reset()
+	})
+}
+
+// FailOnUnexpectedQueries registers an AfterEach block that fails the spec
+// if j recorded any unmatched queries, listing each of them. Combine it with
+// fakesandra.Strict to catch queries that would otherwise silently succeed.
+func FailOnUnexpectedQueries(j Journal) {
+	AfterEach(func() {
+		Expect(j).To(HaveNoUnmatchedQueries())
+	})
+}
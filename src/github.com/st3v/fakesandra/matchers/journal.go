@@ -0,0 +1,98 @@
+package matchers
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/onsi/gomega/format"
+
+	"github.com/st3v/fakesandra/journal"
+)
+
+// maxClosest limits the number of queries listed in failure messages.
+const maxClosest = 3
+
+// Journal is implemented by *journal.Journal.
+type Journal interface {
+	Entries() []journal.Entry
+	Unmatched() []journal.Entry
+}
+
+func toJournal(actual interface{}, matcher string) (Journal, error) {
+	j, ok := actual.(Journal)
+	if !ok {
+		return nil, fmt.Errorf("%s matcher expects a journal.  Got:\n%s", matcher, format.Object(actual, 1))
+	}
+	return j, nil
+}
+
+func compile(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid query pattern %q: %s", pattern, err)
+	}
+	return re, nil
+}
+
+// closest returns the entries whose statements are closest to pattern in
+// terms of edit distance, closest first.
+func closest(pattern string, entries []journal.Entry) []journal.Entry {
+	type candidate struct {
+		entry    journal.Entry
+		distance int
+	}
+
+	candidates := make([]candidate, len(entries))
+	for i, e := range entries {
+		candidates[i] = candidate{e, distance(strings.ToLower(pattern), strings.ToLower(e.Statement))}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+
+	result := []journal.Entry{}
+	for i := 0; i < len(candidates) && i < maxClosest; i++ {
+		result = append(result, candidates[i].entry)
+	}
+	return result
+}
+
+// distance returns the Levenshtein distance between a and b.
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func listEntries(header string, entries []journal.Entry) string {
+	if len(entries) == 0 {
+		return "No queries have been received."
+	}
+
+	lines := []string{header}
+	for _, e := range entries {
+		lines = append(lines, format.Indent+e.String())
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,46 @@
+// Package matchers provides Gomega matchers that make assertions about the
+// queries recorded by a fakesandra journal.
+//
+//	Expect(fakesandra.DefaultJournal).To(HaveReceivedQuery(`INSERT INTO users`))
+//
+// Patterns are regular expressions that are matched against the
+// whitespace-collapsed statement of each recorded query.
+package matchers
+
+import (
+	"github.com/onsi/gomega/types"
+
+	"github.com/st3v/fakesandra/cql/proto"
+)
+
+// HaveReceivedQuery succeeds if the journal contains at least one query
+// matching pattern.
+func HaveReceivedQuery(pattern string) types.GomegaMatcher {
+	return &HaveReceivedQueryMatcher{
+		Pattern: pattern,
+	}
+}
+
+// HaveReceivedQueryWithConsistency succeeds if the journal contains at least
+// one query matching pattern that was sent with the given consistency.
+func HaveReceivedQueryWithConsistency(pattern string, consistency proto.Consistency) types.GomegaMatcher {
+	return &HaveReceivedQueryMatcher{
+		Pattern:     pattern,
+		Consistency: &consistency,
+	}
+}
+
+// HaveReceivedQueriesInOrder succeeds if the journal contains queries
+// matching the given patterns in the given order. Other queries may have
+// been received in between.
+func HaveReceivedQueriesInOrder(patterns ...string) types.GomegaMatcher {
+	return &HaveReceivedQueriesInOrderMatcher{
+		Patterns: patterns,
+	}
+}
+
+// HaveNoUnmatchedQueries succeeds if every query recorded by the journal has
+// been handled by something other than the fallback handler.
+func HaveNoUnmatchedQueries() types.GomegaMatcher {
+	return &HaveNoUnmatchedQueriesMatcher{}
+}
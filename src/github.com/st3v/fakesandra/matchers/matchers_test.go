@@ -0,0 +1,138 @@
+package matchers_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/cql/parser"
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/journal"
+	. "github.com/st3v/fakesandra/matchers"
+)
+
+type query struct {
+	statement   string
+	consistency proto.Consistency
+}
+
+func (q query) String() string                               { return q.statement }
+func (q query) Statement() string                            { return q.statement }
+func (q query) Parsed() (parser.Statement, error)            { return parser.Parse(q.statement) }
+func (q query) Consistency() proto.Consistency               { return q.consistency }
+func (q query) Values() ([][]byte, bool)                     { return nil, false }
+func (q query) NamedValues() (map[string][]byte, bool)       { return nil, false }
+func (q query) SkipMetadata() bool                           { return false }
+func (q query) PageSize() (int32, bool)                      { return 0, false }
+func (q query) PagingState() ([]byte, bool)                  { return nil, false }
+func (q query) SerialConsistency() (proto.Consistency, bool) { return 0, false }
+func (q query) DefaultTimestamp() (time.Time, bool)          { return time.Time{}, false }
+
+var _ = Describe("Matchers", func() {
+	var j *journal.Journal
+
+	receive := func(stmt string, c proto.Consistency) {
+		j.ServeQuery(query{stmt, c}, nil, nil)
+	}
+
+	BeforeEach(func() {
+		j = journal.New()
+		receive("CREATE KEYSPACE foo WITH REPLICATION = {}", proto.All)
+		receive("INSERT INTO foo.users (id, name) VALUES (?, ?)", proto.Quorum)
+		receive("SELECT * FROM foo.users WHERE id = ?", proto.One)
+	})
+
+	Describe("HaveReceivedQuery", func() {
+		It("matches a received query", func() {
+			Expect(j).To(HaveReceivedQuery(`INSERT INTO foo\.users`))
+		})
+
+		It("does not match a query that has not been received", func() {
+			Expect(j).ToNot(HaveReceivedQuery(`DELETE FROM`))
+		})
+
+		It("lists the closest queries on failure", func() {
+			matcher := HaveReceivedQuery(`SELECT * FROM foo.user WHERE`)
+			Expect(matcher.Match(j)).To(BeFalse())
+
+			msg := matcher.FailureMessage(j)
+			Expect(msg).To(ContainSubstring("Closest received queries:"))
+			Expect(msg).To(MatchRegexp(`(?s)queries:\n\s+"SELECT \* FROM foo\.users`))
+		})
+
+		It("says so when nothing has been received", func() {
+			j.Reset()
+			matcher := HaveReceivedQuery(`SELECT`)
+			Expect(matcher.Match(j)).To(BeFalse())
+			Expect(matcher.FailureMessage(j)).To(ContainSubstring("No queries have been received."))
+		})
+
+		It("errors on anything but a journal", func() {
+			_, err := HaveReceivedQuery(`SELECT`).Match("foo")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("errors on invalid patterns", func() {
+			_, err := HaveReceivedQuery(`(`).Match(j)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("HaveReceivedQueryWithConsistency", func() {
+		It("matches statement and consistency", func() {
+			Expect(j).To(HaveReceivedQueryWithConsistency(`^INSERT`, proto.Quorum))
+		})
+
+		It("does not match a different consistency", func() {
+			matcher := HaveReceivedQueryWithConsistency(`^INSERT`, proto.LocalOne)
+			Expect(matcher.Match(j)).To(BeFalse())
+			Expect(matcher.FailureMessage(j)).To(ContainSubstring("with consistency LOCAL_ONE"))
+			Expect(matcher.FailureMessage(j)).To(ContainSubstring("[Consistency: QUORUM]"))
+		})
+	})
+
+	Describe("HaveReceivedQueriesInOrder", func() {
+		It("matches queries in order", func() {
+			Expect(j).To(HaveReceivedQueriesInOrder(`^CREATE`, `^SELECT`))
+		})
+
+		It("does not match queries out of order", func() {
+			matcher := HaveReceivedQueriesInOrder(`^SELECT`, `^INSERT`)
+			Expect(matcher.Match(j)).To(BeFalse())
+			Expect(matcher.FailureMessage(j)).To(ContainSubstring("No query matching\n\t\"^INSERT\""))
+		})
+
+		It("only lists queries received after the last match on failure", func() {
+			matcher := HaveReceivedQueriesInOrder(`^INSERT`, `^CREATE`)
+			Expect(matcher.Match(j)).To(BeFalse())
+
+			msg := matcher.FailureMessage(j)
+			Expect(msg).To(ContainSubstring("No query matching\n\t\"^CREATE\""))
+			Expect(msg).To(ContainSubstring("Closest queries received after the preceding ones:\n"))
+			Expect(msg).To(ContainSubstring("SELECT * FROM foo.users WHERE id = ?"))
+			Expect(msg).NotTo(ContainSubstring("CREATE KEYSPACE"))
+			Expect(msg).NotTo(ContainSubstring("INSERT INTO"))
+		})
+
+		It("reports when nothing was received after the last match", func() {
+			matcher := HaveReceivedQueriesInOrder(`^SELECT`, `^INSERT`)
+			Expect(matcher.Match(j)).To(BeFalse())
+			Expect(matcher.FailureMessage(j)).To(HaveSuffix("No queries have been received after the preceding ones."))
+		})
+	})
+
+	Describe("HaveNoUnmatchedQueries", func() {
+		It("matches when every query was handled", func() {
+			Expect(j).To(HaveNoUnmatchedQueries())
+		})
+
+		It("lists unmatched queries", func() {
+			j.UnmatchedRecorder().ServeQuery(query{"SELECT * FROM typo", proto.One}, nil, nil)
+
+			matcher := HaveNoUnmatchedQueries()
+			Expect(matcher.Match(j)).To(BeFalse())
+			Expect(matcher.FailureMessage(j)).To(ContainSubstring(`"SELECT * FROM typo"`))
+		})
+	})
+})
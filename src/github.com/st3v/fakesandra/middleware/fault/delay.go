@@ -0,0 +1,89 @@
+package fault
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Delay determines the latency added by a rule. The delays returned by
+// Fixed, Uniform and Normal marshal to the JSON form used by scenario files,
+// e.g. {"fixed": "100ms"}.
+type Delay interface {
+	fmt.Stringer
+	Duration() time.Duration
+}
+
+type fixed time.Duration
+
+// Fixed returns a Delay that always lasts d.
+func Fixed(d time.Duration) Delay {
+	return fixed(d)
+}
+
+func (f fixed) Duration() time.Duration {
+	return time.Duration(f)
+}
+
+func (f fixed) String() string {
+	return fmt.Sprintf("fixed(%s)", time.Duration(f))
+}
+
+func (f fixed) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"fixed": time.Duration(f).String()})
+}
+
+type uniform struct {
+	min, max time.Duration
+}
+
+// Uniform returns a Delay that is uniformly distributed in [min, max).
+func Uniform(min, max time.Duration) Delay {
+	return uniform{min, max}
+}
+
+func (u uniform) Duration() time.Duration {
+	if u.max <= u.min {
+		return u.min
+	}
+	return u.min + time.Duration(rand.Int63n(int64(u.max-u.min)))
+}
+
+func (u uniform) String() string {
+	return fmt.Sprintf("uniform(%s, %s)", u.min, u.max)
+}
+
+func (u uniform) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]map[string]string{
+		"uniform": {"min": u.min.String(), "max": u.max.String()},
+	})
+}
+
+type normal struct {
+	mean, stddev time.Duration
+}
+
+// Normal returns a Delay that is normally distributed around mean. Negative
+// samples are cut off at zero.
+func Normal(mean, stddev time.Duration) Delay {
+	return normal{mean, stddev}
+}
+
+func (n normal) Duration() time.Duration {
+	d := time.Duration(rand.NormFloat64()*float64(n.stddev)) + n.mean
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+func (n normal) String() string {
+	return fmt.Sprintf("normal(%s, %s)", n.mean, n.stddev)
+}
+
+func (n normal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]map[string]string{
+		"normal": {"mean": n.mean.String(), "stddev": n.stddev.String()},
+	})
+}
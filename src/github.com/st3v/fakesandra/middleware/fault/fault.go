@@ -0,0 +1,292 @@
+// Package fault provides middleware that makes fakesandra misbehave on
+// purpose. Rules added to an Injector select requests by opcode, statement
+// pattern, probability or occurrence and delay them, fail them with
+// realistic errors, swallow their responses or close their connections.
+package fault
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/proto/v3"
+)
+
+// Frame wraps next and applies the rules of inj to every request frame.
+// The IDs of the statements prepared through it are remembered, so that
+// EXECUTE and BATCH requests are matched against the prepared statements.
+func Frame(inj *Injector, next proto.FrameHandler) proto.FrameHandler {
+	return proto.FrameHandlerFunc(func(req proto.Frame, rw proto.ResponseWriter) {
+		stmts := inj.statements(req)
+		cl, serial := consistency(req)
+		inj.apply(req.Opcode(), stmts, cl, serial, req, rw, func(rw proto.ResponseWriter) {
+			if req.Opcode() == proto.OpPrepare && len(stmts) == 1 {
+				rw = preparedRecorder{rw: rw, inj: inj, stmt: stmts[0]}
+			}
+			next.ServeCQL(req, rw)
+		})
+	})
+}
+
+// Query wraps next and applies the rules of inj to every query.
+func Query(inj *Injector, next proto.QueryHandler) proto.QueryHandler {
+	return proto.QueryHandlerFunc(func(qry proto.Query, req proto.Frame, rw proto.ResponseWriter) {
+		serial, set := qry.SerialConsistency()
+		if !set {
+			serial = proto.Serial
+		}
+		inj.apply(proto.OpQuery, []string{qry.Statement()}, qry.Consistency(), serial, req, rw, func(rw proto.ResponseWriter) {
+			next.ServeQuery(qry, req, rw)
+		})
+	})
+}
+
+// apply triggers the first matching rule, if any, and passes the request on
+// to next unless the rule fails it or closes the connection. Requests whose
+// responses are dropped are still executed, just like a write that reached
+// Cassandra but whose response got lost.
+func (inj *Injector) apply(opcode proto.Opcode, stmts []string, cl, serial proto.Consistency, req proto.Frame, rw proto.ResponseWriter, next func(proto.ResponseWriter)) {
+	r := inj.match(opcode, stmts)
+	if r == nil {
+		next(rw)
+		return
+	}
+
+	if r.Latency != nil {
+		time.Sleep(r.Latency.Duration())
+	}
+
+	switch {
+	case r.Close:
+		conn, err := proto.Hijack(rw)
+		if err != nil {
+			log.Printf("Error closing connection: %s", err)
+			return
+		}
+		conn.Close()
+	case r.Drop:
+		next(discardWriter{rw})
+	case r.Error != nil:
+		rw.WriteFrame(r.Error.response(req, cl, serial))
+	default:
+		next(rw)
+	}
+}
+
+// discardWriter swallows the responses written to it. It keeps the session
+// of the wrapped writer, so that dropped requests such as USE still take
+// effect.
+type discardWriter struct {
+	rw proto.ResponseWriter
+}
+
+func (dw discardWriter) WriteFrame(f proto.Frame) error {
+	return nil
+}
+
+func (dw discardWriter) Session() *proto.Session {
+	return proto.SessionOf(dw.rw)
+}
+
+// preparedRecorder remembers the ID of the statement prepared by a PREPARE
+// request from the response written to it.
+type preparedRecorder struct {
+	rw   proto.ResponseWriter
+	inj  *Injector
+	stmt string
+}
+
+func (pr preparedRecorder) WriteFrame(f proto.Frame) error {
+	if f.Opcode() == proto.OpResult {
+		r := bytes.NewReader(f.Body())
+		var kind int32
+		if err := proto.ReadInt(r, &kind); err == nil && v3.ResultCode(kind) == v3.ResultPrepared {
+			if id, err := proto.ReadShortBytes(r); err == nil {
+				pr.inj.prepare(id, pr.stmt)
+			}
+		}
+	}
+	return pr.rw.WriteFrame(f)
+}
+
+func (pr preparedRecorder) Session() *proto.Session {
+	return proto.SessionOf(pr.rw)
+}
+
+func (pr preparedRecorder) Hijack() (net.Conn, error) {
+	return proto.Hijack(pr.rw)
+}
+
+// statements returns the query strings of QUERY and PREPARE requests, the
+// prepared statement of EXECUTE requests and the statements of BATCH
+// requests. Statements that were not prepared through inj are unknown and
+// left out.
+func (inj *Injector) statements(req proto.Frame) []string {
+	r := bytes.NewReader(req.Body())
+
+	switch req.Opcode() {
+	case proto.OpQuery, proto.OpPrepare:
+		stmt, err := proto.ReadLongString(r)
+		if err != nil {
+			return nil
+		}
+		return []string{proto.TrimStatement(stmt)}
+	case proto.OpExecute:
+		id, err := proto.ReadShortBytes(r)
+		if err != nil {
+			return nil
+		}
+		if stmt, found := inj.statement(id); found {
+			return []string{stmt}
+		}
+	case proto.OpBatch:
+		return inj.batchStatements(r)
+	}
+	return nil
+}
+
+// Kinds of the statements of BATCH requests.
+const (
+	batchQueryString = 0
+	batchPreparedID  = 1
+)
+
+// batchStatements reads the statements of the body of a BATCH request.
+func (inj *Injector) batchStatements(r io.Reader) []string {
+	var typ uint8
+	if err := proto.ReadByte(r, &typ); err != nil {
+		return nil
+	}
+
+	var n uint16
+	if err := proto.ReadShort(r, &n); err != nil {
+		return nil
+	}
+
+	stmts := []string{}
+	for i := uint16(0); i < n; i++ {
+		var kind uint8
+		if err := proto.ReadByte(r, &kind); err != nil {
+			return stmts
+		}
+
+		switch kind {
+		case batchQueryString:
+			stmt, err := proto.ReadLongString(r)
+			if err != nil {
+				return stmts
+			}
+			stmts = append(stmts, proto.TrimStatement(stmt))
+		case batchPreparedID:
+			id, err := proto.ReadShortBytes(r)
+			if err != nil {
+				return stmts
+			}
+			if stmt, found := inj.statement(id); found {
+				stmts = append(stmts, stmt)
+			}
+		default:
+			return stmts
+		}
+
+		var values uint16
+		if err := proto.ReadShort(r, &values); err != nil {
+			return stmts
+		}
+		for j := uint16(0); j < values; j++ {
+			if _, err := proto.ReadBytes(r); err != nil {
+				return stmts
+			}
+		}
+	}
+	return stmts
+}
+
+// consistency returns the consistency and the serial consistency of QUERY
+// and EXECUTE requests. They default to ONE and SERIAL respectively.
+func consistency(req proto.Frame) (proto.Consistency, proto.Consistency) {
+	cl, serial := proto.One, proto.Serial
+	r := bytes.NewReader(req.Body())
+
+	switch req.Opcode() {
+	case proto.OpQuery:
+		if _, err := proto.ReadLongString(r); err != nil {
+			return cl, serial
+		}
+	case proto.OpExecute:
+		if _, err := proto.ReadShortBytes(r); err != nil {
+			return cl, serial
+		}
+	default:
+		return cl, serial
+	}
+
+	var c proto.Consistency
+	if err := proto.ReadConsistency(r, &c); err != nil {
+		return cl, serial
+	}
+
+	if s, err := serialConsistency(r); err == nil {
+		serial = s
+	}
+	return c, serial
+}
+
+// Query flags that precede the serial consistency of a request.
+const (
+	flagValues            = 0x01
+	flagPageSize          = 0x04
+	flagPagingState       = 0x08
+	flagSerialConsistency = 0x10
+	flagNames             = 0x40
+)
+
+// serialConsistency reads the serial consistency from the query parameters
+// following the consistency of a request.
+func serialConsistency(r io.Reader) (proto.Consistency, error) {
+	var flags uint8
+	if err := proto.ReadByte(r, &flags); err != nil {
+		return 0, err
+	}
+
+	if flags&flagValues != 0 {
+		var n uint16
+		if err := proto.ReadShort(r, &n); err != nil {
+			return 0, err
+		}
+		for i := uint16(0); i < n; i++ {
+			if flags&flagNames != 0 {
+				if _, err := proto.ReadString(r); err != nil {
+					return 0, err
+				}
+			}
+			if _, err := proto.ReadBytes(r); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if flags&flagPageSize != 0 {
+		var size int32
+		if err := proto.ReadInt(r, &size); err != nil {
+			return 0, err
+		}
+	}
+
+	if flags&flagPagingState != 0 {
+		if _, err := proto.ReadBytes(r); err != nil {
+			return 0, err
+		}
+	}
+
+	if flags&flagSerialConsistency == 0 {
+		return proto.Serial, nil
+	}
+
+	var serial proto.Consistency
+	err := proto.ReadConsistency(r, &serial)
+	return serial, err
+}
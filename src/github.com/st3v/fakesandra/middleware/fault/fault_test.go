@@ -0,0 +1,269 @@
+package fault_test
+
+import (
+	"bytes"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/proto/v3"
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/engine"
+	"github.com/st3v/fakesandra/middleware/fault"
+)
+
+type recorder struct {
+	frames []proto.Frame
+}
+
+func (r *recorder) WriteFrame(f proto.Frame) error {
+	r.frames = append(r.frames, f)
+	return nil
+}
+
+func queryFrame(stmt string, cl proto.Consistency) proto.Frame {
+	body := new(bytes.Buffer)
+	proto.WriteLongString(body, stmt)
+	proto.WriteShort(body, uint16(cl))
+	proto.WriteByte(body, 0)
+	return requestFrame(proto.OpQuery, body)
+}
+
+// serialQueryFrame returns a QUERY frame with a bound value, a page size and
+// a serial consistency.
+func serialQueryFrame(stmt string, cl, serial proto.Consistency) proto.Frame {
+	body := new(bytes.Buffer)
+	proto.WriteLongString(body, stmt)
+	proto.WriteShort(body, uint16(cl))
+	proto.WriteByte(body, 0x01|0x04|0x10)
+	proto.WriteShort(body, 1)
+	proto.WriteBytes(body, []byte{0, 0, 0, 1})
+	proto.WriteInt(body, 100)
+	proto.WriteShort(body, uint16(serial))
+	return requestFrame(proto.OpQuery, body)
+}
+
+func requestFrame(oc proto.Opcode, body *bytes.Buffer) proto.Frame {
+	buf := new(bytes.Buffer)
+	proto.WriteByte(buf, 0)
+	proto.WriteShort(buf, 7)
+	proto.WriteByte(buf, uint8(oc))
+	proto.WriteInt(buf, int32(body.Len()))
+	buf.Write(body.Bytes())
+
+	f, err := v3.RequestFramer().Frame(buf)
+	Expect(err).ToNot(HaveOccurred())
+	return f
+}
+
+var _ = Describe("Frame", func() {
+	var (
+		inj     *fault.Injector
+		rw      *recorder
+		handled int
+		handler proto.FrameHandler
+	)
+
+	BeforeEach(func() {
+		inj = fault.NewInjector()
+		rw = &recorder{}
+		handled = 0
+		handler = fault.Frame(inj, proto.FrameHandlerFunc(func(req proto.Frame, rw proto.ResponseWriter) {
+			handled++
+			rw.WriteFrame(v3.ResultVoidResponse(req))
+		}))
+	})
+
+	serve := func(stmt string) {
+		handler.ServeCQL(queryFrame(stmt, proto.Quorum), rw)
+	}
+
+	errorCode := func(f proto.Frame) proto.ErrorCode {
+		var code int32
+		Expect(proto.ReadInt(bytes.NewReader(f.Body()), &code)).To(Succeed())
+		return proto.ErrorCode(code)
+	}
+
+	It("passes requests on if no rule matches", func() {
+		_, err := inj.Add(fault.Rule{Pattern: `^DELETE`, Drop: true})
+		Expect(err).ToNot(HaveOccurred())
+
+		serve("SELECT * FROM foo")
+		Expect(handled).To(Equal(1))
+		Expect(rw.frames).To(HaveLen(1))
+	})
+
+	It("swallows responses", func() {
+		inj.Add(fault.Rule{Pattern: `^SELECT`, Drop: true})
+
+		serve("SELECT * FROM foo")
+		Expect(handled).To(Equal(1))
+		Expect(rw.frames).To(BeEmpty())
+	})
+
+	It("executes requests whose responses are dropped", func() {
+		e := engine.New()
+		Expect(e.Exec("CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}")).To(Succeed())
+		Expect(e.Exec("CREATE TABLE ks.users (id int PRIMARY KEY, name text)")).To(Succeed())
+
+		handler = fault.Frame(inj, v3.NewQueryFrameHandler(e))
+		inj.Add(fault.Rule{Pattern: `^INSERT`, Drop: true})
+
+		serve("INSERT INTO ks.users (id, name) VALUES (1, 'alice')")
+		Expect(rw.frames).To(BeEmpty())
+
+		serve("SELECT * FROM ks.users")
+		Expect(rw.frames).To(HaveLen(1))
+
+		res, err := e.Execute("SELECT name FROM ks.users WHERE id = 1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.(*result.Rows).Data).To(Equal([][][]byte{{[]byte("alice")}}))
+	})
+
+	It("matches executed and batched statements against the statements prepared", func() {
+		handler = fault.Frame(inj, v3.NewQueryFrameHandler(v3.ResultVoidHandler))
+		inj.Add(fault.Rule{
+			Pattern: `^INSERT`,
+			Opcodes: []proto.Opcode{proto.OpExecute, proto.OpBatch},
+			Error:   &fault.Error{Code: proto.ErrOverloaded},
+		})
+
+		body := new(bytes.Buffer)
+		proto.WriteLongString(body, "INSERT INTO ks.t (k) VALUES (?)")
+		handler.ServeCQL(requestFrame(proto.OpPrepare, body), rw)
+		Expect(rw.frames).To(HaveLen(1))
+		Expect(rw.frames[0].Opcode()).To(Equal(proto.OpResult))
+
+		r := bytes.NewReader(rw.frames[0].Body())
+		var kind int32
+		Expect(proto.ReadInt(r, &kind)).To(Succeed())
+		id, err := proto.ReadShortBytes(r)
+		Expect(err).NotTo(HaveOccurred())
+
+		body.Reset()
+		proto.WriteShortBytes(body, id)
+		proto.WriteShort(body, uint16(proto.One))
+		proto.WriteByte(body, 0)
+		handler.ServeCQL(requestFrame(proto.OpExecute, body), rw)
+		Expect(errorCode(rw.frames[1])).To(Equal(proto.ErrOverloaded))
+
+		// batch serves a BATCH request with a statement given as query string
+		// and, optionally, the prepared statement.
+		batch := func(stmt string, prepared bool) proto.Frame {
+			body.Reset()
+			proto.WriteByte(body, 0)
+			n := uint16(1)
+			if prepared {
+				n++
+			}
+			proto.WriteShort(body, n)
+			proto.WriteByte(body, 0)
+			proto.WriteLongString(body, stmt)
+			proto.WriteShort(body, 0)
+			if prepared {
+				proto.WriteByte(body, 1)
+				proto.WriteShortBytes(body, id)
+				proto.WriteShort(body, 1)
+				proto.WriteBytes(body, []byte{0, 0, 0, 1})
+			}
+			proto.WriteShort(body, uint16(proto.One))
+			proto.WriteByte(body, 0)
+
+			handler.ServeCQL(requestFrame(proto.OpBatch, body), rw)
+			return rw.frames[len(rw.frames)-1]
+		}
+
+		Expect(errorCode(batch("UPDATE ks.t SET v = 1 WHERE k = 1", true))).To(Equal(proto.ErrOverloaded))
+		Expect(errorCode(batch("INSERT INTO ks.t (k) VALUES (2)", false))).To(Equal(proto.ErrOverloaded))
+		Expect(batch("UPDATE ks.t SET v = 1 WHERE k = 1", false).Opcode()).To(Equal(proto.OpResult))
+	})
+
+	It("adds latency", func() {
+		inj.Add(fault.Rule{Latency: fault.Fixed(20 * time.Millisecond)})
+
+		start := time.Now()
+		serve("SELECT * FROM foo")
+		Expect(time.Since(start)).To(BeNumerically(">=", 20*time.Millisecond))
+		Expect(handled).To(Equal(1))
+	})
+
+	It("answers with write timeouts derived from the consistency", func() {
+		inj.Add(fault.Rule{Error: &fault.Error{Code: proto.ErrWriteTimeout}})
+
+		serve("INSERT INTO foo (a) VALUES (1)")
+		Expect(rw.frames).To(HaveLen(1))
+
+		r := bytes.NewReader(rw.frames[0].Body())
+		var code, received, blockFor int32
+		var cl proto.Consistency
+		proto.ReadInt(r, &code)
+		proto.ReadString(r)
+		proto.ReadConsistency(r, &cl)
+		proto.ReadInt(r, &received)
+		proto.ReadInt(r, &blockFor)
+		writeType, err := proto.ReadString(r)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(proto.ErrorCode(code)).To(Equal(proto.ErrWriteTimeout))
+		Expect(cl).To(Equal(proto.Quorum))
+		Expect(blockFor).To(Equal(int32(2)))
+		Expect(received).To(Equal(int32(1)))
+		Expect(writeType).To(Equal(fault.WriteTypeSimple))
+	})
+
+	It("reports CAS write timeouts at the serial consistency", func() {
+		inj.Add(fault.Rule{Error: &fault.Error{Code: proto.ErrWriteTimeout, WriteType: fault.WriteTypeCAS}})
+
+		handler.ServeCQL(serialQueryFrame("INSERT INTO foo (a) VALUES (?) IF NOT EXISTS", proto.One, proto.LocalSerial), rw)
+		Expect(rw.frames).To(HaveLen(1))
+
+		r := bytes.NewReader(rw.frames[0].Body())
+		var code, received, blockFor int32
+		var cl proto.Consistency
+		proto.ReadInt(r, &code)
+		proto.ReadString(r)
+		proto.ReadConsistency(r, &cl)
+		proto.ReadInt(r, &received)
+		proto.ReadInt(r, &blockFor)
+		writeType, err := proto.ReadString(r)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(cl).To(Equal(proto.LocalSerial))
+		Expect(received).To(BeZero())
+		Expect(blockFor).To(Equal(int32(2)))
+		Expect(writeType).To(Equal(fault.WriteTypeCAS))
+	})
+
+	It("only triggers on the Nth occurrence", func() {
+		inj.Add(fault.Rule{Nth: 2, Error: &fault.Error{Code: proto.ErrOverloaded}})
+
+		serve("SELECT 1")
+		serve("SELECT 2")
+		serve("SELECT 3")
+		Expect(handled).To(Equal(2))
+		Expect(errorCode(rw.frames[1])).To(Equal(proto.ErrOverloaded))
+	})
+
+	It("selects rules by opcode", func() {
+		inj.Add(fault.Rule{Opcodes: []proto.Opcode{proto.OpStartup}, Drop: true})
+
+		serve("SELECT * FROM foo")
+		Expect(handled).To(Equal(1))
+	})
+
+	It("removes rules", func() {
+		id, _ := inj.Add(fault.Rule{Drop: true})
+		Expect(inj.Remove(id)).To(BeTrue())
+		Expect(inj.Rules()).To(BeEmpty())
+
+		serve("SELECT * FROM foo")
+		Expect(handled).To(Equal(1))
+	})
+
+	It("rejects invalid patterns", func() {
+		_, err := inj.Add(fault.Rule{Pattern: `(`})
+		Expect(err).To(HaveOccurred())
+	})
+})
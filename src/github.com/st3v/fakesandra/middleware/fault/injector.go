@@ -0,0 +1,103 @@
+package fault
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/st3v/fakesandra/cql/proto"
+)
+
+// Injector holds a set of rules. The first rule that matches a request
+// decides how to misbehave.
+type Injector struct {
+	mu     sync.RWMutex
+	rules  []*rule
+	nextID int
+
+	// prepared holds the statements prepared through the injector by their
+	// IDs. They are kept when the rules are reset.
+	prepared map[string]string
+}
+
+func NewInjector() *Injector {
+	return &Injector{prepared: map[string]string{}}
+}
+
+// Add adds a copy of r and returns its ID.
+func (inj *Injector) Add(r Rule) (string, error) {
+	compiled, err := newRule(r)
+	if err != nil {
+		return "", err
+	}
+
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+
+	inj.nextID++
+	compiled.ID = strconv.Itoa(inj.nextID)
+	inj.rules = append(inj.rules, compiled)
+
+	return compiled.ID, nil
+}
+
+// Remove removes the rule with the given ID. It returns false if there is
+// no such rule.
+func (inj *Injector) Remove(id string) bool {
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+
+	for i, r := range inj.rules {
+		if r.ID == id {
+			inj.rules = append(inj.rules[:i], inj.rules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Rules returns copies of all rules in the order they were added.
+func (inj *Injector) Rules() []Rule {
+	inj.mu.RLock()
+	defer inj.mu.RUnlock()
+
+	rules := make([]Rule, len(inj.rules))
+	for i, r := range inj.rules {
+		rules[i] = r.Rule
+	}
+	return rules
+}
+
+// Reset removes all rules.
+func (inj *Injector) Reset() {
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	inj.rules = nil
+}
+
+func (inj *Injector) match(opcode proto.Opcode, stmts []string) *rule {
+	inj.mu.RLock()
+	defer inj.mu.RUnlock()
+
+	for _, r := range inj.rules {
+		if r.matches(opcode, stmts) {
+			return r
+		}
+	}
+	return nil
+}
+
+// prepare remembers that the statement with the given ID is stmt.
+func (inj *Injector) prepare(id []byte, stmt string) {
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	inj.prepared[string(id)] = stmt
+}
+
+// statement returns the prepared statement with the given ID.
+func (inj *Injector) statement(id []byte) (string, bool) {
+	inj.mu.RLock()
+	defer inj.mu.RUnlock()
+
+	stmt, found := inj.prepared[string(id)]
+	return stmt, found
+}
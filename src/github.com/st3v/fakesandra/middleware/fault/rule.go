@@ -0,0 +1,185 @@
+package fault
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"sync/atomic"
+
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/proto/v3"
+)
+
+// Rule describes when and how to misbehave. A rule matches a request if the
+// request satisfies all of the rule's selectors. The effects of a matching
+// rule are applied in order: Latency, then Close, Drop, or Error.
+type Rule struct {
+	// ID is assigned by the Injector when the rule is added.
+	ID string
+
+	// Pattern is a regular expression matched against the statement of
+	// QUERY, PREPARE and EXECUTE requests and against each statement of
+	// BATCH requests. Requests without a statement never match a rule with
+	// a pattern.
+	Pattern string
+
+	// Opcodes restricts the rule to requests with one of the given opcodes.
+	Opcodes []proto.Opcode
+
+	// Probability with which a matching request triggers the rule. Zero
+	// means the rule is always triggered.
+	Probability float64
+
+	// Nth restricts the rule to the Nth matching request, counting from 1.
+	Nth int
+
+	// Latency delays the response.
+	Latency Delay
+
+	// Close closes the connection without answering the request.
+	Close bool
+
+	// Drop executes the request but swallows its response.
+	Drop bool
+
+	// Error answers the request with an error instead of passing it on.
+	Error *Error
+}
+
+// rule is a Rule that has been added to an Injector.
+type rule struct {
+	Rule
+	pattern *regexp.Regexp
+	hits    int64
+}
+
+func newRule(r Rule) (*rule, error) {
+	compiled := &rule{Rule: r}
+	if r.Pattern == "" {
+		return compiled, nil
+	}
+
+	var err error
+	if compiled.pattern, err = regexp.Compile(r.Pattern); err != nil {
+		return nil, fmt.Errorf("Invalid pattern %q: %s", r.Pattern, err)
+	}
+	return compiled, nil
+}
+
+func (r *rule) matches(opcode proto.Opcode, stmts []string) bool {
+	if len(r.Opcodes) > 0 {
+		found := false
+		for _, oc := range r.Opcodes {
+			found = found || oc == opcode
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if r.pattern != nil {
+		found := false
+		for _, stmt := range stmts {
+			found = found || r.pattern.MatchString(stmt)
+		}
+		if !found {
+			return false
+		}
+	}
+
+	hits := atomic.AddInt64(&r.hits, 1)
+	if r.Nth > 0 && hits != int64(r.Nth) {
+		return false
+	}
+
+	return r.Probability <= 0 || r.Probability >= 1 || rand.Float64() < r.Probability
+}
+
+// Write types reported by write timeouts.
+const (
+	WriteTypeSimple        = "SIMPLE"
+	WriteTypeBatch         = "BATCH"
+	WriteTypeUnloggedBatch = "UNLOGGED_BATCH"
+	WriteTypeCounter       = "COUNTER"
+	WriteTypeBatchLog      = "BATCH_LOG"
+	WriteTypeCAS           = "CAS"
+)
+
+// DefaultReplicationFactor is used to derive the number of replicas an
+// error claims to have waited for.
+const DefaultReplicationFactor = 3
+
+// Error describes the error a rule answers with. Code is typically one of
+// proto.ErrReadTimeout, proto.ErrWriteTimeout, proto.ErrUnavailable or
+// proto.ErrOverloaded. Fields that are left empty are filled in with the
+// values Cassandra would report for the consistency of the request. Write
+// timeouts of type CAS simulate Paxos contention of lightweight
+// transactions and report the serial consistency of the request.
+type Error struct {
+	Code              proto.ErrorCode
+	Message           string
+	WriteType         string
+	DataPresent       bool
+	ReplicationFactor int
+}
+
+func (e *Error) response(req proto.Frame, cl, serial proto.Consistency) proto.Frame {
+	rf := e.ReplicationFactor
+	if rf <= 0 {
+		rf = DefaultReplicationFactor
+	}
+
+	// Paxos contention does not wait for any replica of the commit.
+	if e.Code == proto.ErrWriteTimeout && e.WriteType == WriteTypeCAS {
+		msg := e.message("Operation timed out - received only 0 responses.")
+		return v3.WriteTimeoutResponse(req, msg, serial, 0, int32(blockFor(serial, rf)), WriteTypeCAS)
+	}
+
+	blockFor := int32(blockFor(cl, rf))
+
+	switch e.Code {
+	case proto.ErrReadTimeout:
+		msg := e.message(fmt.Sprintf("Operation timed out - received only %d responses.", blockFor-1))
+		return v3.ReadTimeoutResponse(req, msg, cl, blockFor-1, blockFor, e.DataPresent)
+	case proto.ErrWriteTimeout:
+		writeType := e.WriteType
+		if writeType == "" {
+			writeType = WriteTypeSimple
+			if req.Opcode() == proto.OpBatch {
+				writeType = WriteTypeBatch
+			}
+		}
+		msg := e.message(fmt.Sprintf("Operation timed out - received only %d responses.", blockFor-1))
+		return v3.WriteTimeoutResponse(req, msg, cl, blockFor-1, blockFor, writeType)
+	case proto.ErrUnavailable:
+		msg := e.message(fmt.Sprintf("Cannot achieve consistency level %s", cl))
+		return v3.UnavailableResponse(req, msg, cl, blockFor, blockFor-1)
+	case proto.ErrOverloaded:
+		return v3.ErrorResponse(req, e.Code, e.message("Server is in overloaded state. Cannot accept more requests at this point"))
+	default:
+		return v3.ErrorResponse(req, e.Code, e.message(e.Code.String()))
+	}
+}
+
+func (e *Error) message(def string) string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return def
+}
+
+// blockFor returns the number of replicas needed to satisfy cl.
+func blockFor(cl proto.Consistency, rf int) int {
+	switch cl {
+	case proto.Two:
+		return 2
+	case proto.Three:
+		return 3
+	case proto.Quorum, proto.LocalQuorum, proto.EachQuorum, proto.Serial, proto.LocalSerial:
+		return rf/2 + 1
+	case proto.All:
+		return rf
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,153 @@
+package frame
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"time"
+
+	"github.com/st3v/fakesandra/cql/proto"
+)
+
+// ChaosConfig describes how responses are broken on the wire. The zero
+// value leaves responses untouched.
+type ChaosConfig struct {
+	// TruncateAfter writes only the first n bytes of each frame.
+	TruncateAfter int
+
+	// HeaderBitFlips lists bit positions within the frame header, including
+	// the version byte, that are flipped before the frame is written.
+	HeaderBitFlips []int
+
+	// BodyBitFlips lists bit positions within the frame body that are
+	// flipped before the frame is written. Positions beyond the end of the
+	// body are ignored.
+	BodyBitFlips []int
+
+	// WrongStreamID sends each response on the stream following the one of
+	// the request.
+	WrongStreamID bool
+
+	// Duplicate writes each frame twice.
+	Duplicate bool
+
+	// HeaderDelay pauses between writing the header and the body of a frame.
+	HeaderDelay time.Duration
+}
+
+// ChaosPolicy returns the configuration used to break responses sent over
+// conn, which allows to configure chaos per connection.
+type ChaosPolicy func(conn net.Conn) ChaosConfig
+
+// Chaos wraps next and breaks the responses it writes according to the
+// configuration the policy returns for the connection of each request.
+func Chaos(policy ChaosPolicy, next proto.FrameHandler) proto.FrameHandler {
+	return proto.FrameHandlerFunc(func(req proto.Frame, rw proto.ResponseWriter) {
+		conn, err := proto.Hijack(rw)
+		if err != nil {
+			log.Printf("Error applying chaos: %s", err)
+			next.ServeCQL(req, rw)
+			return
+		}
+
+		next.ServeCQL(req, &chaosWriter{conn, proto.SessionOf(rw), policy(conn)})
+	})
+}
+
+// ChaosWriter returns a response writer that serializes frames with
+// WriteTo, breaks them according to chaos and writes them straight to the
+// connection underlying rw.
+func ChaosWriter(rw proto.ResponseWriter, chaos ChaosConfig) (proto.ResponseWriter, error) {
+	conn, err := proto.Hijack(rw)
+	if err != nil {
+		return nil, err
+	}
+	return &chaosWriter{conn, proto.SessionOf(rw), chaos}, nil
+}
+
+type chaosWriter struct {
+	out     net.Conn
+	session *proto.Session
+	chaos   ChaosConfig
+}
+
+// headerLen is the length of the frame header, including the version byte,
+// for protocol versions 3 and later.
+const headerLen = 9
+
+func (cw *chaosWriter) WriteFrame(f proto.Frame) error {
+	buf := new(bytes.Buffer)
+	if _, err := f.WriteTo(buf); err != nil {
+		return err
+	}
+
+	raw := cw.mangle(buf.Bytes())
+
+	times := 1
+	if cw.chaos.Duplicate {
+		times = 2
+	}
+
+	for i := 0; i < times; i++ {
+		if err := cw.write(raw); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (cw *chaosWriter) Session() *proto.Session {
+	return cw.session
+}
+
+func (cw *chaosWriter) Hijack() (net.Conn, error) {
+	return cw.out, nil
+}
+
+func (cw *chaosWriter) mangle(raw []byte) []byte {
+	if len(raw) < headerLen {
+		return raw
+	}
+
+	if cw.chaos.WrongStreamID {
+		stream := uint16(raw[2])<<8 | uint16(raw[3])
+		stream++
+		raw[2], raw[3] = byte(stream>>8), byte(stream)
+	}
+
+	flipBits(raw[:headerLen], cw.chaos.HeaderBitFlips)
+	flipBits(raw[headerLen:], cw.chaos.BodyBitFlips)
+
+	if n := cw.chaos.TruncateAfter; n > 0 && n < len(raw) {
+		raw = raw[:n]
+	}
+
+	return raw
+}
+
+func (cw *chaosWriter) write(raw []byte) error {
+	if cw.chaos.HeaderDelay <= 0 || len(raw) <= headerLen {
+		_, err := cw.out.Write(raw)
+		return err
+	}
+
+	if _, err := cw.out.Write(raw[:headerLen]); err != nil {
+		return err
+	}
+
+	time.Sleep(cw.chaos.HeaderDelay)
+
+	_, err := cw.out.Write(raw[headerLen:])
+	return err
+}
+
+func flipBits(b []byte, positions []int) {
+	for _, pos := range positions {
+		if pos < 0 || pos/8 >= len(b) {
+			log.Printf("Ignoring bit flip at position %d", pos)
+			continue
+		}
+		b[pos/8] ^= 0x80 >> uint(pos%8)
+	}
+}
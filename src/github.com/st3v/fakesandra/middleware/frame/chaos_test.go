@@ -0,0 +1,100 @@
+package frame_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/proto/v3"
+	"github.com/st3v/fakesandra/middleware/frame"
+)
+
+var _ = Describe("Chaos", func() {
+	var (
+		server, client net.Conn
+		config         frame.ChaosConfig
+		request        proto.Frame
+		received       chan []byte
+	)
+
+	BeforeEach(func() {
+		server, client = net.Pipe()
+		config = frame.ChaosConfig{}
+
+		buf := new(bytes.Buffer)
+		proto.WriteByte(buf, 0)
+		proto.WriteShort(buf, 5)
+		proto.WriteByte(buf, uint8(proto.OpStartup))
+		proto.WriteInt(buf, 0)
+
+		var err error
+		request, err = v3.RequestFramer().Frame(buf)
+		Expect(err).ToNot(HaveOccurred())
+
+		received = make(chan []byte, 1)
+		go func() {
+			defer GinkgoRecover()
+			client.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			b, _ := io.ReadAll(client)
+			received <- b
+		}()
+	})
+
+	serve := func() []byte {
+		policy := func(conn net.Conn) frame.ChaosConfig {
+			Expect(conn).To(Equal(server))
+			return config
+		}
+
+		handler := frame.Chaos(policy, proto.FrameHandlerFunc(func(req proto.Frame, rw proto.ResponseWriter) {
+			Expect(rw.WriteFrame(v3.ResultVoidResponse(req))).To(Succeed())
+		}))
+
+		handler.ServeCQL(request, proto.FrameWriter(server))
+		server.Close()
+		return <-received
+	}
+
+	original := func() []byte {
+		buf := new(bytes.Buffer)
+		v3.ResultVoidResponse(request).WriteTo(buf)
+		return buf.Bytes()
+	}
+
+	It("leaves frames untouched by default", func() {
+		Expect(serve()).To(Equal(original()))
+	})
+
+	It("truncates frames", func() {
+		config.TruncateAfter = 4
+		Expect(serve()).To(Equal(original()[:4]))
+	})
+
+	It("flips bits in header and body", func() {
+		config.HeaderBitFlips = []int{0}
+		config.BodyBitFlips = []int{31}
+
+		expected := original()
+		expected[0] ^= 0x80
+		expected[12] ^= 0x01
+		Expect(serve()).To(Equal(expected))
+	})
+
+	It("answers on the wrong stream", func() {
+		config.WrongStreamID = true
+
+		expected := original()
+		expected[3] = 6
+		Expect(serve()).To(Equal(expected))
+	})
+
+	It("duplicates frames", func() {
+		config.Duplicate = true
+		Expect(serve()).To(Equal(append(original(), original()...)))
+	})
+})
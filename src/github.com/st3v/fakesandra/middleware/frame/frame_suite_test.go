@@ -0,0 +1,13 @@
+package frame_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestFrame(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Frame Middleware")
+}
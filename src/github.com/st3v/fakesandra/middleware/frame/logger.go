@@ -2,6 +2,7 @@ package frame
 
 import (
 	"fmt"
+	"net"
 
 	"github.com/st3v/fakesandra/cql/proto"
 )
@@ -22,3 +23,11 @@ func (rl *responseLogger) WriteFrame(f proto.Frame) error {
 	rl.log(fmt.Sprintf("Sent: %s", f))
 	return rl.out.WriteFrame(f)
 }
+
+func (rl *responseLogger) Session() *proto.Session {
+	return proto.SessionOf(rl.out)
+}
+
+func (rl *responseLogger) Hijack() (net.Conn, error) {
+	return proto.Hijack(rl.out)
+}
@@ -8,8 +8,8 @@ import (
 
 func Logger(log func(...interface{})) proto.QueryHandler {
 	return proto.QueryHandlerFunc(
-		func(qry string, req proto.Frame, rw proto.ResponseWriter) {
-			log(fmt.Sprintf("Received query: %s", qry))
+		func(qry proto.Query, req proto.Frame, rw proto.ResponseWriter) {
+			log(fmt.Sprintf("Received query: %s", qry.Statement()))
 		},
 	)
 }
@@ -0,0 +1,253 @@
+package scenario
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+type kind int
+
+const (
+	kindNull kind = iota
+	kindBool
+	kindNumber
+	kindString
+	kindArray
+	kindObject
+)
+
+var kindNames = map[kind]string{
+	kindNull:   "null",
+	kindBool:   "boolean",
+	kindNumber: "number",
+	kindString: "string",
+	kindArray:  "array",
+	kindObject: "object",
+}
+
+func (k kind) String() string {
+	return kindNames[k]
+}
+
+// node is a JSON value that remembers the line it was found on, so that
+// validation errors can point to the offending line.
+type node struct {
+	kind   kind
+	line   int
+	path   string
+	value  interface{}
+	keys   []string
+	fields map[string]*node
+	items  []*node
+}
+
+// Error is a validation error at a particular line of a scenario file.
+type Error struct {
+	File    string
+	Line    int
+	Path    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	loc := fmt.Sprintf("line %d", e.Line)
+	if e.File != "" {
+		loc = fmt.Sprintf("%s:%d", e.File, e.Line)
+	}
+
+	if e.Path == "" {
+		return fmt.Sprintf("%s: %s", loc, e.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", loc, e.Path, e.Message)
+}
+
+func (n *node) errorf(format string, args ...interface{}) error {
+	return &Error{Line: n.line, Path: n.path, Message: fmt.Sprintf(format, args...)}
+}
+
+// decoder builds a tree of nodes from a JSON document.
+type decoder struct {
+	data []byte
+	dec  *json.Decoder
+}
+
+func parseNodes(data []byte) (*node, error) {
+	d := &decoder{data: data, dec: json.NewDecoder(bytes.NewReader(data))}
+	d.dec.UseNumber()
+
+	root, err := d.node("")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := d.dec.Token(); err != io.EOF {
+		return nil, &Error{Line: d.line(d.dec.InputOffset()), Message: "unexpected data after top-level value"}
+	}
+
+	return root, nil
+}
+
+// line returns the line of the first token that starts at or after offset.
+func (d *decoder) line(offset int64) int {
+	i := int(offset)
+	for i < len(d.data) && strings.ContainsRune(" \t\r\n,:", rune(d.data[i])) {
+		i++
+	}
+	if i > len(d.data) {
+		i = len(d.data)
+	}
+	return bytes.Count(d.data[:i], []byte("\n")) + 1
+}
+
+func (d *decoder) syntaxError(err error) error {
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		return &Error{Line: d.line(e.Offset - 1), Message: e.Error()}
+	case *json.UnmarshalTypeError:
+		return &Error{Line: d.line(e.Offset), Message: e.Error()}
+	}
+
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return &Error{Line: d.line(int64(len(d.data))), Message: "unexpected end of file"}
+	}
+	return &Error{Line: d.line(d.dec.InputOffset()), Message: err.Error()}
+}
+
+func (d *decoder) node(path string) (*node, error) {
+	line := d.line(d.dec.InputOffset())
+
+	tok, err := d.dec.Token()
+	if err != nil {
+		return nil, d.syntaxError(err)
+	}
+
+	n := &node{line: line, path: path, value: tok}
+
+	switch t := tok.(type) {
+	case nil:
+		n.kind = kindNull
+	case bool:
+		n.kind = kindBool
+	case json.Number:
+		n.kind = kindNumber
+	case string:
+		n.kind = kindString
+	case json.Delim:
+		switch t {
+		case '[':
+			n.kind = kindArray
+			for d.dec.More() {
+				item, err := d.node(fmt.Sprintf("%s[%d]", path, len(n.items)))
+				if err != nil {
+					return nil, err
+				}
+				n.items = append(n.items, item)
+			}
+		case '{':
+			n.kind = kindObject
+			n.fields = map[string]*node{}
+			for d.dec.More() {
+				keyLine := d.line(d.dec.InputOffset())
+				key, err := d.dec.Token()
+				if err != nil {
+					return nil, d.syntaxError(err)
+				}
+
+				name := key.(string)
+				if _, dup := n.fields[name]; dup {
+					return nil, &Error{Line: keyLine, Path: path, Message: fmt.Sprintf("duplicate field %q", name)}
+				}
+
+				childPath := name
+				if path != "" {
+					childPath = path + "." + name
+				}
+
+				child, err := d.node(childPath)
+				if err != nil {
+					return nil, err
+				}
+				n.keys = append(n.keys, name)
+				n.fields[name] = child
+			}
+		}
+
+		// consume closing delimiter
+		if _, err := d.dec.Token(); err != nil {
+			return nil, d.syntaxError(err)
+		}
+	}
+
+	return n, nil
+}
+
+func (n *node) expect(k kind) error {
+	if n.kind != k {
+		return n.errorf("expected %s but got %s", k, n.kind)
+	}
+	return nil
+}
+
+// object checks that n is an object with no fields other than the allowed
+// ones.
+func (n *node) object(allowed ...string) error {
+	if err := n.expect(kindObject); err != nil {
+		return err
+	}
+
+	for _, key := range n.keys {
+		found := false
+		for _, a := range allowed {
+			found = found || a == key
+		}
+		if !found {
+			sort.Strings(allowed)
+			return n.fields[key].errorf("unknown field, expected one of: %s", strings.Join(allowed, ", "))
+		}
+	}
+
+	return nil
+}
+
+func (n *node) field(name string) *node {
+	if n == nil || n.fields == nil {
+		return nil
+	}
+	return n.fields[name]
+}
+
+func (n *node) string() (string, error) {
+	if err := n.expect(kindString); err != nil {
+		return "", err
+	}
+	return n.value.(string), nil
+}
+
+func (n *node) bool() (bool, error) {
+	if err := n.expect(kindBool); err != nil {
+		return false, err
+	}
+	return n.value.(bool), nil
+}
+
+func (n *node) int() (int, error) {
+	if err := n.expect(kindNumber); err != nil {
+		return 0, err
+	}
+	i, err := n.value.(json.Number).Int64()
+	if err != nil {
+		return 0, n.errorf("expected integer but got %s", n.value)
+	}
+	return int(i), nil
+}
+
+func (n *node) float() (float64, error) {
+	if err := n.expect(kindNumber); err != nil {
+		return 0, err
+	}
+	return n.value.(json.Number).Float64()
+}
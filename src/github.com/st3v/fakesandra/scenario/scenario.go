@@ -0,0 +1,647 @@
+// Package scenario loads declarative scenario files that describe stubs,
+// fault rules and an initial schema, so that fakesandra can be configured
+// without writing Go code.
+//
+// Scenario files are JSON documents of the following form:
+//
+//	{
+//	  "schema": [
+//	    "CREATE KEYSPACE app WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}"
+//	  ],
+//	  "stubs": [
+//	    {
+//	      "when": {"query": "^SELECT .* FROM app\\.users", "consistency": "QUORUM"},
+//	      "then": {
+//	        "keyspace": "app",
+//	        "table": "users",
+//	        "columns": [{"name": "id", "type": "int"}, {"name": "name", "type": "text"}],
+//	        "rows": [[1, "alice"], {"id": 2, "name": "bob"}]
+//	      }
+//	    },
+//	    {"when": {"query": "^DELETE"}, "then": {"error": {"code": "UNAUTHORIZED", "message": "nope"}}},
+//	    {"when": {"query": "^INSERT"}, "then": {"void": true}}
+//	  ],
+//	  "faults": [
+//	    {
+//	      "pattern": "^UPDATE", "opcodes": ["QUERY"], "probability": 0.5, "nth": 3,
+//	      "latency": {"uniform": {"min": "10ms", "max": "50ms"}},
+//	      "error": {"code": "WRITE_TIMEOUT", "writeType": "SIMPLE"}
+//	    }
+//	  ]
+//	}
+//
+// Schema entries must be CREATE, ALTER or DROP statements. Latencies are
+// either {"fixed": "100ms"}, {"uniform": {"min", "max"}} or
+// {"normal": {"mean", "stddev"}}. Rows are given as arrays of values in
+// column order or as objects keyed by column name.
+package scenario
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/st3v/fakesandra/cql/parser"
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/cql/types"
+	"github.com/st3v/fakesandra/middleware/fault"
+	"github.com/st3v/fakesandra/stub"
+)
+
+// Scenario is the validated content of a scenario file.
+type Scenario struct {
+	Schema []string
+	Stubs  []stub.Stub
+	Faults []fault.Rule
+}
+
+// Load reads and validates the scenario file at path.
+func Load(path string) (*Scenario, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := Parse(data)
+	if e, ok := err.(*Error); ok {
+		e.File = path
+	}
+	return s, err
+}
+
+// Parse validates data and returns the scenario it describes. Errors are
+// of type *Error and carry the line number of the offending value.
+func Parse(data []byte) (*Scenario, error) {
+	root, err := parseNodes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := root.object("schema", "stubs", "faults"); err != nil {
+		return nil, err
+	}
+
+	s := &Scenario{}
+
+	if n := root.field("schema"); n != nil {
+		if s.Schema, err = parseSchema(n); err != nil {
+			return nil, err
+		}
+	}
+
+	if n := root.field("stubs"); n != nil {
+		if err := n.expect(kindArray); err != nil {
+			return nil, err
+		}
+		for _, item := range n.items {
+			st, err := parseStub(item)
+			if err != nil {
+				return nil, err
+			}
+			s.Stubs = append(s.Stubs, st)
+		}
+	}
+
+	if n := root.field("faults"); n != nil {
+		if err := n.expect(kindArray); err != nil {
+			return nil, err
+		}
+		for _, item := range n.items {
+			r, err := parseRule(item)
+			if err != nil {
+				return nil, err
+			}
+			s.Faults = append(s.Faults, r)
+		}
+	}
+
+	return s, nil
+}
+
+// ParseStub validates data, which holds a single stub in the format used
+// by scenario files, and returns the stub it describes.
+func ParseStub(data []byte) (stub.Stub, error) {
+	root, err := parseNodes(data)
+	if err != nil {
+		return stub.Stub{}, err
+	}
+	return parseStub(root)
+}
+
+// ParseFault validates data, which holds a single fault rule in the format
+// used by scenario files, and returns the rule it describes.
+func ParseFault(data []byte) (fault.Rule, error) {
+	root, err := parseNodes(data)
+	if err != nil {
+		return fault.Rule{}, err
+	}
+	return parseRule(root)
+}
+
+// Apply executes the schema statements using exec and adds stubs and fault
+// rules to the given registry and injector.
+func (s *Scenario) Apply(exec func(stmt string) error, stubs *stub.Registry, faults *fault.Injector) error {
+	for _, stmt := range s.Schema {
+		if err := exec(stmt); err != nil {
+			return fmt.Errorf("Error executing schema statement %q: %s", stmt, err)
+		}
+	}
+
+	for _, st := range s.Stubs {
+		if _, err := stubs.Add(st); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range s.Faults {
+		if _, err := faults.Add(r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parseSchema(n *node) ([]string, error) {
+	if err := n.expect(kindArray); err != nil {
+		return nil, err
+	}
+
+	stmts := []string{}
+	for _, item := range n.items {
+		stmt, err := item.string()
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(stmt) == "" {
+			return nil, item.errorf("empty statement")
+		}
+		parsed, err := parser.Parse(stmt)
+		if err != nil {
+			return nil, item.errorf("%s", err)
+		}
+		if !isSchemaStatement(parsed) {
+			return nil, item.errorf("expected a schema statement, e.g. CREATE KEYSPACE or CREATE TABLE")
+		}
+		stmts = append(stmts, stmt)
+	}
+	return stmts, nil
+}
+
+// isSchemaStatement returns whether stmt creates, alters or drops a schema
+// object.
+func isSchemaStatement(stmt parser.Statement) bool {
+	switch stmt.(type) {
+	case *parser.CreateKeyspace, *parser.AlterKeyspace, *parser.DropKeyspace,
+		*parser.CreateTable, *parser.AlterTable, *parser.DropTable,
+		*parser.CreateType, *parser.AlterType, *parser.DropType,
+		*parser.CreateIndex, *parser.DropIndex,
+		*parser.CreateFunction, *parser.DropFunction,
+		*parser.CreateAggregate, *parser.DropAggregate,
+		*parser.CreateView, *parser.AlterView, *parser.DropView:
+		return true
+	}
+	return false
+}
+
+func parseStub(n *node) (stub.Stub, error) {
+	var s stub.Stub
+
+	if err := n.object("when", "then"); err != nil {
+		return s, err
+	}
+
+	when, then := n.field("when"), n.field("then")
+	if when == nil {
+		return s, n.errorf("missing field \"when\"")
+	}
+	if then == nil {
+		return s, n.errorf("missing field \"then\"")
+	}
+
+	if err := when.object("query", "consistency"); err != nil {
+		return s, err
+	}
+
+	q := when.field("query")
+	if q == nil {
+		return s, when.errorf("missing field \"query\"")
+	}
+
+	var err error
+	if s.Pattern, err = pattern(q); err != nil {
+		return s, err
+	}
+
+	if c := when.field("consistency"); c != nil {
+		cl, err := consistency(c)
+		if err != nil {
+			return s, err
+		}
+		s.Consistency = &cl
+	}
+
+	if err := then.object("void", "error", "keyspace", "table", "columns", "rows"); err != nil {
+		return s, err
+	}
+
+	switch {
+	case then.field("error") != nil:
+		if len(then.keys) > 1 {
+			return s, then.errorf("\"error\" cannot be combined with other fields")
+		}
+		s.Error, err = parseError(then.field("error"))
+	case then.field("void") != nil:
+		if len(then.keys) > 1 {
+			return s, then.errorf("\"void\" cannot be combined with other fields")
+		}
+		void, err := then.field("void").bool()
+		if err != nil {
+			return s, err
+		}
+		if !void {
+			return s, then.field("void").errorf("must be true if present")
+		}
+		s.Result = result.Void{}
+	case then.field("columns") != nil:
+		s.Result, err = parseRows(then)
+	default:
+		return s, then.errorf("expected one of \"void\", \"error\" or \"columns\"")
+	}
+
+	return s, err
+}
+
+func parseError(n *node) (*proto.Error, error) {
+	if err := n.object("code", "message"); err != nil {
+		return nil, err
+	}
+
+	c := n.field("code")
+	if c == nil {
+		return nil, n.errorf("missing field \"code\"")
+	}
+
+	code, err := errorCode(c)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &proto.Error{Code: code, Message: code.String()}
+	if m := n.field("message"); m != nil {
+		if e.Message, err = m.string(); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+func parseRows(n *node) (*result.Rows, error) {
+	rows := &result.Rows{Data: [][][]byte{}}
+
+	var keyspace, table string
+	var err error
+
+	if ks := n.field("keyspace"); ks != nil {
+		if keyspace, err = ks.string(); err != nil {
+			return nil, err
+		}
+	}
+
+	if t := n.field("table"); t != nil {
+		if table, err = t.string(); err != nil {
+			return nil, err
+		}
+	}
+
+	cols := n.field("columns")
+	if err := cols.expect(kindArray); err != nil {
+		return nil, err
+	}
+
+	index := map[string]int{}
+	for i, c := range cols.items {
+		if err := c.object("name", "type"); err != nil {
+			return nil, err
+		}
+
+		if c.field("name") == nil || c.field("type") == nil {
+			return nil, c.errorf("columns need a \"name\" and a \"type\"")
+		}
+
+		name, err := c.field("name").string()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, dup := index[name]; dup {
+			return nil, c.field("name").errorf("duplicate column %q", name)
+		}
+		index[name] = i
+
+		typ, err := c.field("type").string()
+		if err != nil {
+			return nil, err
+		}
+
+		t, err := types.Parse(typ)
+		if err != nil {
+			return nil, c.field("type").errorf("%s", err)
+		}
+
+		if t.ID == types.UDT {
+			return nil, c.field("type").errorf("user-defined types are not supported in stubs, use a tuple instead")
+		}
+
+		rows.Columns = append(rows.Columns, result.Column{
+			Keyspace: keyspace,
+			Table:    table,
+			Name:     name,
+			Type:     t,
+		})
+	}
+
+	data := n.field("rows")
+	if data == nil {
+		return rows, nil
+	}
+
+	if err := data.expect(kindArray); err != nil {
+		return nil, err
+	}
+
+	for _, item := range data.items {
+		row := make([][]byte, len(rows.Columns))
+
+		switch item.kind {
+		case kindArray:
+			if len(item.items) != len(rows.Columns) {
+				return nil, item.errorf("expected %d values but got %d", len(rows.Columns), len(item.items))
+			}
+			for i, v := range item.items {
+				if row[i], err = marshal(v, rows.Columns[i].Type); err != nil {
+					return nil, err
+				}
+			}
+		case kindObject:
+			for _, key := range item.keys {
+				i, found := index[key]
+				if !found {
+					return nil, item.fields[key].errorf("unknown column %q", key)
+				}
+				if row[i], err = marshal(item.fields[key], rows.Columns[i].Type); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			return nil, item.errorf("expected array or object but got %s", item.kind)
+		}
+
+		rows.Data = append(rows.Data, row)
+	}
+
+	return rows, nil
+}
+
+func parseRule(n *node) (fault.Rule, error) {
+	var r fault.Rule
+
+	if err := n.object("pattern", "opcodes", "probability", "nth", "latency", "close", "drop", "error"); err != nil {
+		return r, err
+	}
+
+	var err error
+
+	if p := n.field("pattern"); p != nil {
+		if r.Pattern, err = pattern(p); err != nil {
+			return r, err
+		}
+	}
+
+	if ops := n.field("opcodes"); ops != nil {
+		if err := ops.expect(kindArray); err != nil {
+			return r, err
+		}
+		for _, item := range ops.items {
+			name, err := item.string()
+			if err != nil {
+				return r, err
+			}
+			oc, found := proto.OpcodeByName(name)
+			if !found {
+				return r, item.errorf("unknown opcode %q", name)
+			}
+			r.Opcodes = append(r.Opcodes, oc)
+		}
+	}
+
+	if p := n.field("probability"); p != nil {
+		if r.Probability, err = p.float(); err != nil {
+			return r, err
+		}
+		if r.Probability <= 0 || r.Probability > 1 {
+			return r, p.errorf("probability must be in (0, 1]")
+		}
+	}
+
+	if nth := n.field("nth"); nth != nil {
+		if r.Nth, err = nth.int(); err != nil {
+			return r, err
+		}
+		if r.Nth < 1 {
+			return r, nth.errorf("nth must be at least 1")
+		}
+	}
+
+	if l := n.field("latency"); l != nil {
+		if r.Latency, err = parseLatency(l); err != nil {
+			return r, err
+		}
+	}
+
+	if c := n.field("close"); c != nil {
+		if r.Close, err = c.bool(); err != nil {
+			return r, err
+		}
+	}
+
+	if d := n.field("drop"); d != nil {
+		if r.Drop, err = d.bool(); err != nil {
+			return r, err
+		}
+	}
+
+	if e := n.field("error"); e != nil {
+		if r.Error, err = parseFaultError(e); err != nil {
+			return r, err
+		}
+	}
+
+	if r.Latency == nil && !r.Close && !r.Drop && r.Error == nil {
+		return r, n.errorf("fault has no effect, expected at least one of \"latency\", \"close\", \"drop\" or \"error\"")
+	}
+
+	return r, nil
+}
+
+func parseLatency(n *node) (fault.Delay, error) {
+	if err := n.object("fixed", "uniform", "normal"); err != nil {
+		return nil, err
+	}
+
+	if len(n.keys) != 1 {
+		return nil, n.errorf("expected exactly one of \"fixed\", \"uniform\" or \"normal\"")
+	}
+
+	switch key := n.keys[0]; key {
+	case "fixed":
+		d, err := duration(n.field(key))
+		return fault.Fixed(d), err
+	case "uniform":
+		u := n.field(key)
+		if err := u.object("min", "max"); err != nil {
+			return nil, err
+		}
+		min, max, err := durationPair(u, "min", "max")
+		if err != nil {
+			return nil, err
+		}
+		if max < min {
+			return nil, u.errorf("max must not be less than min")
+		}
+		return fault.Uniform(min, max), nil
+	default:
+		nd := n.field(key)
+		if err := nd.object("mean", "stddev"); err != nil {
+			return nil, err
+		}
+		mean, stddev, err := durationPair(nd, "mean", "stddev")
+		return fault.Normal(mean, stddev), err
+	}
+}
+
+func parseFaultError(n *node) (*fault.Error, error) {
+	if err := n.object("code", "message", "writeType", "dataPresent", "replicationFactor"); err != nil {
+		return nil, err
+	}
+
+	c := n.field("code")
+	if c == nil {
+		return nil, n.errorf("missing field \"code\"")
+	}
+
+	e := &fault.Error{}
+
+	var err error
+	if e.Code, err = errorCode(c); err != nil {
+		return nil, err
+	}
+
+	if m := n.field("message"); m != nil {
+		if e.Message, err = m.string(); err != nil {
+			return nil, err
+		}
+	}
+
+	if wt := n.field("writeType"); wt != nil {
+		if e.WriteType, err = wt.string(); err != nil {
+			return nil, err
+		}
+		switch e.WriteType {
+		case fault.WriteTypeSimple, fault.WriteTypeBatch, fault.WriteTypeUnloggedBatch,
+			fault.WriteTypeCounter, fault.WriteTypeBatchLog, fault.WriteTypeCAS:
+		default:
+			return nil, wt.errorf("unknown write type %q", e.WriteType)
+		}
+	}
+
+	if dp := n.field("dataPresent"); dp != nil {
+		if e.DataPresent, err = dp.bool(); err != nil {
+			return nil, err
+		}
+	}
+
+	if rf := n.field("replicationFactor"); rf != nil {
+		if e.ReplicationFactor, err = rf.int(); err != nil {
+			return nil, err
+		}
+		if e.ReplicationFactor < 1 {
+			return nil, rf.errorf("replication factor must be at least 1")
+		}
+	}
+
+	return e, nil
+}
+
+func pattern(n *node) (string, error) {
+	p, err := n.string()
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := regexp.Compile(p); err != nil {
+		return "", n.errorf("invalid pattern: %s", err)
+	}
+	return p, nil
+}
+
+func consistency(n *node) (proto.Consistency, error) {
+	name, err := n.string()
+	if err != nil {
+		return 0, err
+	}
+
+	cl, found := proto.ConsistencyByName(name)
+	if !found {
+		return 0, n.errorf("unknown consistency %q", name)
+	}
+	return cl, nil
+}
+
+func errorCode(n *node) (proto.ErrorCode, error) {
+	name, err := n.string()
+	if err != nil {
+		return 0, err
+	}
+
+	code, found := proto.ErrorCodeByName(name)
+	if !found {
+		return 0, n.errorf("unknown error code %q", name)
+	}
+	return code, nil
+}
+
+func duration(n *node) (time.Duration, error) {
+	s, err := n.string()
+	if err != nil {
+		return 0, err
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, n.errorf("invalid duration %q", s)
+	}
+	if d < 0 {
+		return 0, n.errorf("duration must not be negative")
+	}
+	return d, nil
+}
+
+func durationPair(n *node, first, second string) (time.Duration, time.Duration, error) {
+	a, b := n.field(first), n.field(second)
+	if a == nil || b == nil {
+		return 0, 0, n.errorf("expected \"%s\" and \"%s\"", first, second)
+	}
+
+	x, err := duration(a)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	y, err := duration(b)
+	return x, y, err
+}
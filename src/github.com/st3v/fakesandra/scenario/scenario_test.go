@@ -0,0 +1,122 @@
+package scenario_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/result"
+	"github.com/st3v/fakesandra/cql/types"
+	"github.com/st3v/fakesandra/middleware/fault"
+	"github.com/st3v/fakesandra/scenario"
+	"github.com/st3v/fakesandra/stub"
+)
+
+var _ = Describe("Parse", func() {
+	It("parses a complete scenario", func() {
+		s, err := scenario.Parse([]byte(`{
+			"schema": ["CREATE KEYSPACE app WITH replication = {}"],
+			"stubs": [
+				{
+					"when": {"query": "^SELECT .* FROM app\\.users", "consistency": "QUORUM"},
+					"then": {
+						"keyspace": "app",
+						"table": "users",
+						"columns": [
+							{"name": "id", "type": "int"},
+							{"name": "tags", "type": "map<int, text>"}
+						],
+						"rows": [[1, {"1": "a"}], {"id": 2}]
+					}
+				},
+				{"when": {"query": "^DELETE"}, "then": {"error": {"code": "UNAUTHORIZED", "message": "nope"}}},
+				{"when": {"query": "^INSERT"}, "then": {"void": true}}
+			],
+			"faults": [
+				{
+					"pattern": "^UPDATE",
+					"opcodes": ["QUERY"],
+					"nth": 3,
+					"latency": {"uniform": {"min": "10ms", "max": "50ms"}},
+					"error": {"code": "WRITE_TIMEOUT", "writeType": "CAS"}
+				}
+			]
+		}`))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(s.Schema).To(Equal([]string{"CREATE KEYSPACE app WITH replication = {}"}))
+
+		Expect(s.Stubs).To(HaveLen(3))
+		Expect(*s.Stubs[0].Consistency).To(Equal(proto.Quorum))
+
+		rows := s.Stubs[0].Result.(*result.Rows)
+		Expect(rows.Columns[1]).To(Equal(result.Column{
+			Keyspace: "app",
+			Table:    "users",
+			Name:     "tags",
+			Type:     types.MapOf(types.Native(types.Int), types.Native(types.Varchar)),
+		}))
+		Expect(rows.Data).To(HaveLen(2))
+		Expect(types.Unmarshal(rows.Columns[1].Type, rows.Data[0][1])).To(Equal([]types.Pair{{Key: int32(1), Value: "a"}}))
+		Expect(rows.Data[1][1]).To(BeNil())
+
+		Expect(s.Stubs[1].Error).To(Equal(&proto.Error{Code: proto.ErrUnauthorized, Message: "nope"}))
+		Expect(s.Stubs[2].Result).To(Equal(result.Void{}))
+
+		Expect(s.Faults).To(HaveLen(1))
+		Expect(s.Faults[0].Opcodes).To(Equal([]proto.Opcode{proto.OpQuery}))
+		Expect(s.Faults[0].Nth).To(Equal(3))
+		Expect(s.Faults[0].Latency.Duration()).To(BeNumerically("~", 30*time.Millisecond, 20*time.Millisecond))
+		Expect(s.Faults[0].Error.WriteType).To(Equal(fault.WriteTypeCAS))
+	})
+
+	It("applies stubs and faults", func() {
+		s, err := scenario.Parse([]byte(`{
+			"schema": ["CREATE TABLE foo (id int PRIMARY KEY)"],
+			"stubs": [{"when": {"query": "foo"}, "then": {"void": true}}],
+			"faults": [{"drop": true}]
+		}`))
+		Expect(err).ToNot(HaveOccurred())
+
+		executed := []string{}
+		exec := func(stmt string) error {
+			executed = append(executed, stmt)
+			return nil
+		}
+
+		stubs, faults := stub.NewRegistry(), fault.NewInjector()
+		Expect(s.Apply(exec, stubs, faults)).To(Succeed())
+		Expect(executed).To(Equal(s.Schema))
+		Expect(stubs.Stubs()).To(HaveLen(1))
+		Expect(faults.Rules()).To(HaveLen(1))
+	})
+
+	Describe("reporting errors with line numbers", func() {
+		for _, entry := range []struct {
+			description string
+			doc         string
+			expected    string
+		}{
+			{"syntax errors", "{\n  \"stubs\": [\n    {]\n}", "line 3: invalid character ']' looking for beginning of value"},
+			{"unknown fields", "{\n  \"stub\": []\n}", "line 2: stub: unknown field, expected one of: faults, schema, stubs"},
+			{"duplicate fields", "{\n  \"schema\": [],\n  \"schema\": []\n}", "line 3: duplicate field \"schema\""},
+			{"wrong kinds", "{\n  \"schema\": [\n    42\n  ]\n}", "line 3: schema[0]: expected string but got number"},
+			{"invalid schema statements", "{\"schema\": [\n\"CREATE TABEL foo (id int PRIMARY KEY)\"]}", "line 2: schema[0]: line 1:7 no viable alternative at input 'TABEL'"},
+			{"non-schema statements", "{\"schema\": [\n\"INSERT INTO app.users (id) VALUES (1)\"]}", "line 2: schema[0]: expected a schema statement, e.g. CREATE KEYSPACE or CREATE TABLE"},
+			{"invalid types", "{\"stubs\": [{\"when\": {\"query\": \"x\"},\n\"then\": {\"columns\": [{\"name\": \"a\",\n\"type\": \"lst<int>\"}]}}]}", "line 3: stubs[0].then.columns[0].type: Invalid type \"lst<int>\": unexpected \"<int>\""},
+			{"invalid values", "{\"stubs\": [{\"when\": {\"query\": \"x\"}, \"then\": {\n\"columns\": [{\"name\": \"a\", \"type\": \"tinyint\"}],\n\"rows\": [\n[1000]]}}]}", "line 4: stubs[0].then.rows[0][0]: invalid tinyint value: Value 1000 out of range for 8 bit integer"},
+			{"unknown consistencies", "{\"stubs\": [{\"when\": {\"query\": \"x\",\n\"consistency\": \"MOST\"}, \"then\": {\"void\": true}}]}", "line 2: stubs[0].when.consistency: unknown consistency \"MOST\""},
+			{"faults without effect", "{\"faults\": [\n{\"nth\": 1}]}", "line 2: faults[0]: fault has no effect, expected at least one of \"latency\", \"close\", \"drop\" or \"error\""},
+			{"invalid durations", "{\"faults\": [{\n\"latency\": {\"fixed\": \"soon\"}}]}", "line 2: faults[0].latency.fixed: invalid duration \"soon\""},
+		} {
+			entry := entry
+			It("reports "+entry.description, func() {
+				_, err := scenario.Parse([]byte(entry.doc))
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(Equal(entry.expected))
+			})
+		}
+	})
+})
@@ -0,0 +1,101 @@
+package scenario
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/st3v/fakesandra/cql/types"
+)
+
+// marshal encodes the JSON value n as a value of type t.
+func marshal(n *node, t types.Type) ([]byte, error) {
+	v, err := value(n, t)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := types.Marshal(t, v)
+	if err != nil {
+		return nil, n.errorf("invalid %s value: %s", t, err)
+	}
+	return b, nil
+}
+
+// value converts n into a Go value that types.Marshal accepts for t.
+func value(n *node, t types.Type) (interface{}, error) {
+	if n.kind == kindNull {
+		return nil, nil
+	}
+
+	switch t.ID {
+	case types.List, types.Set, types.Tuple:
+		if err := n.expect(kindArray); err != nil {
+			return nil, err
+		}
+		if t.ID == types.Tuple && len(n.items) != len(t.Elems) {
+			return nil, n.errorf("expected %d tuple components but got %d", len(t.Elems), len(n.items))
+		}
+		values := make([]interface{}, len(n.items))
+		for i, item := range n.items {
+			elem := t.Elems[0]
+			if t.ID == types.Tuple {
+				elem = t.Elems[i]
+			}
+			if item.kind == kindNull && t.ID != types.Tuple {
+				return nil, item.errorf("null is not supported inside collections")
+			}
+			var err error
+			if values[i], err = value(item, elem); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	case types.Map:
+		if err := n.expect(kindObject); err != nil {
+			return nil, err
+		}
+		pairs := []types.Pair{}
+		for _, key := range n.keys {
+			k, err := mapKey(n.fields[key], key, t.Elems[0])
+			if err != nil {
+				return nil, err
+			}
+			v, err := value(n.fields[key], t.Elems[1])
+			if err != nil {
+				return nil, err
+			}
+			if v == nil {
+				return nil, n.fields[key].errorf("null is not supported inside collections")
+			}
+			pairs = append(pairs, types.Pair{Key: k, Value: v})
+		}
+		return pairs, nil
+	}
+
+	switch n.kind {
+	case kindArray, kindObject:
+		return nil, n.errorf("expected %s value but got %s", t, n.kind)
+	}
+
+	return n.value, nil
+}
+
+// mapKey converts a JSON object key into a Go value for type t.
+func mapKey(n *node, key string, t types.Type) (interface{}, error) {
+	switch t.ID {
+	case types.Bigint, types.Counter, types.Int, types.Smallint, types.Tinyint,
+		types.Double, types.Float, types.Decimal, types.Varint:
+		return json.Number(key), nil
+	case types.Boolean:
+		switch strings.ToLower(key) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return nil, n.errorf("invalid boolean map key %q", key)
+	case types.List, types.Set, types.Map, types.Tuple, types.UDT:
+		return nil, n.errorf("map keys of type %s are not supported", t)
+	}
+	return key, nil
+}
@@ -5,9 +5,17 @@ import (
 	"io"
 	"log"
 	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/st3v/fakesandra/cql/proto"
 	"github.com/st3v/fakesandra/cql/proto/v3"
+	"github.com/st3v/fakesandra/engine"
+	"github.com/st3v/fakesandra/journal"
+	"github.com/st3v/fakesandra/middleware/fault"
+	"github.com/st3v/fakesandra/stub"
 )
 
 const DefaultPort = 9042
@@ -21,6 +29,19 @@ type server struct {
 	addr      string
 	versioner proto.Versioner
 	handler   proto.FrameHandler
+	engine    *engine.Engine
+
+	mu     sync.Mutex
+	conns  map[net.Conn]Connection
+	nextID int
+}
+
+// Connection describes a client connection served by a server.
+type Connection struct {
+	ID          int       `json:"id"`
+	RemoteAddr  string    `json:"remoteAddr"`
+	LocalAddr   string    `json:"localAddr"`
+	ConnectedAt time.Time `json:"connectedAt"`
 }
 
 var DefaultVersioner = func() proto.Versioner {
@@ -65,18 +86,101 @@ var DefaultHandler = func() (vmux *proto.VersionMux) {
 	return
 }()
 
+// DefaultJournal records all queries served by the DefaultHandler. Query
+// handlers that write a response and are added via HandleQuery take
+// precedence over the journal, i.e. their queries will not be recorded.
+var DefaultJournal = journal.New()
+
+// DefaultStubs answers queries served by the DefaultHandler with canned
+// results.
+var DefaultStubs = stub.NewRegistry()
+
+// DefaultEngine executes queries served by the DefaultHandler against an
+// in-memory schema and data set. Stubs take precedence over the engine.
+var DefaultEngine = engine.New()
+
+// SetCassandraVersion makes the DefaultEngine behave like the given
+// Cassandra release, e.g. 2.1, 3.11 or 4.x. This includes the versions
+// listed in system.local, the layout of the system tables, the supported
+// protocol versions, the wording of errors and the available CQL features.
+func SetCassandraVersion(version string) error {
+	profile, err := engine.LookupProfile(version)
+	if err != nil {
+		return err
+	}
+	DefaultEngine.SetProfile(profile)
+	return nil
+}
+
+var strict int32
+
+// Strict enables or disables strict mode for the DefaultHandler. In strict
+// mode queries that are not handled by any query handler are answered with
+// an Invalid error instead of a VOID result. Either way they are recorded as
+// unmatched by the DefaultJournal.
+func Strict(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&strict, v)
+}
+
+var strictHandler = proto.QueryHandlerFunc(
+	func(qry proto.Query, req proto.Frame, rw proto.ResponseWriter) {
+		if atomic.LoadInt32(&strict) == 1 {
+			v3.UnexpectedQueryHandler.ServeQuery(qry, req, rw)
+		}
+	},
+)
+
+func init() {
+	// The strict handler and the unmatched recorder have to sit right in
+	// front of the fallback handler, so they have to be prepended first.
+	HandleQuery(strictHandler)
+	HandleQuery(DefaultJournal.UnmatchedRecorder())
+	HandleQuery(DefaultEngine)
+	HandleQuery(DefaultStubs)
+	HandleQuery(DefaultJournal)
+}
+
+// DefaultFaults holds the fault injection rules that are applied to the
+// DefaultHandler by servers created without an explicit handler.
+var DefaultFaults = fault.NewInjector()
+
 func NewServer(addr string, handler proto.FrameHandler) *server {
 	if handler == nil {
-		handler = DefaultHandler
+		handler = fault.Frame(DefaultFaults, DefaultHandler)
 	}
 
 	return &server{
 		addr:      addr,
 		versioner: DefaultVersioner,
 		handler:   handler,
+		engine:    DefaultEngine,
+		conns:     map[net.Conn]Connection{},
 	}
 }
 
+// Reset discards the stubs, fault rules and recorded queries of the
+// defaults, i.e. the DefaultStubs, DefaultFaults and DefaultJournal, as well
+// as the data of the DefaultEngine and resets its clock. The schema of the
+// engine is kept.
+func Reset() {
+	DefaultStubs.Reset()
+	DefaultEngine.Truncate()
+	DefaultEngine.Clock().Reset()
+	DefaultFaults.Reset()
+	DefaultJournal.Reset()
+}
+
+// SetEngine sets the engine whose profile determines the protocol versions
+// the server offers to clients. It defaults to the DefaultEngine, set it if
+// handler serves queries from another engine.
+func (s *server) SetEngine(e *engine.Engine) {
+	s.engine = e
+}
+
 func (s *server) ListenAndServe() error {
 	addr := s.addr
 	if addr == "" {
@@ -104,17 +208,67 @@ func (s *server) Serve(l net.Listener) error {
 	}
 }
 
+// Connections returns the currently open client connections in the order
+// they were established.
+func (s *server) Connections() []Connection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conns := []Connection{}
+	for _, c := range s.conns {
+		conns = append(conns, c)
+	}
+
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].ID < conns[j].ID
+	})
+
+	return conns
+}
+
+func (s *server) track(c net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	s.conns[c] = Connection{
+		ID:          s.nextID,
+		RemoteAddr:  c.RemoteAddr().String(),
+		LocalAddr:   c.LocalAddr().String(),
+		ConnectedAt: time.Now(),
+	}
+}
+
+func (s *server) untrack(c net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, c)
+}
+
 func (s *server) ServeConnection(c net.Conn) {
 	defer c.Close()
 
+	s.track(c)
+	defer s.untrack(c)
+
 	log.Println("Serving new connection ...")
 
+	session := proto.NewSession()
+
 	for {
 		// TODO: Handle timeouts
-		framer, err := s.versioner.Version(c)
+		profile := s.engine.Profile()
+		framer, err := proto.Negotiate(s.versioner, c, profile.ProtocolVersions)
 		if err == io.EOF {
 			log.Println("Connection closed by client")
 			return
+		} else if unsupported, ok := err.(*proto.UnsupportedVersionError); ok {
+			// Like Cassandra, answer with a protocol error the client can
+			// use to downgrade, then close the connection.
+			log.Printf("Error versioning request: %s", err)
+			msg := profile.UnsupportedProtocolVersion(unsupported.Version, unsupported.Supported)
+			v3.ProtocolErrorResponse(unsupported.StreamID, msg).WriteTo(c)
+			return
 		} else if err != nil {
 			log.Printf("Error versioning request: %s", err)
 			return
@@ -126,6 +280,6 @@ func (s *server) ServeConnection(c net.Conn) {
 			return
 		}
 
-		s.handler.ServeCQL(frame, proto.FrameWriter(c))
+		s.handler.ServeCQL(frame, proto.SessionFrameWriter(c, session))
 	}
 }
@@ -0,0 +1,191 @@
+package fakesandra_test
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+
+	"github.com/gocql/gocql"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/fakesandra"
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/proto/v3"
+	"github.com/st3v/fakesandra/engine"
+	"github.com/st3v/fakesandra/middleware/fault"
+)
+
+var _ = Describe("Server", func() {
+	var (
+		e    *engine.Engine
+		ln   net.Listener
+		conn net.Conn
+	)
+
+	// startup connects to the server, sends a v3 STARTUP request and
+	// returns the response.
+	startup := func() proto.Frame {
+		var err error
+		conn, err = net.Dial("tcp", ln.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+
+		body := new(bytes.Buffer)
+		proto.WriteShort(body, 1)
+		proto.WriteString(body, "CQL_VERSION")
+		proto.WriteString(body, "3.0.0")
+
+		req := new(bytes.Buffer)
+		proto.WriteByte(req, uint8(v3.Version))
+		proto.WriteByte(req, 0)
+		proto.WriteShort(req, 1)
+		proto.WriteByte(req, uint8(proto.OpStartup))
+		proto.WriteInt(req, int32(body.Len()))
+		req.Write(body.Bytes())
+
+		_, err = conn.Write(req.Bytes())
+		Expect(err).NotTo(HaveOccurred())
+
+		var version uint8
+		Expect(proto.ReadByte(conn, &version)).To(Succeed())
+		Expect(version).To(Equal(uint8(0x83)))
+
+		resp, err := v3.ResponseFramer().Frame(conn)
+		Expect(err).NotTo(HaveOccurred())
+		return resp
+	}
+
+	BeforeEach(func() {
+		e = engine.New()
+		conn = nil
+
+		var err error
+		ln, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+
+		server := fakesandra.NewServer("", nil)
+		server.SetEngine(e)
+		go server.Serve(ln)
+	})
+
+	AfterEach(func() {
+		if conn != nil {
+			conn.Close()
+		}
+		ln.Close()
+	})
+
+	It("accepts the protocol versions of the engine's profile", func() {
+		Expect(startup().Opcode()).To(Equal(proto.OpReady))
+	})
+
+	It("rejects protocol versions the engine's profile does not offer", func() {
+		profile, err := engine.LookupProfile("2.1")
+		Expect(err).NotTo(HaveOccurred())
+		profile.ProtocolVersions = []proto.Version{1, 2}
+		e.SetProfile(profile)
+
+		resp := startup()
+		Expect(resp.Opcode()).To(Equal(proto.OpError))
+		Expect(resp.StreamID()).To(Equal(uint16(1)))
+
+		r := bytes.NewReader(resp.Body())
+		var code int32
+		Expect(proto.ReadInt(r, &code)).To(Succeed())
+		Expect(proto.ErrorCode(code)).To(Equal(proto.ErrProtocol))
+		Expect(proto.ReadString(r)).To(Equal("Invalid or unsupported protocol version: 3"))
+	})
+
+	// connect opens a gocql session to the server.
+	connect := func() *gocql.Session {
+		host, port, err := net.SplitHostPort(ln.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+
+		cluster := gocql.NewCluster(host)
+		cluster.ProtoVersion = 3
+		cluster.Port, err = strconv.Atoi(port)
+		Expect(err).NotTo(HaveOccurred())
+
+		session, err := cluster.CreateSession()
+		Expect(err).NotTo(HaveOccurred())
+		return session
+	}
+
+	It("serves prepared statements, bound values and batches to gocql", func() {
+		session := connect()
+		defer session.Close()
+
+		Expect(session.Query("CREATE KEYSPACE IF NOT EXISTS gocql WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}").Exec()).To(Succeed())
+		Expect(session.Query("CREATE TABLE IF NOT EXISTS gocql.t (k int PRIMARY KEY, v text)").Exec()).To(Succeed())
+		Expect(session.Query("INSERT INTO gocql.t (k, v) VALUES (1, 'one')").Exec()).To(Succeed())
+
+		var v string
+		Expect(session.Query("SELECT v FROM gocql.t WHERE k = 1").Scan(&v)).To(Succeed())
+		Expect(v).To(Equal("one"))
+
+		Expect(session.Query("CREATE TABLE IF NOT EXISTS gocql.c (k int PRIMARY KEY, n counter)").Exec()).To(Succeed())
+		Expect(session.Query("TRUNCATE gocql.c").Exec()).To(Succeed())
+
+		batch := session.NewBatch(gocql.CounterBatch)
+		batch.Query("UPDATE gocql.c SET n = n + 1 WHERE k = 1")
+		batch.Query("UPDATE gocql.c SET n = n + 2 WHERE k = 1")
+		Expect(session.ExecuteBatch(batch)).To(Succeed())
+
+		var n int64
+		Expect(session.Query("SELECT n FROM gocql.c WHERE k = 1").Scan(&n)).To(Succeed())
+		Expect(n).To(Equal(int64(3)))
+
+		Expect(session.Query("INSERT INTO gocql.t (k, v) VALUES (?, ?)", 2, "two").Exec()).To(Succeed())
+		Expect(session.Query("SELECT v FROM gocql.t WHERE k = ?", 2).Scan(&v)).To(Succeed())
+		Expect(v).To(Equal("two"))
+
+		batch = session.NewBatch(gocql.LoggedBatch)
+		batch.Query("INSERT INTO gocql.t (k, v) VALUES (?, ?)", 3, "three")
+		batch.Query("UPDATE gocql.t USING TTL ? SET v = ? WHERE k = ?", 60, "four", 4)
+		Expect(session.ExecuteBatch(batch)).To(Succeed())
+
+		keys := map[int]string{}
+		iter := session.Query("SELECT k, v FROM gocql.t WHERE k IN (?, ?) LIMIT ?", 3, 4, 10).Iter()
+		var k int
+		for iter.Scan(&k, &v) {
+			keys[k] = v
+		}
+		Expect(iter.Close()).To(Succeed())
+		Expect(keys).To(Equal(map[int]string{3: "three", 4: "four"}))
+	})
+
+	It("matches fault patterns against the prepared statements and batches of gocql", func() {
+		defer fakesandra.DefaultFaults.Reset()
+
+		session := connect()
+		defer session.Close()
+
+		Expect(session.Query("CREATE KEYSPACE IF NOT EXISTS gocql WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}").Exec()).To(Succeed())
+		Expect(session.Query("CREATE TABLE IF NOT EXISTS gocql.faulty (k int PRIMARY KEY, v text)").Exec()).To(Succeed())
+
+		_, err := fakesandra.DefaultFaults.Add(fault.Rule{
+			Pattern: "^INSERT INTO gocql.faulty",
+			Opcodes: []proto.Opcode{proto.OpExecute, proto.OpBatch},
+			Error:   &fault.Error{Code: proto.ErrWriteTimeout},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = session.Query("INSERT INTO gocql.faulty (k, v) VALUES (?, ?)", 1, "one").Exec()
+		Expect(err).To(BeAssignableToTypeOf(&gocql.RequestErrWriteTimeout{}))
+		Expect(err.(*gocql.RequestErrWriteTimeout).WriteType).To(Equal("SIMPLE"))
+
+		batch := session.NewBatch(gocql.LoggedBatch)
+		batch.Query("UPDATE gocql.faulty SET v = ? WHERE k = ?", "two", 2)
+		batch.Query("INSERT INTO gocql.faulty (k, v) VALUES (?, ?)", 3, "three")
+		err = session.ExecuteBatch(batch)
+		Expect(err).To(BeAssignableToTypeOf(&gocql.RequestErrWriteTimeout{}))
+		Expect(err.(*gocql.RequestErrWriteTimeout).WriteType).To(Equal("BATCH"))
+
+		Expect(session.Query("UPDATE gocql.faulty SET v = ? WHERE k = ?", "four", 4).Exec()).To(Succeed())
+
+		var v string
+		Expect(session.Query("SELECT v FROM gocql.faulty WHERE k = ?", 4).Scan(&v)).To(Succeed())
+		Expect(v).To(Equal("four"))
+		Expect(session.Query("SELECT v FROM gocql.faulty WHERE k = ?", 3).Scan(&v)).To(Equal(gocql.ErrNotFound))
+	})
+})
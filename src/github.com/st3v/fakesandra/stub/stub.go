@@ -0,0 +1,143 @@
+// Package stub answers queries with canned results. Stubs are matched
+// against the statement and, optionally, the consistency of each query.
+package stub
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/st3v/fakesandra/cql/proto"
+	"github.com/st3v/fakesandra/cql/proto/v3"
+	"github.com/st3v/fakesandra/cql/result"
+)
+
+// Stub describes a canned answer to matching queries.
+type Stub struct {
+	// ID is assigned by the Registry when the stub is added.
+	ID string
+
+	// Pattern is a regular expression matched against the
+	// whitespace-collapsed statement of each query.
+	Pattern string
+
+	// Consistency, if set, restricts the stub to queries with the given
+	// consistency.
+	Consistency *proto.Consistency
+
+	// Result is sent to the client. A nil Result sends a VOID result.
+	Result result.Result
+
+	// Error, if set, is sent to the client instead of Result.
+	Error *proto.Error
+}
+
+type stub struct {
+	Stub
+	pattern *regexp.Regexp
+}
+
+func (s *stub) matches(qry proto.Query) bool {
+	if s.Consistency != nil && *s.Consistency != qry.Consistency() {
+		return false
+	}
+	return s.pattern.MatchString(qry.Statement())
+}
+
+// Registry holds stubs and answers queries with the most recently added
+// stub that matches.
+type Registry struct {
+	mu     sync.RWMutex
+	stubs  []*stub
+	nextID int
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Add adds a copy of s and returns its ID.
+func (r *Registry) Add(s Stub) (string, error) {
+	pattern, err := regexp.Compile(s.Pattern)
+	if err != nil {
+		return "", fmt.Errorf("Invalid pattern %q: %s", s.Pattern, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	s.ID = strconv.Itoa(r.nextID)
+	r.stubs = append(r.stubs, &stub{s, pattern})
+
+	return s.ID, nil
+}
+
+// Remove removes the stub with the given ID. It returns false if there is
+// no such stub.
+func (r *Registry) Remove(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, s := range r.stubs {
+		if s.ID == id {
+			r.stubs = append(r.stubs[:i], r.stubs[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Stubs returns all stubs in the order they were added.
+func (r *Registry) Stubs() []Stub {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stubs := make([]Stub, len(r.stubs))
+	for i, s := range r.stubs {
+		stubs[i] = s.Stub
+	}
+	return stubs
+}
+
+// Reset removes all stubs.
+func (r *Registry) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stubs = nil
+}
+
+func (r *Registry) match(qry proto.Query) *stub {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i := len(r.stubs) - 1; i >= 0; i-- {
+		if r.stubs[i].matches(qry) {
+			return r.stubs[i]
+		}
+	}
+	return nil
+}
+
+// ServeQuery answers qry with the matching stub, if any.
+func (r *Registry) ServeQuery(qry proto.Query, req proto.Frame, rw proto.ResponseWriter) {
+	s := r.match(qry)
+	if s == nil {
+		return
+	}
+
+	if s.Error != nil {
+		rw.WriteFrame(v3.ErrResponse(req, s.Error))
+		return
+	}
+
+	res := s.Result
+	if rows, ok := res.(*result.Rows); ok && qry.SkipMetadata() {
+		skipped := *rows
+		skipped.NoMetadata = true
+		res = &skipped
+	}
+
+	rw.WriteFrame(v3.ResultResponse(req, res))
+}